@@ -9,6 +9,12 @@ import (
 // From LSB to MSB, the bits represent a1, b1, ..., h1, a2, ..., h8.
 type Bitboard uint64
 
+// LightSquares and DarkSquares hold the light and dark squares.
+const (
+	LightSquares Bitboard = 0x55AA55AA55AA55AA
+	DarkSquares  Bitboard = ^LightSquares
+)
+
 // Set sets the bit at s to 1.
 func (b *Bitboard) Set(s Square) {
 	*b |= s.Bitboard()
@@ -38,9 +44,9 @@ func (b *Bitboard) ClearIf(s Square, cond bool) {
 // Assign sets the bit at s to 1 if cond is true or 0 if cond is false.
 func (b *Bitboard) Assign(s Square, cond bool) {
 	if cond {
-		*b = 1
+		b.Set(s)
 	} else {
-		*b = 0
+		b.Clear(s)
 	}
 }
 
@@ -64,6 +70,31 @@ func (b *Bitboard) Intersects(other Bitboard) bool {
 	return *b&other != 0
 }
 
+// Count returns the number of bits set.
+func (b *Bitboard) Count() int {
+	return bits.OnesCount64(uint64(*b))
+}
+
+// First returns the square of the least significant bit set. If no bits are
+// set, the result is invalid.
+func (b *Bitboard) First() Square {
+	return Square(bits.TrailingZeros64(uint64(*b)))
+}
+
+// Last returns the square of the most significant bit set. If no bits are
+// set, the result is invalid.
+func (b *Bitboard) Last() Square {
+	return Square(63 - bits.LeadingZeros64(uint64(*b)))
+}
+
+// Pop clears the least significant bit set and returns its square. If no bits
+// are set, the result is invalid.
+func (b *Bitboard) Pop() Square {
+	s := b.First()
+	*b &= *b - 1
+	return s
+}
+
 // Mirror mirrors the represented board vertically.
 // For example, the bit at A1 is now at A8.
 func (b *Bitboard) Mirror() {
@@ -1,6 +1,8 @@
 // Package chess provides basic chess constants and functions.
 package chess
 
+import "strings"
+
 // Color represents either white or black.
 type Color uint8
 
@@ -116,6 +118,23 @@ func (f File) Right() File {
 	return f + 1
 }
 
+// Bitboard returns a bitboard with every square on the file set.
+func (f File) Bitboard() Bitboard {
+	return Bitboard(0x0101010101010101) << f
+}
+
+// Adjacent returns a bitboard with every square on the neighboring files set.
+func (f File) Adjacent() Bitboard {
+	var b Bitboard
+	if f != FileA {
+		b |= f.Left().Bitboard()
+	}
+	if f != FileH {
+		b |= f.Right().Bitboard()
+	}
+	return b
+}
+
 func (f File) String() string {
 	return []string{"FileA", "FileB", "FileC", "FileD", "FileE", "FileF", "FileG", "FileH"}[f]
 }
@@ -148,6 +167,20 @@ func (r Rank) Below() Rank {
 	return r - 1
 }
 
+// Bitboard returns a bitboard with every square on the rank set.
+func (r Rank) Bitboard() Bitboard {
+	return Bitboard(0xFF) << (8 * r)
+}
+
+// Relative returns the rank as seen from the given color's side of the board.
+// For example, Rank2.Relative(Black) is Rank7.
+func (r Rank) Relative(c Color) Rank {
+	if c == Black {
+		return Rank8 - r
+	}
+	return r
+}
+
 func (r Rank) String() string {
 	return []string{"Rank1", "Rank2", "Rank3", "Rank4", "Rank5", "Rank6", "Rank7", "Rank8"}[r]
 }
@@ -253,6 +286,26 @@ func (s Square) Bitboard() Bitboard {
 	return Bitboard(1 << s)
 }
 
+// Light returns true if the square is a light square.
+func (s Square) Light() bool {
+	return (s.File()+File(s.Rank()))%2 == 1
+}
+
+// Distance returns the number of king moves between two squares.
+func Distance(a, b Square) int {
+	df, dr := int(a.File())-int(b.File()), int(a.Rank())-int(b.Rank())
+	if df < 0 {
+		df = -df
+	}
+	if dr < 0 {
+		dr = -dr
+	}
+	if df > dr {
+		return df
+	}
+	return dr
+}
+
 func (s Square) String() string {
 	return []string{
 		"A1", "B1", "C1", "D1", "E1", "F1", "G1", "H1",
@@ -342,7 +395,20 @@ func (m Move) To() Square {
 // a promotion move, ok is false.
 func (m Move) Promotion() (p Piece, ok bool) {
 	p = Piece(m >> 12)
-	return p, p == 0
+	return p, p != 0
+}
+
+// String returns the move in UCI long algebraic notation, like "e2e4" or
+// "e7e8q". The zero Move is returned as "0000", the UCI null move.
+func (m Move) String() string {
+	if m == 0 {
+		return "0000"
+	}
+	s := strings.ToLower(m.From().String() + m.To().String())
+	if p, ok := m.Promotion(); ok {
+		s += string("pnbrqk"[p.Role()])
+	}
+	return s
 }
 
 // EnPassantRight represents an en passant right.
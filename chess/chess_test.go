@@ -10,3 +10,32 @@ func TestColor_Opposite(t *testing.T) {
 		t.Error("Black.Opposite() != White")
 	}
 }
+
+func TestSquareColors(t *testing.T) {
+	for s := A1; s <= H8; s++ {
+		b := LightSquares
+		if got := b.Get(s); got != s.Light() {
+			t.Errorf("%s: LightSquares has %t, Light returns %t", s, got, s.Light())
+		}
+	}
+	if A1.Light() || !H1.Light() || !A8.Light() || H8.Light() {
+		t.Error("corner colors are wrong")
+	}
+}
+
+func TestDistance(t *testing.T) {
+	cases := []struct {
+		a, b Square
+		want int
+	}{
+		{A1, A1, 0},
+		{A1, H8, 7},
+		{E4, F6, 2},
+		{B7, G6, 5},
+	}
+	for _, tc := range cases {
+		if got := Distance(tc.a, tc.b); got != tc.want {
+			t.Errorf("Distance(%s, %s): want %d, got %d", tc.a, tc.b, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package chess
+
+// castleRightsLost holds the castle rights lost when a piece moves from or to
+// a square.
+var castleRightsLost = [64]CastleRights{
+	A1: CastleRights(WhiteLongCastleRight),
+	E1: CastleRights(WhiteShortCastleRight | WhiteLongCastleRight),
+	H1: CastleRights(WhiteShortCastleRight),
+	A8: CastleRights(BlackLongCastleRight),
+	E8: CastleRights(BlackShortCastleRight | BlackLongCastleRight),
+	H8: CastleRights(BlackShortCastleRight),
+}
+
+// CastleRookSquares returns the rook's original and destination squares for a
+// castling move, given the king's destination square. If kingTo isn't a
+// castling destination, ok is false.
+func CastleRookSquares(kingTo Square) (from, to Square, ok bool) {
+	switch kingTo {
+	case G1:
+		return H1, F1, true
+	case C1:
+		return A1, D1, true
+	case G8:
+		return H8, F8, true
+	case C8:
+		return A8, D8, true
+	}
+	return 0, 0, false
+}
+
+// IsCastle returns true if the move is a castling move.
+func (p *Position) IsCastle(m Move) bool {
+	from, to := m.From(), m.To()
+	if !p.Board[NewPiece(p.SideToMove, King)].Get(from) {
+		return false
+	}
+	return from.File()-to.File() == 2 || to.File()-from.File() == 2
+}
+
+// IsEnPassant returns true if the move is an en passant capture.
+func (p *Position) IsEnPassant(m Move) bool {
+	return p.EnPassantRight != NoEnPassantRight &&
+		Square(p.EnPassantRight) == m.To() &&
+		p.Board[NewPiece(p.SideToMove, Pawn)].Get(m.From())
+}
+
+// IsCapture returns true if the move captures a piece, including en passant.
+func (p *Position) IsCapture(m Move) bool {
+	enemies := p.Pieces(p.SideToMove.Opposite())
+	return enemies.Get(m.To()) || p.IsEnPassant(m)
+}
+
+// Make makes a pseudo-legal move, updating all fields of the position.
+//
+// To unmake a move, keep a copy of the position from before the move.
+func (p *Position) Make(m Move) {
+	from, to := m.From(), m.To()
+	us, them := p.SideToMove, p.SideToMove.Opposite()
+	pc, _ := p.Get(from)
+
+	if p.HalfMoves < 255 {
+		p.HalfMoves++
+	}
+
+	if captured, ok := p.Get(to); ok {
+		p.Remove(captured, to)
+		p.HalfMoves = 0
+	}
+
+	p.Remove(pc, from)
+	if promotion, ok := m.Promotion(); ok {
+		p.Put(promotion, to)
+	} else {
+		p.Put(pc, to)
+	}
+
+	epRight := NoEnPassantRight
+	switch pc.Role() {
+	case Pawn:
+		p.HalfMoves = 0
+		if p.EnPassantRight != NoEnPassantRight && Square(p.EnPassantRight) == to {
+			if us == White {
+				p.Remove(BlackPawn, to-8)
+			} else {
+				p.Remove(WhitePawn, to+8)
+			}
+		}
+		// Only record an en passant right if it can be used, so that
+		// positions that only differ by an unusable right compare equal.
+		if to == from+16 || from == to+16 {
+			mid := (from + to) / 2
+			if PawnAttacks(us, mid)&p.Board[NewPiece(them, Pawn)] != 0 {
+				epRight = EnPassantRight(mid)
+			}
+		}
+	case King:
+		if rookFrom, rookTo, ok := CastleRookSquares(to); ok && (from == E1 || from == E8) {
+			rook := NewPiece(us, Rook)
+			p.Remove(rook, rookFrom)
+			p.Put(rook, rookTo)
+		}
+	}
+	p.EnPassantRight = epRight
+
+	p.CastleRights &^= castleRightsLost[from] | castleRightsLost[to]
+
+	if us == Black {
+		p.FullMoves++
+	}
+	p.SideToMove = them
+}
+
+// MakeNull passes the turn to the other side without moving, as searches do
+// to test whether a position is good enough that the side to move could
+// skip its move. The side to move must not be in check.
+func (p *Position) MakeNull() {
+	if p.HalfMoves < 255 {
+		p.HalfMoves++
+	}
+	p.EnPassantRight = NoEnPassantRight
+	if p.SideToMove == Black {
+		p.FullMoves++
+	}
+	p.SideToMove = p.SideToMove.Opposite()
+}
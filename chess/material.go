@@ -0,0 +1,113 @@
+package chess
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaterialKey is a material signature: it identifies how many pieces of each
+// kind are on the board, regardless of where they are. Positions with the
+// same material have the same key.
+//
+// Each piece's count is stored in four bits, in piece order.
+type MaterialKey uint64
+
+// NewMaterialKey returns the key for the given piece counts, indexed by
+// piece. Counts must be between 0 and 15.
+func NewMaterialKey(counts [12]int) MaterialKey {
+	var k MaterialKey
+	for pc, n := range counts {
+		k |= MaterialKey(n) << (4 * pc)
+	}
+	return k
+}
+
+// ParseMaterialKey parses a material signature in the form "KRPvKR": white's
+// pieces, "v", then black's pieces, each side starting with its king. The "v"
+// may be left out when the second king is the last K, as in "KBNK".
+func ParseMaterialKey(s string) (MaterialKey, error) {
+	white, black, ok := strings.Cut(s, "v")
+	if !ok {
+		i := strings.LastIndex(s, "K")
+		if i <= 0 {
+			return 0, fmt.Errorf("chess: invalid material signature: %s", s)
+		}
+		white, black = s[:i], s[i:]
+	}
+
+	var counts [12]int
+	for c, side := range []string{white, black} {
+		if !strings.HasPrefix(side, "K") || strings.Count(side, "K") != 1 {
+			return 0, fmt.Errorf("chess: invalid material signature: %s", s)
+		}
+		for _, r := range side {
+			role := strings.IndexRune("PNBRQK", r)
+			if role < 0 {
+				return 0, fmt.Errorf("chess: invalid material signature: %s", s)
+			}
+			pc := NewPiece(Color(c), Role(role))
+			if counts[pc]++; counts[pc] > 15 {
+				return 0, fmt.Errorf("chess: invalid material signature: %s", s)
+			}
+		}
+	}
+	return NewMaterialKey(counts), nil
+}
+
+// MaterialKey returns the material signature of the position.
+func (p *Position) MaterialKey() MaterialKey {
+	var counts [12]int
+	for pc := WhitePawn; pc <= BlackKing; pc++ {
+		counts[pc] = p.Board[pc].Count()
+	}
+	return NewMaterialKey(counts)
+}
+
+// IsInsufficientMaterial reports whether neither side can checkmate by any
+// sequence of legal moves, for lack of material: only kings are left, or
+// kings and a single knight or bishop, or kings and bishops that are all on
+// squares of one color. Such positions are dead, and so drawn.
+func (p *Position) IsInsufficientMaterial() bool {
+	if p.Board[WhitePawn]|p.Board[BlackPawn]|p.Board[WhiteRook]|p.Board[BlackRook]|p.Board[WhiteQueen]|p.Board[BlackQueen] != 0 {
+		return false
+	}
+	knights := p.Board[WhiteKnight] | p.Board[BlackKnight]
+	bishops := p.Board[WhiteBishop] | p.Board[BlackBishop]
+	switch {
+	case knights == 0:
+		return bishops&LightSquares == 0 || bishops&DarkSquares == 0
+	case bishops == 0:
+		return knights.Count() == 1
+	default:
+		return false
+	}
+}
+
+// Count returns the number of pieces of a kind.
+func (k MaterialKey) Count(pc Piece) int {
+	return int(k>>(4*pc)) & 0xf
+}
+
+// Flip returns the key with the colors swapped.
+func (k MaterialKey) Flip() MaterialKey {
+	const white = 1<<24 - 1
+	return (k&white)<<24 | k>>24
+}
+
+// String returns the signature in the form "KRPvKR", with each side's pieces
+// from most to least valuable.
+func (k MaterialKey) String() string {
+	var b strings.Builder
+	for c := White; c <= Black; c++ {
+		if c == Black {
+			b.WriteByte('v')
+		}
+		for r := King; ; r-- {
+			b.WriteString(strings.Repeat("PNBRQK"[r:r+1], k.Count(NewPiece(c, r))))
+			if r == Pawn {
+				break
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package chess
+
+import "testing"
+
+func TestMaterialKey(t *testing.T) {
+	p := NewPosition()
+	start := p.MaterialKey()
+	if got, want := start.String(), "KQRRBBNNPPPPPPPPvKQRRBBNNPPPPPPPP"; got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+	if start.Flip() != start {
+		t.Error("flipping the starting material changed it")
+	}
+
+	// Quiet moves keep the material; captures change it.
+	p.Make(NewMove(E2, E4))
+	p.Make(NewMove(D7, D5))
+	if p.MaterialKey() != start {
+		t.Error("quiet moves changed the material key")
+	}
+	p.Make(NewMove(E4, D5))
+	if p.MaterialKey() == start {
+		t.Error("capture didn't change the material key")
+	}
+	if got := p.MaterialKey().Count(BlackPawn); got != 7 {
+		t.Errorf("want 7 black pawns, got %d", got)
+	}
+
+	cases := []struct {
+		in, want string
+	}{
+		{"KBNK", "KBNvK"},
+		{"KBNvK", "KBNvK"},
+		{"KPKQ", "KPvKQ"},
+		{"KRPPvKR", "KRPPvKR"},
+	}
+	for _, tc := range cases {
+		k, err := ParseMaterialKey(tc.in)
+		if err != nil {
+			t.Errorf("%s: %v", tc.in, err)
+			continue
+		}
+		if got := k.String(); got != tc.want {
+			t.Errorf("%s: want %s, got %s", tc.in, tc.want, got)
+		}
+	}
+
+	k, _ := ParseMaterialKey("KQvKR")
+	if want, _ := ParseMaterialKey("KRvKQ"); k.Flip() != want {
+		t.Errorf("KQvKR flipped: want KRvKQ, got %s", k.Flip())
+	}
+
+	for _, s := range []string{"", "K", "KBN", "BKvK", "KKvK", "KXvK", "KvKvK"} {
+		if _, err := ParseMaterialKey(s); err == nil {
+			t.Errorf("%q: want error", s)
+		}
+	}
+}
+
+func TestPosition_IsInsufficientMaterial(t *testing.T) {
+	cases := []struct {
+		name   string
+		pieces map[Square]Piece
+		want   bool
+	}{
+		{"KvK", map[Square]Piece{}, true},
+		{"KNvK", map[Square]Piece{B1: WhiteKnight}, true},
+		{"KvKB", map[Square]Piece{C8: BlackBishop}, true},
+		{"KBvKB, same colors", map[Square]Piece{C1: WhiteBishop, F8: BlackBishop}, true},
+		{"KBBvK, same colors", map[Square]Piece{C1: WhiteBishop, E3: WhiteBishop}, true},
+		{"KBvKB, opposite colors", map[Square]Piece{C1: WhiteBishop, C8: BlackBishop}, false},
+		{"KNvKN", map[Square]Piece{B1: WhiteKnight, B8: BlackKnight}, false},
+		{"KNNvK", map[Square]Piece{B1: WhiteKnight, G1: WhiteKnight}, false},
+		{"KBvKN", map[Square]Piece{C1: WhiteBishop, B8: BlackKnight}, false},
+		{"KPvK", map[Square]Piece{A2: WhitePawn}, false},
+		{"KvKR", map[Square]Piece{A8: BlackRook}, false},
+	}
+	for _, tc := range cases {
+		var p Position
+		p.Put(WhiteKing, E1)
+		p.Put(BlackKing, E8)
+		for s, pc := range tc.pieces {
+			p.Put(pc, s)
+		}
+		if got := p.IsInsufficientMaterial(); got != tc.want {
+			t.Errorf("%s: want %t, got %t", tc.name, tc.want, got)
+		}
+	}
+	if p := NewPosition(); p.IsInsufficientMaterial() {
+		t.Error("starting position: want sufficient material")
+	}
+}
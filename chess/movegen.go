@@ -0,0 +1,287 @@
+package chess
+
+// IsAttacked returns true if any piece of color c attacks square s.
+func (p *Position) IsAttacked(s Square, c Color) bool {
+	occupied := p.AllPieces()
+	switch {
+	case PawnAttacks(c.Opposite(), s)&p.Board[NewPiece(c, Pawn)] != 0:
+		return true
+	case Targets(WhiteKnight, s)&p.Board[NewPiece(c, Knight)] != 0:
+		return true
+	case Targets(WhiteKing, s)&p.Board[NewPiece(c, King)] != 0:
+		return true
+	case BishopAttacks(s, occupied)&(p.Board[NewPiece(c, Bishop)]|p.Board[NewPiece(c, Queen)]) != 0:
+		return true
+	case RookAttacks(s, occupied)&(p.Board[NewPiece(c, Rook)]|p.Board[NewPiece(c, Queen)]) != 0:
+		return true
+	}
+	return false
+}
+
+// Attackers returns the pieces of both colors that attack square s. Sliding
+// pieces attack through the squares empty in occupied, so pieces can be
+// removed from occupied to find the attackers behind them.
+func (p *Position) Attackers(s Square, occupied Bitboard) Bitboard {
+	bishops := p.Board[WhiteBishop] | p.Board[BlackBishop] | p.Board[WhiteQueen] | p.Board[BlackQueen]
+	rooks := p.Board[WhiteRook] | p.Board[BlackRook] | p.Board[WhiteQueen] | p.Board[BlackQueen]
+	return PawnAttacks(Black, s)&p.Board[WhitePawn] |
+		PawnAttacks(White, s)&p.Board[BlackPawn] |
+		Targets(WhiteKnight, s)&(p.Board[WhiteKnight]|p.Board[BlackKnight]) |
+		Targets(WhiteKing, s)&(p.Board[WhiteKing]|p.Board[BlackKing]) |
+		BishopAttacks(s, occupied)&bishops |
+		RookAttacks(s, occupied)&rooks
+}
+
+// InCheck returns true if the side to move is in check.
+func (p *Position) InCheck() bool {
+	return p.IsAttacked(p.King(p.SideToMove), p.SideToMove.Opposite())
+}
+
+// PseudoLegalMoves returns all pseudo-legal moves in the position. A
+// pseudo-legal move follows the movement rules for its piece, but may leave
+// the moving side's king in check.
+func (p *Position) PseudoLegalMoves() []Move {
+	return p.appendMoves(make([]Move, 0, 64), true, true)
+}
+
+// NoisyMoves returns the pseudo-legal captures and queen promotions in the
+// position. Quiescence searches use it to search only moves that change the
+// material balance.
+func (p *Position) NoisyMoves() []Move {
+	return p.appendMoves(make([]Move, 0, 16), true, false)
+}
+
+// QuietMoves returns the pseudo-legal moves in the position that aren't
+// noisy: moves to empty squares, underpromotions, and castling.
+func (p *Position) QuietMoves() []Move {
+	return p.appendMoves(make([]Move, 0, 64), false, true)
+}
+
+// LegalMoves returns all legal moves in the position.
+func (p *Position) LegalMoves() []Move {
+	moves := p.PseudoLegalMoves()
+	legal := moves[:0]
+	for _, m := range moves {
+		if p.IsLegal(m) {
+			legal = append(legal, m)
+		}
+	}
+	return legal
+}
+
+// IsLegal returns true if a pseudo-legal move doesn't leave the moving side's
+// king in check.
+func (p *Position) IsLegal(m Move) bool {
+	q := *p
+	q.Make(m)
+	return !q.IsAttacked(q.King(p.SideToMove), q.SideToMove)
+}
+
+// IsPseudoLegal returns true if m is a pseudo-legal move in the position. It
+// accepts any Move, so moves remembered from other positions can be checked
+// before they're made.
+func (p *Position) IsPseudoLegal(m Move) bool {
+	from, to := m.From(), m.To()
+	us := p.SideToMove
+	friends, enemies := p.Pieces(us), p.Pieces(us.Opposite())
+	pc, ok := p.Get(from)
+	if !ok || pc.Color() != us || friends.Get(to) {
+		return false
+	}
+	occupied := friends | enemies
+	promotion, isPromotion := m.Promotion()
+
+	if pc.Role() != Pawn {
+		if isPromotion || m>>12 != 0 {
+			return false
+		}
+		if p.IsCastle(m) {
+			for _, c := range p.appendCastleMoves(nil, occupied) {
+				if c == m {
+					return true
+				}
+			}
+			return false
+		}
+		var attacks Bitboard
+		switch pc.Role() {
+		case Bishop:
+			attacks = BishopAttacks(from, occupied)
+		case Rook:
+			attacks = RookAttacks(from, occupied)
+		case Queen:
+			attacks = QueenAttacks(from, occupied)
+		default:
+			attacks = Targets(pc, from)
+		}
+		return attacks.Get(to)
+	}
+
+	var (
+		forward   = 8
+		startRank = Rank2
+		lastRank  = Rank8
+	)
+	if us == Black {
+		forward, startRank, lastRank = -8, Rank7, Rank1
+	}
+	if to.Rank() == lastRank {
+		r := promotion.Role()
+		if !isPromotion || promotion.Color() != us || r == Pawn || r == King {
+			return false
+		}
+	} else if m>>12 != 0 {
+		return false
+	}
+	switch {
+	case PawnAttacks(us, from)&to.Bitboard() != 0:
+		return enemies.Get(to) || p.IsEnPassant(m)
+	case int(to) == int(from)+forward:
+		return !occupied.Get(to)
+	case int(to) == int(from)+2*forward:
+		return from.Rank() == startRank && !occupied.Get(Square(int(from)+forward)) && !occupied.Get(to)
+	}
+	return false
+}
+
+// appendMoves appends pseudo-legal moves to dst and returns the extended
+// slice.
+//
+// Noisy moves are captures and queen promotions. Quiet moves are everything
+// else, including underpromotions.
+func (p *Position) appendMoves(dst []Move, noisy, quiet bool) []Move {
+	us, them := p.SideToMove, p.SideToMove.Opposite()
+	friends, enemies := p.Pieces(us), p.Pieces(them)
+	occupied := friends | enemies
+
+	var targets Bitboard // Destination squares for non-pawn moves.
+	if noisy {
+		targets |= enemies
+	}
+	if quiet {
+		targets |= ^occupied
+	}
+
+	// Pawns.
+	var (
+		forward   = 8
+		startRank = Rank2
+		lastRank  = Rank8
+	)
+	if us == Black {
+		forward, startRank, lastRank = -8, Rank7, Rank1
+	}
+	captureTargets := enemies
+	if p.EnPassantRight != NoEnPassantRight {
+		captureTargets.Set(Square(p.EnPassantRight))
+	}
+	pawns := p.Board[NewPiece(us, Pawn)]
+	for pawns != 0 {
+		from := pawns.Pop()
+
+		attacks := PawnAttacks(us, from) & captureTargets
+		for attacks != 0 {
+			to := attacks.Pop()
+			dst = appendPawnMoves(dst, us, from, to, to.Rank() == lastRank, noisy, quiet, true)
+		}
+
+		to := Square(int(from) + forward)
+		if occupied.Get(to) {
+			continue
+		}
+		dst = appendPawnMoves(dst, us, from, to, to.Rank() == lastRank, noisy, quiet, false)
+		if from.Rank() == startRank && quiet {
+			to = Square(int(to) + forward)
+			if !occupied.Get(to) {
+				dst = append(dst, NewMove(from, to))
+			}
+		}
+	}
+
+	// Knights, bishops, rooks, queens, and kings.
+	for r := Knight; r <= King; r++ {
+		pieces := p.Board[NewPiece(us, r)]
+		for pieces != 0 {
+			from := pieces.Pop()
+			var attacks Bitboard
+			switch r {
+			case Bishop:
+				attacks = BishopAttacks(from, occupied)
+			case Rook:
+				attacks = RookAttacks(from, occupied)
+			case Queen:
+				attacks = QueenAttacks(from, occupied)
+			default:
+				attacks = Targets(NewPiece(us, r), from)
+			}
+			attacks &= targets
+			for attacks != 0 {
+				dst = append(dst, NewMove(from, attacks.Pop()))
+			}
+		}
+	}
+
+	// Castling.
+	if quiet {
+		dst = p.appendCastleMoves(dst, occupied)
+	}
+
+	return dst
+}
+
+// appendPawnMoves appends a pawn move from one square to another, expanding
+// promotions into one move per promotion piece.
+func appendPawnMoves(dst []Move, us Color, from, to Square, promotion, noisy, quiet, capture bool) []Move {
+	if !promotion {
+		if (capture && noisy) || (!capture && quiet) {
+			dst = append(dst, NewMove(from, to))
+		}
+		return dst
+	}
+	if noisy {
+		dst = append(dst, NewPromotionMove(from, to, NewPiece(us, Queen)))
+	}
+	if quiet {
+		dst = append(dst,
+			NewPromotionMove(from, to, NewPiece(us, Rook)),
+			NewPromotionMove(from, to, NewPiece(us, Bishop)),
+			NewPromotionMove(from, to, NewPiece(us, Knight)),
+		)
+	}
+	return dst
+}
+
+// appendCastleMoves appends castling moves that are pseudo-legal. The king
+// may not castle out of or through check; castling into check is left for
+// IsLegal to detect.
+func (p *Position) appendCastleMoves(dst []Move, occupied Bitboard) []Move {
+	us, them := p.SideToMove, p.SideToMove.Opposite()
+
+	short, long := WhiteShortCastleRight, WhiteLongCastleRight
+	home := E1
+	if us == Black {
+		short, long = BlackShortCastleRight, BlackLongCastleRight
+		home = E8
+	}
+	if !p.CastleRights.Get(short) && !p.CastleRights.Get(long) {
+		return dst
+	}
+	if p.IsAttacked(home, them) {
+		return dst
+	}
+
+	var (
+		f1 = home + 1
+		g1 = home + 2
+		d1 = home - 1
+		c1 = home - 2
+		b1 = home - 3
+	)
+	if p.CastleRights.Get(short) && !occupied.Get(f1) && !occupied.Get(g1) && !p.IsAttacked(f1, them) {
+		dst = append(dst, NewMove(home, g1))
+	}
+	if p.CastleRights.Get(long) && !occupied.Get(d1) && !occupied.Get(c1) && !occupied.Get(b1) && !p.IsAttacked(d1, them) {
+		dst = append(dst, NewMove(home, c1))
+	}
+	return dst
+}
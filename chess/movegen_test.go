@@ -0,0 +1,177 @@
+package chess_test
+
+import (
+	"testing"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/fen"
+)
+
+func perft(p *chess.Position, depth int) int {
+	if depth == 0 {
+		return 1
+	}
+	moves := p.LegalMoves()
+	if depth == 1 {
+		return len(moves)
+	}
+	var n int
+	for _, m := range moves {
+		q := *p
+		q.Make(m)
+		n += perft(&q, depth-1)
+	}
+	return n
+}
+
+func TestPerft(t *testing.T) {
+	// Positions and node counts from https://www.chessprogramming.org/Perft_Results.
+	cases := []struct {
+		fen   string
+		depth int
+		want  int
+	}{
+		{fen.Starting, 4, 197281},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", 3, 97862},
+		{"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", 5, 674624},
+		{"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", 4, 422333},
+		{"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", 3, 62379},
+		{"r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10", 3, 89890},
+	}
+	for _, tc := range cases {
+		p, err := fen.From(tc.fen)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.fen, err)
+		}
+		if got := perft(&p, tc.depth); got != tc.want {
+			t.Errorf("%s: depth %d: want %d, got %d", tc.fen, tc.depth, tc.want, got)
+		}
+	}
+}
+
+// noisyTestFENs have captures, en passant captures, and promotions.
+var noisyTestFENs = []string{
+	"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+	"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+	"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 b kq - 0 1",
+	"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+}
+
+func TestPosition_NoisyMoves(t *testing.T) {
+	for _, s := range noisyTestFENs {
+		p, err := fen.From(s)
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		want := make(map[chess.Move]bool)
+		for _, m := range p.PseudoLegalMoves() {
+			promotion, ok := m.Promotion()
+			if p.IsCapture(m) && !ok || ok && promotion.Role() == chess.Queen {
+				want[m] = true
+			}
+		}
+		got := p.NoisyMoves()
+		for _, m := range got {
+			if !want[m] {
+				t.Errorf("%s: unexpected noisy move %v", s, m)
+			}
+			delete(want, m)
+		}
+		for m := range want {
+			t.Errorf("%s: missing noisy move %v", s, m)
+		}
+	}
+}
+
+func TestPosition_QuietMoves(t *testing.T) {
+	for _, s := range noisyTestFENs {
+		p, err := fen.From(s)
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		want := p.PseudoLegalMoves()
+		got := append(p.NoisyMoves(), p.QuietMoves()...)
+		if len(got) != len(want) {
+			t.Errorf("%s: noisy and quiet moves: want %d, got %d", s, len(want), len(got))
+		}
+		seen := make(map[chess.Move]bool)
+		for _, m := range got {
+			if seen[m] {
+				t.Errorf("%s: %v generated twice", s, m)
+			}
+			seen[m] = true
+		}
+		for _, m := range want {
+			if !seen[m] {
+				t.Errorf("%s: missing move %v", s, m)
+			}
+		}
+	}
+}
+
+func TestPosition_IsPseudoLegal(t *testing.T) {
+	fens := append([]string{
+		fen.Starting,
+		"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1",
+		"r3k2r/8/8/8/8/8/8/R3K2R w - - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+	}, noisyTestFENs...)
+	for _, s := range fens {
+		p, err := fen.From(s)
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		want := make(map[chess.Move]bool)
+		for _, m := range p.PseudoLegalMoves() {
+			want[m] = true
+		}
+		// Try every pair of squares, with every promotion.
+		for from := chess.A1; from <= chess.H8; from++ {
+			for to := chess.A1; to <= chess.H8; to++ {
+				moves := []chess.Move{chess.NewMove(from, to)}
+				for pc := chess.WhitePawn; pc <= chess.BlackKing; pc++ {
+					moves = append(moves, chess.NewPromotionMove(from, to, pc))
+				}
+				for _, m := range moves {
+					if got := p.IsPseudoLegal(m); got != want[m] {
+						t.Errorf("%s: %v: want %t, got %t", s, m, want[m], got)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPosition_Attackers(t *testing.T) {
+	for _, s := range noisyTestFENs {
+		p, err := fen.From(s)
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		for sq := chess.A1; sq <= chess.H8; sq++ {
+			attackers := p.Attackers(sq, p.AllPieces())
+			for _, c := range []chess.Color{chess.White, chess.Black} {
+				if got, want := attackers&p.Pieces(c) != 0, p.IsAttacked(sq, c); got != want {
+					t.Errorf("%s: %v attacked by %v: want %t, got %t", s, sq, c, want, got)
+				}
+			}
+		}
+	}
+}
+
+func TestMove_String(t *testing.T) {
+	cases := []struct {
+		m    chess.Move
+		want string
+	}{
+		{chess.NewMove(chess.E2, chess.E4), "e2e4"},
+		{chess.NewPromotionMove(chess.A7, chess.A8, chess.WhiteKnight), "a7a8n"},
+		{chess.NewPromotionMove(chess.H2, chess.G1, chess.BlackQueen), "h2g1q"},
+		{0, "0000"},
+	}
+	for _, tc := range cases {
+		if got := tc.m.String(); got != tc.want {
+			t.Errorf("want %s, got %s", tc.want, got)
+		}
+	}
+}
@@ -3,7 +3,7 @@ package chess
 // Position represents a game position.
 // Three-fold repetition is not tracked here.
 type Position struct {
-	Board          []Bitboard // Board describes which pieces are on the board and where.
+	Board          [12]Bitboard // Board describes which pieces are on the board and where.
 	CastleRights   CastleRights
 	EnPassantRight EnPassantRight
 	SideToMove     Color
@@ -14,7 +14,6 @@ type Position struct {
 // NewPosition returns a new position, pre-populated with all starting pieces.
 func NewPosition() Position {
 	p := Position{
-		Board:          make([]Bitboard, 12),
 		CastleRights:   AllCastleRights,
 		EnPassantRight: NoEnPassantRight,
 		SideToMove:     White,
@@ -64,7 +63,6 @@ func (p *Position) Get(s Square) (pc Piece, ok bool) {
 
 // Reset resets the position to the starting position.
 func (p *Position) Reset() {
-	// TODO: Optimize this to eliminate all allocations.
 	*p = NewPosition()
 }
 
@@ -95,47 +93,55 @@ func (p *Position) BlackPieces() Bitboard {
 	return b
 }
 
-/*
-// LegalMoves returns all legal moves in the position.
-func (p *Position) LegalMoves() []Move {
-	var (
-		result      []Move
-		friends     []Bitboard // Bitboards for all friendly pieces.
-		enemies     []Bitboard // Bitboards for all enemy pieces.
-		shortCastle bool       // Whether or not the side to move can castle short.
-		longCastle  bool       // Whether or not the side to move can castle long.
-	)
+// Remove removes a piece from the board. No other fields are updated.
+func (p *Position) Remove(pc Piece, s Square) {
+	p.Board[pc].Clear(s)
+}
 
-	if p.SideToMove == White {
-		friends = p.Board[WhitePawn : WhiteKing+1]
-		enemies = p.Board[BlackPawn : BlackKing+1]
-		shortCastle = p.CastleRights.Get(WhiteShortCastleRight)
-		longCastle = p.CastleRights.Get(WhiteLongCastleRight)
-	} else {
-		friends = p.Board[BlackPawn : BlackKing+1]
-		enemies = p.Board[WhitePawn : WhiteKing+1]
-		shortCastle = p.CastleRights.Get(BlackShortCastleRight)
-		longCastle = p.CastleRights.Get(BlackLongCastleRight)
+// Pieces returns a bitboard of all piece locations for the given color.
+func (p *Position) Pieces(c Color) Bitboard {
+	if c == White {
+		return p.WhitePieces()
 	}
+	return p.BlackPieces()
+}
 
-	var friendOccupancy Bitboard // Bitboard of all friendly pieces' locations.
-	for _, bb := range friends {
-		friendOccupancy |= bb
-	}
+// King returns the square of the given color's king. If there's no king of
+// that color on the board, the result is invalid.
+func (p *Position) King(c Color) Square {
+	return p.Board[NewPiece(c, King)].First()
+}
 
-	for s := A1; s <= H8; s++ {
-		// Skip if there's no piece on the square.
-		if !friendOccupancy.Get(s) {
-			continue
-		}
+// FlipColors mirrors the position vertically and swaps the colors of the
+// pieces, the castling rights, the side to move, and the en passant right.
+// The result is the same position seen from the other side of the board.
+func (p *Position) FlipColors() {
+	var board [12]Bitboard
+	for pc, b := range p.Board {
+		b.Mirror()
+		board[NewPiece(Piece(pc).Color().Opposite(), Piece(pc).Role())] = b
+	}
+	p.Board = board
+	p.CastleRights = p.CastleRights>>2 | p.CastleRights&3<<2
+	if p.EnPassantRight != NoEnPassantRight {
+		p.EnPassantRight ^= 56
+	}
+	p.SideToMove = p.SideToMove.Opposite()
+}
 
-		// If it's a king...
-		if friends[King].Get(s) {
-			// ... add legal non-castling moves.
-			continue
+// MirrorFiles mirrors the position horizontally, so the A file becomes the H
+// file. Castling rights are removed, since the kings and rooks no longer
+// stand where castling expects them.
+func (p *Position) MirrorFiles() {
+	var board [12]Bitboard
+	for pc, b := range p.Board {
+		for b != 0 {
+			board[pc].Set(b.Pop() ^ 7)
 		}
 	}
-
-	return result
+	p.Board = board
+	p.CastleRights = NoCastleRights
+	if p.EnPassantRight != NoEnPassantRight {
+		p.EnPassantRight ^= 7
+	}
 }
-*/
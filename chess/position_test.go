@@ -0,0 +1,93 @@
+package chess_test
+
+import (
+	"testing"
+
+	"github.com/clfs/good/fen"
+)
+
+func TestPosition_FlipColors(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{fen.Starting, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR b KQkq - 0 1"},
+		{
+			"rnbqkbnr/ppp1pppp/8/8/3pP3/8/PPPP1PPP/RNBQKBNR b Kq e3 0 3",
+			"rnbqkbnr/pppp1ppp/8/3Pp3/8/8/PPP1PPPP/RNBQKBNR w Qk e6 0 3",
+		},
+		{"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", "8/4p1p1/8/1r3P1K/kp5R/3P4/2P5/8 b - - 0 1"},
+	}
+	for _, tc := range cases {
+		p, err := fen.From(tc.in)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.in, err)
+		}
+		p.FlipColors()
+		if got := fen.To(p); got != tc.want {
+			t.Errorf("%s: want %s, got %s", tc.in, tc.want, got)
+		}
+		p.FlipColors()
+		if got := fen.To(p); got != tc.in {
+			t.Errorf("%s: flipping twice gave %s", tc.in, got)
+		}
+	}
+}
+
+func TestPosition_FlipColors_Perft(t *testing.T) {
+	for _, s := range []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+	} {
+		p, err := fen.From(s)
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		q := p
+		q.FlipColors()
+		if want, got := perft(&p, 3), perft(&q, 3); got != want {
+			t.Errorf("%s: want %d nodes after flipping, got %d", s, want, got)
+		}
+	}
+}
+
+func TestPosition_MirrorFiles(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{fen.Starting, "rnbkqbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBKQBNR w - - 0 1"},
+		{
+			"rnbqkbnr/ppp1pppp/8/8/3pP3/8/PPPP1PPP/RNBQKBNR b Kq e3 0 3",
+			"rnbkqbnr/pppp1ppp/8/8/3Pp3/8/PPP1PPPP/RNBKQBNR b - d3 0 3",
+		},
+	}
+	for _, tc := range cases {
+		p, err := fen.From(tc.in)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.in, err)
+		}
+		p.MirrorFiles()
+		if got := fen.To(p); got != tc.want {
+			t.Errorf("%s: want %s, got %s", tc.in, tc.want, got)
+		}
+	}
+}
+
+func TestPosition_MakeNull(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{fen.Starting, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR b KQkq - 1 1"},
+		{"rnbqkbnr/ppp1pppp/8/8/3pP3/8/PPPP1PPP/RNBQKBNR b Kq e3 0 3", "rnbqkbnr/ppp1pppp/8/8/3pP3/8/PPPP1PPP/RNBQKBNR w Kq - 1 4"},
+	}
+	for _, tc := range cases {
+		p, err := fen.From(tc.in)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.in, err)
+		}
+		p.MakeNull()
+		if got := fen.To(p); got != tc.want {
+			t.Errorf("%s: want %s, got %s", tc.in, tc.want, got)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package chess
 
+import "math/bits"
+
 // targetTable is a lookup table for squares a piece can target. For example,
 // targetTable[WhitePawn][A2] returns a bitboard with A3, B3, and A4 set.
 var targetTable [][]Bitboard
@@ -10,6 +12,16 @@ func Targets(p Piece, s Square) Bitboard {
 	return targetTable[p][s]
 }
 
+// pawnAttackTable is a lookup table for squares a pawn attacks. For example,
+// pawnAttackTable[White][A2] returns a bitboard with B3 set.
+var pawnAttackTable [2][64]Bitboard
+
+// PawnAttacks returns the squares a pawn of the given color attacks from a
+// given square. Unlike Targets, pushes are not included.
+func PawnAttacks(c Color, s Square) Bitboard {
+	return pawnAttackTable[c][s]
+}
+
 // magicTable is a lookup table for squares that sliding pieces (bishops, rooks,
 // and queens) can target, while also respecting occupied squares.
 var magicTable []Bitboard
@@ -49,15 +61,15 @@ func QueenAttacks(s Square, occupied Bitboard) Bitboard {
 	return BishopAttacks(s, occupied) | RookAttacks(s, occupied)
 }
 
-func init() {
-	// Movement constants for target square generation.
-	var (
-		knightDeltas = [][]int{{-2, -1}, {-2, 1}, {-1, -2}, {-1, 2}, {1, -2}, {1, 2}, {2, -1}, {2, 1}}
-		bishopDeltas = [][]int{{-1, -1}, {-1, 1}, {1, -1}, {1, 1}}
-		rookDeltas   = [][]int{{-1, 0}, {0, -1}, {0, 1}, {1, 0}}
-		kingDeltas   = [][]int{{-1, -1}, {-1, 0}, {-1, 1}, {0, -1}, {0, 1}, {1, -1}, {1, 0}, {1, 1}}
-	)
+// Movement constants for target square generation.
+var (
+	knightDeltas = [][]int{{-2, -1}, {-2, 1}, {-1, -2}, {-1, 2}, {1, -2}, {1, 2}, {2, -1}, {2, 1}}
+	bishopDeltas = [][]int{{-1, -1}, {-1, 1}, {1, -1}, {1, 1}}
+	rookDeltas   = [][]int{{-1, 0}, {0, -1}, {0, 1}, {1, 0}}
+	kingDeltas   = [][]int{{-1, -1}, {-1, 0}, {-1, 1}, {0, -1}, {0, 1}, {1, -1}, {1, 0}, {1, 1}}
+)
 
+func init() {
 	targetTable = make([][]Bitboard, 12)
 	bitboards := make([]Bitboard, 12*64) // Backing slice for targetTable
 	for i := range targetTable {
@@ -82,6 +94,17 @@ func init() {
 			}
 		}
 
+		// White pawn attacks. Unlike targets, these include pawns on the first
+		// rank, so that the table can be used in reverse to find attackers.
+		if r != Rank8 {
+			if f != FileA {
+				pawnAttackTable[White][s].Set(NewSquare(f-1, r+1))
+			}
+			if f != FileH {
+				pawnAttackTable[White][s].Set(NewSquare(f+1, r+1))
+			}
+		}
+
 		// White knight targets.
 		for _, d := range knightDeltas {
 			f := f + File(d[0])
@@ -126,10 +149,13 @@ func init() {
 		}
 	}
 
-	// Targets for black pieces.
-	copy(targetTable[BlackPawn], targetTable[WhitePawn])
-	for s := A1; s < H8; s++ {
+	// Targets for black pieces. Black pawn targets are white pawn targets from
+	// the vertically mirrored square, mirrored back.
+	for s := A1; s <= H8; s++ {
+		targetTable[BlackPawn][s] = targetTable[WhitePawn][s^56]
 		targetTable[BlackPawn][s].Mirror()
+		pawnAttackTable[Black][s] = pawnAttackTable[White][s^56]
+		pawnAttackTable[Black][s].Mirror()
 	}
 	copy(targetTable[BlackKnight], targetTable[WhiteKnight])
 	copy(targetTable[BlackBishop], targetTable[WhiteBishop])
@@ -137,3 +163,111 @@ func init() {
 	copy(targetTable[BlackQueen], targetTable[WhiteQueen])
 	copy(targetTable[BlackKing], targetTable[WhiteKing])
 }
+
+// slidingAttacks returns the squares a sliding piece moving along deltas can
+// attack from a given square. It's slow, so it's only used to build tables.
+func slidingAttacks(s Square, occupied Bitboard, deltas [][]int) Bitboard {
+	var b Bitboard
+	for _, d := range deltas {
+		f := s.File() + File(d[0])
+		r := s.Rank() + Rank(d[1])
+		for f.Valid() && r.Valid() {
+			sq := NewSquare(f, r)
+			b.Set(sq)
+			if occupied.Get(sq) {
+				break
+			}
+			f += File(d[0])
+			r += Rank(d[1])
+		}
+	}
+	return b
+}
+
+// relevantOccupancy returns the squares whose occupancy affects a sliding
+// piece's attacks from a given square. Edge squares are excluded, since a
+// piece there can't block anything further along the ray.
+func relevantOccupancy(s Square, deltas [][]int) Bitboard {
+	var b Bitboard
+	for _, d := range deltas {
+		f := s.File() + File(d[0])
+		r := s.Rank() + Rank(d[1])
+		for {
+			nf, nr := f+File(d[0]), r+Rank(d[1])
+			if !f.Valid() || !r.Valid() || !nf.Valid() || !nr.Valid() {
+				break
+			}
+			b.Set(NewSquare(f, r))
+			f, r = nf, nr
+		}
+	}
+	return b
+}
+
+// findMagic searches for magic parameters for a sliding piece on a given
+// square, appending the resulting attack table to magicTable.
+func findMagic(s Square, deltas [][]int, rng *uint64) magicParameters {
+	mask := relevantOccupancy(s, deltas)
+	n := mask.Count()
+
+	// Enumerate all subsets of the mask with the carry-rippler trick.
+	occupancies := make([]Bitboard, 0, 1<<n)
+	attacks := make([]Bitboard, 0, 1<<n)
+	for sub := Bitboard(0); ; {
+		occupancies = append(occupancies, sub)
+		attacks = append(attacks, slidingAttacks(s, sub, deltas))
+		sub = (sub - mask) & mask
+		if sub == 0 {
+			break
+		}
+	}
+
+	table := make([]Bitboard, 1<<n)
+	epoch := make([]int, 1<<n)
+	for try := 1; ; try++ {
+		scale := random(rng) & random(rng) & random(rng) // sparse candidates work best
+		if bits.OnesCount64(uint64(mask)*scale>>56) < 6 {
+			continue
+		}
+		p := magicParameters{
+			index: uint64(len(magicTable)),
+			mask:  uint64(mask),
+			scale: scale,
+			shift: uint8(64 - n),
+		}
+		ok := true
+		for i, occ := range occupancies {
+			offset := uint64(occ) * p.scale >> p.shift
+			if epoch[offset] < try {
+				epoch[offset] = try
+				table[offset] = attacks[i]
+			} else if table[offset] != attacks[i] {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			magicTable = append(magicTable, table...)
+			return p
+		}
+	}
+}
+
+// random returns a pseudo-random number using xorshift64.
+func random(state *uint64) uint64 {
+	*state ^= *state << 13
+	*state ^= *state >> 7
+	*state ^= *state << 17
+	return *state
+}
+
+func init() {
+	// A fixed seed keeps the tables identical across runs.
+	rng := uint64(0x9E3779B97F4A7C15)
+	rookMagicParameters = make([]magicParameters, 64)
+	bishopMagicParameters = make([]magicParameters, 64)
+	for s := A1; s <= H8; s++ {
+		rookMagicParameters[s] = findMagic(s, rookDeltas, &rng)
+		bishopMagicParameters[s] = findMagic(s, bishopDeltas, &rng)
+	}
+}
@@ -0,0 +1,70 @@
+package chess
+
+// Zobrist keys for hashing positions.
+var (
+	zobristPieces       [12][64]uint64
+	zobristCastleRights [16]uint64
+	zobristEnPassant    [64]uint64
+	zobristBlackToMove  uint64
+)
+
+func init() {
+	// A fixed seed keeps hashes identical across runs.
+	rng := uint64(0x2545F4914F6CDD1D)
+	for pc := range zobristPieces {
+		for s := range zobristPieces[pc] {
+			zobristPieces[pc][s] = random(&rng)
+		}
+	}
+	// Castle rights are hashed as a set, so each combination gets the XOR of
+	// its individual rights' keys.
+	var rights [4]uint64
+	for i := range rights {
+		rights[i] = random(&rng)
+	}
+	for cr := range zobristCastleRights {
+		for i := range rights {
+			if cr&(1<<i) != 0 {
+				zobristCastleRights[cr] ^= rights[i]
+			}
+		}
+	}
+	for s := range zobristEnPassant {
+		zobristEnPassant[s] = random(&rng)
+	}
+	zobristBlackToMove = random(&rng)
+}
+
+// Hash returns a Zobrist hash of the position. Positions that are the same for
+// the purposes of repetition have the same hash; the move counters aren't
+// included.
+func (p *Position) Hash() uint64 {
+	var h uint64
+	for pc := WhitePawn; pc <= BlackKing; pc++ {
+		b := p.Board[pc]
+		for b != 0 {
+			h ^= zobristPieces[pc][b.Pop()]
+		}
+	}
+	h ^= zobristCastleRights[p.CastleRights]
+	if p.EnPassantRight != NoEnPassantRight {
+		h ^= zobristEnPassant[p.EnPassantRight]
+	}
+	if p.SideToMove == Black {
+		h ^= zobristBlackToMove
+	}
+	return h
+}
+
+// PawnHash returns a Zobrist hash of the pawns only. It's useful for caching
+// evaluation terms that depend only on pawn structure.
+func (p *Position) PawnHash() uint64 {
+	var h uint64
+	for _, pc := range []Piece{WhitePawn, BlackPawn} {
+		b := p.Board[pc]
+		for b != 0 {
+			h ^= zobristPieces[pc][b.Pop()]
+		}
+	}
+	return h
+}
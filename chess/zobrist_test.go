@@ -0,0 +1,30 @@
+package chess
+
+import "testing"
+
+func TestPosition_Hash(t *testing.T) {
+	p := NewPosition()
+	start := p.Hash()
+
+	// Transpose back to the starting position.
+	for i, m := range []Move{NewMove(G1, F3), NewMove(G8, F6), NewMove(F3, G1), NewMove(F6, G8)} {
+		p.Make(m)
+		if i < 3 && p.Hash() == start {
+			t.Errorf("after %s: hash unchanged", m)
+		}
+	}
+	if p.Hash() != start {
+		t.Error("transposed position has a different hash")
+	}
+	if start := NewPosition(); p.PawnHash() != start.PawnHash() {
+		t.Error("transposed position has a different pawn hash")
+	}
+
+	p.Make(NewMove(E2, E4))
+	q := NewPosition()
+	q.Make(NewMove(E2, E3))
+	q.Make(NewMove(B8, C6))
+	if p.PawnHash() == q.PawnHash() {
+		t.Error("different pawn structures have the same pawn hash")
+	}
+}
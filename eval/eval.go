@@ -2,12 +2,102 @@
 package eval
 
 import (
+	"io"
+	"sync"
+	"sync/atomic"
+
 	"github.com/clfs/good/chess"
-	"github.com/clfs/good/eval/internal/refeval"
+	"github.com/clfs/good/eval/internal/hce"
+	"github.com/clfs/good/eval/internal/nnue"
 )
 
+// weights holds the *hce.Weights used by new evaluators.
+var weights atomic.Value
+
+func init() {
+	weights.Store(&hce.Default)
+}
+
+// LoadWeights loads evaluation weights from a JSON weights file, replacing
+// the current ones. Evaluators created before the call keep their weights.
+func LoadWeights(r io.Reader) error {
+	w, err := hce.ReadJSON(r)
+	if err != nil {
+		return err
+	}
+	weights.Store(w)
+	return nil
+}
+
+// WriteWeights writes the current evaluation weights as a JSON weights file.
+func WriteWeights(w io.Writer) error {
+	return hce.WriteJSON(w, weights.Load().(*hce.Weights))
+}
+
+// ResetWeights restores the built-in evaluation weights.
+func ResetWeights() {
+	weights.Store(&hce.Default)
+}
+
+// evaluators holds idle evaluators for Position.
+var evaluators = sync.Pool{
+	New: func() any { return NewEvaluator() },
+}
+
 // Position returns the value of a position. Positive values are good for white,
 // and negative values are good for black.
 func Position(p chess.Position) int {
-	return refeval.Position(p)
+	e := evaluators.Get().(*Evaluator)
+	if e.Weights() != weights.Load().(*hce.Weights) {
+		// The weights were reloaded since this evaluator was created.
+		e = NewEvaluator()
+	}
+	defer evaluators.Put(e)
+	return e.Position(&p)
+}
+
+// Breakdown is a breakdown of an evaluation into its terms, split by color
+// and by game phase. Its String method formats it as a table.
+type Breakdown = hce.Trace
+
+// Trace evaluates a position like Position, returning the score of every
+// term along with the game phase and the final score.
+func Trace(p chess.Position) *Breakdown {
+	return NewEvaluator().Trace(&p)
+}
+
+// Evaluator evaluates positions with the hand-crafted evaluation function. It
+// caches pawn structure between calls, so it isn't safe for concurrent use;
+// each search thread should have its own.
+type Evaluator = hce.Evaluator
+
+// NewEvaluator returns a new Evaluator using the current weights.
+func NewEvaluator() *Evaluator {
+	return hce.New(weights.Load().(*hce.Weights))
+}
+
+// Accumulator evaluates positions with the NNUE network, updating its state
+// incrementally as moves are made and unmade. It isn't safe for concurrent
+// use.
+type Accumulator = nnue.Stack
+
+// LoadNNUE loads an NNUE network, replacing any previously loaded one.
+// Accumulators created before the call keep their network.
+func LoadNNUE(r io.Reader) error {
+	n, err := nnue.Load(r)
+	if err != nil {
+		return err
+	}
+	nnue.SetDefault(n)
+	return nil
+}
+
+// NewAccumulator returns an Accumulator for the loaded NNUE network. If no
+// network is loaded, ok is false.
+func NewAccumulator() (a *Accumulator, ok bool) {
+	n := nnue.Default()
+	if n == nil {
+		return nil, false
+	}
+	return nnue.NewStack(n), true
 }
@@ -0,0 +1,181 @@
+// Package endgame evaluates endgames that the general evaluation misplays.
+//
+// Endgames are recognized by material signature. Some have a value function,
+// which replaces the general evaluation, and others have a scale function,
+// which scales the general evaluation's endgame score towards a draw. A few
+// endgames are recognized by material patterns rather than exact signatures,
+// such as a lone king against mating material.
+package endgame
+
+import (
+	"github.com/clfs/good/chess"
+)
+
+// KnownWin is added to the value of endgames that are won with correct play,
+// so that they're preferred to any unclear position. It's well below mate
+// scores.
+const KnownWin = 10000
+
+// Scale factors apply to the endgame score of the side that's ahead, out of
+// ScaleNormal.
+const (
+	ScaleDraw   = 0
+	ScaleNormal = 64
+)
+
+// Piece values used by endgame functions, in centipawns.
+const (
+	pawnValue   = 100
+	knightValue = 300
+	bishopValue = 320
+	rookValue   = 500
+	queenValue  = 900
+)
+
+// A valueFunc returns the value of a position from the strong side's
+// perspective.
+type valueFunc func(p *chess.Position, strong chess.Color) int
+
+// A scaleFunc returns the scale factor for the strong side's advantage.
+type scaleFunc func(p *chess.Position, strong chess.Color) int
+
+type valueEntry struct {
+	name   string
+	strong chess.Color
+	fn     valueFunc
+}
+
+type scaleEntry struct {
+	name   string
+	strong chess.Color
+	fn     scaleFunc
+}
+
+// The registry of endgames with exact material signatures.
+var (
+	values = map[chess.MaterialKey]valueEntry{}
+	scales = map[chess.MaterialKey]scaleEntry{}
+)
+
+// mustParse parses a material signature written with the strong side first.
+func mustParse(sig string) chess.MaterialKey {
+	k, err := chess.ParseMaterialKey(sig)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
+
+// addValue registers a value function for a signature, with either color as
+// the strong side.
+func addValue(sig string, fn valueFunc) {
+	k := mustParse(sig)
+	values[k] = valueEntry{k.String(), chess.White, fn}
+	values[k.Flip()] = valueEntry{k.Flip().String(), chess.Black, fn}
+}
+
+// addScale registers a scale function for a signature, with either color as
+// the strong side.
+func addScale(sig string, fn scaleFunc) {
+	k := mustParse(sig)
+	scales[k] = scaleEntry{k.String(), chess.White, fn}
+	scales[k.Flip()] = scaleEntry{k.Flip().String(), chess.Black, fn}
+}
+
+func init() {
+	addValue("KBNK", kbnk)
+	addValue("KQKR", kqkr)
+	addValue("KRKP", krkp)
+	addValue("KPK", kpk)
+	addScale("KNNK", knnk)
+}
+
+// Value returns the value of p from white's perspective, if a value function
+// applies to it, along with the endgame's name.
+func Value(p *chess.Position) (v int, name string, ok bool) {
+	if p.IsInsufficientMaterial() {
+		return 0, "insufficient material", true
+	}
+	k := p.MaterialKey()
+	e, ok := values[k]
+	if !ok {
+		for c := chess.White; c <= chess.Black; c++ {
+			if isKXK(k, c) {
+				e, ok = valueEntry{"KXK", c, kxk}, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return 0, "", false
+	}
+	v = e.fn(p, e.strong)
+	if e.strong == chess.Black {
+		v = -v
+	}
+	return v, e.name, true
+}
+
+// Scale returns the scale factor for each color's advantage, if a scale
+// function applies to p, along with the endgame's name. Factors are
+// ScaleNormal otherwise.
+func Scale(p *chess.Position) (factors [2]int, name string) {
+	factors = [2]int{ScaleNormal, ScaleNormal}
+	k := p.MaterialKey()
+	if e, ok := scales[k]; ok {
+		factors[e.strong] = e.fn(p, e.strong)
+		return factors, e.name
+	}
+	for c := chess.White; c <= chess.Black; c++ {
+		if isWrongBishop(p, k, c) {
+			factors[c] = ScaleDraw
+			name = "wrong bishop"
+		}
+	}
+	if name != "" {
+		return factors, name
+	}
+	if f, ok := oppositeBishops(p, k); ok {
+		factors, name = [2]int{f, f}, "opposite bishops"
+	}
+	for c := chess.White; c <= chess.Black; c++ {
+		if f, ok := pawnless(k, c); ok && f < factors[c] {
+			factors[c], name = f, "pawnless"
+		}
+	}
+	return factors, name
+}
+
+// nonPawns returns the number of knights, bishops, rooks, and queens of a
+// color.
+func nonPawns(k chess.MaterialKey, c chess.Color) int {
+	n := 0
+	for r := chess.Knight; r <= chess.Queen; r++ {
+		n += k.Count(chess.NewPiece(c, r))
+	}
+	return n
+}
+
+// pieceMaterial returns the value of a color's knights, bishops, rooks, and
+// queens.
+func pieceMaterial(k chess.MaterialKey, c chess.Color) int {
+	return material(k, c) - k.Count(chess.NewPiece(c, chess.Pawn))*pawnValue
+}
+
+// material returns the value of a color's material, excluding the king.
+func material(k chess.MaterialKey, c chess.Color) int {
+	return k.Count(chess.NewPiece(c, chess.Pawn))*pawnValue +
+		k.Count(chess.NewPiece(c, chess.Knight))*knightValue +
+		k.Count(chess.NewPiece(c, chess.Bishop))*bishopValue +
+		k.Count(chess.NewPiece(c, chess.Rook))*rookValue +
+		k.Count(chess.NewPiece(c, chess.Queen))*queenValue
+}
+
+// relative returns s from c's point of view, so that c's pawns move up the
+// board.
+func relative(c chess.Color, s chess.Square) chess.Square {
+	if c == chess.White {
+		return s
+	}
+	return s ^ 56
+}
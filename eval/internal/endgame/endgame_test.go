@@ -0,0 +1,169 @@
+package endgame
+
+import (
+	"testing"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/fen"
+)
+
+func position(t *testing.T, s string) chess.Position {
+	t.Helper()
+	p, err := fen.From(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// flip mirrors a position vertically and swaps the colors.
+func flip(p chess.Position) chess.Position {
+	p.FlipColors()
+	return p
+}
+
+func TestValue(t *testing.T) {
+	cases := []struct {
+		fen  string
+		name string
+	}{
+		{"8/8/8/4k3/8/8/8/R3K3 w - - 0 1", "KXK"},
+		{"8/8/8/4k3/8/8/8/Q3K3 b - - 0 1", "KXK"},
+		{"8/8/8/4k3/8/8/1P6/RB2K3 w - - 0 1", "KXK"},
+		{"8/8/8/4k3/8/8/8/NB2K3 w - - 0 1", "KBNvK"},
+		{"8/8/8/4k3/8/8/r7/Q3K3 w - - 0 1", "KQvKR"},
+		{"8/8/8/4k3/3p4/8/8/R3K3 w - - 0 1", "KRvKP"},
+		{"8/8/8/4k3/3P4/8/8/4K3 w - - 0 1", "KPvK"},
+		{"8/8/8/4k3/8/8/8/N3K3 w - - 0 1", "insufficient material"},
+		{"8/8/1b6/4k3/8/8/8/2B1K3 w - - 0 1", "insufficient material"},
+	}
+	for _, tc := range cases {
+		p := position(t, tc.fen)
+		v, name, ok := Value(&p)
+		if !ok || name != tc.name {
+			t.Errorf("%s: want %s, got %q (%t)", tc.fen, tc.name, name, ok)
+			continue
+		}
+		q := flip(p)
+		if w, _, _ := Value(&q); w != -v {
+			t.Errorf("%s: value %d, but flipped value %d", tc.fen, v, w)
+		}
+	}
+
+	for _, s := range []string{
+		"8/8/8/4k3/8/8/8/NN2K3 w - - 0 1",
+		"8/8/2b5/4k3/8/8/8/2B1K3 w - - 0 1",
+		"8/8/8/4k3/8/8/PP6/4K3 w - - 0 1",
+		"8/8/8/4k3/8/8/r7/R3K3 w - - 0 1",
+	} {
+		p := position(t, s)
+		if _, name, ok := Value(&p); ok {
+			t.Errorf("%s: want no value, got %s", s, name)
+		}
+	}
+}
+
+func TestKXK(t *testing.T) {
+	value := func(s string) int {
+		p := position(t, s)
+		v, _, _ := Value(&p)
+		return v
+	}
+	// The weak king is worse off on the edge, and worse off still with the
+	// strong king nearby.
+	center := value("8/8/8/4k3/8/8/8/R3K3 w - - 0 1")
+	edge := value("8/8/8/k7/8/8/8/1R2K3 w - - 0 1")
+	close := value("8/8/8/k7/8/2K5/8/1R6 w - - 0 1")
+	if !(KnownWin < center && center < edge && edge < close) {
+		t.Errorf("want %d < center %d < edge %d < close %d", KnownWin, center, edge, close)
+	}
+	if v := value("k7/2Q5/1K6/8/8/8/8/8 b - - 0 1"); v != 0 {
+		t.Errorf("stalemate: want 0, got %d", v)
+	}
+}
+
+func TestKBNK(t *testing.T) {
+	value := func(s string) int {
+		p := position(t, s)
+		v, _, _ := Value(&p)
+		return v
+	}
+	// With a light-squared bishop, mate is only possible on a8 and h1.
+	right := value("k7/8/1K6/8/8/8/8/4NB2 w - - 0 1")
+	wrong := value("7k/8/6K1/8/8/8/8/4NB2 w - - 0 1")
+	if right <= wrong {
+		t.Errorf("right corner scored %d, wrong corner %d", right, wrong)
+	}
+}
+
+func TestKPK(t *testing.T) {
+	cases := []struct {
+		fen  string
+		won  bool
+		draw bool
+	}{
+		// The black king can't catch the pawn.
+		{"8/k7/8/8/6P1/8/8/K7 w - - 0 1", true, false},
+		// The black king holds the corner against a rook pawn.
+		{"k7/8/8/P7/8/8/8/7K w - - 0 1", false, true},
+		// The black king blocks the pawn, and the white king is behind it.
+		{"4k3/8/8/8/4P3/4K3/8/8 b - - 0 1", false, true},
+	}
+	for _, tc := range cases {
+		p := position(t, tc.fen)
+		v, _, _ := Value(&p)
+		if tc.won != (v > KnownWin) || tc.draw != (v == 0) {
+			t.Errorf("%s: got %d", tc.fen, v)
+		}
+	}
+}
+
+func TestKRKP(t *testing.T) {
+	value := func(s string) int {
+		p := position(t, s)
+		v, _, _ := Value(&p)
+		return v
+	}
+	// The white king in front of the pawn wins easily; an advanced pawn
+	// supported by its king is drawish.
+	front := value("8/8/8/8/4k3/8/3p4/3K2R1 w - - 0 1")
+	advanced := value("R7/8/8/8/7K/8/2pk4/8 w - - 0 1")
+	if front <= rookValue-8 || advanced >= 100 {
+		t.Errorf("king in front scored %d, advanced pawn %d", front, advanced)
+	}
+}
+
+func TestScale(t *testing.T) {
+	cases := []struct {
+		fen     string
+		factors [2]int
+		name    string
+	}{
+		{"1k6/8/8/8/P7/P7/8/2B1K3 w - - 0 1", [2]int{ScaleDraw, ScaleNormal}, "wrong bishop"},
+		{"k7/8/8/8/P7/P7/8/3BK3 w - - 0 1", [2]int{ScaleNormal, ScaleNormal}, ""},
+		{"2k5/8/8/8/8/7p/8/1K1b4 w - - 0 1", [2]int{ScaleNormal, ScaleNormal}, ""},
+		{"8/8/8/8/8/b6p/7K/5k2 w - - 0 1", [2]int{ScaleNormal, ScaleDraw}, "wrong bishop"},
+		{"4k3/5b2/p7/2PP4/8/8/3B4/4K3 w - - 0 1", [2]int{16, 16}, "opposite bishops"},
+		{"4k3/5b2/8/2PPP3/8/8/3B4/4K3 w - - 0 1", [2]int{48, ScaleDraw}, "pawnless"},
+		{"4k3/8/5b2/2PP4/8/8/3B4/4K3 w - - 0 1", [2]int{ScaleNormal, ScaleDraw}, "pawnless"},
+		// Opposite bishops, where pawnless scaling doesn't apply, or applies
+		// to one or both sides.
+		{"4k3/5b2/6p1/2PPP3/8/8/3B4/4K3 w - - 0 1", [2]int{32, 32}, "opposite bishops"},
+		{"4k3/5b2/6p1/1PPPP3/8/8/3B4/4K3 w - - 0 1", [2]int{48, 48}, "opposite bishops"},
+		{"4k3/5b2/8/2P5/8/8/3B4/4K3 w - - 0 1", [2]int{16, ScaleDraw}, "pawnless"},
+		{"4k3/5b2/8/8/8/8/3B4/4K3 w - - 0 1", [2]int{ScaleDraw, ScaleDraw}, "pawnless"},
+		{"4k3/8/5r2/8/8/8/3B4/4K3 w - - 0 1", [2]int{ScaleDraw, 4}, "pawnless"},
+		{"4k3/8/5r2/8/8/8/3R4/4K3 w - - 0 1", [2]int{14, 14}, "pawnless"},
+		{"4k3/8/5r2/8/1P6/8/3R4/4K3 w - - 0 1", [2]int{ScaleNormal, 14}, "pawnless"},
+		{"4k3/8/8/8/8/8/p7/2B1K3 w - - 0 1", [2]int{ScaleDraw, ScaleNormal}, "pawnless"},
+		{"4k3/8/8/8/8/8/p7/2R1K3 w - - 0 1", [2]int{ScaleNormal, ScaleNormal}, ""},
+		{"4k3/8/8/8/8/8/8/1NN1K3 w - - 0 1", [2]int{ScaleDraw, ScaleNormal}, "KNNvK"},
+	}
+	for _, tc := range cases {
+		p := position(t, tc.fen)
+		factors, name := Scale(&p)
+		if factors != tc.factors || name != tc.name {
+			t.Errorf("%s: want %v %q, got %v %q", tc.fen, tc.factors, tc.name, factors, name)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package endgame
+
+import (
+	"github.com/clfs/good/chess"
+	kpkbb "github.com/clfs/good/eval/internal/kpk"
+)
+
+// Mop-up terms guide the strong side towards mate, where the general
+// evaluation would be flat.
+
+// pushToEdge rewards the weak king for being far from the center.
+func pushToEdge(s chess.Square) int {
+	f, r := int(s.File()), int(s.Rank())
+	return 20 * (max(3-f, f-4) + max(3-r, r-4))
+}
+
+// pushClose rewards the strong king for being close to the weak king.
+func pushClose(a, b chess.Square) int {
+	return 140 - 20*chess.Distance(a, b)
+}
+
+// manhattan returns the number of rook steps between two squares.
+func manhattan(a, b chess.Square) int {
+	return abs(int(a.File())-int(b.File())) + abs(int(a.Rank())-int(b.Rank()))
+}
+
+// isKXK reports whether strong has mating material against a lone king.
+func isKXK(k chess.MaterialKey, strong chess.Color) bool {
+	weak := strong.Opposite()
+	if material(k, weak) != 0 {
+		return false
+	}
+	count := func(r chess.Role) int { return k.Count(chess.NewPiece(strong, r)) }
+	return count(chess.Queen) > 0 || count(chess.Rook) > 0 || count(chess.Bishop) > 1 ||
+		count(chess.Bishop) > 0 && count(chess.Knight) > 0
+}
+
+// kxk evaluates mating material against a lone king by driving the king to
+// the edge of the board.
+func kxk(p *chess.Position, strong chess.Color) int {
+	weak := strong.Opposite()
+	if p.SideToMove == weak && !p.InCheck() && len(p.LegalMoves()) == 0 {
+		return 0 // Stalemate.
+	}
+	strongKing, weakKing := p.King(strong), p.King(weak)
+	return KnownWin + material(p.MaterialKey(), strong) + pushToEdge(weakKing) + pushClose(strongKing, weakKing)
+}
+
+// kbnk evaluates bishop and knight against a lone king. Mate is only possible
+// in a corner of the bishop's color, so the weak king is driven there.
+func kbnk(p *chess.Position, strong chess.Color) int {
+	weak := strong.Opposite()
+	strongKing, weakKing := p.King(strong), p.King(weak)
+	corners := [2]chess.Square{chess.A1, chess.H8}
+	if bishop := p.Board[chess.NewPiece(strong, chess.Bishop)]; bishop.First().Light() {
+		corners = [2]chess.Square{chess.H1, chess.A8}
+	}
+	d := min(manhattan(weakKing, corners[0]), manhattan(weakKing, corners[1]))
+	return KnownWin + knightValue + bishopValue + pushClose(strongKing, weakKing) + 40*(14-d)
+}
+
+// kqkr evaluates queen against rook. It's generally won, by driving the weak
+// king to the edge until the rook is lost.
+func kqkr(p *chess.Position, strong chess.Color) int {
+	strongKing, weakKing := p.King(strong), p.King(strong.Opposite())
+	return queenValue - rookValue + pushToEdge(weakKing) + pushClose(strongKing, weakKing)
+}
+
+// krkp evaluates rook against pawn. It's won if the strong king gets in front
+// of the pawn, or the weak king is too far from it; otherwise the pawn's
+// progress decides.
+func krkp(p *chess.Position, strong chess.Color) int {
+	weak := strong.Opposite()
+	// Squares are seen from the strong side, so the pawn moves down.
+	strongKing := relative(strong, p.King(strong))
+	weakKing := relative(strong, p.King(weak))
+	rook := relative(strong, p.Board[chess.NewPiece(strong, chess.Rook)].First())
+	pawn := relative(strong, p.Board[chess.NewPiece(weak, chess.Pawn)].First())
+	queening := chess.NewSquare(pawn.File(), chess.Rank1)
+
+	tempo := func(c chess.Color) int {
+		if p.SideToMove == c {
+			return 1
+		}
+		return 0
+	}
+
+	switch {
+	case strongKing.File() == pawn.File() && strongKing.Rank() < pawn.Rank():
+		// The strong king is in front of the pawn.
+		return rookValue - chess.Distance(strongKing, pawn)
+	case chess.Distance(weakKing, pawn) >= 3+tempo(weak) && chess.Distance(weakKing, rook) >= 3:
+		// The weak king is too far from the pawn and the rook.
+		return rookValue - chess.Distance(strongKing, pawn)
+	case weakKing.Rank() <= chess.Rank3 && chess.Distance(weakKing, pawn) == 1 &&
+		strongKing.Rank() >= chess.Rank4 && chess.Distance(strongKing, pawn) > 2+tempo(strong):
+		// The pawn is far advanced and supported, so it's drawish.
+		return 40 - 4*chess.Distance(strongKing, pawn)
+	default:
+		stop := pawn - 8
+		return 100 - 4*(chess.Distance(strongKing, stop)-chess.Distance(weakKing, stop)-chess.Distance(pawn, queening))
+	}
+}
+
+// kpk evaluates king and pawn against king with the bitbase. Won positions
+// are scored higher the further the pawn has advanced.
+func kpk(p *chess.Position, strong chess.Color) int {
+	if win, _ := kpkbb.Probe(p); !win {
+		return 0
+	}
+	pawn := p.Board[chess.NewPiece(strong, chess.Pawn)].First()
+	return KnownWin + pawnValue + 20*int(pawn.Rank().Relative(strong))
+}
+
+// knnk scales two knights against a lone king to a draw, since mate can't be
+// forced.
+func knnk(p *chess.Position, strong chess.Color) int {
+	return ScaleDraw
+}
+
+// isWrongBishop reports whether strong has only a bishop and pawns on a single
+// rook file, whose queening square the bishop doesn't control, with the weak
+// king holding that corner. Such positions are drawn.
+func isWrongBishop(p *chess.Position, k chess.MaterialKey, strong chess.Color) bool {
+	weak := strong.Opposite()
+	if k.Count(chess.NewPiece(strong, chess.Bishop)) != 1 || nonPawns(k, strong) != 1 || nonPawns(k, weak) != 0 {
+		return false
+	}
+	pawns := p.Board[chess.NewPiece(strong, chess.Pawn)]
+	var file chess.File
+	switch {
+	case pawns == 0:
+		return false
+	case pawns&^chess.FileA.Bitboard() == 0:
+		file = chess.FileA
+	case pawns&^chess.FileH.Bitboard() == 0:
+		file = chess.FileH
+	default:
+		return false
+	}
+	queening := chess.NewSquare(file, chess.Rank8.Relative(strong))
+	bishop := p.Board[chess.NewPiece(strong, chess.Bishop)]
+	return bishop.First().Light() != queening.Light() && chess.Distance(p.King(weak), queening) <= 1
+}
+
+// oppositeBishops returns the scale factor for endgames where each side has
+// only a bishop and pawns, with bishops on opposite colors. These are drawish
+// unless one side is well ahead in pawns.
+func oppositeBishops(p *chess.Position, k chess.MaterialKey) (int, bool) {
+	for c := chess.White; c <= chess.Black; c++ {
+		if k.Count(chess.NewPiece(c, chess.Bishop)) != 1 || nonPawns(k, c) != 1 {
+			return 0, false
+		}
+	}
+	white, black := p.Board[chess.WhiteBishop], p.Board[chess.BlackBishop]
+	if white.First().Light() == black.First().Light() {
+		return 0, false
+	}
+	switch abs(k.Count(chess.WhitePawn) - k.Count(chess.BlackPawn)) {
+	case 0, 1:
+		return 16, true
+	case 2:
+		return 32, true
+	default:
+		return 48, true
+	}
+}
+
+// pawnless returns the scale factor for endgames where c has pieces but no
+// pawns, and is at most a minor piece ahead. Without pawns to promote, such
+// advantages rarely win: a lone minor piece can't mate, and a rook against a
+// minor piece is usually held.
+func pawnless(k chess.MaterialKey, c chess.Color) (int, bool) {
+	strong, weak := pieceMaterial(k, c), pieceMaterial(k, c.Opposite())
+	if k.Count(chess.NewPiece(c, chess.Pawn)) > 0 || strong == 0 || strong-weak > bishopValue {
+		return 0, false
+	}
+	switch {
+	case strong < rookValue:
+		return ScaleDraw, true
+	case weak <= bishopValue:
+		return 4, true
+	default:
+		return 14, true
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,182 @@
+// Package hce implements a hand-crafted evaluation function.
+//
+// Each term is scored separately for the midgame and the endgame, and the two
+// are blended by game phase, which is measured from the remaining non-pawn
+// material.
+package hce
+
+import (
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/eval/internal/endgame"
+)
+
+// Phase weights of each role. A position with all pieces on the board has
+// phase MaxPhase.
+var phaseWeights = [6]int{0, 1, 1, 2, 4, 0}
+
+// MaxPhase is the game phase of a position with all pieces on the board. The
+// phase decreases to zero as pieces are traded.
+const MaxPhase = 24
+
+// Evaluator evaluates positions. It caches pawn structure evaluation between
+// calls, so it isn't safe for concurrent use.
+type Evaluator struct {
+	w     *Weights
+	pawns pawnTable
+}
+
+// New returns an evaluator that uses the given weights.
+func New(w *Weights) *Evaluator {
+	return &Evaluator{w: w}
+}
+
+// Weights returns the weights the evaluator uses.
+func (e *Evaluator) Weights() *Weights {
+	return e.w
+}
+
+// Position returns the value of a position. Positive values are good for
+// white, and negative values are good for black. Endgames with a specialized
+// evaluation function are scored by it instead of the weights.
+func (e *Evaluator) Position(p *chess.Position) int {
+	if v, _, ok := endgame.Value(p); ok {
+		return v
+	}
+	ev := evaluation{w: e.w, p: p}
+	ev.run(&e.pawns)
+	return ev.value()
+}
+
+// Trace evaluates a position like Position, but also records the score of
+// each term. The pawn table is bypassed, so pawn terms are always recorded.
+func (e *Evaluator) Trace(p *chess.Position) *Trace {
+	t := newTrace()
+	ev := evaluation{w: e.w, p: p, trace: t}
+	ev.run(nil)
+	t.Phase = ev.clampedPhase()
+	t.Scale = ev.scaleFactor()
+	t.Score = ev.value()
+	if v, name, ok := endgame.Value(p); ok {
+		t.Endgame, t.Scale, t.Score = name, endgame.ScaleNormal, v
+	}
+	return t
+}
+
+// run evaluates every term. If t is nil, pawn structure isn't cached.
+func (ev *evaluation) run(t *pawnTable) {
+	var name string
+	ev.scale, name = endgame.Scale(ev.p)
+	if ev.trace != nil {
+		ev.trace.Endgame = name
+	}
+
+	ev.term = termMaterial
+	ev.material()
+
+	ev.term = termPawns
+	ev.pawnStructure(t)
+
+	ev.term = termMobility
+	ev.attackMaps()
+	for c := chess.White; c <= chess.Black; c++ {
+		ev.pieces(c)
+	}
+
+	ev.term = termKingSafety
+	for c := chess.White; c <= chess.Black; c++ {
+		ev.kingSafety(c)
+	}
+
+	ev.term = termThreats
+	for c := chess.White; c <= chess.Black; c++ {
+		ev.threats(c)
+	}
+
+	ev.term = termPositional
+	for c := chess.White; c <= chess.Black; c++ {
+		ev.positional(c)
+	}
+}
+
+// evaluation holds the state of a single evaluation.
+type evaluation struct {
+	w     *Weights
+	p     *chess.Position
+	score [2]S // Indexed by color.
+	phase int
+	scale [2]int // Endgame scale factors, indexed by the color that's ahead.
+
+	passed [2]chess.Bitboard // Passed pawns, indexed by color.
+
+	// Attack maps, indexed by color.
+	attacks       [2][6]chess.Bitboard // Squares attacked by each role.
+	attacked      [2]chess.Bitboard    // Squares attacked by any piece.
+	attackedTwice [2]chess.Bitboard    // Squares attacked by at least two pieces.
+
+	kingZone      [2]chess.Bitboard // Squares around each king.
+	kingAttackers [2]int            // Pieces attacking the enemy king zone.
+	kingAttacks   [2][6]int         // Enemy king zone squares attacked, by attacker role.
+
+	term   term   // The term being evaluated.
+	trace  *Trace // If non-nil, term scores are recorded here.
+	coeffs []int  // If non-nil, parameter coefficients are recorded here.
+}
+
+// add adds n times a weight to a color's score. The weight must point into
+// ev.w, so that its coefficient can be recorded.
+func (ev *evaluation) add(c chess.Color, w *S, n int) {
+	ev.score[c].MG += w.MG * n
+	ev.score[c].EG += w.EG * n
+	if ev.trace != nil {
+		ev.trace.add(ev.term, c, *w, n)
+	}
+	if ev.coeffs != nil {
+		if c == chess.Black {
+			n = -n
+		}
+		ev.coeffs[paramIndex[w]] += n
+	}
+}
+
+// addScore adds a precomputed score to a color's score. It's only used for
+// cached scores, which are never traced.
+func (ev *evaluation) addScore(c chess.Color, s S) {
+	ev.score[c].MG += s.MG
+	ev.score[c].EG += s.EG
+}
+
+// clampedPhase returns the game phase, which may exceed MaxPhase after
+// promotions, clamped to MaxPhase.
+func (ev *evaluation) clampedPhase() int {
+	if ev.phase > MaxPhase {
+		return MaxPhase
+	}
+	return ev.phase
+}
+
+// scaleFactor returns the scale factor for the endgame score, which depends
+// on the color that's ahead in it.
+func (ev *evaluation) scaleFactor() int {
+	if ev.score[chess.White].EG >= ev.score[chess.Black].EG {
+		return ev.scale[chess.White]
+	}
+	return ev.scale[chess.Black]
+}
+
+// value blends the midgame and scaled endgame scores by phase.
+func (ev *evaluation) value() int {
+	mg := ev.score[chess.White].MG - ev.score[chess.Black].MG
+	eg := ev.score[chess.White].EG - ev.score[chess.Black].EG
+	eg = eg * ev.scaleFactor() / endgame.ScaleNormal
+	phase := ev.clampedPhase()
+	return (mg*phase + eg*(MaxPhase-phase)) / MaxPhase
+}
+
+// material scores material and computes the game phase.
+func (ev *evaluation) material() {
+	for pc := chess.WhitePawn; pc <= chess.BlackKing; pc++ {
+		n := ev.p.Board[pc].Count()
+		ev.add(pc.Color(), &ev.w.Material[pc.Role()], n)
+		ev.phase += phaseWeights[pc.Role()] * n
+	}
+}
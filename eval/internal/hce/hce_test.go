@@ -0,0 +1,322 @@
+package hce
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/eval/internal/endgame"
+	"github.com/clfs/good/fen"
+)
+
+// one is a weight that counts occurrences of a term, in both game phases.
+var one = S{1, 1}
+
+// evaluate returns the general evaluation of a position, bypassing
+// specialized endgame functions, which would otherwise score many of the
+// small test positions.
+func evaluate(t *testing.T, w *Weights, s string) int {
+	t.Helper()
+	p, err := fen.From(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := evaluation{w: w, p: &p}
+	ev.run(nil)
+	return ev.value()
+}
+
+func TestPawnStructure(t *testing.T) {
+	cases := []struct {
+		name string
+		w    Weights
+		fen  string
+		want int // White's count minus black's count.
+	}{
+		{"isolated", Weights{IsolatedPawn: one}, "4k3/p1p5/8/8/8/8/PP5P/4K3 w - - 0 1", 1 - 2},
+		{"doubled", Weights{DoubledPawn: one}, "4k3/pp6/p7/8/8/2P5/2P5/2P1K3 w - - 0 1", 2 - 1},
+		{"passed free", Weights{PassedPawn: [8]S{5: one}}, "4k3/8/1P6/8/8/8/8/4K3 w - - 0 1", 1},
+		{"passed blocked", Weights{PassedBlocked: [8]S{5: one}}, "4k3/8/1P6/8/8/8/8/4K3 w - - 0 1", 0},
+		{"passed blocked", Weights{PassedBlocked: [8]S{5: one}}, "4k3/1n6/1P6/8/8/8/8/4K3 w - - 0 1", 1},
+		{"not passed", Weights{PassedPawn: [8]S{4: one, 5: one}}, "4k3/2p5/1P6/8/8/8/8/4K3 w - - 0 1", 0},
+		{"black passed", Weights{PassedPawn: [8]S{5: one}}, "4k3/8/8/8/8/6p1/8/4K3 w - - 0 1", -1},
+		{"connected", Weights{ConnectedPawn: [8]S{2: one, 3: one}}, "4k3/8/8/8/3P4/2P5/8/4K3 w - - 0 1", 1},
+		{"phalanx", Weights{PhalanxPawn: [8]S{3: one}}, "4k3/8/8/8/3PP3/8/8/4K3 w - - 0 1", 2},
+		{"backward", Weights{BackwardPawn: one}, "4k3/8/8/2p5/3P4/8/4P3/4K3 w - - 0 1", 0},
+		{"backward", Weights{BackwardPawn: one}, "4k3/8/3p4/8/2P1P3/8/8/4K3 w - - 0 1", 0},
+		{"backward", Weights{BackwardPawn: one}, "4k3/8/8/2p5/4P3/3P4/8/4K3 w - - 0 1", 1},
+		{"candidate", Weights{CandidatePasser: [8]S{4: one}}, "4k3/8/2p5/1P6/P7/8/8/4K3 w - - 0 1", 1},
+		{"candidate", Weights{CandidatePasser: [8]S{4: one}}, "4k3/8/p1p5/1P6/8/8/8/4K3 w - - 0 1", 0},
+	}
+	for _, tc := range cases {
+		if got := evaluate(t, &tc.w, tc.fen); got != tc.want {
+			t.Errorf("%s: %s: want %d, got %d", tc.name, tc.fen, tc.want, got)
+		}
+	}
+}
+
+func TestPawnTable(t *testing.T) {
+	// Positions with the same pawns share a pawn table entry, but passed pawns
+	// are only blocked in one of them.
+	e := New(&Default)
+	for _, s := range []string{
+		"4k3/7p/1P6/8/8/8/8/4K3 w - - 0 1",
+		"4k3/1n5p/1P6/8/8/8/8/4K3 w - - 0 1",
+		"4k3/7p/1P6/8/8/8/8/4K3 w - - 0 1",
+	} {
+		p, err := fen.From(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := New(&Default).Position(&p), e.Position(&p); want != got {
+			t.Errorf("%s: want %d, got %d", s, want, got)
+		}
+	}
+}
+
+func TestMaterial(t *testing.T) {
+	p := chess.NewPosition()
+	if got := New(&Default).Position(&p); got != 0 {
+		t.Errorf("starting position: want 0, got %d", got)
+	}
+}
+
+func TestMobility(t *testing.T) {
+	cases := []struct {
+		name string
+		w    Weights
+		fen  string
+		want int
+	}{
+		{"knight", Weights{KnightMobility: [9]S{2: one}}, "4k3/8/8/8/8/8/7P/N3K3 w - - 0 1", 1},
+		{"knight pawn attacks", Weights{KnightMobility: [9]S{1: one}}, "4k3/8/8/8/p7/8/7P/N3K3 w - - 0 1", 1},
+		{"bishop friendly pieces", Weights{BishopMobility: [14]S{1: one}}, "4k3/8/8/8/8/8/1P6/B3K3 w - - 0 1", 0},
+		{"bishop blocked", Weights{BishopMobility: [14]S{0: one}}, "4k3/8/8/8/8/8/1P6/B3K3 w - - 0 1", 1},
+		{"rook", Weights{RookMobility: [15]S{14: one}}, "4k3/8/8/8/8/8/8/R5K1 w - - 0 1", 0},
+		{"rook", Weights{RookMobility: [15]S{12: one}}, "4k3/8/8/8/8/8/8/R5K1 w - - 0 1", 1},
+		{"queen", Weights{QueenMobility: [28]S{27: one}}, "7k/8/8/3q4/8/8/8/K7 w - - 0 1", -1},
+	}
+	for _, tc := range cases {
+		if got := evaluate(t, &tc.w, tc.fen); got != tc.want {
+			t.Errorf("%s: %s: want %d, got %d", tc.name, tc.fen, tc.want, got)
+		}
+	}
+}
+
+func TestKingSafety(t *testing.T) {
+	cases := []struct {
+		name string
+		w    Weights
+		fen  string
+		want int
+	}{
+		{"shield", Weights{KingShield: [8]S{1: one}}, "4k3/8/8/8/8/8/5PPP/6K1 w - - 0 1", 3},
+		{"shield advanced", Weights{KingShield: [8]S{1: one, 2: {2, 2}}}, "4k3/8/8/8/8/6P1/5P1P/6K1 w - - 0 1", 4},
+		{"shield edge", Weights{KingShield: [8]S{0: one}}, "6k1/5ppp/8/8/8/8/P7/K7 w - - 0 1", 2},
+		{"storm", Weights{PawnStorm: [8]S{2: one}}, "4k3/8/8/8/8/6p1/5PPP/6K1 w - - 0 1", 1},
+		{"open files", Weights{KingOpenFile: one}, "4k3/3p4/8/8/8/8/8/4K3 w - - 0 1", 2 - 2},
+		{"semi-open files", Weights{KingSemiOpenFile: one}, "4k3/3p4/8/8/8/8/8/4K3 w - - 0 1", 1},
+		{"attackers", Weights{KingAttackers: [8]S{2: one}}, "6k1/8/8/8/8/8/8/R2QK3 w - - 0 1", 0},
+		{"attackers", Weights{KingAttackers: [8]S{2: one}}, "6k1/8/8/8/8/8/8/4K1RQ w - - 0 1", 1},
+		{"attack weight", Weights{KingAttackWeight: [6]S{chess.Rook: one}}, "6k1/8/8/8/8/8/8/4K1R1 w - - 0 1", 2},
+	}
+	for _, tc := range cases {
+		if got := evaluate(t, &tc.w, tc.fen); got != tc.want {
+			t.Errorf("%s: %s: want %d, got %d", tc.name, tc.fen, tc.want, got)
+		}
+	}
+
+	// A castled king is safer than one stranded in the center.
+	castled := evaluate(t, &Default, "r1bqk2r/pppp1ppp/2n2n2/2b1p3/2B1P3/2N2N2/PPPP1PPP/R1BQ1RK1 b kq - 0 1")
+	stranded := evaluate(t, &Default, "r1bqk2r/pppp1ppp/2n2n2/2b5/2B1p3/2N2N2/PPPP1PPP/R1BQK2R b kq - 0 1")
+	if castled <= stranded {
+		t.Errorf("castled king scored %d, stranded king scored %d", castled, stranded)
+	}
+}
+
+func TestThreats(t *testing.T) {
+	cases := []struct {
+		name string
+		w    Weights
+		fen  string
+		want int
+	}{
+		{"pawn", Weights{ThreatByPawn: [6]S{chess.Knight: one}}, "4k3/8/8/3n4/4P3/8/8/4K3 w - - 0 1", 1},
+		{"minor", Weights{ThreatByMinor: [6]S{chess.Knight: one}}, "4k3/8/2p5/3n4/8/4N3/8/4K3 w - - 0 1", -1},
+		{"minor on rook", Weights{ThreatByMinor: [6]S{chess.Rook: one}}, "4k3/7p/8/3r4/8/4N3/7P/4K3 w - - 0 1", 1},
+		{"rook", Weights{ThreatByRook: one}, "4k3/7p/8/8/3q4/8/7P/3RK3 w - - 0 1", 1},
+		{"hanging", Weights{HangingPiece: one}, "4k3/7p/8/8/3n4/8/7P/3RK3 w - - 0 1", 1},
+		{"undefended", Weights{UndefendedPiece: one}, "4k3/7p/8/8/3n4/8/7P/3RK3 w - - 0 1", -1},
+		{"pawn push", Weights{PawnPushThreat: one}, "4k3/8/8/3n4/8/4P3/8/4K3 w - - 0 1", 1},
+		{"double pawn push", Weights{PawnPushThreat: one}, "4k3/8/8/3n4/8/8/4P3/4K3 w - - 0 1", 1},
+		{"safe check", Weights{SafeCheck: [6]S{chess.Rook: one}}, "4k3/8/8/8/8/8/8/R3K3 w - - 0 1", 1},
+		{"unsafe check", Weights{SafeCheck: [6]S{chess.Rook: one}}, "k7/8/8/8/8/8/8/KR6 w - - 0 1", 0},
+	}
+	for _, tc := range cases {
+		if got := evaluate(t, &tc.w, tc.fen); got != tc.want {
+			t.Errorf("%s: %s: want %d, got %d", tc.name, tc.fen, tc.want, got)
+		}
+	}
+}
+
+func TestPositional(t *testing.T) {
+	cases := []struct {
+		name string
+		w    Weights
+		fen  string
+		want int
+	}{
+		{"knight outpost", Weights{KnightOutpost: one}, "4k3/7p/8/3N4/8/8/7P/4K3 w - - 0 1", 1},
+		{"knight outpost attackable", Weights{KnightOutpost: one}, "4k3/4p2p/8/3N4/8/8/7P/4K3 w - - 0 1", 0},
+		{"bishop pair", Weights{BishopPair: one}, "2b1k3/7p/8/8/8/8/7P/2B1KB2 w - - 0 1", 1},
+		{"bad bishop", Weights{BadBishop: one}, "4k3/7p/8/8/3p4/3P4/7P/4KB2 w - - 0 1", 1},
+		{"bad bishop other color", Weights{BadBishop: one}, "4k3/7p/8/8/3p4/3P4/7P/2B1K3 w - - 0 1", 0},
+		{"rook open file", Weights{RookOpenFile: one}, "4k3/7p/8/8/8/8/7P/3RK3 w - - 0 1", 1},
+		{"rook semi-open file", Weights{RookSemiOpenFile: one}, "4k3/3p3p/8/8/8/8/7P/3RK3 w - - 0 1", 1},
+		{"rook on seventh", Weights{RookOnSeventh: one}, "4k3/R6p/8/8/8/8/7P/4K3 w - - 0 1", 1},
+		{"early queen", Weights{EarlyQueen: one}, "rnbqkbnr/pppppppp/8/8/4P3/5Q2/PPPP1PPP/RNB1KBNR b KQkq - 0 1", 4},
+		{"space", Weights{Space: one}, "4k3/7p/8/8/3PP3/8/7P/4K3 w - - 0 1", 14 - 8},
+	}
+	for _, tc := range cases {
+		if got := evaluate(t, &tc.w, tc.fen); got != tc.want {
+			t.Errorf("%s: %s: want %d, got %d", tc.name, tc.fen, tc.want, got)
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	for _, s := range []string{
+		fen.Starting,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"r1bqk2r/pppp1ppp/2n2n2/2b5/2B1p3/2N2N2/PPPP1PPP/R1BQK2R b kq - 0 1",
+	} {
+		p, err := fen.From(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := New(&Default)
+		want := e.Position(&p)
+		tr := e.Trace(&p)
+		if tr.Score != want {
+			t.Errorf("%s: trace score %d, want %d", s, tr.Score, want)
+		}
+
+		var mg, eg int
+		for _, ts := range tr.Terms {
+			mg += ts.Total().MG
+			eg += ts.Total().EG
+		}
+		if got := (mg*tr.Phase + eg*(MaxPhase-tr.Phase)) / MaxPhase; got != want {
+			t.Errorf("%s: terms sum to %d, want %d", s, got, want)
+		}
+	}
+}
+
+func TestEndgames(t *testing.T) {
+	e := New(&Default)
+	eval := func(s string) int {
+		p, err := fen.From(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e.Position(&p)
+	}
+
+	// Specialized endgames replace the general evaluation.
+	if got := eval("8/8/8/4k3/8/8/8/R3K3 w - - 0 1"); got < endgame.KnownWin {
+		t.Errorf("KRK: want a known win, got %d", got)
+	}
+	if got := eval("8/8/8/4k3/8/8/8/r3K3 w - - 0 1"); got > -endgame.KnownWin {
+		t.Errorf("KKR: want a known loss, got %d", got)
+	}
+
+	// Scale factors pull drawish endgames towards zero.
+	p, err := fen.From("4k3/5b2/p7/2PP4/8/8/3B4/4K3 w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr := e.Trace(&p); tr.Scale != 16 || tr.Endgame != "opposite bishops" {
+		t.Errorf("opposite bishops: want scale 16, got %d (%q)", tr.Scale, tr.Endgame)
+	}
+	// Only the endgame score is scaled, so the midgame score remains.
+	wrong, right := eval("1k6/8/8/8/P7/P7/8/2B1K3 w - - 0 1"), eval("1k6/8/8/8/P7/P7/8/3BK3 w - - 0 1")
+	if wrong >= 50 || right <= 200 {
+		t.Errorf("wrong bishop scored %d, right bishop %d", wrong, right)
+	}
+}
+
+func TestCoefficients(t *testing.T) {
+	params := Flatten(&Default)
+	for _, s := range []string{
+		fen.Starting,
+		"r1bqk2r/pppp1ppp/2n2n2/2b1p3/2B1P3/2N2N2/PPPP1PPP/R1BQ1RK1 w kq - 6 5",
+		"8/5pk1/6p1/3P4/1p6/1P3qP1/5P1K/4Q3 b - - 0 45",
+		"4k3/8/2p5/1P6/P7/8/8/4K3 w - - 0 1",
+	} {
+		p, err := fen.From(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		coeffs, phase := Coefficients(&p)
+		var mg, eg int
+		for _, c := range coeffs {
+			mg += c.Count * params[c.Index].MG
+			eg += c.Count * params[c.Index].EG
+		}
+		want := New(&Default).Position(&p)
+		if got := (mg*phase + eg*(MaxPhase-phase)) / MaxPhase; got != want {
+			t.Errorf("%s: want %d, got %d", s, want, got)
+		}
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	params := Flatten(&Default)
+	if len(params) != len(ParamNames()) {
+		t.Fatalf("%d parameters, but %d names", len(params), len(ParamNames()))
+	}
+	var w Weights
+	Unflatten(&w, params)
+	if w != Default {
+		t.Error("Unflatten(Flatten(Default)) != Default")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	// The embedded defaults are stored in the format WriteJSON produces.
+	var b bytes.Buffer
+	if err := WriteJSON(&b, &Default); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != string(defaultJSON) {
+		t.Errorf("WriteJSON(Default) doesn't match default.json:\n%s", got)
+	}
+
+	w, err := ReadJSON(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *w != Default {
+		t.Error("ReadJSON(WriteJSON(Default)) != Default")
+	}
+}
+
+func TestReadJSON_Invalid(t *testing.T) {
+	valid := string(defaultJSON)
+	for _, tc := range []struct{ old, new string }{
+		{`"IsolatedPawn": [-8, -12]`, `"IsolatedPawn": [-8]`},
+		{`"IsolatedPawn": [-8, -12]`, `"IsolatedPawn": [[-8, -12]]`},
+		{`"IsolatedPawn": [-8, -12]`, `"IsolatedPawn": [-8, -12], "Extra": [0, 0]`},
+		{`"IsolatedPawn": [-8, -12],`, ``},
+		{`[0, 0], [6, 0]`, `[6, 0]`},
+		{`[0, 0], [6, 0]`, `[0, 0], [6.5, 0]`},
+		{`{`, `[`},
+	} {
+		s := strings.Replace(valid, tc.old, tc.new, 1)
+		if _, err := ReadJSON(strings.NewReader(s)); err == nil {
+			t.Errorf("%q -> %q: want error", tc.old, tc.new)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package hce
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Weights files are JSON objects with one member per field of Weights. A
+// single S is written as a [mg, eg] pair, and an array of S as an array of
+// pairs:
+//
+//	{
+//	  "Material": [[82, 94], [337, 281], [365, 297], [477, 512], [1025, 936], [0, 0]],
+//	  "IsolatedPawn": [-8, -12],
+//	  ...
+//	}
+//
+// Every field must be present with exactly the right shape.
+
+//go:embed default.json
+var defaultJSON []byte
+
+// Default holds the default weights, loaded from the embedded default.json.
+var Default = mustReadJSON(defaultJSON)
+
+func mustReadJSON(b []byte) Weights {
+	w, err := ReadJSON(bytes.NewReader(b))
+	if err != nil {
+		panic(err)
+	}
+	return *w
+}
+
+// ReadJSON reads weights in the JSON weights file format.
+func ReadJSON(r io.Reader) (*Weights, error) {
+	var fields map[string]json.RawMessage
+	d := json.NewDecoder(r)
+	if err := d.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("hce: invalid weights: %w", err)
+	}
+
+	var w Weights
+	v := reflect.ValueOf(&w).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		raw, ok := fields[name]
+		if !ok {
+			return nil, fmt.Errorf("hce: invalid weights: missing %s", name)
+		}
+		delete(fields, name)
+		if err := readValue(v.Field(i), raw); err != nil {
+			return nil, fmt.Errorf("hce: invalid weights: %s: %w", name, err)
+		}
+	}
+	for name := range fields {
+		return nil, fmt.Errorf("hce: invalid weights: unknown field %s", name)
+	}
+	return &w, nil
+}
+
+// readValue decodes raw into v, which is an S or an array of S, checking that
+// its shape matches.
+func readValue(v reflect.Value, raw json.RawMessage) error {
+	if v.Kind() != reflect.Array {
+		var pair []int
+		if err := json.Unmarshal(raw, &pair); err != nil || len(pair) != 2 {
+			return fmt.Errorf("want a [mg, eg] pair, got %s", raw)
+		}
+		v.Set(reflect.ValueOf(S{pair[0], pair[1]}))
+		return nil
+	}
+
+	var elems []json.RawMessage
+	if err := json.Unmarshal(raw, &elems); err != nil {
+		return fmt.Errorf("want an array, got %s", raw)
+	}
+	if len(elems) != v.Len() {
+		return fmt.Errorf("want %d elements, got %d", v.Len(), len(elems))
+	}
+	for i, e := range elems {
+		if err := readValue(v.Index(i), e); err != nil {
+			return fmt.Errorf("element %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes weights in the JSON weights file format, with one field
+// per line.
+func WriteJSON(dst io.Writer, w *Weights) error {
+	var b bytes.Buffer
+	b.WriteString("{\n")
+	v := reflect.ValueOf(w).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		fmt.Fprintf(&b, "  %q: ", v.Type().Field(i).Name)
+		writeValue(&b, v.Field(i))
+		if i < v.NumField()-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("}\n")
+	_, err := dst.Write(b.Bytes())
+	return err
+}
+
+func writeValue(b *bytes.Buffer, v reflect.Value) {
+	if v.Kind() != reflect.Array {
+		s := v.Interface().(S)
+		fmt.Fprintf(b, "[%d, %d]", s.MG, s.EG)
+		return
+	}
+	b.WriteString("[")
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		writeValue(b, v.Index(i))
+	}
+	b.WriteString("]")
+}
@@ -0,0 +1,62 @@
+package hce
+
+import "github.com/clfs/good/chess"
+
+// kingSafety scores the safety of a color's king: the pieces attacking its
+// zone, its pawn shield, enemy pawn storms, and open files nearby.
+func (ev *evaluation) kingSafety(c chess.Color) {
+	them := c.Opposite()
+
+	n := ev.kingAttackers[them]
+	if n >= len(ev.w.KingAttackers) {
+		n = len(ev.w.KingAttackers) - 1
+	}
+	ev.add(them, &ev.w.KingAttackers[n], 1)
+	for r, n := range ev.kingAttacks[them] {
+		ev.add(them, &ev.w.KingAttackWeight[r], n)
+	}
+
+	var (
+		ksq   = ev.p.King(c)
+		us    = ev.p.Board[chess.NewPiece(c, chess.Pawn)]
+		enemy = ev.p.Board[chess.NewPiece(them, chess.Pawn)]
+		// Pawns behind the king don't shield it or storm it.
+		front = forwardRanks(c, ksq.Rank()) | ksq.Rank().Bitboard()
+	)
+
+	// Look at the king's file and its neighbors, shifted inwards on the edge.
+	center := ksq.File()
+	if center == chess.FileA {
+		center = chess.FileB
+	} else if center == chess.FileH {
+		center = chess.FileG
+	}
+	for f := center.Left(); f <= center.Right(); f++ {
+		file := f.Bitboard()
+
+		shield := us & file & front
+		ev.add(c, &ev.w.KingShield[closest(c, shield)], 1)
+
+		storm := enemy & file & front
+		ev.add(c, &ev.w.PawnStorm[closest(c, storm)], 1)
+
+		switch {
+		case (us|enemy)&file == 0:
+			ev.add(c, &ev.w.KingOpenFile, 1)
+		case us&file == 0:
+			ev.add(c, &ev.w.KingSemiOpenFile, 1)
+		}
+	}
+}
+
+// closest returns the relative rank of the pawn in b closest to c's side of
+// the board, or zero if b is empty.
+func closest(c chess.Color, b chess.Bitboard) chess.Rank {
+	if b == 0 {
+		return 0
+	}
+	if c == chess.White {
+		return b.First().Rank()
+	}
+	return b.Last().Rank().Relative(c)
+}
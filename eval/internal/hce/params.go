@@ -0,0 +1,99 @@
+package hce
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/clfs/good/chess"
+)
+
+// Every field of Weights is an S or a (possibly nested) array of S, so the
+// weights can be viewed as a flat list of parameters. The order is the field
+// order, with arrays in index order.
+
+// walk calls fn for every parameter in w, in flattened order.
+func walk(w *Weights, fn func(name string, s *S)) {
+	v := reflect.ValueOf(w).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		walkValue(v.Type().Field(i).Name, v.Field(i), fn)
+	}
+}
+
+func walkValue(name string, v reflect.Value, fn func(name string, s *S)) {
+	switch v.Kind() {
+	case reflect.Struct:
+		fn(name, v.Addr().Interface().(*S))
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walkValue(fmt.Sprintf("%s[%d]", name, i), v.Index(i), fn)
+		}
+	default:
+		panic("hce: unexpected weight type " + v.Type().String())
+	}
+}
+
+// Flatten returns the parameters in w as a flat list.
+func Flatten(w *Weights) []S {
+	var params []S
+	walk(w, func(_ string, s *S) { params = append(params, *s) })
+	return params
+}
+
+// Unflatten sets the parameters in w from a flat list, as returned by
+// Flatten.
+func Unflatten(w *Weights, params []S) {
+	i := 0
+	walk(w, func(_ string, s *S) {
+		*s = params[i]
+		i++
+	})
+}
+
+// ParamNames returns the name of each parameter, in flattened order. For
+// example, "PassedPawn[5]".
+func ParamNames() []string {
+	var names []string
+	walk(&indexWeights, func(name string, _ *S) { names = append(names, name) })
+	return names
+}
+
+var (
+	// indexWeights is only used to identify parameters by address.
+	indexWeights Weights
+	// paramIndex maps the address of each parameter in indexWeights to its
+	// flattened index.
+	paramIndex = map[*S]int{}
+	// paramCount is the number of parameters.
+	paramCount int
+)
+
+func init() {
+	walk(&indexWeights, func(_ string, s *S) {
+		paramIndex[s] = paramCount
+		paramCount++
+	})
+}
+
+// Coefficient is the number of times a parameter is counted in an evaluation,
+// for white minus for black.
+type Coefficient struct {
+	Index int // Index of the parameter, in flattened order.
+	Count int
+}
+
+// Coefficients returns the non-zero coefficients of every parameter when
+// evaluating p, along with the game phase. The evaluation is linear in its
+// parameters: the midgame score is the sum of each coefficient's count times
+// its parameter's midgame value, likewise for the endgame, and the two are
+// blended by phase.
+func Coefficients(p *chess.Position) ([]Coefficient, int) {
+	ev := evaluation{w: &indexWeights, p: p, coeffs: make([]int, paramCount)}
+	ev.run(nil)
+	var coeffs []Coefficient
+	for i, n := range ev.coeffs {
+		if n != 0 {
+			coeffs = append(coeffs, Coefficient{i, n})
+		}
+	}
+	return coeffs, ev.clampedPhase()
+}
@@ -0,0 +1,165 @@
+package hce
+
+import "github.com/clfs/good/chess"
+
+// Masks for pawn structure evaluation, indexed by color and square.
+var (
+	// frontSpan holds the squares in front of a square on the same file.
+	frontSpan [2][64]chess.Bitboard
+	// passedSpan holds the squares in front of a square on the same and
+	// neighboring files. A pawn is passed if no enemy pawns are there.
+	passedSpan [2][64]chess.Bitboard
+	// supportSpan holds the squares beside and behind a square on the
+	// neighboring files, where friendly pawns could support it.
+	supportSpan [2][64]chess.Bitboard
+)
+
+// forwardRanks returns the ranks in front of r, from c's side of the board.
+func forwardRanks(c chess.Color, r chess.Rank) chess.Bitboard {
+	if c == chess.White {
+		return ^chess.Bitboard(0) << (8 * (r + 1))
+	}
+	return ^chess.Bitboard(0) >> (8 * (8 - r))
+}
+
+func init() {
+	for c := chess.White; c <= chess.Black; c++ {
+		for s := chess.A1; s <= chess.H8; s++ {
+			f, r := s.File(), s.Rank()
+			ahead := chess.Bitboard(0)
+			if r.Relative(c) != chess.Rank8 {
+				ahead = forwardRanks(c, r)
+			}
+			frontSpan[c][s] = f.Bitboard() & ahead
+			passedSpan[c][s] = (f.Bitboard() | f.Adjacent()) & ahead
+			supportSpan[c][s] = f.Adjacent() &^ ahead
+		}
+	}
+}
+
+// stopSquare returns the square in front of a pawn of color c on s.
+func stopSquare(c chess.Color, s chess.Square) chess.Square {
+	if c == chess.White {
+		return s + 8
+	}
+	return s - 8
+}
+
+// pawnEntry caches the pawn structure evaluation for one pawn hash.
+type pawnEntry struct {
+	key    uint64
+	score  [2]S
+	passed [2]chess.Bitboard
+}
+
+// pawnTableSize is the number of entries in a pawn table.
+const pawnTableSize = 1 << 13
+
+// pawnTable is a hash table of pawn structure evaluations. Pawn structure
+// changes rarely during search, so most lookups hit.
+type pawnTable [pawnTableSize]pawnEntry
+
+// probe returns the entry for a pawn hash, and whether it holds a result.
+func (t *pawnTable) probe(key uint64) (*pawnEntry, bool) {
+	e := &t[key%pawnTableSize]
+	// Only positions without pawns have the zero key, and they're cheap to
+	// evaluate, so a zero key never hits. This keeps empty entries invalid.
+	return e, e.key == key && key != 0
+}
+
+// pawnStructure scores pawn structure. Terms that depend only on pawns are
+// cached in t, if it's non-nil; passed pawn scores are computed afterwards,
+// since they depend on whether other pieces block the pawns.
+func (ev *evaluation) pawnStructure(t *pawnTable) {
+	if t == nil {
+		for c := chess.White; c <= chess.Black; c++ {
+			ev.pawns(c)
+			ev.passedPawns(c)
+		}
+		return
+	}
+
+	key := ev.p.PawnHash()
+	e, ok := t.probe(key)
+	if !ok {
+		var pawns evaluation
+		pawns.w, pawns.p = ev.w, ev.p
+		for c := chess.White; c <= chess.Black; c++ {
+			pawns.pawns(c)
+		}
+		*e = pawnEntry{key: key, score: pawns.score, passed: pawns.passed}
+	}
+	for c := chess.White; c <= chess.Black; c++ {
+		ev.addScore(c, e.score[c])
+		ev.passed[c] = e.passed[c]
+		ev.passedPawns(c)
+	}
+}
+
+// pawns scores the pawn structure of one color and records its passed pawns.
+func (ev *evaluation) pawns(c chess.Color) {
+	us, them := ev.p.Board[chess.NewPiece(c, chess.Pawn)], ev.p.Board[chess.NewPiece(c.Opposite(), chess.Pawn)]
+
+	b := us
+	for b != 0 {
+		s := b.Pop()
+		f, r := s.File(), s.Rank()
+		rr := r.Relative(c)
+
+		var (
+			neighbors  = us & f.Adjacent()
+			supporters = us & chess.PawnAttacks(c.Opposite(), s)
+			phalanx    = neighbors & r.Bitboard()
+			front      = frontSpan[c][s]
+			blockers   = them & front
+			sentries   = them & passedSpan[c][s] &^ front
+		)
+
+		if us&front != 0 {
+			ev.add(c, &ev.w.DoubledPawn, 1)
+		}
+		if neighbors == 0 {
+			ev.add(c, &ev.w.IsolatedPawn, 1)
+		}
+		if supporters != 0 {
+			ev.add(c, &ev.w.ConnectedPawn[rr], 1)
+		}
+		if phalanx != 0 {
+			ev.add(c, &ev.w.PhalanxPawn[rr], 1)
+		}
+
+		switch {
+		case blockers == 0 && sentries == 0 && us&front == 0:
+			ev.passed[c].Set(s)
+		case blockers == 0:
+			helpers := us & supportSpan[c][s]
+			if helpers.Count() >= sentries.Count() {
+				ev.add(c, &ev.w.CandidatePasser[rr], 1)
+			}
+		}
+
+		// A backward pawn has no friendly pawns beside or behind it on
+		// neighboring files, and its stop square is guarded by an enemy pawn.
+		if neighbors != 0 && us&supportSpan[c][s] == 0 {
+			if chess.PawnAttacks(c, stopSquare(c, s))&them != 0 {
+				ev.add(c, &ev.w.BackwardPawn, 1)
+			}
+		}
+	}
+}
+
+// passedPawns scores a color's passed pawns by rank, and by whether their
+// stop squares are blocked.
+func (ev *evaluation) passedPawns(c chess.Color) {
+	occupied := ev.p.AllPieces()
+	b := ev.passed[c]
+	for b != 0 {
+		s := b.Pop()
+		rr := s.Rank().Relative(c)
+		if occupied.Get(stopSquare(c, s)) {
+			ev.add(c, &ev.w.PassedBlocked[rr], 1)
+		} else {
+			ev.add(c, &ev.w.PassedPawn[rr], 1)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package hce
+
+import "github.com/clfs/good/chess"
+
+// attackMaps computes pawn and king attacks, which the other terms build on.
+// Piece attacks are added as pieces are scored.
+func (ev *evaluation) attackMaps() {
+	for c := chess.White; c <= chess.Black; c++ {
+		pawns := ev.p.Board[chess.NewPiece(c, chess.Pawn)]
+		for pawns != 0 {
+			ev.attacks[c][chess.Pawn] |= chess.PawnAttacks(c, pawns.Pop())
+		}
+		ksq := ev.p.King(c)
+		ev.attacks[c][chess.King] = chess.Targets(chess.NewPiece(c, chess.King), ksq)
+		ev.kingZone[c] = ev.attacks[c][chess.King] | ksq.Bitboard()
+		ev.attacked[c] = ev.attacks[c][chess.Pawn] | ev.attacks[c][chess.King]
+	}
+}
+
+// pieces scores knights, bishops, rooks, and queens by mobility, and records
+// their attacks and any attacks on the enemy king zone.
+func (ev *evaluation) pieces(c chess.Color) {
+	var (
+		them     = c.Opposite()
+		occupied = ev.p.AllPieces()
+		// Squares a piece can move to usefully.
+		available = ^ev.p.Pieces(c) &^ ev.attacks[them][chess.Pawn]
+	)
+
+	for r := chess.Knight; r <= chess.Queen; r++ {
+		b := ev.p.Board[chess.NewPiece(c, r)]
+		for b != 0 {
+			s := b.Pop()
+
+			var attacks chess.Bitboard
+			switch r {
+			case chess.Knight:
+				attacks = chess.Targets(chess.WhiteKnight, s)
+			case chess.Bishop:
+				attacks = chess.BishopAttacks(s, occupied)
+			case chess.Rook:
+				attacks = chess.RookAttacks(s, occupied)
+			case chess.Queen:
+				attacks = chess.QueenAttacks(s, occupied)
+			}
+			ev.attackedTwice[c] |= ev.attacked[c] & attacks
+			ev.attacks[c][r] |= attacks
+			ev.attacked[c] |= attacks
+
+			mobility := attacks & available
+			n := mobility.Count()
+			switch r {
+			case chess.Knight:
+				ev.add(c, &ev.w.KnightMobility[n], 1)
+			case chess.Bishop:
+				ev.add(c, &ev.w.BishopMobility[n], 1)
+			case chess.Rook:
+				ev.add(c, &ev.w.RookMobility[n], 1)
+			case chess.Queen:
+				ev.add(c, &ev.w.QueenMobility[n], 1)
+			}
+
+			if zone := attacks & ev.kingZone[them]; zone != 0 {
+				ev.kingAttackers[c]++
+				ev.kingAttacks[c][r] += zone.Count()
+			}
+		}
+	}
+}
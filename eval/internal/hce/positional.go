@@ -0,0 +1,111 @@
+package hce
+
+import "github.com/clfs/good/chess"
+
+// Masks for positional evaluation, indexed by color.
+var (
+	// outpostRanks holds the ranks a knight or bishop can hold an outpost on.
+	outpostRanks [2]chess.Bitboard
+	// spaceMask holds the central squares on a color's side of the board
+	// that space is measured over.
+	spaceMask [2]chess.Bitboard
+	// homeMinors holds the starting squares of a color's knights and
+	// bishops.
+	homeMinors [2]chess.Bitboard
+)
+
+func init() {
+	center := chess.FileC.Bitboard() | chess.FileD.Bitboard() | chess.FileE.Bitboard() | chess.FileF.Bitboard()
+	for c := chess.White; c <= chess.Black; c++ {
+		outpostRanks[c] = chess.Rank4.Relative(c).Bitboard() | chess.Rank5.Relative(c).Bitboard() |
+			chess.Rank6.Relative(c).Bitboard()
+		spaceMask[c] = center & (chess.Rank2.Relative(c).Bitboard() | chess.Rank3.Relative(c).Bitboard() |
+			chess.Rank4.Relative(c).Bitboard())
+		back := chess.Rank1.Relative(c).Bitboard()
+		homeMinors[c] = back & (chess.FileB.Bitboard() | chess.FileC.Bitboard() |
+			chess.FileF.Bitboard() | chess.FileG.Bitboard())
+	}
+}
+
+// behind returns the squares behind the pawns in b on the same file, from c's
+// side of the board, up to three ranks back.
+func behind(c chess.Color, b chess.Bitboard) chess.Bitboard {
+	if c == chess.White {
+		b |= b >> 8
+		return b | b>>16
+	}
+	b |= b << 8
+	return b | b<<16
+}
+
+// positional scores where a color's pieces stand: outposts, the bishop pair,
+// bishops hemmed in by their own pawns, rooks on open files and the seventh
+// rank, early queen development, and space.
+func (ev *evaluation) positional(c chess.Color) {
+	var (
+		them  = c.Opposite()
+		us    = ev.p.Board[chess.NewPiece(c, chess.Pawn)]
+		enemy = ev.p.Board[chess.NewPiece(them, chess.Pawn)]
+	)
+
+	for r := chess.Knight; r <= chess.Bishop; r++ {
+		b := ev.p.Board[chess.NewPiece(c, r)] & outpostRanks[c]
+		for b != 0 {
+			s := b.Pop()
+			// No enemy pawn can ever attack the square.
+			if enemy&passedSpan[c][s]&^s.File().Bitboard() != 0 {
+				continue
+			}
+			if r == chess.Knight {
+				ev.add(c, &ev.w.KnightOutpost, 1)
+			} else {
+				ev.add(c, &ev.w.BishopOutpost, 1)
+			}
+		}
+	}
+
+	bishops := ev.p.Board[chess.NewPiece(c, chess.Bishop)]
+	if bishops&chess.LightSquares != 0 && bishops&chess.DarkSquares != 0 {
+		ev.add(c, &ev.w.BishopPair, 1)
+	}
+	// Pawns blocked on the same color of square as a bishop.
+	blocked := us & push(them, ev.p.AllPieces())
+	for b := bishops; b != 0; {
+		color := chess.LightSquares
+		if s := b.Pop(); !color.Get(s) {
+			color = chess.DarkSquares
+		}
+		n := blocked & color
+		ev.add(c, &ev.w.BadBishop, n.Count())
+	}
+
+	for b := ev.p.Board[chess.NewPiece(c, chess.Rook)]; b != 0; {
+		s := b.Pop()
+		file := s.File().Bitboard()
+		switch {
+		case (us|enemy)&file == 0:
+			ev.add(c, &ev.w.RookOpenFile, 1)
+		case us&file == 0:
+			ev.add(c, &ev.w.RookSemiOpenFile, 1)
+		}
+		// The seventh rank matters while it holds enemy pawns or cuts the
+		// enemy king off on the eighth.
+		if s.Rank().Relative(c) == chess.Rank7 &&
+			(enemy&s.Rank().Bitboard() != 0 || ev.p.King(them).Rank().Relative(c) == chess.Rank8) {
+			ev.add(c, &ev.w.RookOnSeventh, 1)
+		}
+	}
+
+	// A queen that leaves home before the minor pieces is easily chased.
+	queens := ev.p.Board[chess.NewPiece(c, chess.Queen)]
+	if queens != 0 && queens&chess.Rank1.Relative(c).Bitboard() == 0 {
+		home := homeMinors[c] & (ev.p.Board[chess.NewPiece(c, chess.Knight)] | bishops)
+		ev.add(c, &ev.w.EarlyQueen, home.Count())
+	}
+
+	// Central squares that enemy pawns don't attack, counting those behind
+	// our own pawns twice.
+	space := spaceMask[c] &^ us &^ ev.attacks[them][chess.Pawn]
+	covered := space & behind(c, us)
+	ev.add(c, &ev.w.Space, space.Count()+covered.Count())
+}
@@ -0,0 +1,86 @@
+package hce
+
+import "github.com/clfs/good/chess"
+
+// push returns the squares in front of the pawns in b, from c's side of the
+// board.
+func push(c chess.Color, b chess.Bitboard) chess.Bitboard {
+	if c == chess.White {
+		return b << 8
+	}
+	return b >> 8
+}
+
+// threats scores a color's threats against enemy pieces, and the safe checks
+// it has available. It needs the attack maps of both colors.
+func (ev *evaluation) threats(c chess.Color) {
+	var (
+		them     = c.Opposite()
+		occupied = ev.p.AllPieces()
+		// Enemy knights, bishops, rooks, and queens.
+		targets = ev.p.Pieces(them) &^ ev.p.Board[chess.NewPiece(them, chess.Pawn)] &^
+			ev.p.Board[chess.NewPiece(them, chess.King)]
+		minors = ev.attacks[c][chess.Knight] | ev.attacks[c][chess.Bishop]
+		// Squares a pawn or piece can move to without being captured for free.
+		safe = ^ev.attacked[them] | ev.attacked[c]
+	)
+
+	for r := chess.Knight; r <= chess.Queen; r++ {
+		b := ev.p.Board[chess.NewPiece(them, r)]
+
+		n := b & ev.attacks[c][chess.Pawn]
+		ev.add(c, &ev.w.ThreatByPawn[r], n.Count())
+
+		// Minors attacked by minors only count if they aren't defended by a
+		// pawn. Rooks and queens are always worth more than their attacker.
+		n = b & minors
+		if r <= chess.Bishop {
+			n &^= ev.attacks[them][chess.Pawn]
+		}
+		ev.add(c, &ev.w.ThreatByMinor[r], n.Count())
+	}
+
+	queens := ev.p.Board[chess.NewPiece(them, chess.Queen)] & ev.attacks[c][chess.Rook]
+	ev.add(c, &ev.w.ThreatByRook, queens.Count())
+
+	hanging := targets & ev.attacked[c] &^ ev.attacked[them]
+	ev.add(c, &ev.w.HangingPiece, hanging.Count())
+
+	undefended := targets &^ ev.attacked[them]
+	ev.add(them, &ev.w.UndefendedPiece, undefended.Count())
+
+	// Pawn pushes, including double pushes, to safe squares that would
+	// attack a piece not already attacked by a pawn.
+	pawns := ev.p.Board[chess.NewPiece(c, chess.Pawn)]
+	pushes := push(c, pawns) &^ occupied
+	pushes |= push(c, pushes&chess.Rank3.Relative(c).Bitboard()) &^ occupied
+	pushes &= safe &^ ev.attacks[them][chess.Pawn]
+	var pushAttacks chess.Bitboard
+	for pushes != 0 {
+		pushAttacks |= chess.PawnAttacks(c, pushes.Pop())
+	}
+	n := targets & pushAttacks &^ ev.attacks[c][chess.Pawn]
+	ev.add(c, &ev.w.PawnPushThreat, n.Count())
+
+	// Checking squares that the enemy doesn't attack, or that are defended
+	// more often than the enemy attacks them.
+	var (
+		ksq    = ev.p.King(them)
+		checks = ^ev.p.Pieces(c) & (^ev.attacked[them] | ev.attackedTwice[c]&^ev.attackedTwice[them])
+	)
+	for r := chess.Knight; r <= chess.Queen; r++ {
+		var b chess.Bitboard
+		switch r {
+		case chess.Knight:
+			b = chess.Targets(chess.WhiteKnight, ksq)
+		case chess.Bishop:
+			b = chess.BishopAttacks(ksq, occupied)
+		case chess.Rook:
+			b = chess.RookAttacks(ksq, occupied)
+		case chess.Queen:
+			b = chess.QueenAttacks(ksq, occupied)
+		}
+		b &= ev.attacks[c][r] & checks
+		ev.add(c, &ev.w.SafeCheck[r], b.Count())
+	}
+}
@@ -0,0 +1,108 @@
+package hce
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/eval/internal/endgame"
+)
+
+// term identifies a group of evaluation parameters for tracing.
+type term int
+
+const (
+	termMaterial term = iota
+	termPawns
+	termMobility
+	termKingSafety
+	termThreats
+	termPositional
+	termCount
+)
+
+var termNames = [termCount]string{
+	termMaterial:   "Material",
+	termPawns:      "Pawns",
+	termMobility:   "Mobility",
+	termKingSafety: "King safety",
+	termThreats:    "Threats",
+	termPositional: "Positional",
+}
+
+// TermScore is the score of one evaluation term for each color.
+type TermScore struct {
+	Name         string
+	White, Black S
+}
+
+// Total returns white's score minus black's score.
+func (ts TermScore) Total() S {
+	return S{ts.White.MG - ts.Black.MG, ts.White.EG - ts.Black.EG}
+}
+
+// Trace is a breakdown of an evaluation.
+type Trace struct {
+	Terms []TermScore // In evaluation order.
+	Phase int         // From 0 in the endgame to MaxPhase in the midgame.
+	Scale int         // Endgame scale factor, out of 64.
+
+	// Endgame names the specialized endgame evaluation that applied, if any.
+	// If it replaced the general evaluation, Score comes from it alone.
+	Endgame string
+
+	Score int // The final score, blended by phase.
+}
+
+func newTrace() *Trace {
+	t := &Trace{Terms: make([]TermScore, termCount)}
+	for i := range t.Terms {
+		t.Terms[i].Name = termNames[i]
+	}
+	return t
+}
+
+func (t *Trace) add(tm term, c chess.Color, w S, n int) {
+	s := &t.Terms[tm].White
+	if c == chess.Black {
+		s = &t.Terms[tm].Black
+	}
+	s.MG += w.MG * n
+	s.EG += w.EG * n
+}
+
+// String formats the trace as a table. Scores are in centipawns, and positive
+// values are good for white.
+func (t *Trace) String() string {
+	var b strings.Builder
+	line := "-------------+-------------+-------------+-------------\n"
+	fmt.Fprintf(&b, "%-12s | %11s | %11s | %11s\n", "Term", "White", "Black", "Total")
+	fmt.Fprintf(&b, "%12s | %5s %5s | %5s %5s | %5s %5s\n", "", "MG", "EG", "MG", "EG", "MG", "EG")
+	b.WriteString(line)
+	var total TermScore
+	for _, ts := range t.Terms {
+		writeRow(&b, ts)
+		total.White.MG += ts.White.MG
+		total.White.EG += ts.White.EG
+		total.Black.MG += ts.Black.MG
+		total.Black.EG += ts.Black.EG
+	}
+	b.WriteString(line)
+	total.Name = "Total"
+	writeRow(&b, total)
+	fmt.Fprintf(&b, "\nPhase: %d/%d\n", t.Phase, MaxPhase)
+	if t.Scale != endgame.ScaleNormal {
+		fmt.Fprintf(&b, "Scale: %d/%d\n", t.Scale, endgame.ScaleNormal)
+	}
+	if t.Endgame != "" {
+		fmt.Fprintf(&b, "Endgame: %s\n", t.Endgame)
+	}
+	fmt.Fprintf(&b, "Final evaluation: %+d (white side)\n", t.Score)
+	return b.String()
+}
+
+func writeRow(b *strings.Builder, ts TermScore) {
+	total := ts.Total()
+	fmt.Fprintf(b, "%-12s | %5d %5d | %5d %5d | %5d %5d\n",
+		ts.Name, ts.White.MG, ts.White.EG, ts.Black.MG, ts.Black.EG, total.MG, total.EG)
+}
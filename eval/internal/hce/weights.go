@@ -0,0 +1,57 @@
+package hce
+
+// S is a score with separate midgame and endgame values, measured in
+// centipawns.
+type S struct {
+	MG, EG int
+}
+
+// Weights holds the parameters of the evaluation. Arrays indexed by rank use
+// the rank relative to the side being scored, so index 1 is a pawn's starting
+// rank.
+type Weights struct {
+	Material [6]S // Indexed by role. The king's value is unused.
+
+	PassedPawn      [8]S // Passed pawns whose stop square is free.
+	PassedBlocked   [8]S // Passed pawns whose stop square is occupied.
+	CandidatePasser [8]S // Pawns on half-open files with enough support to become passed.
+	ConnectedPawn   [8]S // Pawns defended by another pawn.
+	PhalanxPawn     [8]S // Pawns with a friendly pawn beside them.
+	IsolatedPawn    S    // Pawns with no friendly pawns on neighboring files.
+	DoubledPawn     S    // Pawns with a friendly pawn in front of them.
+	BackwardPawn    S    // Pawns that can't be supported and can't safely advance.
+
+	// Mobility is indexed by the number of squares a piece can move to,
+	// excluding squares occupied by friendly pieces or attacked by enemy pawns.
+	KnightMobility [9]S
+	BishopMobility [14]S
+	RookMobility   [15]S
+	QueenMobility  [28]S
+
+	KingAttackWeight [6]S // Per king zone square attacked, indexed by the attacker's role.
+	KingAttackers    [8]S // Indexed by the number of pieces attacking the king zone.
+	KingShield       [8]S // Indexed by the rank of the closest friendly pawn in front of the king, per file. Zero means none.
+	PawnStorm        [8]S // Indexed by the rank of the closest enemy pawn in front of the king, per file. Zero means none.
+	KingSemiOpenFile S    // Per file near the king without friendly pawns.
+	KingOpenFile     S    // Per file near the king without any pawns.
+
+	// Threats are indexed by the role of the attacked enemy piece. Values for
+	// pawns and kings are unused.
+	ThreatByPawn    [6]S // Per piece attacked by a pawn.
+	ThreatByMinor   [6]S // Per piece attacked by a knight or bishop. Minors defended by a pawn don't count.
+	ThreatByRook    S    // Per queen attacked by a rook.
+	HangingPiece    S    // Per enemy piece that's attacked and not defended.
+	UndefendedPiece S    // Per piece that isn't defended, whether or not it's attacked.
+	PawnPushThreat  S    // Per piece a safe pawn push would attack.
+	SafeCheck       [6]S // Per safe square a piece could give check from, indexed by its role.
+
+	KnightOutpost    S // Per knight on ranks 4 to 6 that no enemy pawn can attack.
+	BishopOutpost    S // Per bishop on ranks 4 to 6 that no enemy pawn can attack.
+	BishopPair       S // Bishops on both colors of square.
+	BadBishop        S // Per bishop, per friendly blocked pawn on the bishop's color of square.
+	RookOpenFile     S // Per rook on a file without pawns.
+	RookSemiOpenFile S // Per rook on a file without friendly pawns.
+	RookOnSeventh    S // Per rook on the seventh rank, with enemy pawns there or the enemy king on the eighth.
+	EarlyQueen       S // Per knight or bishop still at home after the queen has left the first rank.
+	Space            S // Per central square behind the pawns that enemy pawns don't attack.
+}
@@ -0,0 +1,17 @@
+//go:build ignore
+
+// This program generates kpk.bin. Run it with go generate.
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/clfs/good/eval/internal/kpk"
+)
+
+func main() {
+	if err := os.WriteFile("kpk.bin", kpk.Generate(), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
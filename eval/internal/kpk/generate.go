@@ -0,0 +1,141 @@
+package kpk
+
+import (
+	"github.com/clfs/good/chess"
+)
+
+// Results of positions during generation. Positions start out unknown, unless
+// they're invalid or their result is immediately clear, and are resolved by
+// iterating over their successors until nothing changes.
+const (
+	invalid = 0
+	unknown = 1 << iota
+	draw
+	win
+)
+
+// Generate computes the bitbase by retrograde analysis.
+func Generate() []byte {
+	db := make([]uint8, size)
+	for i := range db {
+		db[i] = initial(decode(i))
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i, r := range db {
+			if r != unknown {
+				continue
+			}
+			if r = classify(db, decode(i)); r != unknown {
+				db[i] = r
+				changed = true
+			}
+		}
+	}
+
+	// Anything still unknown can't be won.
+	b := make([]byte, Size)
+	for i, r := range db {
+		if r == win {
+			b[i/8] |= 1 << (i % 8)
+		}
+	}
+	return b
+}
+
+// entry is a bitbase position: white has a king and a pawn, and black has a
+// king.
+type entry struct {
+	stm          chess.Color
+	wk, bk, pawn chess.Square
+}
+
+// decode is the inverse of index.
+func decode(i int) entry {
+	p := i >> 13
+	return entry{
+		stm:  chess.Color(i & 1),
+		wk:   chess.Square(i >> 1 & 63),
+		bk:   chess.Square(i >> 7 & 63),
+		pawn: chess.NewSquare(chess.File(p/6), chess.Rank(p%6+1)),
+	}
+}
+
+// pushes returns the squares the pawn can be pushed to, ignoring blockers.
+func pushes(s chess.Square) chess.Bitboard {
+	return chess.Targets(chess.WhitePawn, s) &^ chess.PawnAttacks(chess.White, s)
+}
+
+// initial returns the result of a position that's known without looking at
+// its successors.
+func initial(e entry) uint8 {
+	wkTargets := chess.Targets(chess.WhiteKing, e.wk)
+	bkTargets := chess.Targets(chess.BlackKing, e.bk)
+	pawnAttacks := chess.PawnAttacks(chess.White, e.pawn)
+	promotion := e.pawn + 8
+
+	switch {
+	case chess.Distance(e.wk, e.bk) <= 1 || e.wk == e.pawn || e.bk == e.pawn:
+		return invalid
+	case e.stm == chess.White && pawnAttacks.Get(e.bk):
+		// Black can't be in check with white to move.
+		return invalid
+	case e.stm == chess.White && e.pawn.Rank() == chess.Rank7 && e.wk != promotion && e.bk != promotion &&
+		(chess.Distance(e.bk, promotion) > 1 || wkTargets.Get(promotion)):
+		// The pawn promotes safely.
+		return win
+	case e.stm == chess.Black && bkTargets&^(wkTargets|pawnAttacks) == 0:
+		// Black has no moves. This is stalemate, unless black is in check,
+		// which a pawn can't mate alone.
+		return draw
+	case e.stm == chess.Black && bkTargets&^wkTargets&e.pawn.Bitboard() != 0:
+		// Black captures the undefended pawn.
+		return draw
+	default:
+		return unknown
+	}
+}
+
+// classify returns the result of a position from the results of its
+// successors. White wins if any move wins; black draws if any move draws.
+func classify(db []uint8, e entry) uint8 {
+	var r uint8
+	if e.stm == chess.White {
+		b := chess.Targets(chess.WhiteKing, e.wk) &^ chess.Targets(chess.BlackKing, e.bk)
+		for b != 0 {
+			r |= db[index(chess.Black, b.Pop(), e.bk, e.pawn)]
+		}
+		if e.pawn.Rank() < chess.Rank7 {
+			// Pushing onto a king leads to an invalid position, which
+			// contributes nothing.
+			b := pushes(e.pawn)
+			single := e.pawn + 8
+			for b != 0 {
+				to := b.Pop()
+				if to != single && (single == e.wk || single == e.bk) {
+					continue // The double push is blocked.
+				}
+				r |= db[index(chess.Black, e.wk, e.bk, to)]
+			}
+		}
+	} else {
+		b := chess.Targets(chess.BlackKing, e.bk) &^ chess.Targets(chess.WhiteKing, e.wk)
+		for b != 0 {
+			r |= db[index(chess.White, e.wk, b.Pop(), e.pawn)]
+		}
+	}
+
+	good, bad := uint8(win), uint8(draw)
+	if e.stm == chess.Black {
+		good, bad = draw, win
+	}
+	switch {
+	case r&good != 0:
+		return good
+	case r&unknown != 0:
+		return unknown
+	default:
+		return bad
+	}
+}
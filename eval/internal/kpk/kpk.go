@@ -0,0 +1,76 @@
+// Package kpk holds a bitbase of king and pawn versus king endgames.
+//
+// The bitbase records whether the side with the pawn wins every KPK position,
+// assuming best play. It's computed by Generate with retrograde analysis and
+// embedded as kpk.bin, one bit per position. Positions are stored with the
+// pawn white and on files A to D; other positions are mirrored to match.
+package kpk
+
+import (
+	_ "embed"
+	"fmt"
+
+	"github.com/clfs/good/chess"
+)
+
+//go:generate go run gen.go
+
+//go:embed kpk.bin
+var bitbase []byte
+
+// Size is the size of the bitbase in bytes.
+const Size = size / 8
+
+// size is the number of positions: two sides to move, 64 squares for each
+// king, and 24 pawn squares on files A to D and ranks 2 to 7.
+const size = 2 * 64 * 64 * 24
+
+func init() {
+	if len(bitbase) != Size {
+		panic(fmt.Sprintf("kpk: bitbase has %d bytes, want %d", len(bitbase), Size))
+	}
+}
+
+// index returns the bitbase index of a position with a white pawn on files A
+// to D. The pawn can't be on the first or last rank.
+func index(stm chess.Color, wk, bk, pawn chess.Square) int {
+	p := int(pawn.File())*6 + int(pawn.Rank()) - 1
+	return int(stm) | int(wk)<<1 | int(bk)<<7 | p<<13
+}
+
+// Probe reports whether the side with the pawn wins p. If p isn't a KPK
+// position, ok is false.
+func Probe(p *chess.Position) (win, ok bool) {
+	var strong chess.Color
+	switch p.MaterialKey() {
+	case whiteKPK:
+		strong = chess.White
+	case blackKPK:
+		strong = chess.Black
+	default:
+		return false, false
+	}
+	weak := strong.Opposite()
+	wk, bk := p.King(strong), p.King(weak)
+	pawn := p.Board[chess.NewPiece(strong, chess.Pawn)].First()
+	stm := p.SideToMove
+	if strong == chess.Black {
+		// Flip the board so the pawn is white.
+		wk, bk, pawn, stm = wk^56, bk^56, pawn^56, stm.Opposite()
+	}
+	return probe(stm, wk, bk, pawn), true
+}
+
+// probe reports whether white wins a position with a white pawn.
+func probe(stm chess.Color, wk, bk, pawn chess.Square) bool {
+	if pawn.File() > chess.FileD {
+		wk, bk, pawn = wk^7, bk^7, pawn^7
+	}
+	i := index(stm, wk, bk, pawn)
+	return bitbase[i/8]>>(i%8)&1 == 1
+}
+
+var (
+	whiteKPK = chess.NewMaterialKey([12]int{chess.WhitePawn: 1, chess.WhiteKing: 1, chess.BlackKing: 1})
+	blackKPK = whiteKPK.Flip()
+)
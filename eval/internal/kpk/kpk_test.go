@@ -0,0 +1,106 @@
+package kpk
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/fen"
+)
+
+func TestEmbedded(t *testing.T) {
+	if !bytes.Equal(Generate(), bitbase) {
+		t.Error("kpk.bin is out of date; run go generate")
+	}
+}
+
+func TestProbe(t *testing.T) {
+	cases := []struct {
+		fen string
+		win bool
+	}{
+		// The king on the sixth rank in front of its pawn wins.
+		{"4k3/8/4K3/4P3/8/8/8/8 b - - 0 1", true},
+		{"4k3/8/4K3/4P3/8/8/8/8 w - - 0 1", true},
+		// Otherwise, the opposition decides.
+		{"8/4k3/8/4K3/4P3/8/8/8 b - - 0 1", true},
+		{"8/4k3/8/4K3/4P3/8/8/8 w - - 0 1", false},
+		// A rook pawn can't be won against a king in the corner.
+		{"k7/8/1K6/P7/8/8/8/8 w - - 0 1", false},
+		// The pawn outruns the king.
+		{"8/8/8/8/6P1/8/k7/7K w - - 0 1", true},
+		{"8/8/4k3/8/6P1/8/8/K7 b - - 0 1", false},
+		// Black is stalemated.
+		{"k7/P7/1K6/8/8/8/8/8 b - - 0 1", false},
+		// The same positions with colors swapped.
+		{"8/8/8/4p3/4k3/8/4K3/8 w - - 0 1", true},
+		{"8/8/8/4p3/4k3/8/4K3/8 b - - 0 1", false},
+		{"8/8/8/8/p7/1k6/8/K7 b - - 0 1", false},
+		// Pawns on other files.
+		{"3k4/8/3K4/3P4/8/8/8/8 b - - 0 1", true},
+		{"7k/8/6K1/7P/8/8/8/8 w - - 0 1", false},
+	}
+	for _, tc := range cases {
+		p, err := fen.From(tc.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		win, ok := Probe(&p)
+		if !ok {
+			t.Errorf("%s: not a KPK position", tc.fen)
+			continue
+		}
+		if win != tc.win {
+			t.Errorf("%s: want win %t, got %t", tc.fen, tc.win, win)
+		}
+	}
+
+	p := chess.NewPosition()
+	if _, ok := Probe(&p); ok {
+		t.Error("starting position: want not ok")
+	}
+}
+
+// TestConsistent checks the bitbase against legal move generation: white wins
+// if some move wins, and black loses if every move loses.
+func TestConsistent(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	for i := 0; i < size; i++ {
+		e := decode(i)
+		if initial(e) == invalid || e.pawn.Rank() == chess.Rank7 {
+			// Promotions lead out of the bitbase.
+			continue
+		}
+		var p chess.Position
+		p.Put(chess.WhiteKing, e.wk)
+		p.Put(chess.BlackKing, e.bk)
+		p.Put(chess.WhitePawn, e.pawn)
+		p.SideToMove = e.stm
+		p.EnPassantRight = chess.NoEnPassantRight
+
+		want := e.stm == chess.Black
+		moves := p.LegalMoves()
+		if len(moves) == 0 {
+			want = false
+		}
+		for _, m := range moves {
+			q := p
+			q.Make(m)
+			win, ok := Probe(&q)
+			if !ok {
+				win = false // The pawn was captured.
+			}
+			if e.stm == chess.White && win {
+				want = true
+			}
+			if e.stm == chess.Black && !win {
+				want = false
+			}
+		}
+		if got := probe(e.stm, e.wk, e.bk, e.pawn); got != want {
+			t.Errorf("%s: want win %t, got %t", fen.To(p), want, got)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package nnue
+
+import "github.com/clfs/good/chess"
+
+// accumulator holds the feature transformer output for both perspectives,
+// indexed by color.
+type accumulator struct {
+	v [2][]int16
+}
+
+func (a *accumulator) init(hidden int) {
+	a.v[chess.White] = make([]int16, hidden)
+	a.v[chess.Black] = make([]int16, hidden)
+}
+
+// copyFrom copies the values of another accumulator.
+func (a *accumulator) copyFrom(b *accumulator) {
+	copy(a.v[chess.White], b.v[chess.White])
+	copy(a.v[chess.Black], b.v[chess.Black])
+}
+
+// Stack is a stack of accumulators that follows a line of play, so that
+// positions can be evaluated without recomputing the feature transformer.
+//
+// Each Push updates the new top incrementally from the pieces that the move
+// adds and removes. Only the perspective of a side whose king moves is
+// refreshed from scratch, since every one of its features depends on the king
+// square.
+//
+// A Stack isn't safe for concurrent use; each search thread needs its own.
+type Stack struct {
+	net *Network
+	acc []accumulator
+	top int
+	buf *buffers
+}
+
+// NewStack returns a new stack for a network. Reset must be called before the
+// stack is used.
+func NewStack(net *Network) *Stack {
+	s := &Stack{net: net, buf: net.newBuffers()}
+	s.grow()
+	return s
+}
+
+// grow adds an accumulator to the stack's backing storage.
+func (s *Stack) grow() {
+	var a accumulator
+	a.init(s.net.Hidden)
+	s.acc = append(s.acc, a)
+}
+
+// Reset empties the stack and refreshes its bottom accumulator from p.
+func (s *Stack) Reset(p *chess.Position) {
+	s.top = 0
+	s.net.refresh(&s.acc[0], p, chess.White)
+	s.net.refresh(&s.acc[0], p, chess.Black)
+}
+
+// Push pushes the accumulator for the position reached by making m in p. The
+// position p must match the current top of the stack, and must be the
+// position before m is made.
+func (s *Stack) Push(p *chess.Position, m chess.Move) {
+	if s.top+1 == len(s.acc) {
+		s.grow()
+	}
+	prev, next := &s.acc[s.top], &s.acc[s.top+1]
+	s.top++
+
+	from, to := m.From(), m.To()
+	pc, _ := p.Get(from)
+
+	if pc.Role() == chess.King {
+		// The mover's perspective needs a refresh, and the other perspective
+		// only sees captures and castling rook moves.
+		q := *p
+		q.Make(m)
+		s.net.refresh(next, &q, pc.Color())
+
+		other := pc.Color().Opposite()
+		copy(next.v[other], prev.v[other])
+		ksq := p.King(other)
+		if captured, ok := p.Get(to); ok {
+			s.net.sub(next.v[other], feature(other, ksq, captured, to))
+		}
+		if rookFrom, rookTo, ok := chess.CastleRookSquares(to); ok && p.IsCastle(m) {
+			rook := chess.NewPiece(pc.Color(), chess.Rook)
+			s.net.sub(next.v[other], feature(other, ksq, rook, rookFrom))
+			s.net.add(next.v[other], feature(other, ksq, rook, rookTo))
+		}
+		return
+	}
+
+	next.copyFrom(prev)
+
+	added := pc
+	if promotion, ok := m.Promotion(); ok {
+		added = promotion
+	}
+	captured, capturedOK := p.Get(to)
+	capturedSquare := to
+	if p.IsEnPassant(m) {
+		captured, capturedOK = chess.NewPiece(pc.Color().Opposite(), chess.Pawn), true
+		if pc.Color() == chess.White {
+			capturedSquare = to - 8
+		} else {
+			capturedSquare = to + 8
+		}
+	}
+
+	for c := chess.White; c <= chess.Black; c++ {
+		v, ksq := next.v[c], p.King(c)
+		s.net.sub(v, feature(c, ksq, pc, from))
+		s.net.add(v, feature(c, ksq, added, to))
+		if capturedOK {
+			s.net.sub(v, feature(c, ksq, captured, capturedSquare))
+		}
+	}
+}
+
+// Pop pops the top accumulator, returning to the position before the last
+// pushed move.
+func (s *Stack) Pop() {
+	s.top--
+}
+
+// Evaluate returns the value of the position at the top of the stack. Only
+// the side to move of p is used. Positive values are good for white, and
+// negative values are good for black.
+func (s *Stack) Evaluate(p *chess.Position) int {
+	return s.net.propagate(&s.acc[s.top], p.SideToMove, s.buf)
+}
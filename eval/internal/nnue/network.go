@@ -0,0 +1,287 @@
+package nnue
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/clfs/good/chess"
+)
+
+// FeatureCount is the number of HalfKP input features per perspective: one for
+// each combination of king square, non-king piece, and piece square.
+const FeatureCount = 64 * 10 * 64
+
+// Quantization scales. A float network is quantized by multiplying feature
+// transformer parameters by ActivationScale, hidden layer weights by
+// WeightScale, and hidden layer biases by ActivationScale*WeightScale.
+const (
+	ActivationScale = 127 // A clipped activation of 1.0 is represented as 127.
+	WeightScale     = 64
+	OutputScale     = 400 // Centipawns per unit of float network output.
+)
+
+// magic identifies network files.
+const magic = "GOODNNUE"
+
+// version is the current network file version.
+const version = 1
+
+// Network is a quantized HalfKP network.
+//
+// The feature transformer maps each perspective's active features to a hidden
+// vector of size Hidden. The two vectors, side to move first, are clipped and
+// concatenated, then passed through two clipped hidden layers of sizes L1 and
+// L2, and finally a single output neuron.
+type Network struct {
+	Hidden, L1, L2 int
+
+	FTWeights  []int16 // FeatureCount rows of Hidden weights.
+	FTBiases   []int16 // Hidden biases.
+	L1Weights  []int8  // L1 rows of 2*Hidden weights.
+	L1Biases   []int32 // L1 biases.
+	L2Weights  []int8  // L2 rows of L1 weights.
+	L2Biases   []int32 // L2 biases.
+	OutWeights []int8  // L2 weights.
+	OutBias    int32
+}
+
+// NewNetwork returns a new network with the given layer sizes and all
+// parameters set to zero.
+func NewNetwork(hidden, l1, l2 int) *Network {
+	return &Network{
+		Hidden:     hidden,
+		L1:         l1,
+		L2:         l2,
+		FTWeights:  make([]int16, FeatureCount*hidden),
+		FTBiases:   make([]int16, hidden),
+		L1Weights:  make([]int8, l1*2*hidden),
+		L1Biases:   make([]int32, l1),
+		L2Weights:  make([]int8, l2*l1),
+		L2Biases:   make([]int32, l2),
+		OutWeights: make([]int8, l2),
+	}
+}
+
+// header is the fixed-size header of a network file.
+type header struct {
+	Magic          [8]byte
+	Version        uint32
+	Features       uint32
+	Hidden, L1, L2 uint32
+}
+
+// Load reads a network in the format written by WriteTo.
+func Load(r io.Reader) (*Network, error) {
+	br := bufio.NewReader(r)
+
+	var h header
+	if err := binary.Read(br, binary.LittleEndian, &h); err != nil {
+		return nil, fmt.Errorf("nnue: reading header: %w", err)
+	}
+	if string(h.Magic[:]) != magic {
+		return nil, errors.New("nnue: not a network file")
+	}
+	if h.Version != version {
+		return nil, fmt.Errorf("nnue: unsupported version: %d", h.Version)
+	}
+	if h.Features != FeatureCount {
+		return nil, fmt.Errorf("nnue: unsupported feature count: %d", h.Features)
+	}
+	if h.Hidden == 0 || h.Hidden > 4096 || h.L1 == 0 || h.L1 > 4096 || h.L2 == 0 || h.L2 > 4096 {
+		return nil, fmt.Errorf("nnue: invalid layer sizes: %d, %d, %d", h.Hidden, h.L1, h.L2)
+	}
+
+	n := NewNetwork(int(h.Hidden), int(h.L1), int(h.L2))
+	for _, data := range n.parameters() {
+		if err := binary.Read(br, binary.LittleEndian, data); err != nil {
+			return nil, fmt.Errorf("nnue: reading parameters: %w", err)
+		}
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		return nil, errors.New("nnue: trailing data after parameters")
+	}
+	return n, nil
+}
+
+// WriteTo writes the network to w.
+func (n *Network) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	h := header{
+		Version:  version,
+		Features: FeatureCount,
+		Hidden:   uint32(n.Hidden),
+		L1:       uint32(n.L1),
+		L2:       uint32(n.L2),
+	}
+	copy(h.Magic[:], magic)
+	if err := binary.Write(bw, binary.LittleEndian, h); err != nil {
+		return cw.n, err
+	}
+	for _, data := range n.parameters() {
+		if err := binary.Write(bw, binary.LittleEndian, data); err != nil {
+			return cw.n, err
+		}
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// countingWriter counts the bytes written to an underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// parameters returns pointers to all parameters, in file order.
+func (n *Network) parameters() []any {
+	return []any{
+		n.FTBiases, n.FTWeights,
+		n.L1Biases, n.L1Weights,
+		n.L2Biases, n.L2Weights,
+		&n.OutBias, n.OutWeights,
+	}
+}
+
+// Evaluate returns the value of a position by refreshing both perspectives
+// from scratch. Positive values are good for white, and negative values are
+// good for black.
+func (n *Network) Evaluate(p *chess.Position) int {
+	var a accumulator
+	a.init(n.Hidden)
+	n.refresh(&a, p, chess.White)
+	n.refresh(&a, p, chess.Black)
+	return n.propagate(&a, p.SideToMove, n.newBuffers())
+}
+
+// feature returns the HalfKP feature index for a non-king piece on a square,
+// as seen from a perspective whose king is on ksq.
+//
+// Squares are flipped vertically for black, so both perspectives see their own
+// pieces moving up the board.
+func feature(perspective chess.Color, ksq chess.Square, pc chess.Piece, s chess.Square) int {
+	if perspective == chess.Black {
+		ksq ^= 56
+		s ^= 56
+	}
+	rel := int(pc.Role()) * 2
+	if pc.Color() != perspective {
+		rel++
+	}
+	return int(ksq)*640 + rel*64 + int(s)
+}
+
+// Features appends the active features of a position from a perspective to
+// dst and returns the extended slice.
+func Features(dst []int, p *chess.Position, perspective chess.Color) []int {
+	ksq := p.King(perspective)
+	for pc := chess.WhitePawn; pc <= chess.BlackKing; pc++ {
+		if pc.Role() == chess.King {
+			continue
+		}
+		b := p.Board[pc]
+		for b != 0 {
+			dst = append(dst, feature(perspective, ksq, pc, b.Pop()))
+		}
+	}
+	return dst
+}
+
+// refresh recomputes one perspective of an accumulator from scratch.
+func (n *Network) refresh(a *accumulator, p *chess.Position, perspective chess.Color) {
+	v := a.v[perspective]
+	copy(v, n.FTBiases)
+	var buf [32]int
+	for _, f := range Features(buf[:0], p, perspective) {
+		n.add(v, f)
+	}
+}
+
+// add adds a feature's weights to an accumulator perspective.
+func (n *Network) add(v []int16, f int) {
+	w := n.FTWeights[f*n.Hidden : (f+1)*n.Hidden]
+	for i := range v {
+		v[i] += w[i]
+	}
+}
+
+// sub subtracts a feature's weights from an accumulator perspective.
+func (n *Network) sub(v []int16, f int) {
+	w := n.FTWeights[f*n.Hidden : (f+1)*n.Hidden]
+	for i := range v {
+		v[i] -= w[i]
+	}
+}
+
+// buffers holds the activations of the layers after the feature
+// transformer, so they aren't allocated for every evaluation.
+type buffers struct {
+	input, l1, l2 []int32
+}
+
+// newBuffers returns buffers sized for the network.
+func (n *Network) newBuffers() *buffers {
+	return &buffers{
+		input: make([]int32, 2*n.Hidden),
+		l1:    make([]int32, n.L1),
+		l2:    make([]int32, n.L2),
+	}
+}
+
+// propagate runs the layers after the feature transformer, using b for the
+// activations, and returns the value of the position for white.
+func (n *Network) propagate(a *accumulator, stm chess.Color, b *buffers) int {
+	for i, x := range a.v[stm] {
+		b.input[i] = clip(int32(x))
+	}
+	for i, x := range a.v[stm.Opposite()] {
+		b.input[n.Hidden+i] = clip(int32(x))
+	}
+
+	layer(b.l1, b.input, n.L1Weights, n.L1Biases)
+	layer(b.l2, b.l1, n.L2Weights, n.L2Biases)
+
+	out := n.OutBias
+	for i, x := range b.l2 {
+		out += int32(n.OutWeights[i]) * x
+	}
+
+	score := int(out) * OutputScale / (ActivationScale * WeightScale)
+	if stm == chess.Black {
+		score = -score
+	}
+	return score
+}
+
+// layer computes a clipped fully connected layer into out, which has one
+// element per bias.
+func layer(out, input []int32, weights []int8, biases []int32) {
+	for i := range out {
+		row := weights[i*len(input) : (i+1)*len(input)]
+		sum := biases[i]
+		for j, x := range input {
+			sum += int32(row[j]) * x
+		}
+		out[i] = clip(sum / WeightScale)
+	}
+}
+
+// clip clamps an activation to [0, ActivationScale].
+func clip(x int32) int32 {
+	if x < 0 {
+		return 0
+	}
+	if x > ActivationScale {
+		return ActivationScale
+	}
+	return x
+}
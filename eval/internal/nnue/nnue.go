@@ -1,12 +1,38 @@
 // Package nnue implements an NNUE positional evaluation function.
+//
+// Networks use HalfKP features: each non-king piece contributes one feature
+// per perspective, keyed by that perspective's king square. During search,
+// a Stack keeps the feature transformer up to date incrementally, which is far
+// cheaper than calling Position at every node.
 package nnue
 
 import (
+	"sync/atomic"
+
 	"github.com/clfs/good/chess"
 )
 
-// Position returns the value of a position. Positive values are good for white,
-// and negative values are good for black.
+// def holds the *Network used by Position and by stacks created for the
+// default network.
+var def atomic.Value
+
+// Default returns the default network, or nil if none has been set.
+func Default() *Network {
+	n, _ := def.Load().(*Network)
+	return n
+}
+
+// SetDefault replaces the default network. It's safe to call during a
+// search: stacks created before the call keep their network, and n must not
+// be modified afterwards.
+func SetDefault(n *Network) {
+	def.Store(n)
+}
+
+// Position returns the value of a position with the default network.
+// Positive values are good for white, and negative values are good for black.
+//
+// Position panics if no default network has been set.
 func Position(p chess.Position) int {
-	panic("not implemented")
+	return Default().Evaluate(&p)
 }
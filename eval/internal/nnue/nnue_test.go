@@ -0,0 +1,132 @@
+package nnue
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/fen"
+	"github.com/google/go-cmp/cmp"
+)
+
+// randomNetwork returns a small network with random parameters.
+func randomNetwork(r *rand.Rand) *Network {
+	n := NewNetwork(16, 8, 8)
+	for i := range n.FTWeights {
+		n.FTWeights[i] = int16(r.Intn(64) - 32)
+	}
+	for i := range n.FTBiases {
+		n.FTBiases[i] = int16(r.Intn(64) - 32)
+	}
+	for _, w := range [][]int8{n.L1Weights, n.L2Weights, n.OutWeights} {
+		for i := range w {
+			w[i] = int8(r.Intn(128) - 64)
+		}
+	}
+	for _, b := range [][]int32{n.L1Biases, n.L2Biases} {
+		for i := range b {
+			b[i] = int32(r.Intn(4096) - 2048)
+		}
+	}
+	n.OutBias = int32(r.Intn(4096) - 2048)
+	return n
+}
+
+func TestStack(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	net := randomNetwork(r)
+
+	fens := []string{
+		fen.Starting,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+	}
+	for _, f := range fens {
+		root, err := fen.From(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := NewStack(net)
+		s.Reset(&root)
+
+		for game := 0; game < 20; game++ {
+			// Play random moves, then unwind, checking both directions.
+			line := []chess.Position{root}
+			for ply := 0; ply < 40; ply++ {
+				p := line[len(line)-1]
+				moves := p.LegalMoves()
+				if len(moves) == 0 {
+					break
+				}
+				m := moves[r.Intn(len(moves))]
+				s.Push(&p, m)
+				p.Make(m)
+				line = append(line, p)
+				checkTop(t, s, &p)
+			}
+			for len(line) > 1 {
+				s.Pop()
+				line = line[:len(line)-1]
+				checkTop(t, s, &line[len(line)-1])
+			}
+		}
+	}
+}
+
+func TestStack_EvaluateAllocs(t *testing.T) {
+	s := NewStack(randomNetwork(rand.New(rand.NewSource(1))))
+	p := chess.NewPosition()
+	s.Reset(&p)
+	if n := testing.AllocsPerRun(100, func() { s.Evaluate(&p) }); n != 0 {
+		t.Errorf("want no allocations, got %v", n)
+	}
+}
+
+func TestSetDefault(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	a, b := randomNetwork(r), randomNetwork(r)
+	p := chess.NewPosition()
+
+	SetDefault(a)
+	s := NewStack(Default())
+	s.Reset(&p)
+	SetDefault(b)
+	if want, got := b.Evaluate(&p), Position(p); want != got {
+		t.Errorf("Position: want %d, got %d", want, got)
+	}
+	if want, got := a.Evaluate(&p), s.Evaluate(&p); want != got {
+		t.Errorf("Stack.Evaluate: want %d, got %d", want, got)
+	}
+}
+
+// checkTop checks that the top of a stack matches a full refresh of p.
+func checkTop(t *testing.T, s *Stack, p *chess.Position) {
+	t.Helper()
+	var want accumulator
+	want.init(s.net.Hidden)
+	s.net.refresh(&want, p, chess.White)
+	s.net.refresh(&want, p, chess.Black)
+	if diff := cmp.Diff(want.v, s.acc[s.top].v); diff != "" {
+		t.Fatalf("%s: accumulator mismatch (-want +got)\n%s", fen.To(*p), diff)
+	}
+	if want, got := s.net.Evaluate(p), s.Evaluate(p); want != got {
+		t.Fatalf("%s: want %d, got %d", fen.To(*p), want, got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	want := randomNetwork(rand.New(rand.NewSource(2)))
+	var buf bytes.Buffer
+	if _, err := want.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("(-want +got)\n%s", diff)
+	}
+}
@@ -20,9 +20,13 @@ var PieceValues = map[chess.Piece]int{
 	chess.BlackQueen:  -900,
 }
 
-// Position returns the value of a position.
+// Position returns the value of a position. Positions without enough
+// material to mate are drawn.
 func Position(p chess.Position) int {
 	// TODO: Account for checkmate.
+	if p.IsInsufficientMaterial() {
+		return 0
+	}
 	var score int
 	for s := chess.A1; s <= chess.H8; s++ {
 		pc, ok := p.Get(s)
@@ -0,0 +1,158 @@
+package eval
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/eval/internal/nnue"
+	"github.com/clfs/good/eval/internal/refeval"
+	"github.com/clfs/good/fen"
+)
+
+// symmetryEvaluators lists the evaluators checked by TestSymmetry. Every
+// evaluation function should be added here.
+var symmetryEvaluators = []struct {
+	name string
+	fn   func(chess.Position) int
+
+	// files is set if mirroring the files of a position shouldn't change its
+	// score. NNUE networks learn their own, slightly asymmetric, weights.
+	files bool
+}{
+	{"refeval", refeval.Position, true},
+	{"hce", Position, true},
+	{"nnue", randomNetwork(rand.New(rand.NewSource(1))).evaluate, false},
+}
+
+// randomNetwork returns a small NNUE network with random parameters. A random
+// network is as symmetric as a trained one, if the implementation is right.
+func randomNetwork(r *rand.Rand) network {
+	n := nnue.NewNetwork(16, 8, 8)
+	for i := range n.FTWeights {
+		n.FTWeights[i] = int16(r.Intn(64) - 32)
+	}
+	for i := range n.FTBiases {
+		n.FTBiases[i] = int16(r.Intn(64) - 32)
+	}
+	for _, w := range [][]int8{n.L1Weights, n.L2Weights, n.OutWeights} {
+		for i := range w {
+			w[i] = int8(r.Intn(128) - 64)
+		}
+	}
+	for _, b := range [][]int32{n.L1Biases, n.L2Biases} {
+		for i := range b {
+			b[i] = int32(r.Intn(4096) - 2048)
+		}
+	}
+	n.OutBias = int32(r.Intn(4096) - 2048)
+	return network{n}
+}
+
+type network struct{ *nnue.Network }
+
+func (n network) evaluate(p chess.Position) int {
+	return n.Evaluate(&p)
+}
+
+// readEPD reads the positions of an EPD file, along with their ids. Blank
+// lines and lines starting with # are skipped.
+func readEPD(t *testing.T, name string) (positions []chess.Position, ids []string) {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			t.Fatalf("%s:%d: too few fields", name, n)
+		}
+		p, err := fen.From(strings.Join(fields[:4], " ") + " 0 1")
+		if err != nil {
+			t.Fatalf("%s:%d: %v", name, n, err)
+		}
+		id := fmt.Sprintf("%s:%d", name, n)
+		if i := strings.Index(line, `id "`); i >= 0 {
+			id = strings.SplitN(line[i+4:], `"`, 2)[0]
+		}
+		positions = append(positions, p)
+		ids = append(ids, id)
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return positions, ids
+}
+
+// TestSymmetry checks that every evaluator scores positions the same way for
+// both colors: flipping the colors of a position negates its score. When the
+// hand-crafted evaluation fails, the terms that differ are reported.
+func TestSymmetry(t *testing.T) {
+	positions, ids := readEPD(t, "testdata/symmetry.epd")
+	for _, e := range symmetryEvaluators {
+		t.Run(e.name, func(t *testing.T) {
+			for i, p := range positions {
+				q := p
+				q.FlipColors()
+				if a, b := e.fn(p), e.fn(q); a != -b {
+					t.Errorf("%s: %s: got %d, and %d with the colors flipped", ids[i], fen.To(p), a, b)
+					if e.name == "hce" {
+						reportAsymmetry(t, p, q)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestSymmetry_MirrorFiles checks that mirroring a position without castling
+// rights horizontally doesn't change its score, for the evaluators that should
+// be symmetric that way.
+func TestSymmetry_MirrorFiles(t *testing.T) {
+	positions, ids := readEPD(t, "testdata/symmetry.epd")
+	for _, e := range symmetryEvaluators {
+		if !e.files {
+			continue
+		}
+		t.Run(e.name, func(t *testing.T) {
+			for i, p := range positions {
+				if p.CastleRights != chess.NoCastleRights {
+					continue
+				}
+				q := p
+				q.MirrorFiles()
+				if a, b := e.fn(p), e.fn(q); a != b {
+					t.Errorf("%s: %s: got %d, and %d mirrored", ids[i], fen.To(p), a, b)
+				}
+			}
+		})
+	}
+}
+
+// reportAsymmetry logs the terms of the hand-crafted evaluation that differ
+// between a position and the position with the colors flipped.
+func reportAsymmetry(t *testing.T, p, flipped chess.Position) {
+	t.Helper()
+	a, b := Trace(p), Trace(flipped)
+	for i := range a.Terms {
+		x, y := a.Terms[i], b.Terms[i]
+		if x.White != y.Black || x.Black != y.White {
+			t.Logf("\t%s: white %v, black %v; flipped: white %v, black %v", x.Name, x.White, x.Black, y.White, y.Black)
+		}
+	}
+	if a.Phase != b.Phase || a.Scale != b.Scale || a.Endgame != b.Endgame {
+		t.Logf("\tphase %d, scale %d, endgame %q; flipped: phase %d, scale %d, endgame %q",
+			a.Phase, a.Scale, a.Endgame, b.Phase, b.Scale, b.Endgame)
+	}
+}
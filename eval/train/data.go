@@ -0,0 +1,100 @@
+package train
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/eval/internal/nnue"
+	"github.com/clfs/good/fen"
+)
+
+// A sample is a training position, seen from the side to move.
+type sample struct {
+	features [2][]uint16 // Active features for the side to move, then the other side.
+	score    float32     // Evaluation in centipawns, from the side to move's perspective.
+	result   float32     // Game result: 1 for a win, 0.5 for a draw, 0 for a loss.
+}
+
+// readSamples reads training samples from r, one per line, in the format
+//
+//	<fen> | <score> | <result>
+//
+// where score is an evaluation in centipawns from white's perspective, and
+// result is the game result from white's perspective, either as a number
+// (1, 0.5, 0) or as PGN notation (1-0, 1/2-1/2, 0-1). Blank lines and lines
+// starting with '#' are ignored.
+func readSamples(r io.Reader) ([]sample, error) {
+	var samples []sample
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		x, err := parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("train: line %d: %w", n, err)
+		}
+		samples = append(samples, x)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("train: %w", err)
+	}
+	return samples, nil
+}
+
+// parseSample parses one line of training data.
+func parseSample(line string) (sample, error) {
+	var x sample
+
+	fields := strings.Split(line, "|")
+	if len(fields) != 3 {
+		return x, fmt.Errorf("invalid number of fields: %d", len(fields))
+	}
+
+	p, err := fen.From(strings.TrimSpace(fields[0]))
+	if err != nil {
+		return x, err
+	}
+	// HalfKP features are keyed by each side's king square.
+	if p.Board[chess.WhiteKing].Count() != 1 || p.Board[chess.BlackKing].Count() != 1 {
+		return x, fmt.Errorf("position needs one king per side: %s", strings.TrimSpace(fields[0]))
+	}
+
+	score, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 32)
+	if err != nil {
+		return x, fmt.Errorf("invalid score: %s", fields[1])
+	}
+
+	var result float64
+	switch r := strings.TrimSpace(fields[2]); r {
+	case "1-0":
+		result = 1
+	case "1/2-1/2":
+		result = 0.5
+	case "0-1":
+		result = 0
+	default:
+		result, err = strconv.ParseFloat(r, 32)
+		if err != nil || result < 0 || result > 1 {
+			return x, fmt.Errorf("invalid result: %s", r)
+		}
+	}
+
+	if p.SideToMove == chess.Black {
+		score, result = -score, 1-result
+	}
+	x.score, x.result = float32(score), float32(result)
+
+	var buf [32]int
+	for i, c := range []chess.Color{p.SideToMove, p.SideToMove.Opposite()} {
+		for _, f := range nnue.Features(buf[:0], &p, c) {
+			x.features[i] = append(x.features[i], uint16(f))
+		}
+	}
+	return x, nil
+}
@@ -0,0 +1,266 @@
+package train
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/clfs/good/eval/internal/nnue"
+)
+
+// network is the float version of an nnue.Network, with the same layout. It's
+// also used to hold gradients and optimizer moments.
+type network struct {
+	Hidden, L1, L2 int
+
+	FTWeights  []float32
+	FTBiases   []float32
+	L1Weights  []float32
+	L1Biases   []float32
+	L2Weights  []float32
+	L2Biases   []float32
+	OutWeights []float32
+	OutBias    []float32 // A single bias, kept in a slice like the others.
+}
+
+// newNetwork returns a network with all parameters set to zero. If withFT is
+// false, the large feature transformer weight matrix isn't allocated.
+func newNetwork(hidden, l1, l2 int, withFT bool) *network {
+	n := &network{
+		Hidden:     hidden,
+		L1:         l1,
+		L2:         l2,
+		FTBiases:   make([]float32, hidden),
+		L1Weights:  make([]float32, l1*2*hidden),
+		L1Biases:   make([]float32, l1),
+		L2Weights:  make([]float32, l2*l1),
+		L2Biases:   make([]float32, l2),
+		OutWeights: make([]float32, l2),
+		OutBias:    make([]float32, 1),
+	}
+	if withFT {
+		n.FTWeights = make([]float32, nnue.FeatureCount*hidden)
+	}
+	return n
+}
+
+// randomize initializes weights with small random values.
+func (n *network) randomize(r *rand.Rand) {
+	uniform := func(w []float32, limit float64) {
+		for i := range w {
+			w[i] = float32((r.Float64()*2 - 1) * limit)
+		}
+	}
+	// Roughly 30 features are active per perspective.
+	uniform(n.FTWeights, 1/math.Sqrt(30))
+	uniform(n.L1Weights, 1/math.Sqrt(float64(2*n.Hidden)))
+	uniform(n.L2Weights, 1/math.Sqrt(float64(n.L1)))
+	uniform(n.OutWeights, 1/math.Sqrt(float64(n.L2)))
+}
+
+// dense returns the parameters other than the feature transformer weights.
+func (n *network) dense() [][]float32 {
+	return [][]float32{
+		n.FTBiases,
+		n.L1Weights, n.L1Biases,
+		n.L2Weights, n.L2Biases,
+		n.OutWeights, n.OutBias,
+	}
+}
+
+// zeroDense sets all dense parameters to zero.
+func (n *network) zeroDense() {
+	for _, w := range n.dense() {
+		for i := range w {
+			w[i] = 0
+		}
+	}
+}
+
+// workspace holds the activations of one forward pass, so they can be reused
+// by the backward pass without allocating.
+type workspace struct {
+	acc  [2][]float32 // Feature transformer output per perspective.
+	in   []float32    // Clipped, concatenated accumulators.
+	z1   []float32
+	h1   []float32
+	z2   []float32
+	h2   []float32
+	dh1  []float32
+	dh2  []float32
+	din  []float32
+	grad *network // Gradients of the dense parameters.
+}
+
+func newWorkspace(n *network) *workspace {
+	return &workspace{
+		acc:  [2][]float32{make([]float32, n.Hidden), make([]float32, n.Hidden)},
+		in:   make([]float32, 2*n.Hidden),
+		z1:   make([]float32, n.L1),
+		h1:   make([]float32, n.L1),
+		z2:   make([]float32, n.L2),
+		h2:   make([]float32, n.L2),
+		dh1:  make([]float32, n.L1),
+		dh2:  make([]float32, n.L2),
+		din:  make([]float32, 2*n.Hidden),
+		grad: newNetwork(n.Hidden, n.L1, n.L2, false),
+	}
+}
+
+// forward computes the network output for a sample, in units of
+// nnue.OutputScale centipawns.
+func (n *network) forward(ws *workspace, x *sample) float32 {
+	for i := range ws.acc {
+		acc := ws.acc[i]
+		copy(acc, n.FTBiases)
+		for _, f := range x.features[i] {
+			row := n.FTWeights[int(f)*n.Hidden : (int(f)+1)*n.Hidden]
+			for j, w := range row {
+				acc[j] += w
+			}
+		}
+		for j, v := range acc {
+			ws.in[i*n.Hidden+j] = clamp(v)
+		}
+	}
+	affine(ws.z1, n.L1Weights, n.L1Biases, ws.in)
+	for i, v := range ws.z1 {
+		ws.h1[i] = clamp(v)
+	}
+	affine(ws.z2, n.L2Weights, n.L2Biases, ws.h1)
+	for i, v := range ws.z2 {
+		ws.h2[i] = clamp(v)
+	}
+	y := n.OutBias[0]
+	for i, v := range ws.h2 {
+		y += n.OutWeights[i] * v
+	}
+	return y
+}
+
+// backward accumulates the gradients of the dense parameters into ws.grad,
+// given the derivative of the loss with respect to the output. It stores the
+// derivative with respect to each accumulator in dacc, which must have length
+// 2*Hidden.
+func (n *network) backward(ws *workspace, dy float32, dacc []float32) {
+	g := ws.grad
+
+	g.OutBias[0] += dy
+	for i, v := range ws.h2 {
+		g.OutWeights[i] += dy * v
+		ws.dh2[i] = dy * n.OutWeights[i] * active(ws.z2[i])
+	}
+
+	backAffine(g.L2Weights, g.L2Biases, n.L2Weights, ws.dh2, ws.h1, ws.dh1)
+	for i := range ws.dh1 {
+		ws.dh1[i] *= active(ws.z1[i])
+	}
+
+	backAffine(g.L1Weights, g.L1Biases, n.L1Weights, ws.dh1, ws.in, ws.din)
+	for i := range ws.acc {
+		for j, v := range ws.acc[i] {
+			k := i*n.Hidden + j
+			dacc[k] = ws.din[k] * active(v)
+			g.FTBiases[j] += dacc[k]
+		}
+	}
+}
+
+// affine computes out = w*in + b, where w has one row per output.
+func affine(out, w, b, in []float32) {
+	for i := range out {
+		row := w[i*len(in) : (i+1)*len(in)]
+		sum := b[i]
+		for j, v := range in {
+			sum += row[j] * v
+		}
+		out[i] = sum
+	}
+}
+
+// backAffine accumulates the weight and bias gradients of an affine layer,
+// given the derivative dout with respect to its output, and stores the
+// derivative with respect to its input in din.
+func backAffine(gw, gb, w, dout, in, din []float32) {
+	for j := range din {
+		din[j] = 0
+	}
+	for i, d := range dout {
+		if d == 0 {
+			continue
+		}
+		gb[i] += d
+		row := w[i*len(in) : (i+1)*len(in)]
+		grow := gw[i*len(in) : (i+1)*len(in)]
+		for j, v := range in {
+			grow[j] += d * v
+			din[j] += d * row[j]
+		}
+	}
+}
+
+// clamp is the clipped ReLU activation.
+func clamp(x float32) float32 {
+	if x < 0 {
+		return 0
+	}
+	if x > 1 {
+		return 1
+	}
+	return x
+}
+
+// active returns the derivative of clamp at x.
+func active(x float32) float32 {
+	if x > 0 && x < 1 {
+		return 1
+	}
+	return 0
+}
+
+// maxWeight is the largest hidden layer weight that survives quantization.
+const maxWeight = 127.0 / nnue.WeightScale
+
+// clipWeights keeps hidden layer weights within the quantizable range.
+func (n *network) clipWeights() {
+	for _, w := range [][]float32{n.L1Weights, n.L2Weights, n.OutWeights} {
+		for i, v := range w {
+			if v > maxWeight {
+				w[i] = maxWeight
+			} else if v < -maxWeight {
+				w[i] = -maxWeight
+			}
+		}
+	}
+}
+
+// quantize returns the quantized version of the network.
+func (n *network) quantize() *nnue.Network {
+	q := nnue.NewNetwork(n.Hidden, n.L1, n.L2)
+	for i, v := range n.FTWeights {
+		q.FTWeights[i] = int16(round(v, nnue.ActivationScale, math.MinInt16, math.MaxInt16))
+	}
+	for i, v := range n.FTBiases {
+		q.FTBiases[i] = int16(round(v, nnue.ActivationScale, math.MinInt16, math.MaxInt16))
+	}
+	quantizeLayer(q.L1Weights, q.L1Biases, n.L1Weights, n.L1Biases)
+	quantizeLayer(q.L2Weights, q.L2Biases, n.L2Weights, n.L2Biases)
+	var outBias [1]int32
+	quantizeLayer(q.OutWeights, outBias[:], n.OutWeights, n.OutBias)
+	q.OutBias = outBias[0]
+	return q
+}
+
+// quantizeLayer quantizes the weights and biases of a hidden layer.
+func quantizeLayer(qw []int8, qb []int32, w, b []float32) {
+	for i, v := range w {
+		qw[i] = int8(round(v, nnue.WeightScale, -127, 127))
+	}
+	for i, v := range b {
+		qb[i] = int32(round(v, nnue.ActivationScale*nnue.WeightScale, math.MinInt32, math.MaxInt32))
+	}
+}
+
+// round scales v and rounds it to the nearest integer in [lo, hi].
+func round(v float32, scale, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, math.Round(float64(v)*scale)))
+}
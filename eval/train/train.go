@@ -0,0 +1,387 @@
+// Package train trains NNUE networks on the CPU.
+//
+// Training data is a text file of positions labelled with an evaluation and a
+// game result. Each position is scored by a HalfKP network in floating point,
+// and the network is fit to a blend of the evaluation and the result with the
+// Adam optimizer. The final network is quantized into the format loaded by the
+// engine's NNUE evaluator.
+package train
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/clfs/good/eval/internal/nnue"
+)
+
+// Config configures a training run.
+type Config struct {
+	Data       string // Path to the training data.
+	Output     string // Path to write the quantized network to.
+	Checkpoint string // Path to save checkpoints to and resume from, if set.
+
+	Hidden, L1, L2 int // Layer sizes; see nnue.Network.
+
+	Epochs       int
+	BatchSize    int
+	LearningRate float64
+
+	// Lambda is the weight of the evaluation in the training target. The rest
+	// of the weight goes to the game result, so 1 trains on evaluations only
+	// and 0 trains on results only.
+	Lambda float64
+
+	// Scale converts centipawns to win probability, as sigmoid(cp/Scale).
+	Scale float64
+
+	Threads int   // Number of worker goroutines. Zero means one per CPU.
+	Seed    int64 // Seed for initialization and shuffling.
+
+	Log io.Writer // Progress is written here, if non-nil.
+}
+
+// DefaultConfig returns a configuration with sensible defaults for a small
+// network. Data and Output must still be set.
+func DefaultConfig() Config {
+	return Config{
+		Hidden:       128,
+		L1:           32,
+		L2:           32,
+		Epochs:       10,
+		BatchSize:    16384,
+		LearningRate: 0.001,
+		Lambda:       0.75,
+		Scale:        400,
+	}
+}
+
+// validate checks that a configuration can be trained.
+func (cfg *Config) validate() error {
+	if cfg.Data == "" || cfg.Output == "" {
+		return errors.New("train: data and output paths are required")
+	}
+	for _, f := range []struct {
+		name  string
+		value int
+	}{
+		{"hidden layer size", cfg.Hidden},
+		{"L1 size", cfg.L1},
+		{"L2 size", cfg.L2},
+		{"epochs", cfg.Epochs},
+		{"batch size", cfg.BatchSize},
+	} {
+		if f.value <= 0 {
+			return fmt.Errorf("train: %s must be positive, got %d", f.name, f.value)
+		}
+	}
+	if cfg.Threads < 0 {
+		return fmt.Errorf("train: threads must not be negative, got %d", cfg.Threads)
+	}
+	if cfg.Scale <= 0 {
+		return fmt.Errorf("train: scale must be positive, got %v", cfg.Scale)
+	}
+	return nil
+}
+
+// Adam hyperparameters.
+const (
+	beta1   = 0.9
+	beta2   = 0.999
+	epsilon = 1e-8
+)
+
+// state is the full training state, as saved in checkpoints.
+type state struct {
+	Net   *network
+	M, V  *network // Adam moment estimates, shaped like Net.
+	Step  int      // Number of optimizer steps taken.
+	Epoch int      // Number of epochs completed.
+}
+
+// Train runs a training session.
+func Train(cfg Config) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	if cfg.Threads == 0 {
+		cfg.Threads = runtime.NumCPU()
+	}
+	logf := func(format string, args ...any) {
+		if cfg.Log != nil {
+			fmt.Fprintf(cfg.Log, format+"\n", args...)
+		}
+	}
+
+	f, err := os.Open(cfg.Data)
+	if err != nil {
+		return fmt.Errorf("train: %w", err)
+	}
+	samples, err := readSamples(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		return errors.New("train: no training samples")
+	}
+	logf("loaded %d samples", len(samples))
+
+	st, err := loadCheckpoint(cfg.Checkpoint)
+	if err != nil {
+		return err
+	}
+	switch {
+	case st == nil:
+		st = newState(cfg)
+	case st.Net.Hidden != cfg.Hidden || st.Net.L1 != cfg.L1 || st.Net.L2 != cfg.L2:
+		return fmt.Errorf("train: checkpoint layer sizes %d, %d, %d don't match configuration", st.Net.Hidden, st.Net.L1, st.Net.L2)
+	default:
+		logf("resuming from epoch %d", st.Epoch)
+	}
+
+	t := newTrainer(cfg, st)
+	r := rand.New(rand.NewSource(cfg.Seed + int64(st.Epoch)))
+	for st.Epoch < cfg.Epochs {
+		start := time.Now()
+		r.Shuffle(len(samples), func(i, j int) { samples[i], samples[j] = samples[j], samples[i] })
+
+		var loss float64
+		for i := 0; i < len(samples); i += cfg.BatchSize {
+			batch := samples[i:min(i+cfg.BatchSize, len(samples))]
+			loss += t.step(batch)
+		}
+		st.Epoch++
+
+		logf("epoch %d: loss %.6f (%s)", st.Epoch, loss/float64(len(samples)), time.Since(start).Round(time.Millisecond))
+		if err := saveCheckpoint(cfg.Checkpoint, st); err != nil {
+			return err
+		}
+	}
+
+	return writeNetwork(cfg.Output, st.Net.quantize())
+}
+
+func newState(cfg Config) *state {
+	st := &state{
+		Net: newNetwork(cfg.Hidden, cfg.L1, cfg.L2, true),
+		M:   newNetwork(cfg.Hidden, cfg.L1, cfg.L2, true),
+		V:   newNetwork(cfg.Hidden, cfg.L1, cfg.L2, true),
+	}
+	st.Net.randomize(rand.New(rand.NewSource(cfg.Seed)))
+	return st
+}
+
+// trainer runs optimizer steps over batches.
+type trainer struct {
+	cfg        Config
+	st         *state
+	workspaces []*workspace
+
+	dacc    []float32 // Per-sample accumulator gradients for the current batch.
+	ftGrad  []float32 // Feature transformer weight gradients.
+	touched []bool    // Features with a non-zero gradient.
+}
+
+func newTrainer(cfg Config, st *state) *trainer {
+	t := &trainer{
+		cfg:     cfg,
+		st:      st,
+		ftGrad:  make([]float32, len(st.Net.FTWeights)),
+		touched: make([]bool, nnue.FeatureCount),
+	}
+	for i := 0; i < cfg.Threads; i++ {
+		t.workspaces = append(t.workspaces, newWorkspace(st.Net))
+	}
+	return t
+}
+
+// step runs forward and backward passes over a batch, then updates the
+// network. It returns the summed loss over the batch.
+func (t *trainer) step(batch []sample) float64 {
+	net := t.st.Net
+	width := 2 * net.Hidden
+	if len(t.dacc) < len(batch)*width {
+		t.dacc = make([]float32, len(batch)*width)
+	}
+
+	// Split the batch between workers. Each worker accumulates dense
+	// gradients in its own workspace.
+	losses := make([]float64, len(t.workspaces))
+	var wg sync.WaitGroup
+	chunk := (len(batch) + len(t.workspaces) - 1) / len(t.workspaces)
+	for w, ws := range t.workspaces {
+		lo, hi := w*chunk, min((w+1)*chunk, len(batch))
+		if lo >= hi {
+			continue
+		}
+		wg.Add(1)
+		go func(w int, ws *workspace) {
+			defer wg.Done()
+			ws.grad.zeroDense()
+			for i := lo; i < hi; i++ {
+				losses[w] += t.sample(ws, &batch[i], t.dacc[i*width:(i+1)*width])
+			}
+		}(w, ws)
+	}
+	wg.Wait()
+
+	// Reduce dense gradients into the first workspace.
+	grad := t.workspaces[0].grad
+	for _, ws := range t.workspaces[1:] {
+		for k, g := range ws.grad.dense() {
+			dst := grad.dense()[k]
+			for i, v := range g {
+				dst[i] += v
+			}
+		}
+	}
+
+	// Scatter accumulator gradients into the rows of active features.
+	for i := range batch {
+		for side, features := range batch[i].features {
+			d := t.dacc[i*width+side*net.Hidden : i*width+(side+1)*net.Hidden]
+			for _, f := range features {
+				t.touched[f] = true
+				row := t.ftGrad[int(f)*net.Hidden : (int(f)+1)*net.Hidden]
+				for j, v := range d {
+					row[j] += v
+				}
+			}
+		}
+	}
+
+	t.update(grad, len(batch))
+
+	var loss float64
+	for _, l := range losses {
+		loss += l
+	}
+	return loss
+}
+
+// sample runs one sample forward and backward, returning its loss.
+func (t *trainer) sample(ws *workspace, x *sample, dacc []float32) float64 {
+	y := float64(t.st.Net.forward(ws, x))
+	pred := sigmoid(y * nnue.OutputScale / t.cfg.Scale)
+	target := t.cfg.Lambda*sigmoid(float64(x.score)/t.cfg.Scale) + (1-t.cfg.Lambda)*float64(x.result)
+
+	diff := pred - target
+	dy := 2 * diff * pred * (1 - pred) * nnue.OutputScale / t.cfg.Scale
+	t.st.Net.backward(ws, float32(dy), dacc)
+	return diff * diff
+}
+
+// update applies one Adam step. Only the feature transformer rows of features
+// seen in the batch are updated.
+func (t *trainer) update(grad *network, n int) {
+	st := t.st
+	st.Step++
+	lr := t.cfg.LearningRate * math.Sqrt(1-math.Pow(beta2, float64(st.Step))) / (1 - math.Pow(beta1, float64(st.Step)))
+	scale := float32(1 / float64(n))
+
+	params, ms, vs := st.Net.dense(), st.M.dense(), st.V.dense()
+	for k, g := range grad.dense() {
+		adam(params[k], ms[k], vs[k], g, scale, lr)
+	}
+
+	h := st.Net.Hidden
+	for f, ok := range t.touched {
+		if !ok {
+			continue
+		}
+		t.touched[f] = false
+		lo, hi := f*h, (f+1)*h
+		adam(st.Net.FTWeights[lo:hi], st.M.FTWeights[lo:hi], st.V.FTWeights[lo:hi], t.ftGrad[lo:hi], scale, lr)
+		for i := lo; i < hi; i++ {
+			t.ftGrad[i] = 0
+		}
+	}
+
+	st.Net.clipWeights()
+}
+
+// adam updates parameters w in place from gradients g, which are multiplied by
+// scale first.
+func adam(w, m, v, g []float32, scale float32, lr float64) {
+	for i := range w {
+		gi := float64(g[i] * scale)
+		mi := beta1*float64(m[i]) + (1-beta1)*gi
+		vi := beta2*float64(v[i]) + (1-beta2)*gi*gi
+		m[i], v[i] = float32(mi), float32(vi)
+		w[i] -= float32(lr * mi / (math.Sqrt(vi) + epsilon))
+	}
+}
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// loadCheckpoint loads the training state from path. If path is empty or
+// doesn't exist, it returns a nil state.
+func loadCheckpoint(path string) (*state, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("train: %w", err)
+	}
+	defer f.Close()
+	var st state
+	if err := gob.NewDecoder(f).Decode(&st); err != nil {
+		return nil, fmt.Errorf("train: reading checkpoint: %w", err)
+	}
+	return &st, nil
+}
+
+// saveCheckpoint saves the training state to path, if path is non-empty. The
+// previous checkpoint is only replaced once the new one is fully written.
+func saveCheckpoint(path string, st *state) error {
+	if path == "" {
+		return nil
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("train: %w", err)
+	}
+	if err := gob.NewEncoder(f).Encode(st); err != nil {
+		f.Close()
+		return fmt.Errorf("train: writing checkpoint: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("train: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// writeNetwork writes a quantized network to path.
+func writeNetwork(path string, n *nnue.Network) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("train: %w", err)
+	}
+	if _, err := n.WriteTo(f); err != nil {
+		f.Close()
+		return fmt.Errorf("train: %w", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,191 @@
+package train
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/eval/internal/nnue"
+	"github.com/clfs/good/fen"
+)
+
+var testData = `
+# A few positions with made-up labels.
+rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1 | 20 | 1/2-1/2
+r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1 | -35 | 0.5
+8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1 | 110 | 1-0
+r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1 | -250 | 0-1
+rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R b KQ - 1 8 | -400 | 0
+`
+
+func TestParseSample(t *testing.T) {
+	x, err := parseSample("rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R b KQ - 1 8 | -400 | 0-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Black is to move, so labels are flipped to black's perspective.
+	if x.score != 400 || x.result != 1 {
+		t.Errorf("want score 400 and result 1, got %v and %v", x.score, x.result)
+	}
+	if len(x.features[0]) != 26 || len(x.features[1]) != 26 {
+		t.Errorf("want 26 features per perspective, got %d and %d", len(x.features[0]), len(x.features[1]))
+	}
+
+	for _, line := range []string{
+		"8/8/8/8/8/8/8/8 w - - 0 1 | 1",
+		fen.Starting + " | x | 1",
+		fen.Starting + " | 0 | 2",
+		"8/8/8/8/8/8/8/4K3 w - - 0 1 | 0 | 1",    // No black king.
+		"4k3/8/8/8/8/8/8/4K2K w - - 0 1 | 0 | 1", // Two white kings.
+	} {
+		if _, err := parseSample(line); err == nil {
+			t.Errorf("%q: want error", line)
+		}
+	}
+}
+
+// TestQuantize checks that quantized networks evaluate close to their float
+// versions.
+func TestQuantize(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	n := newNetwork(16, 8, 8, true)
+	n.randomize(r)
+	for _, w := range n.dense() {
+		for i := range w {
+			w[i] += float32(r.Float64()*0.2 - 0.1)
+		}
+	}
+	n.clipWeights()
+	q := n.quantize()
+	ws := newWorkspace(n)
+
+	for _, line := range strings.Split(strings.TrimSpace(testData), "\n")[1:] {
+		p, err := fen.From(strings.Split(line, "|")[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		x, err := parseSample(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := float64(n.forward(ws, &x)) * nnue.OutputScale
+		got := float64(q.Evaluate(&p))
+		if p.SideToMove == chess.Black {
+			got = -got
+		}
+		if math.Abs(want-got) > 25 {
+			t.Errorf("%s: float network gives %.1f, quantized gives %.0f", fen.To(p), want, got)
+		}
+	}
+}
+
+// TestBackward compares analytic gradients with numerical ones.
+func TestBackward(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	n := newNetwork(8, 4, 4, true)
+	n.randomize(r)
+	for _, w := range n.dense() {
+		for i := range w {
+			w[i] += float32(r.Float64()*0.4 - 0.1)
+		}
+	}
+	ws := newWorkspace(n)
+	x, err := parseSample(fen.Starting + " | 0 | 0.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dacc := make([]float32, 2*n.Hidden)
+	n.forward(ws, &x)
+	n.backward(ws, 1, dacc)
+
+	const h = 1e-2
+	for k, w := range n.dense() {
+		g := ws.grad.dense()[k]
+		for i := range w {
+			old := w[i]
+			w[i] = old + h
+			hi := n.forward(ws, &x)
+			w[i] = old - h
+			lo := n.forward(ws, &x)
+			w[i] = old
+			if num := (hi - lo) / (2 * h); math.Abs(float64(num-g[i])) > 1e-2 {
+				t.Errorf("parameter %d/%d: analytic gradient %f, numerical %f", k, i, g[i], num)
+			}
+		}
+	}
+}
+
+func TestTrain(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data.txt")
+	if err := os.WriteFile(data, []byte(testData), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Data = data
+	cfg.Output = filepath.Join(dir, "net.nnue")
+	cfg.Checkpoint = filepath.Join(dir, "checkpoint")
+	cfg.Hidden, cfg.L1, cfg.L2 = 8, 4, 4
+	cfg.Epochs = 2
+	cfg.BatchSize = 2
+	cfg.Threads = 2
+	if err := Train(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resume for one more epoch.
+	cfg.Epochs = 3
+	if err := Train(cfg); err != nil {
+		t.Fatal(err)
+	}
+	st, err := loadCheckpoint(cfg.Checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Epoch != 3 {
+		t.Errorf("want 3 epochs in checkpoint, got %d", st.Epoch)
+	}
+
+	f, err := os.Open(cfg.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := nnue.Load(f); err != nil {
+		t.Errorf("loading trained network: %v", err)
+	}
+}
+
+func TestTrain_Config(t *testing.T) {
+	cases := []struct {
+		name string
+		edit func(*Config)
+	}{
+		{"no data", func(c *Config) { c.Data = "" }},
+		{"no output", func(c *Config) { c.Output = "" }},
+		{"zero batch", func(c *Config) { c.BatchSize = 0 }},
+		{"negative batch", func(c *Config) { c.BatchSize = -1 }},
+		{"zero epochs", func(c *Config) { c.Epochs = 0 }},
+		{"zero hidden", func(c *Config) { c.Hidden = 0 }},
+		{"negative L1", func(c *Config) { c.L1 = -4 }},
+		{"zero L2", func(c *Config) { c.L2 = 0 }},
+		{"negative threads", func(c *Config) { c.Threads = -1 }},
+		{"zero scale", func(c *Config) { c.Scale = 0 }},
+	}
+	dir := t.TempDir()
+	for _, tc := range cases {
+		cfg := DefaultConfig()
+		cfg.Data = filepath.Join(dir, "data.txt") // Never read.
+		cfg.Output = filepath.Join(dir, "net.nnue")
+		tc.edit(&cfg)
+		if err := Train(cfg); err == nil || !strings.HasPrefix(err.Error(), "train: ") || strings.Contains(err.Error(), "no such file") {
+			t.Errorf("%s: want a configuration error, got %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package tune
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/clfs/good/eval/internal/endgame"
+	"github.com/clfs/good/eval/internal/hce"
+	"github.com/clfs/good/fen"
+)
+
+// A position is a tuning position, reduced to what the linear evaluation
+// model needs.
+type position struct {
+	coeffs []coefficient
+	phase  float64 // Midgame weight, from 0 to 1.
+	result float64 // Game result from white's perspective: 1, 0.5 or 0.
+}
+
+// coefficient is a compact hce.Coefficient.
+type coefficient struct {
+	index int32
+	count int32
+}
+
+// errSkip is returned for positions that are left out of tuning.
+var errSkip = errors.New("tune: position skipped")
+
+// readPositions reads tuning positions from r, one per line. Positions scored
+// or scaled by specialized endgame functions are skipped, since the weights
+// don't determine their evaluation. Two formats are
+// accepted. The first is EPD with the result in a c9 operation:
+//
+//	rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - c9 "1/2-1/2";
+//
+// The second is a full FEN followed by the result, optionally in brackets:
+//
+//	rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1 [0.5]
+//
+// Results are from white's perspective, written either as PGN results or as
+// numbers. Blank lines and lines starting with '#' are ignored.
+func readPositions(r io.Reader) ([]position, error) {
+	var positions []position
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		x, err := parsePosition(line)
+		if err == errSkip {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tune: line %d: %w", n, err)
+		}
+		positions = append(positions, x)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("tune: %w", err)
+	}
+	return positions, nil
+}
+
+// parsePosition parses one line of tuning data.
+func parsePosition(line string) (position, error) {
+	var x position
+
+	fields := strings.Fields(line)
+	if len(fields) < 5 {
+		return x, fmt.Errorf("missing result: %s", line)
+	}
+
+	var s, result string
+	if i := strings.Index(line, "c9"); i >= 0 {
+		// EPD has no move counters.
+		s = strings.Join(fields[:4], " ") + " 0 1"
+		result = strings.TrimSuffix(strings.TrimSpace(line[i+len("c9"):]), ";")
+		result = strings.Trim(strings.TrimSpace(result), `"`)
+	} else {
+		if len(fields) != 7 {
+			return x, fmt.Errorf("invalid number of fields: %d", len(fields))
+		}
+		s = strings.Join(fields[:6], " ")
+		result = strings.Trim(fields[6], "[]")
+	}
+
+	p, err := fen.From(s)
+	if err != nil {
+		return x, err
+	}
+
+	switch result {
+	case "1-0":
+		x.result = 1
+	case "1/2-1/2":
+		x.result = 0.5
+	case "0-1":
+		x.result = 0
+	default:
+		x.result, err = strconv.ParseFloat(result, 64)
+		if err != nil || x.result < 0 || x.result > 1 {
+			return x, fmt.Errorf("invalid result: %s", result)
+		}
+	}
+
+	if _, _, ok := endgame.Value(&p); ok {
+		return x, errSkip
+	}
+	if scale, _ := endgame.Scale(&p); scale != [2]int{endgame.ScaleNormal, endgame.ScaleNormal} {
+		return x, errSkip
+	}
+
+	coeffs, phase := hce.Coefficients(&p)
+	x.phase = float64(phase) / hce.MaxPhase
+	x.coeffs = make([]coefficient, len(coeffs))
+	for i, c := range coeffs {
+		x.coeffs[i] = coefficient{int32(c.Index), int32(c.Count)}
+	}
+	return x, nil
+}
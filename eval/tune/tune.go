@@ -0,0 +1,303 @@
+// Package tune tunes the weights of the hand-crafted evaluation.
+//
+// It implements Texel's tuning method. Each position in a dataset is labelled
+// with the result of the game it came from, and the evaluation is mapped to an
+// expected score with the sigmoid
+//
+//	1 / (1 + 10^(-K*eval/400))
+//
+// K is fit to the dataset first, then every weight is optimized to minimize the
+// mean squared error between expected scores and results. The evaluation is
+// linear in its weights, so each position is reduced to a sparse coefficient
+// vector once, and the gradient of the error is computed exactly.
+package tune
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/clfs/good/eval/internal/hce"
+)
+
+// Config configures a tuning run.
+type Config struct {
+	Data    string // Path to the tuning data.
+	Weights string // Path to a weights file to start from. Empty means the defaults.
+	Output  string // Path to write the tuned weights to, as a JSON weights file.
+
+	// K is the sigmoid scaling constant. Zero means it's fit to the data.
+	K float64
+
+	Epochs       int     // Number of full-batch optimizer steps.
+	LearningRate float64 // Adam step size, in centipawns.
+
+	Threads int // Number of worker goroutines. Zero means one per CPU.
+
+	Log io.Writer // Progress is written here, if non-nil.
+}
+
+// DefaultConfig returns a configuration with sensible defaults. Data and
+// Output must still be set.
+func DefaultConfig() Config {
+	return Config{
+		Epochs:       2000,
+		LearningRate: 1,
+	}
+}
+
+// Adam hyperparameters.
+const (
+	beta1   = 0.9
+	beta2   = 0.999
+	epsilon = 1e-8
+)
+
+// Tune runs a tuning session.
+func Tune(cfg Config) error {
+	if cfg.Data == "" || cfg.Output == "" {
+		return errors.New("tune: data and output paths are required")
+	}
+	if cfg.Threads <= 0 {
+		cfg.Threads = runtime.NumCPU()
+	}
+	logf := func(format string, args ...any) {
+		if cfg.Log != nil {
+			fmt.Fprintf(cfg.Log, format+"\n", args...)
+		}
+	}
+
+	f, err := os.Open(cfg.Data)
+	if err != nil {
+		return fmt.Errorf("tune: %w", err)
+	}
+	positions, err := readPositions(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if len(positions) == 0 {
+		return errors.New("tune: no tuning positions")
+	}
+	logf("loaded %d positions", len(positions))
+
+	start := &hce.Default
+	if cfg.Weights != "" {
+		if start, err = readWeights(cfg.Weights); err != nil {
+			return err
+		}
+	}
+
+	t := newTuner(positions, cfg.Threads)
+	params := toFloat(hce.Flatten(start))
+
+	k := cfg.K
+	if k == 0 {
+		k = t.fitK(params)
+		logf("fit K = %.6f", k)
+	}
+	logf("initial error %.6f", t.loss(params, k))
+
+	t.optimize(params, k, cfg.Epochs, cfg.LearningRate, func(epoch int, loss float64, elapsed time.Duration) {
+		if epoch%100 == 0 || epoch == cfg.Epochs {
+			logf("epoch %d: error %.6f (%s)", epoch, loss, elapsed.Round(time.Millisecond))
+		}
+	})
+
+	var w hce.Weights
+	hce.Unflatten(&w, toInt(params))
+	return writeWeights(cfg.Output, &w)
+}
+
+// readWeights reads a JSON weights file.
+func readWeights(path string) (*hce.Weights, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("tune: %w", err)
+	}
+	defer f.Close()
+	return hce.ReadJSON(f)
+}
+
+// writeWeights writes w to path as a JSON weights file.
+func writeWeights(path string, w *hce.Weights) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("tune: %w", err)
+	}
+	if err := hce.WriteJSON(f, w); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// toFloat converts weights to a flat float vector, midgame values first.
+func toFloat(s []hce.S) []float64 {
+	v := make([]float64, 2*len(s))
+	for i, x := range s {
+		v[i], v[len(s)+i] = float64(x.MG), float64(x.EG)
+	}
+	return v
+}
+
+// toInt is the inverse of toFloat, rounding to whole centipawns.
+func toInt(v []float64) []hce.S {
+	s := make([]hce.S, len(v)/2)
+	for i := range s {
+		s[i] = hce.S{MG: int(math.Round(v[i])), EG: int(math.Round(v[len(s)+i]))}
+	}
+	return s
+}
+
+// tuner evaluates the error and its gradient over a dataset, split between
+// worker goroutines.
+type tuner struct {
+	positions []position
+	chunks    [][]position
+}
+
+func newTuner(positions []position, threads int) *tuner {
+	t := &tuner{positions: positions}
+	size := (len(positions) + threads - 1) / threads
+	for lo := 0; lo < len(positions); lo += size {
+		t.chunks = append(t.chunks, positions[lo:min(lo+size, len(positions))])
+	}
+	return t
+}
+
+// eval returns the evaluation of x under the linear model.
+func eval(x *position, params []float64) float64 {
+	n := len(params) / 2
+	var mg, eg float64
+	for _, c := range x.coeffs {
+		mg += float64(c.count) * params[c.index]
+		eg += float64(c.count) * params[n+int(c.index)]
+	}
+	return mg*x.phase + eg*(1-x.phase)
+}
+
+// sigmoid maps an evaluation to an expected score.
+func sigmoid(e, k float64) float64 {
+	return 1 / (1 + math.Pow(10, -k*e/400))
+}
+
+// run calls fn concurrently on each chunk, and returns the sum of the results.
+func (t *tuner) run(fn func(i int, chunk []position) float64) float64 {
+	results := make([]float64, len(t.chunks))
+	var wg sync.WaitGroup
+	for i, chunk := range t.chunks {
+		wg.Add(1)
+		go func(i int, chunk []position) {
+			defer wg.Done()
+			results[i] = fn(i, chunk)
+		}(i, chunk)
+	}
+	wg.Wait()
+	var sum float64
+	for _, r := range results {
+		sum += r
+	}
+	return sum
+}
+
+// loss returns the mean squared error over the dataset.
+func (t *tuner) loss(params []float64, k float64) float64 {
+	sum := t.run(func(_ int, chunk []position) float64 {
+		var sum float64
+		for i := range chunk {
+			d := chunk[i].result - sigmoid(eval(&chunk[i], params), k)
+			sum += d * d
+		}
+		return sum
+	})
+	return sum / float64(len(t.positions))
+}
+
+// fitK returns the K that minimizes the error of params, found by golden
+// section search. The error is unimodal in K.
+func (t *tuner) fitK(params []float64) float64 {
+	phi := (math.Sqrt(5) - 1) / 2
+	lo, hi := 0.0, 10.0
+	a, b := hi-phi*(hi-lo), lo+phi*(hi-lo)
+	fa, fb := t.loss(params, a), t.loss(params, b)
+	for hi-lo > 1e-6 {
+		if fa < fb {
+			hi, b, fb = b, a, fa
+			a = hi - phi*(hi-lo)
+			fa = t.loss(params, a)
+		} else {
+			lo, a, fa = a, b, fb
+			b = lo + phi*(hi-lo)
+			fb = t.loss(params, b)
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// gradient stores the gradient of the error with respect to params in grad,
+// and returns the error.
+func (t *tuner) gradient(params, grad []float64, k float64) float64 {
+	n := len(params) / 2
+	grads := make([][]float64, len(t.chunks))
+	loss := t.run(func(i int, chunk []position) float64 {
+		g := make([]float64, len(params))
+		var sum float64
+		for j := range chunk {
+			x := &chunk[j]
+			s := sigmoid(eval(x, params), k)
+			d := x.result - s
+			sum += d * d
+			// Derivative of the squared error with respect to the evaluation.
+			de := -2 * d * s * (1 - s) * k * math.Ln10 / 400
+			for _, c := range x.coeffs {
+				g[c.index] += de * float64(c.count) * x.phase
+				g[n+int(c.index)] += de * float64(c.count) * (1 - x.phase)
+			}
+		}
+		grads[i] = g
+		return sum
+	})
+	for i := range grad {
+		grad[i] = 0
+	}
+	scale := 1 / float64(len(t.positions))
+	for _, g := range grads {
+		for i, v := range g {
+			grad[i] += v * scale
+		}
+	}
+	return loss * scale
+}
+
+// optimize runs full-batch Adam on params for the given number of epochs,
+// calling progress after each one.
+func (t *tuner) optimize(params []float64, k float64, epochs int, lr float64, progress func(epoch int, loss float64, elapsed time.Duration)) {
+	grad := make([]float64, len(params))
+	m := make([]float64, len(params))
+	v := make([]float64, len(params))
+	start := time.Now()
+	for epoch := 1; epoch <= epochs; epoch++ {
+		loss := t.gradient(params, grad, k)
+		c1 := 1 - math.Pow(beta1, float64(epoch))
+		c2 := 1 - math.Pow(beta2, float64(epoch))
+		for i, g := range grad {
+			m[i] = beta1*m[i] + (1-beta1)*g
+			v[i] = beta2*v[i] + (1-beta2)*g*g
+			params[i] -= lr * (m[i] / c1) / (math.Sqrt(v[i]/c2) + epsilon)
+		}
+		progress(epoch, loss, time.Since(start))
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
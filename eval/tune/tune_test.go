@@ -0,0 +1,153 @@
+package tune
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clfs/good/eval/internal/hce"
+	"github.com/clfs/good/fen"
+)
+
+const testData = `# Comment lines and blank lines are skipped.
+
+rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - c9 "1/2-1/2";
+r1bqk2r/pppp1ppp/2n2n2/2b1p3/2B1P3/2N2N2/PPPP1PPP/R1BQ1RK1 w kq - c9 "1-0";
+4k3/pp6/8/8/8/8/3q3P/4K3 w - - 0 1 [0.0]
+4k3/pp6/8/8/8/8/3Q3P/4K3 b - - 0 1 1-0
+4k3/pp6/8/8/8/8/PPP5/4K3 w - - 0 1 [1.0]
+4k3/ppp5/8/8/8/8/PP6/4K3 w - - 0 1 0-1
+`
+
+func TestReadPositions(t *testing.T) {
+	positions, err := readPositions(strings.NewReader(testData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{0.5, 1, 0, 1, 1, 0}
+	if len(positions) != len(want) {
+		t.Fatalf("want %d positions, got %d", len(want), len(positions))
+	}
+	for i, x := range positions {
+		if x.result != want[i] {
+			t.Errorf("position %d: want result %v, got %v", i, want[i], x.result)
+		}
+	}
+	if positions[0].phase != 1 {
+		t.Errorf("want starting phase 1, got %v", positions[0].phase)
+	}
+
+	for _, bad := range []string{
+		"4k3/8/8/8/8/8/8/4K3 w - - 0 1",
+		"4k3/8/8/8/8/8/8/4K3 w - - 0 1 2-0",
+		`4k3/8/8/8/8/8/8/4K3 w - - c9 "*";`,
+	} {
+		if _, err := readPositions(strings.NewReader(bad)); err == nil {
+			t.Errorf("%s: want error", bad)
+		}
+	}
+
+	// Specialized endgames are left out.
+	positions, err = readPositions(strings.NewReader("4k3/8/8/8/8/8/3Q4/4K3 b - - 0 1 1-0\n"))
+	if err != nil || len(positions) != 0 {
+		t.Errorf("KQK: want no positions, got %d (%v)", len(positions), err)
+	}
+}
+
+func TestEvalMatchesEvaluator(t *testing.T) {
+	positions, err := readPositions(strings.NewReader(testData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := toFloat(hce.Flatten(&hce.Default))
+	e := hce.New(&hce.Default)
+	lines := strings.Split(testData, "\n")[2:] // Skip the comment and blank line.
+	for i := range positions {
+		p, err := fen.From(strings.Join(strings.Fields(lines[i])[:4], " ") + " 0 1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The evaluator rounds towards zero when blending phases.
+		got, want := eval(&positions[i], params), float64(e.Position(&p))
+		if math.Abs(got-want) >= 1 {
+			t.Errorf("%s: want %v, got %v", lines[i], want, got)
+		}
+	}
+}
+
+func TestGradient(t *testing.T) {
+	positions, err := readPositions(strings.NewReader(testData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := newTuner(positions, 3)
+	params := toFloat(hce.Flatten(&hce.Default))
+	grad := make([]float64, len(params))
+	const k = 1.2
+	tr.gradient(params, grad, k)
+
+	// Compare against numerical gradients of the parameters in use.
+	names := hce.ParamNames()
+	for i := range params {
+		if grad[i] == 0 {
+			continue
+		}
+		const h = 1e-3
+		old := params[i]
+		params[i] = old + h
+		hi := tr.loss(params, k)
+		params[i] = old - h
+		lo := tr.loss(params, k)
+		params[i] = old
+		want := (hi - lo) / (2 * h)
+		if math.Abs(want-grad[i]) > 1e-6+1e-3*math.Abs(want) {
+			t.Errorf("%s: want gradient %g, got %g", names[i%len(names)], want, grad[i])
+		}
+	}
+}
+
+func TestFitK(t *testing.T) {
+	// Results drawn exactly from the sigmoid with K = 1.5 should fit it.
+	var positions []position
+	for e := -800.0; e <= 800; e += 50 {
+		positions = append(positions, position{phase: 1, result: sigmoid(e, 1.5)})
+	}
+	// Give each position its own parameter, holding its evaluation.
+	tr := newTuner(positions, 2)
+	params := make([]float64, 2*len(positions))
+	for i := range positions {
+		positions[i].coeffs = []coefficient{{int32(i), 1}}
+		params[i] = -800 + 50*float64(i)
+	}
+	if k := tr.fitK(params); math.Abs(k-1.5) > 1e-3 {
+		t.Errorf("want K = 1.5, got %v", k)
+	}
+}
+
+func TestTune(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data.epd")
+	if err := os.WriteFile(data, []byte(testData), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tune once from the defaults, then again from the result.
+	cfg := DefaultConfig()
+	cfg.Data = data
+	cfg.Output = filepath.Join(dir, "weights.json")
+	cfg.Epochs = 50
+	if err := Tune(cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Weights = cfg.Output
+	cfg.Output = filepath.Join(dir, "weights2.json")
+	if err := Tune(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readWeights(cfg.Output); err != nil {
+		t.Error(err)
+	}
+}
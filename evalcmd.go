@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/clfs/good/eval"
+	"github.com/clfs/good/fen"
+)
+
+// runEval implements the "good eval" command.
+func runEval(args []string) error {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	weights := fs.String("weights", "", "JSON weights `file` to evaluate with, instead of the built-in weights")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: good eval [-weights file] [fen]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *weights != "" {
+		f, err := os.Open(*weights)
+		if err != nil {
+			return err
+		}
+		err = eval.LoadWeights(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	s := fen.Starting
+	if fs.NArg() > 0 {
+		s = strings.Join(fs.Args(), " ")
+	}
+	p, err := fen.From(s)
+	if err != nil {
+		return err
+	}
+	fmt.Print(eval.Trace(p))
+	return nil
+}
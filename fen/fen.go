@@ -143,7 +143,8 @@ func To(p chess.Position) string {
 	return b.String()
 }
 
-// BUG(clfs): From accepts invalid piece placements without returning an error.
+// BUG(clfs): From accepts illegal positions, such as ones without kings,
+// without returning an error.
 
 // From returns the position described by the FEN string.
 //
@@ -162,21 +163,31 @@ func From(s string) (chess.Position, error) {
 	}
 
 	// Piece placement.
-	// TODO: check that all 64 squares are specified.
-	square := chess.A8
-	for _, r := range fields[0] {
-		switch r {
-		case '1', '2', '3', '4', '5', '6', '7', '8':
-			square += chess.Square(r - '0') // advance rightwards
-		case '/':
-			square -= 16 // move to the leftmost square in the rank below
-		default:
-			piece, ok := pieceFrom[r]
-			if !ok {
-				return p, fmt.Errorf("fen: invalid board rune: %c", r)
+	ranks := strings.Split(fields[0], "/")
+	if len(ranks) != 8 {
+		return p, fmt.Errorf("fen: invalid number of ranks: %d", len(ranks))
+	}
+	for i, rank := range ranks {
+		r := chess.Rank8 - chess.Rank(i)
+		f := chess.FileA
+		for _, c := range rank {
+			if f > chess.FileH {
+				return p, fmt.Errorf("fen: too many squares in rank: %s", rank)
 			}
-			p.Put(piece, square)
-			square++
+			switch c {
+			case '1', '2', '3', '4', '5', '6', '7', '8':
+				f += chess.File(c - '0') // advance rightwards
+			default:
+				piece, ok := pieceFrom[c]
+				if !ok {
+					return p, fmt.Errorf("fen: invalid board rune: %c", c)
+				}
+				p.Put(piece, chess.NewSquare(f, r))
+				f++
+			}
+		}
+		if f != chess.FileH+1 {
+			return p, fmt.Errorf("fen: wrong number of squares in rank: %s", rank)
 		}
 	}
 
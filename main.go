@@ -1,19 +1,38 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 
 	"github.com/clfs/good/uci"
 )
 
+// commands maps subcommand names to their implementations. Each receives the
+// arguments following its name.
+var commands = map[string]func(args []string) error{
+	"eval":  runEval,
+	"tb":    runTB,
+	"train": runTrain,
+	"tune":  runTune,
+}
+
 func main() {
-	// for i, v := range chess.TableBlackPawnPushes {
-	// 	if i%4 == 0 {
-	// 		fmt.Printf("\n")
-	// 	}
-	// 	fmt.Printf("%#016X, ", v)
-	// }
+	log.SetFlags(0)
+	log.SetPrefix("good: ")
+
+	if len(os.Args) > 1 {
+		cmd, ok := commands[os.Args[1]]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "good: unknown command %q\n", os.Args[1])
+			os.Exit(2)
+		}
+		if err := cmd(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	client := uci.New(os.Stdin, os.Stdout)
 	if err := client.Run(); err != nil {
 		log.Fatal(err)
@@ -0,0 +1,615 @@
+// Package alphabeta implements the main search.
+//
+// It starts from the same negamax alpha-beta search as refsearch, with
+// iterative deepening, principal variation search, and aspiration windows,
+// and adds the techniques that make a search strong: a transposition table,
+// a quiescence search at the leaves, and staged move ordering by captured
+// material, killer moves, counter-moves, and history.
+//
+// The search is selective. Nodes are pruned by reverse futility pruning,
+// razoring, and verified null-move pruning; late quiet moves are reduced or
+// skipped; and checks and singular hash moves are extended. The parameters of
+// these techniques are listed in Params, for tuning. With a tablebase or
+// depth-to-mate tables, endgame positions they know aren't searched at all.
+package alphabeta
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/eval"
+	"github.com/clfs/good/search/internal/core"
+	"github.com/clfs/good/search/internal/tt"
+	"github.com/clfs/good/tablebase"
+)
+
+// aspirationWindow is the half-width of the first window searched around the
+// previous iteration's score.
+const aspirationWindow = 25
+
+// Search searches p with iterative deepening until the depth or node limit is
+// reached, or ctx is done, and returns the best completed iteration. Results
+// are cached in table, which may hold results from earlier searches.
+//
+// With more than one thread, the threads search p at once, sharing table.
+// The node limit applies to the nodes of every thread together, and each
+// thread may search one node over it.
+//
+// If p has no legal moves, the PV is empty. If no iteration completes, the PV
+// holds the first legal move and the depth is zero.
+func Search(ctx context.Context, table *tt.Table, p chess.Position, opts core.Options) core.Iteration {
+	table.NewSearch()
+	moves := core.Filter(p.LegalMoves(), opts.RootMoves)
+	if len(moves) == 0 {
+		score := 0
+		if p.InCheck() {
+			score = -core.Mate
+		}
+		return core.Iteration{Score: score}
+	}
+	if e, ok := table.Probe(p.Hash(), 0); ok {
+		toFront(moves, e.Move)
+	}
+
+	sh := &shared{threads: make([]*searcher, max(opts.Threads, 1))}
+	r := reductions()
+	for i := range sh.threads {
+		s := &searcher{ctx: ctx, opts: opts, tt: table, sh: sh, id: i, ev: eval.NewEvaluator(), reductions: r}
+		s.hashes = append(s.hashes, opts.History...)
+		s.hashes = append(s.hashes, p.Hash())
+		s.rootMoves = append([]chess.Move(nil), moves...)
+		s.rootNodes = make(map[chess.Move]int64, len(moves))
+		sh.threads[i] = s
+	}
+	return sh.run(p)
+}
+
+// iterate searches p with iterative deepening and returns the last completed
+// iteration. Only the main thread reports iterations.
+func (s *searcher) iterate(p chess.Position) core.Iteration {
+	maxDepth := s.opts.Depth
+	if maxDepth <= 0 || maxDepth > core.MaxPly {
+		maxDepth = core.MaxPly
+	}
+	result := core.Iteration{PV: []chess.Move{s.rootMoves[0]}}
+	for depth := 1; depth <= maxDepth && s.ctx.Err() == nil; depth++ {
+		if s.skipDepth(depth) {
+			continue
+		}
+		s.rootDepth = depth
+		score := s.aspiration(&p, depth, result.Score)
+		if s.stopped {
+			break
+		}
+		result = core.Iteration{
+			Depth: depth,
+			Score: score,
+			PV:    append([]chess.Move(nil), s.pv[0]...),
+		}
+		if s.id == 0 && s.opts.Report != nil {
+			result.Nodes = s.sh.nodes()
+			result.Effort = float64(s.rootNodes[result.PV[0]]) / float64(s.nodes)
+			s.opts.Report(result)
+		}
+		toFront(s.rootMoves, result.PV[0])
+	}
+	return result
+}
+
+// searcher holds the state of a search thread.
+type searcher struct {
+	ctx     context.Context
+	opts    core.Options
+	tt      *tt.Table
+	sh      *shared
+	id      int   // The thread's index; the main thread is 0.
+	nodes   int64 // Accessed atomically, since other threads read it.
+	stopped bool
+
+	ev *eval.Evaluator
+
+	hist       histories
+	reductions [64][64]int // Late-move reductions by depth and move number.
+	rootDepth  int
+	rootMoves  []chess.Move
+	rootNodes  map[chess.Move]int64 // The nodes the thread has searched under each root move.
+	hashes     []uint64             // Hashes of the game and the current line, ending with the current position.
+
+	// Per ply of the current line.
+	stack    [core.MaxPly + 1]stackEntry   // The moves made.
+	evals    [core.MaxPly + 1]int          // Static evaluations, or -core.Infinity in check.
+	excluded [core.MaxPly + 1]chess.Move   // A move to skip, while testing if it's singular.
+	pv       [core.MaxPly + 1][]chess.Move // The principal variation.
+
+	// nmpMinPly disables null moves before it, while a null move's fail high
+	// is verified.
+	nmpMinPly int
+}
+
+// toFront moves m to the front of moves, if it's there, so that it's
+// searched first.
+func toFront(moves []chess.Move, m chess.Move) {
+	for i, rm := range moves {
+		if rm == m {
+			copy(moves[1:i+1], moves[:i])
+			moves[0] = m
+			return
+		}
+	}
+}
+
+// aspiration searches the root to depth, starting with a narrow window
+// around the previous score and widening it on each failure.
+func (s *searcher) aspiration(p *chess.Position, depth, prev int) int {
+	if depth < 4 || core.IsMate(prev) {
+		return s.negamax(p, depth, -core.Infinity, core.Infinity, 0)
+	}
+	delta := aspirationWindow
+	alpha, beta := prev-delta, prev+delta
+	for {
+		score := s.negamax(p, depth, alpha, beta, 0)
+		switch {
+		case s.stopped:
+			return 0
+		case score <= alpha:
+			alpha = max(score-delta, -core.Infinity)
+		case score >= beta:
+			beta = min(score+delta, core.Infinity)
+		default:
+			return score
+		}
+		delta *= 2
+	}
+}
+
+// checkStop sets s.stopped if the search should end.
+func (s *searcher) checkStop() {
+	if atomic.LoadInt32(&s.sh.stop) != 0 {
+		s.stopped = true
+	}
+	if s.opts.Nodes > 0 && s.sh.nodes() >= s.opts.Nodes {
+		s.stopped = true
+	}
+	if s.nodes%1024 == 0 && s.ctx.Err() != nil {
+		s.stopped = true
+	}
+}
+
+// negamax returns the score of p searched to depth, failing soft: if the
+// score is at most alpha, or at least beta, it's a bound on the true score.
+// The principal variation from ply is left in s.pv[ply].
+func (s *searcher) negamax(p *chess.Position, depth, alpha, beta, ply int) int {
+	s.pv[ply] = s.pv[ply][:0]
+	if ply > 0 && s.isRepetition(p, ply) {
+		return 0
+	}
+	if depth <= 0 || ply >= core.MaxPly {
+		return s.quiesce(p, alpha, beta, ply)
+	}
+	if s.checkStop(); s.stopped {
+		return 0
+	}
+	atomic.AddInt64(&s.nodes, 1)
+
+	// The fifty-move rule doesn't apply if the last move mated.
+	if ply > 0 && p.HalfMoves >= 100 && (!p.InCheck() || len(p.LegalMoves()) > 0) {
+		return 0
+	}
+	if ply > 0 && p.IsInsufficientMaterial() {
+		return 0
+	}
+
+	// Neither side can do better than mating on the next move, or worse
+	// than being mated now.
+	if ply > 0 {
+		alpha = max(alpha, -core.Mate+ply)
+		beta = min(beta, core.Mate-ply-1)
+		if alpha >= beta {
+			return alpha
+		}
+	}
+
+	pvNode := beta-alpha > 1
+	excluded := s.excluded[ply]
+
+	// A deep enough result from the table can end the search of the node,
+	// except on the principal variation, which would be cut short. While a
+	// move is excluded, the node isn't the one in the table.
+	hash := s.hashes[len(s.hashes)-1]
+	entry, hit := s.tt.Probe(hash, ply)
+	if excluded != 0 {
+		entry, hit = tt.Entry{}, false
+	}
+	if hit && ply > 0 && !pvNode && entry.Depth >= depth {
+		switch {
+		case entry.Bound == tt.Exact,
+			entry.Bound == tt.Lower && entry.Score >= beta,
+			entry.Bound == tt.Upper && entry.Score <= alpha:
+			return entry.Score
+		}
+	}
+
+	// Depth-to-mate tables and the tablebase end the search of positions
+	// they know, unless their result is a bound that doesn't cut off. Then
+	// the search goes on, on the principal variation, with its result
+	// bounded by theirs. The tablebase ignores the fifty-move counter, so
+	// it's only probed right after a capture or pawn move.
+	tbMin, tbMax := -core.Infinity, core.Infinity
+	if ply > 0 && excluded == 0 {
+		score, bound, ok := 0, tt.Exact, false
+		if dtm := s.opts.DTM; dtm != nil {
+			var wdl tablebase.WDL
+			var plies int
+			if wdl, plies, ok = dtm.Probe(p); ok {
+				score, bound = dtmScore(wdl, plies, ply, int(p.HalfMoves))
+			}
+		}
+		if tb := s.opts.Tablebase; tb != nil && !ok && p.HalfMoves == 0 {
+			var wdl tablebase.WDL
+			if wdl, ok = tb.ProbeWDL(p); ok {
+				score, bound = tbScore(wdl, ply)
+			}
+		}
+		switch {
+		case !ok:
+		case bound == tt.Exact,
+			bound == tt.Lower && score >= beta,
+			bound == tt.Upper && score <= alpha:
+			eval := 0
+			if !p.InCheck() {
+				eval = s.evaluate(p)
+			}
+			s.tt.Store(hash, ply, tt.Entry{Score: score, Eval: eval, Depth: min(depth+tbDepth, core.MaxPly-1), Bound: bound})
+			return score
+		case pvNode && bound == tt.Lower:
+			tbMin, alpha = score, max(alpha, score)
+		case pvNode:
+			tbMax = score
+		}
+	}
+
+	inCheck := p.InCheck()
+	staticEval := -core.Infinity
+	switch {
+	case inCheck:
+	case excluded != 0:
+		staticEval = s.evals[ply]
+	case hit:
+		staticEval = entry.Eval
+	default:
+		staticEval = s.evaluate(p)
+	}
+	s.evals[ply] = staticEval
+	// The position is improving if it evaluates better than the last time
+	// the side to move was to move.
+	improving := !inCheck && ply >= 2 && staticEval > s.evals[ply-2]
+
+	if !pvNode && !inCheck && excluded == 0 {
+		if v, ok := s.prune(p, depth, alpha, beta, ply, staticEval, improving); ok {
+			return v
+		}
+	}
+
+	var mp picker
+	if ply == 0 {
+		mp = s.newRootPicker()
+	} else {
+		mp = s.newPicker(p, ply, entry.Move)
+	}
+	var (
+		best      = tbMin
+		bestMove  chess.Move
+		bound     = tt.Upper
+		legal     int
+		quiets    []chess.Move // Quiet moves searched without a cutoff.
+		lmpLimit  = (lmpBase + depth*depth) / 2
+		nonPawns  = hasNonPawnMaterial(p, p.SideToMove)
+		canExtend = ply < 2*s.rootDepth
+	)
+	if improving {
+		lmpLimit *= 2
+	}
+	for m := mp.nextMove(); m != 0; m = mp.nextMove() {
+		if m == excluded || !p.IsLegal(m) {
+			continue
+		}
+		legal++
+		quiet := isQuiet(p, m)
+		pc, _ := p.Get(m.From())
+		q := *p
+		q.Make(m)
+		givesCheck := q.InCheck()
+
+		// Skip quiet moves that are unlikely to matter, once a move has
+		// saved the side to move from being mated.
+		if ply > 0 && quiet && nonPawns && best > -core.Mate+core.MaxPly {
+			if depth <= lmpDepth && len(quiets) >= lmpLimit {
+				mp.skipQuiets = true
+				continue
+			}
+			if !inCheck && !givesCheck && depth <= futilityDepth &&
+				staticEval+futilityBase+futilityMargin*depth <= alpha {
+				mp.skipQuiets = true
+				continue
+			}
+		}
+
+		extension := 0
+		switch {
+		case !canExtend:
+		case m == entry.Move && s.isSingular(p, depth, ply, entry):
+			extension = 1
+		case s.stopped:
+			return 0
+		case givesCheck && seeGE(p, m, -checkExtensionSEE):
+			extension = 1
+		}
+		newDepth := depth - 1 + extension
+
+		s.stack[ply] = stackEntry{move: m, piece: pc}
+		s.hashes = append(s.hashes, q.Hash())
+		nodes := s.nodes
+
+		var score int
+		if legal == 1 {
+			score = -s.negamax(&q, newDepth, -beta, -alpha, ply+1)
+		} else {
+			// Search late quiet moves to a reduced depth first, expecting
+			// them to fail low. Root moves are ordered by earlier
+			// iterations rather than history, so they're not reduced.
+			r := 0
+			if quiet && depth >= lmrDepth && ply > 0 {
+				r = s.reductions[min(depth, 63)][min(legal, 63)]
+				r -= s.quietScore(ply, pc, m) / lmrHistory
+				if pvNode {
+					r--
+				}
+				if !improving {
+					r++
+				}
+				if givesCheck {
+					r--
+				}
+				r = max(0, min(r, newDepth-1))
+			}
+
+			// Prove that the move is no better than the first with a null
+			// window, and search it properly if it is.
+			score = -s.negamax(&q, newDepth-r, -alpha-1, -alpha, ply+1)
+			if score > alpha && r > 0 {
+				score = -s.negamax(&q, newDepth, -alpha-1, -alpha, ply+1)
+			}
+			if score > alpha && score < beta {
+				score = -s.negamax(&q, newDepth, -beta, -alpha, ply+1)
+			}
+		}
+
+		s.hashes = s.hashes[:len(s.hashes)-1]
+		if ply == 0 {
+			s.rootNodes[m] += s.nodes - nodes
+		}
+		if s.stopped {
+			return 0
+		}
+		if score > best {
+			best, bestMove = score, m
+			if score > alpha {
+				alpha, bound = score, tt.Exact
+				s.pv[ply] = append(append(s.pv[ply][:0], m), s.pv[ply+1]...)
+			}
+			if alpha >= beta {
+				bound = tt.Lower
+				if quiet {
+					s.updateQuiet(p, ply, depth, m, quiets)
+				}
+				break
+			}
+		}
+		if quiet {
+			quiets = append(quiets, m)
+		}
+	}
+	if legal == 0 {
+		switch {
+		case excluded != 0:
+			return alpha
+		case inCheck:
+			return -core.Mate + ply
+		}
+		return 0
+	}
+
+	best = min(best, tbMax)
+
+	if excluded == 0 {
+		eval := staticEval
+		if inCheck {
+			eval = 0
+		}
+		s.tt.Store(hash, ply, tt.Entry{Move: bestMove, Score: best, Eval: eval, Depth: depth, Bound: bound})
+	}
+	return best
+}
+
+// tbDepth is how much deeper than the search a tablebase or depth-to-mate
+// result is stored in the transposition table, since it's exact.
+const tbDepth = 6
+
+// tbScore returns the score and bound of a tablebase result ply plies below
+// the root. Wins are at least as good as winning the tablebase position, and
+// losses at most as bad. Wins and losses spoiled by the fifty-move rule are
+// draws.
+func tbScore(wdl tablebase.WDL, ply int) (int, tt.Bound) {
+	switch wdl {
+	case tablebase.Win:
+		return core.TBWin - ply, tt.Lower
+	case tablebase.Loss:
+		return -core.TBWin + ply, tt.Upper
+	}
+	return 0, tt.Exact
+}
+
+// dtmScore returns the score and bound of a depth-to-mate table result ply
+// plies below the root, with the plies to mate and the fifty-move counter.
+// Mates too deep for a mate score are scored as tablebase wins and losses.
+// The tables ignore the fifty-move rule, so mates it might spoil only bound
+// the score by a draw.
+func dtmScore(wdl tablebase.WDL, plies, ply, halfMoves int) (int, tt.Bound) {
+	switch {
+	case wdl == tablebase.Draw:
+		return 0, tt.Exact
+	case halfMoves+plies > 100 && wdl == tablebase.Win:
+		return 0, tt.Lower
+	case halfMoves+plies > 100:
+		return 0, tt.Upper
+	case wdl == tablebase.Win && ply+plies <= core.MaxPly:
+		return core.Mate - ply - plies, tt.Exact
+	case wdl == tablebase.Win:
+		return core.TBWin - ply, tt.Exact
+	case ply+plies <= core.MaxPly:
+		return -core.Mate + ply + plies, tt.Exact
+	}
+	return -core.TBWin + ply, tt.Exact
+}
+
+// prune tries to end the search of a node that isn't on the principal
+// variation or in check before searching its moves. If it succeeds, it
+// returns the node's score and true.
+func (s *searcher) prune(p *chess.Position, depth, alpha, beta, ply, staticEval int, improving bool) (int, bool) {
+	// Reverse futility pruning.
+	margin := rfpMargin * depth
+	if improving {
+		margin -= rfpMargin
+	}
+	if depth <= rfpDepth && staticEval-margin >= beta && !core.IsMate(beta) {
+		return staticEval, true
+	}
+
+	// Razoring.
+	if depth <= razorDepth && staticEval+razorBase+razorMargin*depth <= alpha {
+		if v := s.quiesce(p, alpha, alpha+1, ply); v <= alpha {
+			return v, true
+		}
+	}
+
+	// Null-move pruning. Without pieces other than pawns, passing may be the
+	// best move, so the null move's result can't be trusted.
+	us := p.SideToMove
+	if ply == 0 || depth < nmpDepth || staticEval < beta || ply < s.nmpMinPly ||
+		s.stack[ply-1].move == 0 || !hasNonPawnMaterial(p, us) {
+		return 0, false
+	}
+	r := nmpBase + depth/nmpDepthDivisor + min((staticEval-beta)/nmpEvalDivisor, 3)
+	q := *p
+	q.MakeNull()
+	s.stack[ply] = stackEntry{}
+	s.hashes = append(s.hashes, q.Hash())
+	v := -s.negamax(&q, depth-1-r, -beta, -beta+1, ply+1)
+	s.hashes = s.hashes[:len(s.hashes)-1]
+	if s.stopped || v < beta {
+		return 0, false
+	}
+	if core.IsMate(v) {
+		v = beta
+	}
+	// Verify the fail high with a search without null moves for the side
+	// to move: a reduced one at high depths, in case of zugzwang, and one
+	// only a ply shallower if zugzwang is likely.
+	verifyDepth, minPly := depth-1-r, ply+3*(depth-1-r)/4
+	switch {
+	case isZugzwangProne(p, us):
+		verifyDepth, minPly = depth-1, ply+1
+	case depth < nmpVerifyDepth:
+		return v, true
+	}
+	saved := s.nmpMinPly
+	s.nmpMinPly = minPly
+	w := s.negamax(p, verifyDepth, beta-1, beta, ply)
+	s.nmpMinPly = saved
+	if !s.stopped && w >= beta {
+		return v, true
+	}
+	return 0, false
+}
+
+// isSingular reports whether the hash move of a node is singular: much
+// better than every other move, so that it's worth extending. The search of
+// the other moves may set s.stopped.
+func (s *searcher) isSingular(p *chess.Position, depth, ply int, entry tt.Entry) bool {
+	if ply == 0 || depth < singularDepth || entry.Bound == tt.Upper ||
+		entry.Depth < depth-singularTTDepth || core.IsMate(entry.Score) {
+		return false
+	}
+	singularBeta := entry.Score - singularMargin*depth
+	s.excluded[ply] = entry.Move
+	v := s.negamax(p, (depth-1)/2, singularBeta-1, singularBeta, ply)
+	s.excluded[ply] = 0
+	return v < singularBeta
+}
+
+// hasNonPawnMaterial reports whether color c has pieces other than pawns
+// and the king.
+func hasNonPawnMaterial(p *chess.Position, c chess.Color) bool {
+	for r := chess.Knight; r <= chess.Queen; r++ {
+		if p.Board[chess.NewPiece(c, r)] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isZugzwangProne reports whether color c has so little material that it
+// may be in zugzwang: no more than one piece other than pawns and the king.
+func isZugzwangProne(p *chess.Position, c chess.Color) bool {
+	n := 0
+	for r := chess.Knight; r <= chess.Queen; r++ {
+		b := p.Board[chess.NewPiece(c, r)]
+		n += b.Count()
+	}
+	return n <= 1
+}
+
+// isRepetition reports whether p repeats a position since the last capture
+// or pawn move, not looking past null moves. p's hash must be the last in
+// s.hashes.
+func (s *searcher) isRepetition(p *chess.Position, ply int) bool {
+	last := len(s.hashes) - 1
+	limit := int(p.HalfMoves)
+	for i := 1; i <= ply && i <= limit; i++ {
+		if s.stack[ply-i].move == 0 {
+			limit = i
+			break
+		}
+	}
+	for i := last - 2; i >= 0 && i >= last-limit; i -= 2 {
+		if s.hashes[i] == s.hashes[last] {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluate returns the static evaluation of p from the side to move's point
+// of view.
+func (s *searcher) evaluate(p *chess.Position) int {
+	v := s.ev.Position(p)
+	if p.SideToMove == chess.Black {
+		return -v
+	}
+	return v
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
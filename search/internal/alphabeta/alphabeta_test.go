@@ -0,0 +1,285 @@
+package alphabeta
+
+import (
+	"context"
+	"testing"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/fen"
+	"github.com/clfs/good/search/internal/core"
+	"github.com/clfs/good/search/internal/tt"
+	"github.com/clfs/good/tablebase"
+	"github.com/clfs/good/tablebase/dtm"
+)
+
+func mustParse(t *testing.T, s string) chess.Position {
+	t.Helper()
+	p, err := fen.From(s)
+	if err != nil {
+		t.Fatalf("%s: %v", s, err)
+	}
+	return p
+}
+
+func TestSearch_Mate(t *testing.T) {
+	cases := []struct {
+		fen   string
+		depth int
+		move  string
+		score int
+	}{
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", 2, "a1a8", core.Mate - 1},
+		{"kbK5/pp6/1P6/8/8/8/8/R7 w - - 0 1", 6, "a1a6", core.Mate - 3}, // Zugzwang.
+		{"r1bqkbnr/pppp1ppp/2n5/4p3/2B1P3/5Q2/PPPP1PPP/RNB1K1NR w KQkq - 0 1", 3, "f3f7", core.Mate - 1},
+	}
+	for _, tc := range cases {
+		p := mustParse(t, tc.fen)
+		got := Search(context.Background(), tt.New(1), p, core.Options{Depth: tc.depth})
+		if len(got.PV) == 0 || got.PV[0].String() != tc.move || got.Score != tc.score {
+			t.Errorf("%s: want %s with score %d, got %v with score %d", tc.fen, tc.move, tc.score, got.PV, got.Score)
+		}
+	}
+}
+
+func TestSearch_NoMoves(t *testing.T) {
+	cases := []struct {
+		fen   string
+		score int
+	}{
+		{"7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", 0},         // Stalemate.
+		{"6Qk/5K2/8/8/8/8/8/8 b - - 0 1", -core.Mate}, // Checkmate.
+	}
+	for _, tc := range cases {
+		got := Search(context.Background(), tt.New(1), mustParse(t, tc.fen), core.Options{Depth: 3})
+		if len(got.PV) != 0 || got.Score != tc.score {
+			t.Errorf("%s: want no moves with score %d, got %v with score %d", tc.fen, tc.score, got.PV, got.Score)
+		}
+	}
+}
+
+// TestSearch_Horizon checks that shallow searches see the replies to
+// captures and checks, and don't take defended material.
+func TestSearch_Horizon(t *testing.T) {
+	cases := []struct {
+		fen   string
+		avoid string
+	}{
+		{"4k3/8/3p4/4p3/8/8/7Q/4K3 w - - 0 1", "h2e5"},
+		{"4k3/8/3p4/4p3/8/5N2/8/4K3 w - - 0 1", "f3e5"},
+		{"3rk3/8/8/3p4/8/8/8/3RK3 w - - 0 1", "d1d5"},
+	}
+	for _, tc := range cases {
+		got := Search(context.Background(), tt.New(1), mustParse(t, tc.fen), core.Options{Depth: 1})
+		if len(got.PV) == 0 || got.PV[0].String() == tc.avoid {
+			t.Errorf("%s: want a move other than %s, got %v with score %d", tc.fen, tc.avoid, got.PV, got.Score)
+		}
+	}
+}
+
+// TestSearch_Table checks that a search is cheaper when the table holds the
+// results of an earlier one.
+func TestSearch_Table(t *testing.T) {
+	p := mustParse(t, "r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10")
+	table := tt.New(1)
+	first := Search(context.Background(), table, p, core.Options{Depth: 3})
+	second := Search(context.Background(), table, p, core.Options{Depth: 3})
+	if second.Score != first.Score || second.Nodes >= first.Nodes {
+		t.Errorf("first search: score %d in %d nodes, second: score %d in %d nodes",
+			first.Score, first.Nodes, second.Score, second.Nodes)
+	}
+}
+
+// rookTablebase knows positions with kings and one rook, which its side
+// wins, and counts its probes.
+type rookTablebase struct {
+	probes int
+}
+
+func (tb *rookTablebase) ProbeWDL(p *chess.Position) (tablebase.WDL, bool) {
+	all := p.AllPieces()
+	if all.Count() != 3 || p.CastleRights != chess.NoCastleRights {
+		return 0, false
+	}
+	tb.probes++
+	switch {
+	case p.Board[chess.NewPiece(p.SideToMove, chess.Rook)] != 0:
+		return tablebase.Win, true
+	case p.Board[chess.NewPiece(p.SideToMove.Opposite(), chess.Rook)] != 0:
+		return tablebase.Loss, true
+	}
+	return tablebase.Draw, true
+}
+
+func (tb *rookTablebase) RootMoves(p *chess.Position) ([]chess.Move, tablebase.WDL, bool) {
+	return nil, 0, false
+}
+
+func TestSearch_Tablebase(t *testing.T) {
+	cases := []struct {
+		fen   string
+		move  string
+		score int
+	}{
+		// Taking the rook leaves a won tablebase position.
+		{"4k3/8/8/8/8/8/3r4/R3K3 w - - 0 1", "e1d2", core.TBWin - 1},
+		// Only taking the rook saves black, and it's a tablebase draw.
+		{"8/8/8/8/8/8/1k6/Rn2K3 b - - 0 1", "b2a1", 0},
+	}
+	for _, tc := range cases {
+		tb := &rookTablebase{}
+		got := Search(context.Background(), tt.New(1), mustParse(t, tc.fen), core.Options{Depth: 4, Tablebase: tb})
+		if len(got.PV) == 0 || got.PV[0].String() != tc.move || got.Score != tc.score || tb.probes == 0 {
+			t.Errorf("%s: want %s with score %d, got %v with score %d after %d probes",
+				tc.fen, tc.move, tc.score, got.PV, got.Score, tb.probes)
+		}
+	}
+}
+
+func TestSearch_DTM(t *testing.T) {
+	key, err := chess.ParseMaterialKey("KRK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := dtm.Generate(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := dtm.NewSet(table)
+
+	// A shallow search finds the exact mate distance of a long mate.
+	for _, fen := range []string{"8/8/8/4k3/8/8/8/R3K3 w - - 0 1", "8/8/8/4k3/8/8/8/R3K3 b - - 0 1"} {
+		p := mustParse(t, fen)
+		wdl, plies, ok := set.Probe(&p)
+		if !ok {
+			t.Fatalf("%s: can't probe", fen)
+		}
+		want := core.Mate - plies
+		if wdl == tablebase.Loss {
+			want = -core.Mate + plies
+		}
+		got := Search(context.Background(), tt.New(1), p, core.Options{Depth: 2, DTM: set})
+		if got.Score != want || len(got.PV) == 0 {
+			t.Errorf("%s: want score %d, got %v with score %d", fen, want, got.PV, got.Score)
+		}
+	}
+
+	// Too close to the fifty-move rule, the mate isn't certain.
+	p := mustParse(t, "8/8/8/4k3/8/8/8/R3K3 w - - 90 1")
+	got := Search(context.Background(), tt.New(1), p, core.Options{Depth: 2, DTM: set})
+	if core.IsMate(got.Score) || got.Score < 0 || got.Score >= core.TBWin-core.MaxPly {
+		t.Errorf("fifty-move counter 90: want a score without a mate, got %v with score %d", got.PV, got.Score)
+	}
+}
+
+func TestDTMScore(t *testing.T) {
+	cases := []struct {
+		wdl                   tablebase.WDL
+		plies, ply, halfMoves int
+		score                 int
+		bound                 tt.Bound
+	}{
+		{tablebase.Win, 5, 2, 0, core.Mate - 7, tt.Exact},
+		{tablebase.Loss, 4, 2, 0, -core.Mate + 6, tt.Exact},
+		{tablebase.Draw, 0, 2, 0, 0, tt.Exact},
+		{tablebase.Win, 20, 3, 80, core.Mate - 23, tt.Exact},                                // Mates on the last move the rule allows.
+		{tablebase.Win, 21, 3, 80, 0, tt.Lower},                                             // Too slow for the fifty-move rule.
+		{tablebase.Loss, 21, 3, 80, 0, tt.Upper},                                            // Too slow for the fifty-move rule.
+		{tablebase.Win, 90, core.MaxPly - 10, 0, core.TBWin - core.MaxPly + 10, tt.Exact},   // Too deep for a mate score.
+		{tablebase.Loss, 90, core.MaxPly - 10, 0, -core.TBWin + core.MaxPly - 10, tt.Exact}, // Too deep for a mate score.
+	}
+	for _, tc := range cases {
+		score, bound := dtmScore(tc.wdl, tc.plies, tc.ply, tc.halfMoves)
+		if score != tc.score || bound != tc.bound {
+			t.Errorf("%+v: want score %d and bound %v, got %d and %v", tc, tc.score, tc.bound, score, bound)
+		}
+		if core.IsMate(score) && (score > core.Mate-tc.ply || score < -core.Mate+tc.ply) {
+			t.Errorf("%+v: score %d is out of the mate range", tc, score)
+		}
+	}
+}
+
+func TestSearch_Effort(t *testing.T) {
+	cases := []struct {
+		fen      string
+		dominant bool
+	}{
+		{"4k3/8/8/3q4/8/8/8/3RK3 w - - 0 1", true}, // Only one move wins the queen.
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", false},
+	}
+	for _, tc := range cases {
+		var effort float64
+		report := func(it core.Iteration) { effort = it.Effort }
+		Search(context.Background(), tt.New(1), mustParse(t, tc.fen), core.Options{Depth: 10, Report: report})
+		if effort <= 0 || effort > 1 || (effort > 0.9) != tc.dominant {
+			t.Errorf("%s: got effort %v", tc.fen, effort)
+		}
+	}
+}
+
+// TestSearch_Repetition checks that a losing side heads for a repetition of
+// an earlier position.
+func TestSearch_Repetition(t *testing.T) {
+	p := mustParse(t, "r2qk2r/8/8/8/8/8/8/4K1N1 w - - 10 40")
+	earlier := p
+	earlier.Make(chess.NewMove(chess.G1, chess.F3))
+
+	got := Search(context.Background(), tt.New(1), p, core.Options{Depth: 3, History: []uint64{earlier.Hash()}})
+	if len(got.PV) == 0 || got.PV[0].String() != "g1f3" || got.Score != 0 {
+		t.Errorf("want g1f3 with score 0, got %v with score %d", got.PV, got.Score)
+	}
+}
+
+// TestSearch_InsufficientMaterial checks that dead positions are drawn
+// without searching them.
+func TestSearch_InsufficientMaterial(t *testing.T) {
+	cases := []string{
+		"4k3/8/8/8/8/8/8/1N2K3 w - - 0 1",
+		"4kb2/8/8/8/8/8/8/2B1K3 w - - 0 1",
+		"4k3/8/8/8/8/8/8/4K3 w - - 0 1",
+	}
+	const depth = 6
+	for _, s := range cases {
+		p := mustParse(t, s)
+		got := Search(context.Background(), tt.New(1), p, core.Options{Depth: depth})
+		// Each iteration searches only the root and its children.
+		if limit := int64(depth * (1 + len(p.LegalMoves()))); got.Score != 0 || got.Nodes > limit {
+			t.Errorf("%s: want score 0 in at most %d nodes, got score %d in %d nodes", s, limit, got.Score, got.Nodes)
+		}
+	}
+}
+
+func TestSearch_Limits(t *testing.T) {
+	p := chess.NewPosition()
+
+	got := Search(context.Background(), tt.New(1), p, core.Options{Nodes: 1000})
+	if got.Nodes > 1000 || len(got.PV) == 0 {
+		t.Errorf("node limit: searched %d nodes, got PV %v", got.Nodes, got.PV)
+	}
+
+	root := []chess.Move{chess.NewMove(chess.A2, chess.A3), chess.NewMove(chess.H2, chess.H3)}
+	got = Search(context.Background(), tt.New(1), p, core.Options{Depth: 2, RootMoves: root})
+	if len(got.PV) == 0 || (got.PV[0] != root[0] && got.PV[0] != root[1]) {
+		t.Errorf("root moves: got PV %v", got.PV)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	got = Search(ctx, tt.New(1), p, core.Options{})
+	if len(got.PV) != 1 || got.Depth != 0 {
+		t.Errorf("canceled: got depth %d and PV %v", got.Depth, got.PV)
+	}
+}
+
+func TestSearch_Threads(t *testing.T) {
+	p := mustParse(t, "r1bqkbnr/pppp1ppp/2n5/4p3/2B1P3/5Q2/PPPP1PPP/RNB1K1NR w KQkq - 0 1")
+	got := Search(context.Background(), tt.New(1), p, core.Options{Depth: 5, Threads: 4})
+	if got.Depth != 5 || len(got.PV) == 0 || got.PV[0].String() != "f3f7" || got.Score != core.Mate-1 {
+		t.Errorf("want f3f7 mating at depth 5, got %v with score %d at depth %d", got.PV, got.Score, got.Depth)
+	}
+
+	// Each thread may search one node over the limit.
+	got = Search(context.Background(), tt.New(1), chess.NewPosition(), core.Options{Nodes: 10000, Threads: 4})
+	if got.Nodes > 10000+3 || len(got.PV) == 0 {
+		t.Errorf("node limit: searched %d nodes, got PV %v", got.Nodes, got.PV)
+	}
+}
@@ -0,0 +1,98 @@
+package alphabeta
+
+import (
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/search/internal/core"
+)
+
+// maxHistory bounds history scores. Updates shrink scores near the bound, so
+// that they never reach it and recent results keep mattering.
+const maxHistory = 16384
+
+// histories remember which quiet moves caused beta cutoffs, to try them
+// early in other positions.
+type histories struct {
+	// killers are, by ply, the last two quiet moves that caused a cutoff.
+	killers [core.MaxPly + 1][2]chess.Move
+
+	// counters are, by the previous move's piece and destination, the last
+	// quiet move that refuted it.
+	counters [12][64]chess.Move
+
+	// butterfly scores quiet moves by side, origin, and destination.
+	butterfly [2][64][64]int16
+
+	// continuation scores quiet moves by piece and destination, following a
+	// move by the previous move's piece and destination.
+	continuation [12][64][12][64]int16
+}
+
+// A stackEntry records the move made from a ply of the current line, and the
+// piece that moved.
+type stackEntry struct {
+	move  chess.Move
+	piece chess.Piece
+}
+
+// gravity adds bonus to a history score, keeping it within maxHistory.
+func gravity(v *int16, bonus int) {
+	if bonus > maxHistory {
+		bonus = maxHistory
+	} else if bonus < -maxHistory {
+		bonus = -maxHistory
+	}
+	abs := bonus
+	if abs < 0 {
+		abs = -abs
+	}
+	*v += int16(bonus - int(*v)*abs/maxHistory)
+}
+
+// quietScore returns the history score of a quiet move of piece pc at ply.
+func (s *searcher) quietScore(ply int, pc chess.Piece, m chess.Move) int {
+	h := &s.hist
+	score := int(h.butterfly[pc.Color()][m.From()][m.To()])
+	for _, back := range [...]int{1, 2} {
+		if ply < back {
+			break
+		}
+		if prev := s.stack[ply-back]; prev.move != 0 {
+			score += int(h.continuation[prev.piece][prev.move.To()][pc][m.To()])
+		}
+	}
+	return score
+}
+
+// updateQuiet rewards a quiet move that caused a beta cutoff at ply, and
+// penalizes the quiet moves tried before it.
+func (s *searcher) updateQuiet(p *chess.Position, ply, depth int, best chess.Move, tried []chess.Move) {
+	h := &s.hist
+	if k := &h.killers[ply]; k[0] != best {
+		k[0], k[1] = best, k[0]
+	}
+	if ply > 0 {
+		if prev := s.stack[ply-1]; prev.move != 0 {
+			h.counters[prev.piece][prev.move.To()] = best
+		}
+	}
+
+	bonus := depth * depth
+	s.updateQuietScore(p, ply, best, bonus)
+	for _, m := range tried {
+		s.updateQuietScore(p, ply, m, -bonus)
+	}
+}
+
+func (s *searcher) updateQuietScore(p *chess.Position, ply int, m chess.Move, bonus int) {
+	h := &s.hist
+	pc, _ := p.Get(m.From())
+	gravity(&h.butterfly[pc.Color()][m.From()][m.To()], bonus)
+	for _, back := range [...]int{1, 2} {
+		if ply < back {
+			break
+		}
+		if prev := s.stack[ply-back]; prev.move != 0 {
+			gravity(&h.continuation[prev.piece][prev.move.To()][pc][m.To()], bonus)
+		}
+	}
+}
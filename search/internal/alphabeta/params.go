@@ -0,0 +1,133 @@
+package alphabeta
+
+import (
+	"fmt"
+	"math"
+)
+
+// Parameters of the selective search. Depths are in plies, and margins in
+// centipawns.
+var (
+	// Reverse futility pruning: at shallow depths, a node whose static
+	// evaluation beats beta by a margin per ply fails high.
+	rfpDepth  = 8
+	rfpMargin = 75
+
+	// Razoring: at shallow depths, a node whose static evaluation is far
+	// below alpha is resolved by a quiescence search if that fails low.
+	razorDepth  = 3
+	razorBase   = 200
+	razorMargin = 150
+
+	// Null-move pruning: a node fails high if passing still beats beta in a
+	// search reduced by nmpBase + depth/nmpDepthDivisor plies, and by one more
+	// per nmpEvalDivisor of static evaluation above beta, up to three. At
+	// nmpVerifyDepth and deeper, or with little material, fail highs are
+	// verified by a reduced search without null moves.
+	nmpDepth        = 3
+	nmpBase         = 3
+	nmpDepthDivisor = 3
+	nmpEvalDivisor  = 200
+	nmpVerifyDepth  = 12
+
+	// Late-move reductions: quiet moves searched after the first are reduced
+	// by lmrBase/100 + ln(depth)*ln(move number)/(lmrDivisor/100) plies, less
+	// one per lmrHistory of history score.
+	lmrDepth   = 3
+	lmrBase    = 75
+	lmrDivisor = 225
+	lmrHistory = 8192
+
+	// Futility pruning: at shallow depths, quiet moves are skipped if the
+	// static evaluation plus a margin can't reach alpha.
+	futilityDepth  = 6
+	futilityBase   = 100
+	futilityMargin = 100
+
+	// Late-move pruning: at shallow depths, quiet moves after the first
+	// (lmpBase + depth²)/2 are skipped, or twice as many if the position is
+	// improving.
+	lmpDepth = 8
+	lmpBase  = 3
+
+	// Check extensions: checks that don't lose more than checkExtensionSEE
+	// in exchanges are extended by a ply.
+	checkExtensionSEE = 0
+
+	// Singular extensions: from singularDepth, the hash move is extended by a
+	// ply if every other move fails low against the hash score less
+	// singularMargin per ply, in a search of half the depth. The hash score
+	// must be from at least singularTTDepth plies less deep.
+	singularDepth   = 8
+	singularMargin  = 2
+	singularTTDepth = 3
+)
+
+// A Param is a tunable parameter of the search.
+type Param struct {
+	Name     string
+	Default  int
+	Min, Max int
+	value    *int
+}
+
+// Params lists the parameters of the search, for tuning, for example with
+// SPSA.
+var Params = []Param{
+	{Name: "RFPDepth", Min: 0, Max: 16, value: &rfpDepth},
+	{Name: "RFPMargin", Min: 10, Max: 300, value: &rfpMargin},
+	{Name: "RazorDepth", Min: 0, Max: 8, value: &razorDepth},
+	{Name: "RazorBase", Min: 0, Max: 1000, value: &razorBase},
+	{Name: "RazorMargin", Min: 0, Max: 600, value: &razorMargin},
+	{Name: "NMPDepth", Min: 1, Max: 16, value: &nmpDepth},
+	{Name: "NMPBase", Min: 1, Max: 8, value: &nmpBase},
+	{Name: "NMPDepthDivisor", Min: 1, Max: 16, value: &nmpDepthDivisor},
+	{Name: "NMPEvalDivisor", Min: 25, Max: 1000, value: &nmpEvalDivisor},
+	{Name: "NMPVerifyDepth", Min: 1, Max: 64, value: &nmpVerifyDepth},
+	{Name: "LMRDepth", Min: 1, Max: 16, value: &lmrDepth},
+	{Name: "LMRBase", Min: 0, Max: 300, value: &lmrBase},
+	{Name: "LMRDivisor", Min: 50, Max: 600, value: &lmrDivisor},
+	{Name: "LMRHistory", Min: 512, Max: 65536, value: &lmrHistory},
+	{Name: "FutilityDepth", Min: 0, Max: 16, value: &futilityDepth},
+	{Name: "FutilityBase", Min: 0, Max: 1000, value: &futilityBase},
+	{Name: "FutilityMargin", Min: 10, Max: 500, value: &futilityMargin},
+	{Name: "LMPDepth", Min: 0, Max: 16, value: &lmpDepth},
+	{Name: "LMPBase", Min: 0, Max: 32, value: &lmpBase},
+	{Name: "CheckExtensionSEE", Min: -1000, Max: 1000, value: &checkExtensionSEE},
+	{Name: "SingularDepth", Min: 2, Max: 32, value: &singularDepth},
+	{Name: "SingularMargin", Min: 0, Max: 16, value: &singularMargin},
+	{Name: "SingularTTDepth", Min: 0, Max: 16, value: &singularTTDepth},
+}
+
+func init() {
+	for i := range Params {
+		Params[i].Default = *Params[i].value
+	}
+}
+
+// SetParam sets a parameter by name. It must not be called during a search.
+func SetParam(name string, value int) error {
+	for _, p := range Params {
+		if p.Name != name {
+			continue
+		}
+		if value < p.Min || value > p.Max {
+			return fmt.Errorf("alphabeta: %s: %d is out of range [%d, %d]", name, value, p.Min, p.Max)
+		}
+		*p.value = value
+		return nil
+	}
+	return fmt.Errorf("alphabeta: unknown parameter %s", name)
+}
+
+// reductions returns the table of late-move reductions by depth and move
+// number, for the current parameters.
+func reductions() (r [64][64]int) {
+	for d := 1; d < 64; d++ {
+		for n := 1; n < 64; n++ {
+			v := float64(lmrBase)/100 + math.Log(float64(d))*math.Log(float64(n))/(float64(lmrDivisor)/100)
+			r[d][n] = int(v)
+		}
+	}
+	return r
+}
@@ -0,0 +1,36 @@
+package alphabeta
+
+import "testing"
+
+func TestSetParam(t *testing.T) {
+	defer SetParam("RFPMargin", rfpMargin)
+	if err := SetParam("RFPMargin", 100); err != nil {
+		t.Fatal(err)
+	}
+	if rfpMargin != 100 {
+		t.Errorf("want rfpMargin 100, got %d", rfpMargin)
+	}
+	for _, c := range []struct {
+		name  string
+		value int
+	}{
+		{"RFPMargin", 0},
+		{"RFPMargin", 1000},
+		{"NoSuchParam", 1},
+	} {
+		if err := SetParam(c.name, c.value); err == nil {
+			t.Errorf("%s %d: want an error", c.name, c.value)
+		}
+	}
+	if rfpMargin != 100 {
+		t.Errorf("failed calls changed rfpMargin to %d", rfpMargin)
+	}
+}
+
+func TestParams(t *testing.T) {
+	for _, p := range Params {
+		if p.Default < p.Min || p.Default > p.Max {
+			t.Errorf("%s: default %d is out of range [%d, %d]", p.Name, p.Default, p.Min, p.Max)
+		}
+	}
+}
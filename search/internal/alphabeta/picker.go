@@ -0,0 +1,243 @@
+package alphabeta
+
+import "github.com/clfs/good/chess"
+
+// A stage is a step of move picking. Moves are generated a stage at a time,
+// so a beta cutoff on an early move skips generating the rest.
+type stage int
+
+const (
+	stageHash         stage = iota // The move from the transposition table.
+	stageGenCaptures               // Generate and score captures and queen promotions.
+	stageGoodCaptures              // Captures that don't lose material, by MVV-LVA.
+	stageKillers                   // Quiet moves that caused cutoffs at the same ply.
+	stageCounter                   // The quiet move that last refuted the previous move.
+	stageGenQuiets                 // Generate and score quiet moves.
+	stageQuiets                    // Quiet moves, by history.
+	stageBadCaptures               // Captures that lose material, in generation order.
+	stageDone
+	stageRoot // Root moves, in the order given.
+)
+
+// A scoredMove is a move with its ordering score.
+type scoredMove struct {
+	move  chess.Move
+	score int
+}
+
+// A picker returns the pseudo-legal moves of a position one at a time, best
+// first by the move ordering heuristics. Legality is left to the caller.
+type picker struct {
+	s     *searcher
+	p     *chess.Position
+	ply   int
+	stage stage
+
+	hashMove chess.Move
+	killers  [2]chess.Move
+	counter  chess.Move
+
+	returned  [3]chess.Move // Killers and the counter-move, once returned.
+	nReturned int
+
+	moves []scoredMove // Moves of the current stage.
+	next  int          // Index of the next move to return from moves.
+	bad   []chess.Move // Captures that lose material.
+
+	// noisyOnly skips quiet moves and losing captures, for the quiescence
+	// search.
+	noisyOnly bool
+
+	// skipQuiets skips the remaining quiet moves, once the search has
+	// decided they're not worth trying.
+	skipQuiets bool
+}
+
+// newPicker returns a picker for p at ply. The hash move is tried first if
+// it's pseudo-legal.
+func (s *searcher) newPicker(p *chess.Position, ply int, hashMove chess.Move) picker {
+	mp := picker{s: s, p: p, ply: ply, hashMove: hashMove}
+	if !p.IsPseudoLegal(hashMove) {
+		mp.hashMove = 0
+	}
+	mp.killers = s.hist.killers[ply]
+	if ply > 0 {
+		if prev := s.stack[ply-1]; prev.move != 0 {
+			mp.counter = s.hist.counters[prev.piece][prev.move.To()]
+		}
+	}
+	return mp
+}
+
+// newRootPicker returns a picker of the root moves, in order. They're
+// ordered by earlier iterations rather than by heuristics.
+func (s *searcher) newRootPicker() picker {
+	mp := picker{s: s, stage: stageRoot}
+	for _, m := range s.rootMoves {
+		mp.moves = append(mp.moves, scoredMove{move: m})
+	}
+	return mp
+}
+
+// newNoisyPicker returns a picker of the captures and queen promotions of p
+// that don't lose material.
+func (s *searcher) newNoisyPicker(p *chess.Position, ply int) picker {
+	return picker{s: s, p: p, ply: ply, stage: stageGenCaptures, noisyOnly: true}
+}
+
+// nextMove returns the next move, or zero if there are no more.
+func (mp *picker) nextMove() chess.Move {
+	for {
+		if mp.skipQuiets && mp.stage >= stageKillers && mp.stage <= stageQuiets {
+			mp.stage, mp.next = stageBadCaptures, 0
+		}
+		switch mp.stage {
+		case stageHash:
+			mp.stage++
+			if mp.hashMove != 0 {
+				return mp.hashMove
+			}
+
+		case stageGenCaptures:
+			mp.moves, mp.next = mp.moves[:0], 0
+			for _, m := range mp.p.NoisyMoves() {
+				if m == mp.hashMove {
+					continue
+				}
+				attacker, _ := mp.p.Get(m.From())
+				mp.moves = append(mp.moves, scoredMove{m, 10*gain(mp.p, m) - seeValues[attacker.Role()]})
+			}
+			mp.stage++
+
+		case stageGoodCaptures:
+			if mp.next == len(mp.moves) {
+				if mp.noisyOnly {
+					mp.stage = stageDone
+				} else {
+					mp.stage, mp.next = mp.stage+1, 0
+				}
+				continue
+			}
+			m := mp.pickBest()
+			if seeGE(mp.p, m, 0) {
+				return m
+			}
+			if !mp.noisyOnly {
+				mp.bad = append(mp.bad, m)
+			}
+
+		case stageKillers:
+			if mp.next < len(mp.killers) {
+				m := mp.killers[mp.next]
+				mp.next++
+				if m != 0 && mp.isNewQuiet(m) {
+					return mp.early(m)
+				}
+				continue
+			}
+			mp.stage++
+
+		case stageCounter:
+			mp.stage++
+			if m := mp.counter; m != 0 && mp.isNewQuiet(m) {
+				return mp.early(m)
+			}
+
+		case stageGenQuiets:
+			mp.moves, mp.next = mp.moves[:0], 0
+			for _, m := range mp.p.QuietMoves() {
+				if mp.seen(m) {
+					continue
+				}
+				pc, _ := mp.p.Get(m.From())
+				mp.moves = append(mp.moves, scoredMove{m, mp.s.quietScore(mp.ply, pc, m)})
+			}
+			sortMoves(mp.moves)
+			mp.stage++
+
+		case stageQuiets:
+			if mp.next < len(mp.moves) {
+				mp.next++
+				return mp.moves[mp.next-1].move
+			}
+			mp.stage, mp.next = mp.stage+1, 0
+
+		case stageRoot:
+			if mp.next < len(mp.moves) {
+				mp.next++
+				return mp.moves[mp.next-1].move
+			}
+			mp.stage = stageDone
+
+		case stageBadCaptures:
+			if mp.next < len(mp.bad) {
+				mp.next++
+				return mp.bad[mp.next-1]
+			}
+			mp.stage++
+
+		default:
+			return 0
+		}
+	}
+}
+
+// isNewQuiet reports whether m is a pseudo-legal quiet move that hasn't been
+// returned yet by an earlier stage.
+func (mp *picker) isNewQuiet(m chess.Move) bool {
+	return !mp.seen(m) && mp.p.IsPseudoLegal(m) && isQuiet(mp.p, m)
+}
+
+// seen reports whether m was returned before quiet moves were generated.
+func (mp *picker) seen(m chess.Move) bool {
+	if m == mp.hashMove {
+		return true
+	}
+	for _, e := range mp.returned[:mp.nReturned] {
+		if m == e {
+			return true
+		}
+	}
+	return false
+}
+
+// early records that a quiet move is returned before quiet moves are
+// generated, and returns it.
+func (mp *picker) early(m chess.Move) chess.Move {
+	mp.returned[mp.nReturned] = m
+	mp.nReturned++
+	return m
+}
+
+// pickBest removes the highest scoring remaining move from the current stage
+// and returns it. Captures are picked this way rather than sorted, since a
+// cutoff usually comes after a few.
+func (mp *picker) pickBest() chess.Move {
+	best := mp.next
+	for i := mp.next + 1; i < len(mp.moves); i++ {
+		if mp.moves[i].score > mp.moves[best].score {
+			best = i
+		}
+	}
+	mp.moves[mp.next], mp.moves[best] = mp.moves[best], mp.moves[mp.next]
+	mp.next++
+	return mp.moves[mp.next-1].move
+}
+
+// sortMoves sorts moves by descending score, keeping equal moves in order.
+func sortMoves(moves []scoredMove) {
+	for i := 1; i < len(moves); i++ {
+		for j := i; j > 0 && moves[j].score > moves[j-1].score; j-- {
+			moves[j], moves[j-1] = moves[j-1], moves[j]
+		}
+	}
+}
+
+// isQuiet reports whether m is a quiet move: neither a capture nor a queen
+// promotion.
+func isQuiet(p *chess.Position, m chess.Move) bool {
+	if promotion, ok := m.Promotion(); ok {
+		return promotion.Role() != chess.Queen && !p.IsCapture(m)
+	}
+	return !p.IsCapture(m)
+}
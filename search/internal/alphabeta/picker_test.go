@@ -0,0 +1,113 @@
+package alphabeta
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/fen"
+)
+
+// pickAll returns every move of a picker.
+func pickAll(mp *picker) []chess.Move {
+	var moves []chess.Move
+	for m := mp.nextMove(); m != 0; m = mp.nextMove() {
+		moves = append(moves, m)
+	}
+	return moves
+}
+
+// TestPicker_AllMoves checks that pickers return each pseudo-legal move once,
+// whatever moves they're given to try early.
+func TestPicker_AllMoves(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	randomMove := func() chess.Move {
+		return chess.NewMove(chess.Square(r.Intn(64)), chess.Square(r.Intn(64)))
+	}
+	for _, s := range []string{
+		fen.Starting,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 b kq - 0 1",
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+	} {
+		p := mustParse(t, s)
+		want := p.PseudoLegalMoves()
+		for i := 0; i < 50; i++ {
+			// Half the time, use real moves, which may be captures.
+			early := [4]chess.Move{randomMove(), randomMove(), randomMove(), randomMove()}
+			for j := range early {
+				if r.Intn(2) == 0 {
+					early[j] = want[r.Intn(len(want))]
+				}
+			}
+			sr := &searcher{}
+			sr.hist.killers[1] = [2]chess.Move{early[1], early[2]}
+			sr.stack[0] = stackEntry{move: chess.NewMove(chess.E7, chess.E5), piece: chess.BlackPawn}
+			sr.hist.counters[chess.BlackPawn][chess.E5] = early[3]
+
+			mp := sr.newPicker(&p, 1, early[0])
+			got := pickAll(&mp)
+			seen := make(map[chess.Move]bool)
+			for _, m := range got {
+				if seen[m] {
+					t.Errorf("%s: early moves %v: %v picked twice", s, early, m)
+				}
+				seen[m] = true
+			}
+			if len(got) != len(want) {
+				t.Errorf("%s: early moves %v: want %d moves, got %d", s, early, len(want), len(got))
+			}
+		}
+	}
+}
+
+func TestPicker_Order(t *testing.T) {
+	// White can take a rook with a pawn, a knight with a bishop, a defended
+	// pawn with the queen, or play quiet moves.
+	p := mustParse(t, "4k3/8/2r2p2/1P2p3/6n1/8/4B2Q/4K3 w - - 0 1")
+	var (
+		hashMove = chess.NewMove(chess.E1, chess.F1)
+		killer   = chess.NewMove(chess.H2, chess.H7)
+		counter  = chess.NewMove(chess.E2, chess.D3)
+		history  = chess.NewMove(chess.E1, chess.F2)
+	)
+	sr := &searcher{}
+	sr.hist.killers[1] = [2]chess.Move{killer, chess.NewMove(chess.A1, chess.A2)} // The second isn't pseudo-legal.
+	sr.stack[0] = stackEntry{move: chess.NewMove(chess.E7, chess.E5), piece: chess.BlackPawn}
+	sr.hist.counters[chess.BlackPawn][chess.E5] = counter
+	gravity(&sr.hist.butterfly[chess.White][history.From()][history.To()], 100)
+
+	mp := sr.newPicker(&p, 1, hashMove)
+	got := pickAll(&mp)
+	want := []string{"e1f1", "b5c6", "e2g4", "h2h7", "e2d3", "e1f2"}
+	for i, w := range want {
+		if i >= len(got) || got[i].String() != w {
+			t.Fatalf("want moves starting %v, got %v", want, got)
+		}
+	}
+	if last := got[len(got)-1].String(); last != "h2e5" {
+		t.Errorf("want the losing capture h2e5 last, got %s in %v", last, got)
+	}
+
+	noisy := sr.newNoisyPicker(&p, 1)
+	got = pickAll(&noisy)
+	if len(got) != 2 || got[0].String() != "b5c6" || got[1].String() != "e2g4" {
+		t.Errorf("noisy: want [b5c6 e2g4], got %v", got)
+	}
+}
+
+func TestGravity(t *testing.T) {
+	var v int16
+	for i := 0; i < 1000; i++ {
+		gravity(&v, 2*maxHistory)
+		if v > maxHistory {
+			t.Fatalf("after %d bonuses: %d is over %d", i+1, v, maxHistory)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		gravity(&v, -400)
+		if v < -maxHistory {
+			t.Fatalf("after %d maluses: %d is under %d", i+1, v, -maxHistory)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package alphabeta
+
+import (
+	"sync/atomic"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/search/internal/core"
+)
+
+// deltaMargin is how much more than the captured material a capture may gain
+// through positional factors. Captures that can't raise alpha even with it
+// are pruned.
+const deltaMargin = 200
+
+// quiesce returns the score of p searched until it's quiet, failing soft, so
+// that the main search isn't misled by evaluating positions in the middle of
+// exchanges.
+//
+// Out of check, the side to move may stand pat on the static evaluation, or
+// try captures and queen promotions, skipping those that lose material or
+// can't raise alpha. In check, every move is searched, so mates are found.
+func (s *searcher) quiesce(p *chess.Position, alpha, beta, ply int) int {
+	if s.checkStop(); s.stopped {
+		return 0
+	}
+	atomic.AddInt64(&s.nodes, 1)
+	if ply >= core.MaxPly {
+		return s.evaluate(p)
+	}
+
+	inCheck := p.InCheck()
+	best, standPat := -core.Infinity, 0
+	var mp picker
+	if inCheck {
+		mp = s.newPicker(p, ply, 0)
+	} else {
+		standPat = s.evaluate(p)
+		if standPat >= beta {
+			return standPat
+		}
+		best, alpha = standPat, max(alpha, standPat)
+		mp = s.newNoisyPicker(p, ply)
+	}
+
+	legal := 0
+	for m := mp.nextMove(); m != 0; m = mp.nextMove() {
+		if !inCheck && standPat+gain(p, m)+deltaMargin <= alpha {
+			continue
+		}
+		if !p.IsLegal(m) {
+			continue
+		}
+		legal++
+		pc, _ := p.Get(m.From())
+		s.stack[ply] = stackEntry{move: m, piece: pc}
+
+		q := *p
+		q.Make(m)
+		score := -s.quiesce(&q, -beta, -alpha, ply+1)
+		if s.stopped {
+			return 0
+		}
+		if score > best {
+			best = score
+			if score > alpha {
+				alpha = score
+			}
+			if alpha >= beta {
+				break
+			}
+		}
+	}
+	if inCheck && legal == 0 {
+		return -core.Mate + ply
+	}
+	return best
+}
+
+// gain returns the material a noisy move wins, not counting recaptures.
+func gain(p *chess.Position, m chess.Move) int {
+	var v int
+	if victim, ok := p.Get(m.To()); ok {
+		v = seeValues[victim.Role()]
+	} else if p.IsEnPassant(m) {
+		v = seeValues[chess.Pawn]
+	}
+	if promotion, ok := m.Promotion(); ok {
+		v += seeValues[promotion.Role()] - seeValues[chess.Pawn]
+	}
+	return v
+}
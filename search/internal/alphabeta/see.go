@@ -0,0 +1,82 @@
+package alphabeta
+
+import "github.com/clfs/good/chess"
+
+// seeValues are the piece values used by static exchange evaluation. The king
+// can't be captured, so its value never matters.
+var seeValues = [6]int{100, 320, 330, 500, 950, 0}
+
+// seeGE reports whether the static exchange evaluation of m is at least
+// threshold: whether, if both sides keep capturing on m's destination with
+// their least valuable piece while it pays to, the side to move gains at
+// least threshold. Pins are ignored.
+//
+// Castling, en passant captures, and promotions are assumed to gain nothing.
+func seeGE(p *chess.Position, m chess.Move, threshold int) bool {
+	if _, ok := m.Promotion(); ok || p.IsCastle(m) || p.IsEnPassant(m) {
+		return 0 >= threshold
+	}
+	from, to := m.From(), m.To()
+
+	// swap is what the side to move gains if the exchange stops now, less
+	// the threshold, from the point of view of the side that just captured.
+	swap := -threshold
+	if victim, ok := p.Get(to); ok {
+		swap += seeValues[victim.Role()]
+	}
+	if swap < 0 {
+		return false
+	}
+	attacker, _ := p.Get(from)
+	swap = seeValues[attacker.Role()] - swap
+	if swap <= 0 {
+		return true
+	}
+
+	occupied := p.AllPieces() &^ from.Bitboard() &^ to.Bitboard()
+	attackers := p.Attackers(to, occupied)
+	bishops := p.Board[chess.WhiteBishop] | p.Board[chess.BlackBishop] | p.Board[chess.WhiteQueen] | p.Board[chess.BlackQueen]
+	rooks := p.Board[chess.WhiteRook] | p.Board[chess.BlackRook] | p.Board[chess.WhiteQueen] | p.Board[chess.BlackQueen]
+
+	stm := p.SideToMove
+	res := true // Whether the side to move reaches the threshold.
+	for {
+		stm = stm.Opposite()
+		attackers &= occupied
+		ours := attackers & p.Pieces(stm)
+		if ours == 0 {
+			break
+		}
+		res = !res
+
+		var r chess.Role
+		var bb chess.Bitboard
+		for r = chess.Pawn; r <= chess.King; r++ {
+			if bb = ours & p.Board[chess.NewPiece(stm, r)]; bb != 0 {
+				break
+			}
+		}
+		if r == chess.King {
+			// The king may only capture if the square isn't defended.
+			if attackers&^p.Pieces(stm) != 0 {
+				return !res
+			}
+			return res
+		}
+
+		swap = seeValues[r] - swap
+		if res && swap < 1 || !res && swap < 0 {
+			break
+		}
+		occupied &^= bb.First().Bitboard()
+		switch r {
+		case chess.Pawn, chess.Bishop:
+			attackers |= chess.BishopAttacks(to, occupied) & bishops
+		case chess.Rook:
+			attackers |= chess.RookAttacks(to, occupied) & rooks
+		case chess.Queen:
+			attackers |= chess.BishopAttacks(to, occupied)&bishops | chess.RookAttacks(to, occupied)&rooks
+		}
+	}
+	return res
+}
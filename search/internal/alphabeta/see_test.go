@@ -0,0 +1,43 @@
+package alphabeta
+
+import (
+	"testing"
+
+	"github.com/clfs/good/chess"
+)
+
+func TestSeeGE(t *testing.T) {
+	cases := []struct {
+		fen  string
+		move string
+		want int
+	}{
+		{"4k3/8/8/4p3/8/8/8/4RK2 w - - 0 1", "e1e5", 100},              // Undefended pawn.
+		{"4k3/8/3p4/4p3/8/8/7Q/4K3 w - - 0 1", "h2e5", 100 - 950},      // Defended pawn.
+		{"4k3/8/3p4/4n3/3P4/8/8/4K3 w - - 0 1", "d4e5", 320 - 100},     // Pawn takes a defended knight.
+		{"4k3/8/3p4/4p3/8/5N2/8/4K3 w - - 0 1", "f3e5", 100 - 320},     // Knight takes a defended pawn.
+		{"4k3/4r3/8/4p3/8/8/4R3/4R1K1 w - - 0 1", "e2e5", 100},         // Rooks recapture from behind.
+		{"4k3/4r3/4r3/4p3/8/8/4R3/4R1K1 w - - 0 1", "e2e5", 100 - 500}, // Black captures last.
+		{"4k3/8/8/3Kp3/8/8/8/8 w - - 0 1", "d5e5", 100},                // The king takes an undefended pawn.
+		{"4k3/1p6/8/8/8/8/8/R3K3 w - - 0 1", "a1a6", -500},             // Quiet move to an attacked square.
+		{"4k3/8/8/8/8/8/8/R3K3 w - - 0 1", "a1a7", 0},                  // Quiet move.
+		{"4k3/8/8/8/8/8/8/R3K2R w KQ - 0 1", "e1g1", 0},                // Castling.
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", 0},               // En passant.
+		{"1r2k3/P7/8/8/8/8/8/4K3 w - - 0 1", "a7b8q", 0},               // Promotion.
+	}
+	for _, tc := range cases {
+		p := mustParse(t, tc.fen)
+		var m chess.Move
+		for _, lm := range p.PseudoLegalMoves() {
+			if lm.String() == tc.move {
+				m = lm
+			}
+		}
+		if m == 0 {
+			t.Fatalf("%s: %s isn't a move", tc.fen, tc.move)
+		}
+		if !seeGE(&p, m, tc.want) || seeGE(&p, m, tc.want+1) {
+			t.Errorf("%s: %s: want SEE %d", tc.fen, tc.move, tc.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package alphabeta
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/search/internal/core"
+)
+
+// shared is the state shared by the threads of a search.
+//
+// Threads search with Lazy SMP: each runs its own iterative deepening search
+// of the root, with its own histories, and they cooperate only through the
+// transposition table. Helper threads skip some depths, so that they tend to
+// be ahead of the main thread and fill the table with results it can use.
+type shared struct {
+	threads []*searcher // The main thread first, then the helpers.
+	stop    int32       // Non-zero once the threads should stop, accessed atomically.
+}
+
+// run runs every thread on p until the main thread finishes, and returns the
+// best iteration any of them completed.
+func (sh *shared) run(p chess.Position) core.Iteration {
+	results := make([]core.Iteration, len(sh.threads))
+	var wg sync.WaitGroup
+	for i := 1; i < len(sh.threads); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = sh.threads[i].iterate(p)
+		}(i)
+	}
+	results[0] = sh.threads[0].iterate(p)
+	atomic.StoreInt32(&sh.stop, 1)
+	wg.Wait()
+
+	best := results[0]
+	for _, r := range results[1:] {
+		if r.Depth > best.Depth || r.Depth == best.Depth && r.Score > best.Score {
+			best = r
+		}
+	}
+	best.Nodes = sh.nodes()
+	return best
+}
+
+// nodes returns the nodes searched by every thread.
+func (sh *shared) nodes() int64 {
+	var n int64
+	for _, s := range sh.threads {
+		n += atomic.LoadInt64(&s.nodes)
+	}
+	return n
+}
+
+// The depths helper threads skip, as in Stockfish: helper i skips blocks of
+// skipSize[i%20] depths, alternately, starting at a phase of skipPhase[i%20].
+var (
+	skipSize  = [20]int{1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 3, 3, 4, 4, 4, 4, 4, 4, 4, 4}
+	skipPhase = [20]int{0, 1, 0, 1, 2, 3, 0, 1, 2, 3, 4, 5, 0, 1, 2, 3, 4, 5, 6, 7}
+)
+
+// skipDepth reports whether the thread skips an iteration of depth.
+func (s *searcher) skipDepth(depth int) bool {
+	if s.id == 0 {
+		return false
+	}
+	i := (s.id - 1) % len(skipSize)
+	return (depth+skipPhase[i])/skipSize[i]%2 != 0
+}
@@ -0,0 +1,108 @@
+// Package core defines what search backends have in common: how they score
+// positions, how they're limited, and what they report.
+package core
+
+import (
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/tablebase"
+)
+
+// Scores are in centipawns from the side to move's point of view, except
+// for mate scores, which count the plies to mate from the root.
+const (
+	// Infinity is greater than any score.
+	Infinity = 32001
+	// Mate is the score of checkmating at the root. Mating in n plies scores
+	// Mate - n, and being mated in n plies scores -Mate + n.
+	Mate = 32000
+	// MaxPly is the deepest any search goes.
+	MaxPly = 128
+	// TBWin is the score of a tablebase win at the root. Reaching a won
+	// tablebase position in n plies scores TBWin - n, and a lost one
+	// -TBWin + n, which are less than any mate score.
+	TBWin = Mate - 2*MaxPly
+)
+
+// IsMate reports whether a score is a mate score.
+func IsMate(score int) bool {
+	return score >= Mate-MaxPly || score <= -Mate+MaxPly
+}
+
+// Options configures a search.
+type Options struct {
+	Depth int   // The deepest iteration, or 0 to search until stopped.
+	Nodes int64 // The nodes to search at most, or 0 for no limit.
+
+	// Threads is the number of threads to search with. Zero means one.
+	Threads int
+
+	// RootMoves restricts the search to some legal moves. If it's empty,
+	// every legal move is searched.
+	RootMoves []chess.Move
+
+	// Tablebase, if non-nil, gives the results of endgame positions.
+	Tablebase Tablebase
+
+	// DTM, if non-nil, gives the distance to mate of endgame positions, for
+	// exact mate scores.
+	DTM DTM
+
+	// History holds the hashes of the game's earlier positions, oldest
+	// first, so that repetitions can be detected.
+	History []uint64
+
+	// Report, if non-nil, is called after each completed iteration.
+	Report func(Iteration)
+}
+
+// A Tablebase knows the results of some endgame positions, as
+// *tablebase.Tablebase does.
+type Tablebase interface {
+	// ProbeWDL returns the result of p, ignoring the fifty-move counter. If
+	// p can't be probed, ok is false.
+	ProbeWDL(p *chess.Position) (wdl tablebase.WDL, ok bool)
+
+	// RootMoves returns the legal moves of p that keep its best result
+	// under the fifty-move rule, and that result. If p can't be probed, ok
+	// is false.
+	RootMoves(p *chess.Position) (moves []chess.Move, wdl tablebase.WDL, ok bool)
+}
+
+// A DTM knows the distance to mate of some endgame positions, as *dtm.Set
+// does. It ignores the fifty-move rule.
+type DTM interface {
+	// Probe returns the result of p and the plies to mate, which are 0 for
+	// draws and for checkmate. If p can't be probed, ok is false.
+	Probe(p *chess.Position) (wdl tablebase.WDL, dtm int, ok bool)
+}
+
+// An Iteration is the result of one iteration of iterative deepening.
+type Iteration struct {
+	Depth int
+	Score int
+	Nodes int64
+	PV    []chess.Move // The principal variation, starting with the best move.
+
+	// Effort is the share of the search's nodes spent on the best move, from
+	// 0 to 1. A move that takes most of the effort is unlikely to be
+	// overtaken.
+	Effort float64
+}
+
+// Filter returns the moves in moves that are also in allowed, or moves if
+// allowed is empty.
+func Filter(moves, allowed []chess.Move) []chess.Move {
+	if len(allowed) == 0 {
+		return moves
+	}
+	var res []chess.Move
+	for _, m := range moves {
+		for _, a := range allowed {
+			if m == a {
+				res = append(res, m)
+				break
+			}
+		}
+	}
+	return res
+}
@@ -1,2 +1,366 @@
 // Package mcts implements Monte Carlo tree search.
+//
+// The search is UCT: each playout descends the tree from the root, choosing
+// at every node the move that maximizes an upper confidence bound on its
+// value, until it adds a new node. The new position is evaluated, by random
+// rollouts or by the static evaluation squashed to a win probability, and
+// the result is backed up along the path. The most visited move is played.
+//
+// With a policy and value network, the search is PUCT instead, as in
+// AlphaZero: the network gives each move a prior probability, which guides
+// selection, and evaluates new positions in batches.
+//
+// The search is also an MCTS-solver: wins and losses found in the tree are
+// proven and backed up exactly, as in minimax, so that it finds mates and
+// plays them by the shortest route.
 package mcts
+
+import (
+	"context"
+	"math"
+	"math/rand"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/eval"
+	"github.com/clfs/good/search/internal/core"
+)
+
+// Config configures a search.
+type Config struct {
+	// Exploration is the UCT exploration constant. Higher values spread
+	// playouts over more moves, and lower values concentrate them on the
+	// best moves so far.
+	Exploration float64
+
+	// Rollouts evaluates new positions by playing random moves to the end of
+	// the game, or for at most maxRolloutPlies, rather than by the static
+	// evaluation alone.
+	Rollouts bool
+
+	// Scale converts centipawns to win probability, as sigmoid(cp/Scale).
+	Scale float64
+
+	// Net, if non-nil, makes the search PUCT, with priors and values from
+	// Net. Exploration is then the PUCT constant, and Rollouts is ignored.
+	Net PolicyValue
+
+	// BatchSize is the number of new positions PUCT evaluates at once.
+	BatchSize int
+
+	// NoiseAlpha and NoiseFraction add Dirichlet noise to PUCT's priors at
+	// the root, for variety in self-play: the priors are mixed with a sample
+	// of Dirichlet(NoiseAlpha), which gets NoiseFraction of the weight. Zero
+	// adds no noise.
+	NoiseAlpha, NoiseFraction float64
+
+	// Temperature, if positive, makes the search choose its move at random,
+	// with probability proportional to visits^(1/Temperature), rather than
+	// choosing the most visited move. Proven wins are still played.
+	Temperature float64
+
+	Seed int64 // Seed for rollouts, noise, and move choice.
+}
+
+// DefaultConfig returns a configuration with sensible defaults.
+func DefaultConfig() Config {
+	return Config{
+		Exploration:   math.Sqrt2,
+		Scale:         400,
+		BatchSize:     8,
+		NoiseAlpha:    0.3,
+		NoiseFraction: 0,
+	}
+}
+
+// maxRolloutPlies is the longest rollout. Positions still undecided at its
+// end are scored by the static evaluation.
+const maxRolloutPlies = 60
+
+// reportInterval is about the number of playouts between checks of the
+// depth limit. Iterations are reported each time the number of playouts
+// doubles, from reportInterval on.
+const reportInterval = 1024
+
+// Search searches p with UCT until the node or depth limit is reached, ctx
+// is done, or the root is proven, and returns the result. Nodes are
+// playouts, and the depth is that of the principal variation, the line of
+// most visited moves. The search runs in one thread.
+//
+// The search starts from the part of tree below p, if p was reached from
+// the tree's last root by a move or two, and leaves its own tree there for
+// the next search.
+//
+// If p has no legal moves, the PV is empty.
+func Search(ctx context.Context, tree *Tree, p chess.Position, cfg Config, opts core.Options) core.Iteration {
+	moves := core.Filter(p.LegalMoves(), opts.RootMoves)
+	if len(moves) == 0 {
+		score := 0
+		if p.InCheck() {
+			score = -core.Mate
+		}
+		return core.Iteration{Score: score}
+	}
+
+	s := &searcher{
+		ctx:  ctx,
+		cfg:  cfg,
+		opts: opts,
+		tree: tree,
+		ev:   eval.NewEvaluator(),
+		rng:  rand.New(rand.NewSource(cfg.Seed)),
+	}
+	s.hashes = append(s.hashes, opts.History...)
+	s.hashes = append(s.hashes, p.Hash())
+	puct := cfg.Net != nil
+	root := tree.reuse(p.Hash())
+	if root == nil || len(opts.RootMoves) > 0 || tree.puct != puct {
+		root = tree.newRoot(p.Hash(), moves, puct)
+	}
+
+	if puct {
+		s.addNoise(root)
+	}
+
+	next := int64(reportInterval)
+	for !s.done(root) {
+		if puct {
+			s.nodes += int64(s.puctBatch(root, p))
+		} else {
+			s.playout(root, p)
+			s.nodes++
+		}
+		if s.nodes >= next && opts.Report != nil {
+			opts.Report(s.iteration(root))
+			for next <= s.nodes {
+				next *= 2
+			}
+		}
+	}
+	it := s.iteration(root)
+	if c := s.chooseMove(root); c != nil && c.move != it.PV[0] {
+		it.PV = append([]chess.Move{c.move}, principalVariation(c)...)
+		it.Score = s.score(c)
+	}
+	return it
+}
+
+// searcher holds the state of a search.
+type searcher struct {
+	ctx   context.Context
+	cfg   Config
+	opts  core.Options
+	tree  *Tree
+	nodes int64 // Playouts.
+
+	nextCheck int64 // The playouts at which to next check the depth.
+	noised    bool  // Whether the root's priors have noise.
+
+	ev     *eval.Evaluator
+	rng    *rand.Rand
+	hashes []uint64 // Hashes of the game and the current path, ending with the current position.
+	path   []*node  // The current path, from the root.
+}
+
+// done reports whether the search should end. The depth is only checked
+// about every reportInterval playouts, but ctx is checked before every
+// playout or batch, since rollouts and network evaluations are slow.
+func (s *searcher) done(root *node) bool {
+	switch {
+	case root.proven != unproven:
+		return true
+	case s.opts.Nodes > 0 && s.nodes >= s.opts.Nodes:
+		return true
+	case s.ctx.Err() != nil:
+		return true
+	case s.nodes < s.nextCheck:
+		return false
+	}
+	s.nextCheck = s.nodes + reportInterval
+	return s.opts.Depth > 0 && len(principalVariation(root)) >= s.opts.Depth
+}
+
+// playout descends the tree from root, whose position is p, adds a node, and
+// backs its value up the path. Nodes are visited on the way down.
+func (s *searcher) playout(root *node, p chess.Position) {
+	s.path = append(s.path[:0], root)
+	root.visits++
+	base := len(s.hashes)
+	n := root
+	var result float64
+	for {
+		if n.proven != unproven {
+			result = n.proven.value()
+			break
+		}
+		child, added := s.selectChild(n)
+		if child == nil {
+			// The tree is full.
+			result = 1 - s.evaluate(&p)
+			break
+		}
+		p.Make(child.move)
+		child.visits++
+		s.path = append(s.path, child)
+		s.hashes = append(s.hashes, p.Hash())
+		n = child
+		if added {
+			n.expand(&p, s.isRepetition(&p))
+			if n.proven != unproven {
+				result = n.proven.value()
+			} else {
+				result = 1 - s.evaluate(&p)
+			}
+			break
+		}
+	}
+	s.hashes = s.hashes[:base]
+	backup(s.path, result)
+}
+
+// selectChild returns the child of n to descend to, adding a new one if n
+// has moves without children and the tree has room. It returns nil if no
+// child can be chosen.
+func (s *searcher) selectChild(n *node) (child *node, added bool) {
+	if len(n.children) < len(n.moves) && !s.tree.full() {
+		c := s.tree.newNode(n.moves[len(n.children)])
+		n.children = append(n.children, c)
+		return c, true
+	}
+	var best *node
+	bestScore := math.Inf(-1)
+	logVisits := math.Log(float64(n.visits))
+	for _, c := range n.children {
+		if c.proven == loss {
+			continue
+		}
+		u := c.mean() + s.cfg.Exploration*math.Sqrt(logVisits/float64(c.visits))
+		if u > bestScore {
+			best, bestScore = c, u
+		}
+	}
+	if best == nil && len(n.children) > 0 {
+		// Every move tried loses, and the rest can't be added.
+		best = n.children[0]
+	}
+	return best, false
+}
+
+// backup adds result, the value of the last node of path for the side that
+// moved to it, to the nodes of path, which must already count the visit, and
+// proves what the result proves.
+func backup(path []*node, result float64) {
+	proving := true
+	for i := len(path) - 1; i >= 0; i-- {
+		n := path[i]
+		n.wins += result
+		result = 1 - result
+		if proving && i < len(path)-1 {
+			proving = n.prove()
+		} else if proving {
+			proving = n.proven != unproven
+		}
+	}
+}
+
+// isRepetition reports whether p repeats a position since the last capture
+// or pawn move. p's hash must be the last in s.hashes.
+func (s *searcher) isRepetition(p *chess.Position) bool {
+	last := len(s.hashes) - 1
+	for i := last - 2; i >= 0 && i >= last-int(p.HalfMoves); i -= 2 {
+		if s.hashes[i] == s.hashes[last] {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluate returns the value of p for the side to move, as a win
+// probability.
+func (s *searcher) evaluate(p *chess.Position) float64 {
+	if !s.cfg.Rollouts {
+		return s.staticValue(p)
+	}
+	// Play random moves, keeping track of whose point of view the result
+	// is from.
+	q := *p
+	flip := false
+	for i := 0; i < maxRolloutPlies; i++ {
+		moves := q.LegalMoves()
+		switch {
+		case len(moves) == 0 && q.InCheck():
+			return boolValue(flip)
+		case len(moves) == 0, q.HalfMoves >= 100, q.IsInsufficientMaterial():
+			return 0.5
+		}
+		q.Make(moves[s.rng.Intn(len(moves))])
+		flip = !flip
+	}
+	v := s.staticValue(&q)
+	if flip {
+		v = 1 - v
+	}
+	return v
+}
+
+// staticValue returns the static evaluation of p for the side to move, as a
+// win probability.
+func (s *searcher) staticValue(p *chess.Position) float64 {
+	v := s.ev.Position(p)
+	if p.SideToMove == chess.Black {
+		v = -v
+	}
+	return 1 / (1 + math.Exp(-float64(v)/s.cfg.Scale))
+}
+
+// boolValue returns 1 if b is true, and 0 otherwise.
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// iteration returns the result of the search so far.
+func (s *searcher) iteration(root *node) core.Iteration {
+	pv := principalVariation(root)
+	it := core.Iteration{Depth: len(pv), Nodes: s.nodes, PV: pv}
+	if len(pv) == 0 {
+		// No playout got past the root.
+		it.PV = []chess.Move{root.moves[0]}
+		return it
+	}
+	best := bestChild(root)
+	it.Score = s.score(best)
+	it.Effort = float64(best.visits) / float64(root.visits)
+	return it
+}
+
+// score returns the score of the root for a move to one of its visited
+// children.
+func (s *searcher) score(c *node) int {
+	switch c.proven {
+	case win:
+		return core.Mate - 1 - c.dist
+	case loss:
+		return -core.Mate + 1 + c.dist
+	}
+	return s.centipawns(c.mean())
+}
+
+// centipawns converts a win probability back to centipawns, the inverse of
+// staticValue, within the range of non-mate scores.
+func (s *searcher) centipawns(v float64) int {
+	const limit = core.Mate - core.MaxPly - 1
+	v = math.Max(1e-9, math.Min(v, 1-1e-9))
+	cp := s.cfg.Scale * math.Log(v/(1-v))
+	return int(math.Round(math.Max(-limit, math.Min(cp, limit))))
+}
+
+// principalVariation returns the best line from n.
+func principalVariation(n *node) []chess.Move {
+	var pv []chess.Move
+	for c := bestChild(n); c != nil && c.visits > 0 && len(pv) < core.MaxPly; c = bestChild(c) {
+		pv = append(pv, c.move)
+	}
+	return pv
+}
@@ -0,0 +1,192 @@
+package mcts
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/fen"
+	"github.com/clfs/good/search/internal/core"
+)
+
+func mustParse(t *testing.T, s string) chess.Position {
+	t.Helper()
+	p, err := fen.From(s)
+	if err != nil {
+		t.Fatalf("%s: %v", s, err)
+	}
+	return p
+}
+
+func TestSearch_Mate(t *testing.T) {
+	cases := []struct {
+		fen   string
+		move  string
+		score int
+	}{
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "a1a8", core.Mate - 1},
+		{"kbK5/pp6/1P6/8/8/8/8/R7 w - - 0 1", "a1a6", core.Mate - 3}, // Zugzwang.
+		{"r1bqkbnr/pppp1ppp/2n5/4p3/2B1P3/5Q2/PPPP1PPP/RNB1K1NR w KQkq - 0 1", "f3f7", core.Mate - 1},
+		{"r7/8/8/8/8/8/5k2/7K w - - 0 1", "h1h2", -core.Mate + 2}, // Mated in 1.
+	}
+	for _, rollouts := range []bool{false, true} {
+		cfg := DefaultConfig()
+		cfg.Rollouts = rollouts
+		for _, tc := range cases {
+			p := mustParse(t, tc.fen)
+			got := Search(context.Background(), NewTree(16), p, cfg, core.Options{Nodes: 200000})
+			if len(got.PV) == 0 || got.PV[0].String() != tc.move || got.Score != tc.score {
+				t.Errorf("%s, rollouts %v: want %s with score %d, got %v with score %d",
+					tc.fen, rollouts, tc.move, tc.score, got.PV, got.Score)
+			}
+		}
+	}
+}
+
+func TestSearch_NoMoves(t *testing.T) {
+	cases := []struct {
+		fen   string
+		score int
+	}{
+		{"7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", 0},         // Stalemate.
+		{"6Qk/5K2/8/8/8/8/8/8 b - - 0 1", -core.Mate}, // Checkmate.
+	}
+	for _, tc := range cases {
+		got := Search(context.Background(), NewTree(1), mustParse(t, tc.fen), DefaultConfig(), core.Options{Nodes: 100})
+		if len(got.PV) != 0 || got.Score != tc.score {
+			t.Errorf("%s: want no moves with score %d, got %v with score %d", tc.fen, tc.score, got.PV, got.Score)
+		}
+	}
+}
+
+func TestSearch_Material(t *testing.T) {
+	// Black can win a bishop with check.
+	p := mustParse(t, "rnb1kbnr/pppp1ppp/8/4p1q1/4P3/3P1Q2/PPP2PPP/RNB1KBNR b KQkq - 0 1")
+	got := Search(context.Background(), NewTree(16), p, DefaultConfig(), core.Options{Nodes: 5000})
+	if len(got.PV) == 0 || got.PV[0].String() != "g5c1" {
+		t.Errorf("want g5c1, got %v with score %d", got.PV, got.Score)
+	}
+}
+
+func TestSearch_Repetition(t *testing.T) {
+	// Black is lost unless it repeats the position.
+	p := mustParse(t, "r2qk2r/8/8/8/8/8/8/4K1N1 w - - 10 40")
+	earlier := p
+	earlier.Make(chess.NewMove(chess.G1, chess.F3))
+	got := Search(context.Background(), NewTree(16), p, DefaultConfig(), core.Options{
+		Nodes:   2000,
+		History: []uint64{earlier.Hash()},
+	})
+	if len(got.PV) == 0 || got.PV[0].String() != "g1f3" || got.Score != 0 {
+		t.Errorf("want a repetition with g1f3, got %v with score %d", got.PV, got.Score)
+	}
+}
+
+func TestSearch_Limits(t *testing.T) {
+	p := chess.NewPosition()
+
+	got := Search(context.Background(), NewTree(16), p, DefaultConfig(), core.Options{Nodes: 500})
+	if got.Nodes != 500 || len(got.PV) == 0 || got.Effort <= 0 || got.Effort > 1 {
+		t.Errorf("node limit: searched %d nodes with effort %v, got PV %v", got.Nodes, got.Effort, got.PV)
+	}
+
+	got = Search(context.Background(), NewTree(16), p, DefaultConfig(), core.Options{Depth: 3})
+	if got.Depth < 3 {
+		t.Errorf("depth limit: got depth %d", got.Depth)
+	}
+
+	root := []chess.Move{chess.NewMove(chess.A2, chess.A3), chess.NewMove(chess.H2, chess.H3)}
+	got = Search(context.Background(), NewTree(16), p, DefaultConfig(), core.Options{Nodes: 100, RootMoves: root})
+	if len(got.PV) == 0 || (got.PV[0] != root[0] && got.PV[0] != root[1]) {
+		t.Errorf("root moves: got PV %v", got.PV)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	got = Search(ctx, NewTree(16), p, DefaultConfig(), core.Options{})
+	if len(got.PV) != 1 || got.Nodes != 0 {
+		t.Errorf("canceled: searched %d nodes, got PV %v", got.Nodes, got.PV)
+	}
+
+	// A tree with room for only a few nodes still searches.
+	tree := NewTree(0)
+	got = Search(context.Background(), tree, p, DefaultConfig(), core.Options{Nodes: 100})
+	if len(got.PV) == 0 || tree.Hashfull() != 1000 {
+		t.Errorf("full tree: got PV %v, hashfull %d", got.PV, tree.Hashfull())
+	}
+}
+
+// TestSearch_Cancel checks that a search with slow rollouts stops soon after
+// ctx is canceled.
+func TestSearch_Cancel(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Rollouts = true
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	got := Search(ctx, NewTree(16), chess.NewPosition(), cfg, core.Options{})
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("want the search to stop soon after 5ms, took %v for %d playouts", elapsed, got.Nodes)
+	}
+}
+
+func TestSearch_Reuse(t *testing.T) {
+	tree := NewTree(16)
+	p := chess.NewPosition()
+	got := Search(context.Background(), tree, p, DefaultConfig(), core.Options{Nodes: 5000})
+
+	// Play the best move and the reply the search expected.
+	history := []uint64{p.Hash()}
+	p.Make(got.PV[0])
+	history = append(history, p.Hash())
+	p.Make(got.PV[1])
+
+	visits := 0
+	for _, c := range tree.root.children {
+		if c.move == got.PV[0] {
+			for _, gc := range c.children {
+				if gc.move == got.PV[1] {
+					visits = gc.visits
+				}
+			}
+		}
+	}
+	Search(context.Background(), tree, p, DefaultConfig(), core.Options{Nodes: 1000, History: history})
+	if visits == 0 || tree.root.visits != visits+1000 {
+		t.Errorf("want the root's %d visits kept and 1000 added, got %d", visits, tree.root.visits)
+	}
+	if tree.size != count(tree.root) {
+		t.Errorf("tree size %d, but it has %d nodes", tree.size, count(tree.root))
+	}
+
+	// Positions the tree doesn't reach start a new tree.
+	Search(context.Background(), tree, chess.NewPosition(), DefaultConfig(), core.Options{Nodes: 1000})
+	if tree.root.visits != 1000 {
+		t.Errorf("new tree: want 1000 root visits, got %d", tree.root.visits)
+	}
+}
+
+func TestNode_Prove(t *testing.T) {
+	moves := []chess.Move{chess.NewMove(chess.A2, chess.A3), chess.NewMove(chess.B2, chess.B3)}
+	cases := []struct {
+		children []node
+		proven   proof
+		dist     int
+	}{
+		{[]node{{proven: loss, dist: 2}, {proven: win, dist: 4}}, loss, 5},
+		{[]node{{proven: loss, dist: 2}, {proven: loss, dist: 6}}, win, 7},
+		{[]node{{proven: loss, dist: 2}, {proven: draw}}, draw, 0},
+		{[]node{{proven: loss, dist: 2}, {}}, unproven, 0},
+		{[]node{{proven: loss, dist: 2}}, unproven, 0}, // A move has no child yet.
+	}
+	for i, tc := range cases {
+		n := &node{moves: moves}
+		for j := range tc.children {
+			n.children = append(n.children, &tc.children[j])
+		}
+		if ok := n.prove(); ok != (tc.proven != unproven) || n.proven != tc.proven || n.dist != tc.dist {
+			t.Errorf("case %d: want proof %d at %d plies, got %d at %d plies (%v)", i, tc.proven, tc.dist, n.proven, n.dist, ok)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package mcts
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/clfs/good/chess"
+)
+
+// A PolicyValue evaluates positions for PUCT.
+type PolicyValue interface {
+	// Evaluate returns a prior probability for each of p's legal moves, in
+	// the order of moves, and the win probability of the side to move.
+	Evaluate(p *chess.Position, moves []chess.Move) (priors []float64, value float64)
+}
+
+// A BatchPolicyValue is a PolicyValue that evaluates several positions at
+// once faster than one at a time.
+type BatchPolicyValue interface {
+	PolicyValue
+
+	// EvaluateBatch evaluates positions as Evaluate does.
+	EvaluateBatch(ps []*chess.Position, moves [][]chess.Move) (priors [][]float64, values []float64)
+}
+
+// evaluateBatch evaluates positions with pv, in one batch if it can.
+func evaluateBatch(pv PolicyValue, ps []*chess.Position, moves [][]chess.Move) (priors [][]float64, values []float64) {
+	if b, ok := pv.(BatchPolicyValue); ok {
+		return b.EvaluateBatch(ps, moves)
+	}
+	priors, values = make([][]float64, len(ps)), make([]float64, len(ps))
+	for i, p := range ps {
+		priors[i], values[i] = pv.Evaluate(p, moves[i])
+	}
+	return priors, values
+}
+
+// fpuReduction is how much less than its parent a move not yet visited is
+// assumed to be worth, as a win probability.
+const fpuReduction = 0.1
+
+// A leaf is a new position waiting for evaluation in a PUCT batch.
+type leaf struct {
+	path []*node // From the root to the leaf's node.
+	pos  chess.Position
+}
+
+// A descent is how a PUCT playout's descent of the tree ended.
+type descent int
+
+const (
+	descentProven    descent = iota // At a proven node, whose value is known.
+	descentLeaf                     // At a new position, to be evaluated.
+	descentCollision                // At a position already waiting in the batch.
+)
+
+// puctBatch runs a batch of PUCT playouts from root, whose position is p,
+// and returns the number it completed.
+//
+// Each playout descends the tree to a new position, counting a visit but no
+// win in each node on the way: a virtual loss, which steers the rest of the
+// batch elsewhere. The new positions are evaluated together at the end, and
+// their values backed up. The batch ends early if a playout reaches a
+// position already in it.
+func (s *searcher) puctBatch(root *node, p chess.Position) int {
+	size := s.cfg.BatchSize
+	if size < 1 {
+		size = 1
+	}
+	if s.opts.Nodes > 0 && s.opts.Nodes-s.nodes < int64(size) {
+		size = int(s.opts.Nodes - s.nodes)
+	}
+
+	var leaves []leaf
+	done := 0
+	for i := 0; i < size; i++ {
+		path, pos, result, d := s.descend(root, p)
+		if d == descentCollision {
+			for _, n := range path {
+				n.visits--
+			}
+			break
+		}
+		if d == descentLeaf {
+			leaves = append(leaves, leaf{path, pos})
+			continue
+		}
+		backup(path, result)
+		done++
+	}
+	if len(leaves) == 0 {
+		return done
+	}
+
+	ps := make([]*chess.Position, len(leaves))
+	moves := make([][]chess.Move, len(leaves))
+	for i := range leaves {
+		ps[i] = &leaves[i].pos
+		moves[i] = leaves[i].path[len(leaves[i].path)-1].moves
+	}
+	priors, values := evaluateBatch(s.cfg.Net, ps, moves)
+	for i, l := range leaves {
+		n := l.path[len(l.path)-1]
+		n.pending = false
+		if s.tree.room(len(n.moves)) {
+			for j, m := range n.moves {
+				c := s.tree.newNode(m)
+				c.prior = float32(priors[i][j])
+				n.children = append(n.children, c)
+			}
+			if n == root {
+				s.addNoise(root)
+			}
+		}
+		backup(l.path, 1-values[i])
+		done++
+	}
+	return done
+}
+
+// descend descends the tree from root, whose position is p, by PUCT
+// selection, and returns the path, the position it ended at, and how it
+// ended, with the value of the last node for the side that moved to it if
+// it's proven.
+func (s *searcher) descend(root *node, p chess.Position) (path []*node, pos chess.Position, result float64, d descent) {
+	path = []*node{root}
+	root.visits++
+	base := len(s.hashes)
+	defer func() { s.hashes = s.hashes[:base] }()
+
+	n := root
+	for {
+		if n.proven == unproven && n.moves == nil {
+			n.expand(&p, s.isRepetition(&p))
+		}
+		switch {
+		case n.proven != unproven:
+			return path, p, n.proven.value(), descentProven
+		case n.pending:
+			return path, p, 0, descentCollision
+		case len(n.children) == 0:
+			n.pending = true
+			return path, p, 0, descentLeaf
+		}
+		n = s.selectPUCT(n)
+		p.Make(n.move)
+		n.visits++
+		path = append(path, n)
+		s.hashes = append(s.hashes, p.Hash())
+	}
+}
+
+// selectPUCT returns the child of n that maximizes AlphaZero's PUCT bound.
+// Moves not yet visited are valued at a little less than n itself.
+func (s *searcher) selectPUCT(n *node) *node {
+	var best *node
+	bestScore := math.Inf(-1)
+	sqrtVisits := math.Sqrt(float64(n.visits))
+	fpu := 1 - n.mean() - fpuReduction
+	for _, c := range n.children {
+		if c.proven == loss {
+			continue
+		}
+		q := fpu
+		if c.visits > 0 {
+			q = c.mean()
+		}
+		u := q + s.cfg.Exploration*float64(c.prior)*sqrtVisits/float64(1+c.visits)
+		if u > bestScore {
+			best, bestScore = c, u
+		}
+	}
+	if best == nil {
+		// Every move loses.
+		best = n.children[0]
+	}
+	return best
+}
+
+// addNoise mixes Dirichlet noise into the priors of the root's children,
+// once per search.
+func (s *searcher) addNoise(root *node) {
+	if s.noised || s.cfg.NoiseFraction <= 0 || len(root.children) == 0 {
+		return
+	}
+	s.noised = true
+	noise := make([]float64, len(root.children))
+	var sum float64
+	for i := range noise {
+		noise[i] = sampleGamma(s.rng, s.cfg.NoiseAlpha)
+		sum += noise[i]
+	}
+	if sum == 0 {
+		return
+	}
+	for i, c := range root.children {
+		mixed := (1-s.cfg.NoiseFraction)*float64(c.prior) + s.cfg.NoiseFraction*noise[i]/sum
+		c.prior = float32(mixed)
+	}
+}
+
+// sampleGamma returns a sample of the gamma distribution with shape alpha
+// and scale 1, by Marsaglia and Tsang's method. Normalized, samples of it
+// are a sample of a Dirichlet distribution.
+func sampleGamma(r *rand.Rand, alpha float64) float64 {
+	if alpha < 1 {
+		return sampleGamma(r, alpha+1) * math.Pow(r.Float64(), 1/alpha)
+	}
+	d := alpha - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := r.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := r.Float64()
+		if u < 1-0.0331*x*x*x*x || math.Log(u) < 0.5*x*x+d*(1-v+math.Log(v)) {
+			return d * v
+		}
+	}
+}
+
+// chooseMove returns the root's child to play when the temperature is
+// positive, chosen at random by visits, or nil otherwise. Proven wins are
+// always chosen, and proven losses never are if there's a choice.
+func (s *searcher) chooseMove(root *node) *node {
+	best := bestChild(root)
+	if s.cfg.Temperature <= 0 || best == nil || best.visits == 0 || best.proven != unproven && best.proven != draw {
+		return nil
+	}
+	// Visits are scaled by the best move's, so that low temperatures don't
+	// overflow.
+	weights := make([]float64, len(root.children))
+	var sum float64
+	for i, c := range root.children {
+		if c.visits > 0 && c.proven != loss {
+			weights[i] = math.Pow(float64(c.visits)/float64(best.visits), 1/s.cfg.Temperature)
+			sum += weights[i]
+		}
+	}
+	x := s.rng.Float64() * sum
+	for i, c := range root.children {
+		x -= weights[i]
+		if weights[i] > 0 && x < 0 {
+			return c
+		}
+	}
+	return best
+}
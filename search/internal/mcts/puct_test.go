@@ -0,0 +1,196 @@
+package mcts
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/search/internal/core"
+)
+
+// testNet is a PolicyValue that gives favorite a prior of 0.9, spreads the
+// rest evenly, and values every position as even. It counts the batches it
+// evaluates.
+type testNet struct {
+	favorite chess.Move
+	batches  int
+	largest  int // Positions in the largest batch.
+}
+
+func (n *testNet) Evaluate(p *chess.Position, moves []chess.Move) ([]float64, float64) {
+	priors := make([]float64, len(moves))
+	favorite := -1
+	for i, m := range moves {
+		if m == n.favorite {
+			favorite = i
+		}
+	}
+	for i := range priors {
+		switch {
+		case favorite < 0:
+			priors[i] = 1 / float64(len(moves))
+		case i == favorite:
+			priors[i] = 0.9
+		default:
+			priors[i] = 0.1 / float64(len(moves)-1)
+		}
+	}
+	return priors, 0.5
+}
+
+func (n *testNet) EvaluateBatch(ps []*chess.Position, moves [][]chess.Move) ([][]float64, []float64) {
+	n.batches++
+	if len(ps) > n.largest {
+		n.largest = len(ps)
+	}
+	priors, values := make([][]float64, len(ps)), make([]float64, len(ps))
+	for i, p := range ps {
+		priors[i], values[i] = n.Evaluate(p, moves[i])
+	}
+	return priors, values
+}
+
+// slowNet is a testNet that takes a while to evaluate each batch.
+type slowNet struct {
+	testNet
+	delay time.Duration
+}
+
+func (n *slowNet) EvaluateBatch(ps []*chess.Position, moves [][]chess.Move) ([][]float64, []float64) {
+	time.Sleep(n.delay)
+	return n.testNet.EvaluateBatch(ps, moves)
+}
+
+func puctConfig(net PolicyValue) Config {
+	cfg := DefaultConfig()
+	cfg.Net = net
+	return cfg
+}
+
+func TestPUCT_Mate(t *testing.T) {
+	cases := []struct {
+		fen   string
+		move  string
+		score int
+	}{
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "a1a8", core.Mate - 1},
+		{"kbK5/pp6/1P6/8/8/8/8/R7 w - - 0 1", "a1a6", core.Mate - 3},
+		{"r7/8/8/8/8/8/5k2/7K w - - 0 1", "h1h2", -core.Mate + 2},
+	}
+	for _, tc := range cases {
+		p := mustParse(t, tc.fen)
+		got := Search(context.Background(), NewTree(16), p, puctConfig(&testNet{}), core.Options{Nodes: 200000})
+		if len(got.PV) == 0 || got.PV[0].String() != tc.move || got.Score != tc.score {
+			t.Errorf("%s: want %s with score %d, got %v with score %d", tc.fen, tc.move, tc.score, got.PV, got.Score)
+		}
+	}
+}
+
+func TestPUCT_Priors(t *testing.T) {
+	favorite := chess.NewMove(chess.H2, chess.H3)
+	net := &testNet{favorite: favorite}
+	got := Search(context.Background(), NewTree(16), chess.NewPosition(), puctConfig(net), core.Options{Nodes: 1000})
+	if len(got.PV) == 0 || got.PV[0] != favorite {
+		t.Errorf("want the favorite %v, got %v", favorite, got.PV)
+	}
+	if got.Nodes != 1000 || net.largest < 2 || net.batches >= 1000 {
+		t.Errorf("searched %d nodes in %d batches of at most %d", got.Nodes, net.batches, net.largest)
+	}
+}
+
+func TestPUCT_Reuse(t *testing.T) {
+	tree := NewTree(16)
+	p := chess.NewPosition()
+	Search(context.Background(), tree, p, DefaultConfig(), core.Options{Nodes: 1000})
+	if tree.puct {
+		t.Fatal("UCT built a PUCT tree")
+	}
+	// A PUCT search doesn't reuse a UCT tree, which has no priors.
+	Search(context.Background(), tree, p, puctConfig(&testNet{}), core.Options{Nodes: 1000})
+	if !tree.puct || tree.root.visits != 1000 {
+		t.Errorf("want a new PUCT tree with 1000 visits, got PUCT %v with %d visits", tree.puct, tree.root.visits)
+	}
+}
+
+func TestPUCT_Noise(t *testing.T) {
+	cfg := puctConfig(&testNet{})
+	cfg.NoiseFraction = 0.25
+	tree := NewTree(16)
+	Search(context.Background(), tree, chess.NewPosition(), cfg, core.Options{Nodes: 100})
+	var sum float64
+	varied := false
+	for _, c := range tree.root.children {
+		sum += float64(c.prior)
+		if math.Abs(float64(c.prior)-1.0/20) > 1e-3 {
+			varied = true
+		}
+	}
+	if math.Abs(sum-1) > 1e-3 || !varied {
+		t.Errorf("want varied priors summing to 1, got a sum of %v, varied %v", sum, varied)
+	}
+}
+
+func TestSearch_Temperature(t *testing.T) {
+	p := chess.NewPosition()
+	moves := func(temperature float64) map[chess.Move]bool {
+		seen := make(map[chess.Move]bool)
+		for seed := int64(0); seed < 10; seed++ {
+			cfg := DefaultConfig()
+			cfg.Temperature, cfg.Seed = temperature, seed
+			got := Search(context.Background(), NewTree(16), p, cfg, core.Options{Nodes: 200})
+			seen[got.PV[0]] = true
+		}
+		return seen
+	}
+	if n := len(moves(0)); n != 1 {
+		t.Errorf("temperature 0: want one move, got %d", n)
+	}
+	if n := len(moves(10)); n < 2 {
+		t.Errorf("temperature 10: want several moves, got %d", n)
+	}
+
+	// Proven wins are played whatever the temperature.
+	cfg := DefaultConfig()
+	cfg.Temperature = 10
+	got := Search(context.Background(), NewTree(16), mustParse(t, "6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1"), cfg, core.Options{Nodes: 10000})
+	if got.PV[0].String() != "a1a8" {
+		t.Errorf("want the mate a1a8, got %v", got.PV)
+	}
+}
+
+func TestSampleGamma(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, alpha := range []float64{0.3, 1, 2.5} {
+		const n = 20000
+		var sum float64
+		for i := 0; i < n; i++ {
+			x := sampleGamma(r, alpha)
+			if x < 0 {
+				t.Fatalf("alpha %v: negative sample %v", alpha, x)
+			}
+			sum += x
+		}
+		if mean := sum / n; math.Abs(mean-alpha) > 0.05*alpha+0.02 {
+			t.Errorf("alpha %v: mean %v", alpha, mean)
+		}
+	}
+}
+
+// TestPUCT_Cancel checks that a search with a slow network stops soon after
+// ctx is canceled.
+func TestPUCT_Cancel(t *testing.T) {
+	net := &slowNet{delay: 5 * time.Millisecond}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	got := Search(ctx, NewTree(16), chess.NewPosition(), puctConfig(net), core.Options{})
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("want the search to stop soon after 20ms, took %v for %d batches", elapsed, net.batches)
+	}
+	if len(got.PV) == 0 {
+		t.Error("want a move")
+	}
+}
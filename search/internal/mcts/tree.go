@@ -0,0 +1,250 @@
+package mcts
+
+import "github.com/clfs/good/chess"
+
+// A proof is what is known for certain about the value of a node, for the
+// side that moved to it.
+type proof uint8
+
+const (
+	unproven proof = iota
+	loss
+	draw
+	win
+)
+
+// value returns the value of a proven node as a win probability.
+func (pr proof) value() float64 {
+	switch pr {
+	case win:
+		return 1
+	case draw:
+		return 0.5
+	}
+	return 0
+}
+
+// rank orders proofs from worst to best, for the side that moved. Unproven
+// nodes rank with draws.
+func (pr proof) rank() int {
+	switch pr {
+	case loss:
+		return 0
+	case win:
+		return 2
+	}
+	return 1
+}
+
+// A node is a position in the tree.
+type node struct {
+	move     chess.Move   // The move to the node.
+	hash     uint64       // The position's hash.
+	moves    []chess.Move // Legal moves, or nil if the game is over.
+	children []*node      // Children for a prefix of moves, in the same order.
+
+	visits int
+	wins   float64 // Sum of the results of playouts through the node, for the side that moved to it.
+	prior  float32 // The PUCT prior of the move to the node.
+
+	// pending is set while a PUCT batch waits for the node's evaluation.
+	pending bool
+
+	proven proof
+	dist   int // For a proven node, the plies from the node to the end of the game.
+}
+
+// mean returns the average result of playouts through n, or its value if
+// it's proven.
+func (n *node) mean() float64 {
+	if n.proven != unproven {
+		return n.proven.value()
+	}
+	return n.wins / float64(n.visits)
+}
+
+// prove tries to prove n from its children, and reports whether n is proven.
+// A move to a won position loses, a move to a position whose every move
+// loses wins, and a move to a position whose every move is proven and none
+// wins draws.
+func (n *node) prove() bool {
+	if n.proven != unproven {
+		return true
+	}
+	complete := len(n.children) == len(n.moves)
+	minWin, maxLoss, drawn := -1, -1, false
+	for _, c := range n.children {
+		switch c.proven {
+		case win:
+			if minWin < 0 || c.dist < minWin {
+				minWin = c.dist
+			}
+		case loss:
+			if c.dist > maxLoss {
+				maxLoss = c.dist
+			}
+		case draw:
+			drawn = true
+		default:
+			complete = false
+		}
+	}
+	switch {
+	case minWin >= 0:
+		n.proven, n.dist = loss, minWin+1
+	case !complete:
+		return false
+	case drawn:
+		n.proven = draw
+	default:
+		n.proven, n.dist = win, maxLoss+1
+	}
+	return true
+}
+
+// better reports whether c is a better move to play than d: a faster win, a
+// slower loss, or else a move that was visited more.
+func (c *node) better(d *node) bool {
+	if rc, rd := c.proven.rank(), d.proven.rank(); rc != rd {
+		return rc > rd
+	}
+	switch c.proven {
+	case win:
+		return c.dist < d.dist
+	case loss:
+		return c.dist > d.dist
+	}
+	return c.visits > d.visits
+}
+
+// bestChild returns the best child of n to play, or nil if it has none.
+func bestChild(n *node) *node {
+	var best *node
+	for _, c := range n.children {
+		if best == nil || c.better(best) {
+			best = c
+		}
+	}
+	return best
+}
+
+// nodeBytes is about the memory a node takes, with its moves.
+const nodeBytes = 192
+
+// A Tree is a search tree, kept between searches so that later searches of
+// the same game can start from the part of it that's still relevant. It isn't
+// safe for concurrent use.
+type Tree struct {
+	root    *node
+	size    int // Nodes in the tree.
+	maxSize int
+	puct    bool // Whether the tree was built by PUCT, with priors.
+}
+
+// NewTree returns a tree of at most about mb megabytes.
+func NewTree(mb int) *Tree {
+	t := &Tree{}
+	t.Resize(mb)
+	return t
+}
+
+// Resize changes the most memory the tree may take to about mb megabytes,
+// clearing it. The tree always has room for at least one node.
+func (t *Tree) Resize(mb int) {
+	t.maxSize = mb << 20 / nodeBytes
+	if t.maxSize < 1 {
+		t.maxSize = 1
+	}
+	t.Clear()
+}
+
+// Clear empties the tree.
+func (t *Tree) Clear() {
+	t.root, t.size = nil, 0
+}
+
+// Hashfull returns how full the tree is, in permille.
+func (t *Tree) Hashfull() int {
+	return t.size * 1000 / t.maxSize
+}
+
+// full reports whether the tree has no room for more nodes.
+func (t *Tree) full() bool {
+	return t.size >= t.maxSize
+}
+
+// room reports whether the tree has room for n more nodes.
+func (t *Tree) room(n int) bool {
+	return t.size+n <= t.maxSize
+}
+
+// newNode returns a node for a move, counting it in the tree's size.
+func (t *Tree) newNode(m chess.Move) *node {
+	t.size++
+	return &node{move: m}
+}
+
+// newRoot replaces the tree with a root with the given moves, for PUCT or
+// not.
+func (t *Tree) newRoot(hash uint64, moves []chess.Move, puct bool) *node {
+	t.Clear()
+	t.puct = puct
+	t.root = t.newNode(0)
+	t.root.hash, t.root.moves = hash, moves
+	return t.root
+}
+
+// reuse looks for the position with the given hash at most two plies below
+// the root, and if it's there, makes it the root and returns it. Otherwise,
+// or if the game was over there, it returns nil.
+func (t *Tree) reuse(hash uint64) *node {
+	if t.root == nil {
+		return nil
+	}
+	if t.root.hash == hash {
+		return t.root
+	}
+	var found *node
+	for _, c := range t.root.children {
+		for _, gc := range c.children {
+			if gc.hash == hash {
+				found = gc
+			}
+		}
+		if c.hash == hash {
+			found = c
+			break
+		}
+	}
+	if found == nil || found.moves == nil {
+		return nil
+	}
+	found.move = 0
+	t.root, t.size = found, count(found)
+	return found
+}
+
+// count returns the number of nodes in the subtree of n.
+func count(n *node) int {
+	c := 1
+	for _, child := range n.children {
+		c += count(child)
+	}
+	return c
+}
+
+// expand sets up a new node for p, the position after its move: it records
+// the legal moves, or proves the node if the game is over. Repetitions are
+// draws.
+func (n *node) expand(p *chess.Position, repetition bool) {
+	n.hash = p.Hash()
+	moves := p.LegalMoves()
+	switch {
+	case len(moves) == 0 && p.InCheck():
+		n.proven = win
+	case len(moves) == 0, repetition, p.HalfMoves >= 100, p.IsInsufficientMaterial():
+		n.proven = draw
+	default:
+		n.moves = append([]chess.Move(nil), moves...)
+	}
+}
@@ -1,2 +1,256 @@
 // Package refsearch is a reference implementation of a search function.
+//
+// It's a negamax alpha-beta search with iterative deepening, principal
+// variation search, and aspiration windows, which scores leaves with
+// eval.Position. It's meant to be simple and obviously correct rather than
+// fast, so that other search backends can be compared against it.
 package refsearch
+
+import (
+	"context"
+	"sort"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/eval"
+	"github.com/clfs/good/search/internal/core"
+)
+
+// maxPly is the deepest the search goes.
+const maxPly = 64
+
+// aspirationWindow is the half-width of the first window searched around the
+// previous iteration's score.
+const aspirationWindow = 25
+
+// Search searches p with iterative deepening until the depth or node limit is
+// reached, or ctx is done, and returns the last completed iteration. If p has
+// no legal moves, the PV is empty. If no iteration completes, the PV holds
+// the first legal move and the depth is zero.
+func Search(ctx context.Context, p chess.Position, opts core.Options) core.Iteration {
+	s := &searcher{ctx: ctx, opts: opts}
+	s.hashes = append(s.hashes, opts.History...)
+	s.hashes = append(s.hashes, p.Hash())
+
+	moves := core.Filter(p.LegalMoves(), opts.RootMoves)
+	if len(moves) == 0 {
+		score := 0
+		if p.InCheck() {
+			score = -core.Mate
+		}
+		return core.Iteration{Score: score}
+	}
+	s.rootMoves = moves
+
+	maxDepth := opts.Depth
+	if maxDepth <= 0 || maxDepth > maxPly {
+		maxDepth = maxPly
+	}
+	result := core.Iteration{PV: []chess.Move{moves[0]}}
+	for depth := 1; depth <= maxDepth && ctx.Err() == nil; depth++ {
+		score := s.aspiration(&p, depth, result.Score)
+		if s.stopped {
+			break
+		}
+		result = core.Iteration{
+			Depth: depth,
+			Score: score,
+			Nodes: s.nodes,
+			PV:    append([]chess.Move(nil), s.pv[0]...),
+		}
+		if opts.Report != nil {
+			opts.Report(result)
+		}
+		// Search the best move first in the next iteration.
+		for i, m := range s.rootMoves {
+			if m == result.PV[0] {
+				copy(s.rootMoves[1:i+1], s.rootMoves[:i])
+				s.rootMoves[0] = m
+				break
+			}
+		}
+	}
+	result.Nodes = s.nodes
+	return result
+}
+
+// searcher holds the state of a search.
+type searcher struct {
+	ctx     context.Context
+	opts    core.Options
+	nodes   int64
+	stopped bool
+
+	rootMoves []chess.Move
+	hashes    []uint64                 // Hashes of the game and the current line, ending with the current position.
+	pv        [maxPly + 1][]chess.Move // The principal variation from each ply.
+}
+
+// aspiration searches the root to depth, starting with a narrow window
+// around the previous score and widening it on each failure.
+func (s *searcher) aspiration(p *chess.Position, depth, prev int) int {
+	if depth < 4 || core.IsMate(prev) {
+		return s.negamax(p, depth, -core.Infinity, core.Infinity, 0)
+	}
+	delta := aspirationWindow
+	alpha, beta := prev-delta, prev+delta
+	for {
+		score := s.negamax(p, depth, alpha, beta, 0)
+		switch {
+		case s.stopped:
+			return 0
+		case score <= alpha:
+			alpha = max(score-delta, -core.Infinity)
+		case score >= beta:
+			beta = min(score+delta, core.Infinity)
+		default:
+			return score
+		}
+		delta *= 2
+	}
+}
+
+// checkStop sets s.stopped if the search should end.
+func (s *searcher) checkStop() {
+	if s.opts.Nodes > 0 && s.nodes >= s.opts.Nodes {
+		s.stopped = true
+	}
+	if s.nodes%1024 == 0 && s.ctx.Err() != nil {
+		s.stopped = true
+	}
+}
+
+// negamax returns the score of p searched to depth, failing soft: if the
+// score is at most alpha, or at least beta, it's a bound on the true score.
+// The principal variation from ply is left in s.pv[ply].
+func (s *searcher) negamax(p *chess.Position, depth, alpha, beta, ply int) int {
+	s.nodes++
+	s.pv[ply] = s.pv[ply][:0]
+	if s.checkStop(); s.stopped {
+		return 0
+	}
+
+	var moves []chess.Move
+	if ply == 0 {
+		moves = s.rootMoves
+	} else {
+		moves = p.LegalMoves()
+	}
+	if len(moves) == 0 {
+		if p.InCheck() {
+			return -core.Mate + ply
+		}
+		return 0
+	}
+	if ply > 0 && (p.HalfMoves >= 100 || s.isRepetition(p)) {
+		return 0
+	}
+	if depth <= 0 || ply >= maxPly {
+		return evaluate(p)
+	}
+
+	// Neither side can do better than mating on the next move, or worse
+	// than being mated now.
+	if ply > 0 {
+		alpha = max(alpha, -core.Mate+ply)
+		beta = min(beta, core.Mate-ply-1)
+		if alpha >= beta {
+			return alpha
+		}
+	}
+
+	if ply > 0 {
+		orderMoves(p, moves)
+	}
+	best := -core.Infinity
+	for i, m := range moves {
+		q := *p
+		q.Make(m)
+		s.hashes = append(s.hashes, q.Hash())
+
+		var score int
+		if i == 0 {
+			score = -s.negamax(&q, depth-1, -beta, -alpha, ply+1)
+		} else {
+			// Prove that the move is no better than the first with a null
+			// window, and search it properly if it is.
+			score = -s.negamax(&q, depth-1, -alpha-1, -alpha, ply+1)
+			if score > alpha && score < beta {
+				score = -s.negamax(&q, depth-1, -beta, -alpha, ply+1)
+			}
+		}
+
+		s.hashes = s.hashes[:len(s.hashes)-1]
+		if s.stopped {
+			return 0
+		}
+		if score > best {
+			best = score
+			if score > alpha {
+				alpha = score
+				s.pv[ply] = append(append(s.pv[ply][:0], m), s.pv[ply+1]...)
+			}
+			if alpha >= beta {
+				break
+			}
+		}
+	}
+	return best
+}
+
+// isRepetition reports whether p repeats a position since the last capture
+// or pawn move. p's hash must be the last in s.hashes.
+func (s *searcher) isRepetition(p *chess.Position) bool {
+	last := len(s.hashes) - 1
+	for i := last - 2; i >= 0 && i >= last-int(p.HalfMoves); i -= 2 {
+		if s.hashes[i] == s.hashes[last] {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluate returns the static evaluation of p from the side to move's point
+// of view.
+func evaluate(p *chess.Position) int {
+	v := eval.Position(*p)
+	if p.SideToMove == chess.Black {
+		return -v
+	}
+	return v
+}
+
+// roleValues orders captures. Kings are never captured, but do capture.
+var roleValues = [6]int{1, 3, 3, 5, 9, 10}
+
+// orderMoves sorts captures first, most valuable victim first and then
+// least valuable attacker first, and keeps other moves in order.
+func orderMoves(p *chess.Position, moves []chess.Move) {
+	key := func(m chess.Move) int {
+		victim, ok := p.Get(m.To())
+		if !ok {
+			if p.IsEnPassant(m) {
+				return 10*roleValues[chess.Pawn] - roleValues[chess.Pawn]
+			}
+			return 0
+		}
+		attacker, _ := p.Get(m.From())
+		return 10*roleValues[victim.Role()] - roleValues[attacker.Role()]
+	}
+	sort.SliceStable(moves, func(i, j int) bool {
+		return key(moves[i]) > key(moves[j])
+	})
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,150 @@
+package refsearch
+
+import (
+	"context"
+	"testing"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/fen"
+	"github.com/clfs/good/search/internal/core"
+)
+
+func mustParse(t *testing.T, s string) chess.Position {
+	t.Helper()
+	p, err := fen.From(s)
+	if err != nil {
+		t.Fatalf("%s: %v", s, err)
+	}
+	return p
+}
+
+func TestSearch_Mate(t *testing.T) {
+	cases := []struct {
+		fen   string
+		depth int
+		move  string
+		score int
+	}{
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", 2, "a1a8", core.Mate - 1},
+		{"kbK5/pp6/1P6/8/8/8/8/R7 w - - 0 1", 4, "a1a6", core.Mate - 3},
+		{"r1bqkbnr/pppp1ppp/2n5/4p3/2B1P3/5Q2/PPPP1PPP/RNB1K1NR w KQkq - 0 1", 3, "f3f7", core.Mate - 1},
+	}
+	for _, tc := range cases {
+		p := mustParse(t, tc.fen)
+		got := Search(context.Background(), p, core.Options{Depth: tc.depth})
+		if len(got.PV) == 0 || got.PV[0].String() != tc.move || got.Score != tc.score {
+			t.Errorf("%s: want %s with score %d, got %v with score %d", tc.fen, tc.move, tc.score, got.PV, got.Score)
+		}
+	}
+}
+
+func TestSearch_NoMoves(t *testing.T) {
+	cases := []struct {
+		fen   string
+		score int
+	}{
+		{"7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", 0},         // Stalemate.
+		{"6Qk/5K2/8/8/8/8/8/8 b - - 0 1", -core.Mate}, // Checkmate.
+	}
+	for _, tc := range cases {
+		got := Search(context.Background(), mustParse(t, tc.fen), core.Options{Depth: 3})
+		if len(got.PV) != 0 || got.Score != tc.score {
+			t.Errorf("%s: want no moves with score %d, got %v with score %d", tc.fen, tc.score, got.PV, got.Score)
+		}
+	}
+}
+
+// minimax returns the score of p searched to depth without pruning, with the
+// same rules for mates and leaves as negamax.
+func minimax(p *chess.Position, depth, ply int) int {
+	moves := p.LegalMoves()
+	if len(moves) == 0 {
+		if p.InCheck() {
+			return -core.Mate + ply
+		}
+		return 0
+	}
+	if ply > 0 && p.HalfMoves >= 100 {
+		return 0
+	}
+	if depth == 0 {
+		return evaluate(p)
+	}
+	best := -core.Infinity
+	for _, m := range moves {
+		q := *p
+		q.Make(m)
+		best = max(best, -minimax(&q, depth-1, ply+1))
+	}
+	return best
+}
+
+// TestSearch_Minimax checks that pruning doesn't change the score of shallow
+// searches, which are too short for repetitions.
+func TestSearch_Minimax(t *testing.T) {
+	for _, s := range []string{
+		fen.Starting,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10",
+	} {
+		p := mustParse(t, s)
+		maxDepth := 3
+		if testing.Short() {
+			maxDepth = 2
+		}
+		for depth := 1; depth <= maxDepth; depth++ {
+			want := minimax(&p, depth, 0)
+			got := Search(context.Background(), p, core.Options{Depth: depth})
+			if got.Score != want {
+				t.Errorf("%s: depth %d: want score %d, got %d", s, depth, want, got.Score)
+			}
+		}
+	}
+}
+
+// TestSearch_Repetition checks that a losing side heads for a repetition of
+// an earlier position.
+func TestSearch_Repetition(t *testing.T) {
+	p := mustParse(t, "r2qk2r/8/8/8/8/8/8/4K1N1 w - - 10 40")
+	earlier := p
+	earlier.Make(chess.NewMove(chess.G1, chess.F3))
+
+	got := Search(context.Background(), p, core.Options{Depth: 3, History: []uint64{earlier.Hash()}})
+	if len(got.PV) == 0 || got.PV[0].String() != "g1f3" || got.Score != 0 {
+		t.Errorf("want g1f3 with score 0, got %v with score %d", got.PV, got.Score)
+	}
+}
+
+func TestSearch_Limits(t *testing.T) {
+	p := chess.NewPosition()
+
+	got := Search(context.Background(), p, core.Options{Nodes: 1000})
+	if got.Nodes > 1000 || len(got.PV) == 0 {
+		t.Errorf("node limit: searched %d nodes, got PV %v", got.Nodes, got.PV)
+	}
+
+	root := []chess.Move{chess.NewMove(chess.A2, chess.A3), chess.NewMove(chess.H2, chess.H3)}
+	got = Search(context.Background(), p, core.Options{Depth: 2, RootMoves: root})
+	if len(got.PV) == 0 || (got.PV[0] != root[0] && got.PV[0] != root[1]) {
+		t.Errorf("root moves: got PV %v", got.PV)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	got = Search(ctx, p, core.Options{})
+	if len(got.PV) != 1 || got.Depth != 0 {
+		t.Errorf("canceled: got depth %d and PV %v", got.Depth, got.PV)
+	}
+
+	var depths []int
+	Search(context.Background(), p, core.Options{Depth: 3, Report: func(it core.Iteration) {
+		depths = append(depths, it.Depth)
+		if len(it.PV) == 0 {
+			t.Errorf("depth %d: empty PV", it.Depth)
+		}
+	}})
+	if len(depths) != 3 || depths[0] != 1 || depths[2] != 3 {
+		t.Errorf("reported depths %v, want [1 2 3]", depths)
+	}
+}
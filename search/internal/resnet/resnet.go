@@ -0,0 +1,392 @@
+// Package resnet implements a small residual policy and value network, in
+// the style of AlphaZero, evaluated in pure Go on the CPU.
+//
+// The input is the position from the side to move's point of view, as
+// planes of 8x8 squares. A 3x3 convolution and a tower of residual blocks,
+// each two 3x3 convolutions with a skip connection, produce Filters planes.
+// The policy head is a 1x1 convolution to 64 planes, one per destination
+// square, giving a logit for a move from each square; the priors are the
+// softmax of the legal moves' logits. The value head is a 1x1 convolution to
+// one plane, a hidden layer, and a sigmoid, giving the side to move's win
+// probability.
+//
+// Batch normalization, if used in training, must be folded into the
+// convolutions' weights and biases.
+package resnet
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/clfs/good/chess"
+)
+
+// Input planes: the side to move's pieces, the opponent's pieces, their
+// castling rights, the en passant square, and a plane of ones, which lets
+// convolutions tell the edge of the board.
+const (
+	planePieces    = 0  // 12 planes, pawns to kings, ours then theirs.
+	planeCastling  = 12 // 4 planes: our short and long castling, then theirs.
+	planeEnPassant = 16
+	planeOnes      = 17
+
+	// InputPlanes is the number of input planes.
+	InputPlanes = 18
+)
+
+// magic identifies network files.
+const magic = "GOODRNET"
+
+// version is the current network file version.
+const version = 1
+
+// Network is a residual policy and value network.
+type Network struct {
+	Blocks      int // Residual blocks.
+	Filters     int // Planes in the body.
+	ValueHidden int // Size of the value head's hidden layer.
+
+	// Convolution weights are indexed by output plane, input plane, and
+	// the 3x3 or 1x1 kernel, in order.
+	InputWeights []float32 // Filters × InputPlanes × 3×3.
+	InputBiases  []float32 // Filters.
+	BlockWeights []float32 // Blocks × 2 convolutions × Filters × Filters × 3×3.
+	BlockBiases  []float32 // Blocks × 2 convolutions × Filters.
+
+	PolicyWeights []float32 // 64 × Filters.
+	PolicyBiases  []float32 // 64.
+
+	ValueConvWeights []float32 // Filters.
+	ValueConvBias    float32
+	ValueWeights     []float32 // ValueHidden × 64.
+	ValueBiases      []float32 // ValueHidden.
+	ValueOutWeights  []float32 // ValueHidden.
+	ValueOutBias     float32
+}
+
+// NewNetwork returns a new network of the given sizes with all parameters
+// set to zero.
+func NewNetwork(blocks, filters, valueHidden int) *Network {
+	return &Network{
+		Blocks:           blocks,
+		Filters:          filters,
+		ValueHidden:      valueHidden,
+		InputWeights:     make([]float32, filters*InputPlanes*9),
+		InputBiases:      make([]float32, filters),
+		BlockWeights:     make([]float32, blocks*2*filters*filters*9),
+		BlockBiases:      make([]float32, blocks*2*filters),
+		PolicyWeights:    make([]float32, 64*filters),
+		PolicyBiases:     make([]float32, 64),
+		ValueConvWeights: make([]float32, filters),
+		ValueWeights:     make([]float32, valueHidden*64),
+		ValueBiases:      make([]float32, valueHidden),
+		ValueOutWeights:  make([]float32, valueHidden),
+	}
+}
+
+// header is the fixed-size header of a network file.
+type header struct {
+	Magic       [8]byte
+	Version     uint32
+	Blocks      uint32
+	Filters     uint32
+	ValueHidden uint32
+}
+
+// Load reads a network in the format written by WriteTo.
+func Load(r io.Reader) (*Network, error) {
+	br := bufio.NewReader(r)
+
+	var h header
+	if err := binary.Read(br, binary.LittleEndian, &h); err != nil {
+		return nil, fmt.Errorf("resnet: reading header: %w", err)
+	}
+	if string(h.Magic[:]) != magic {
+		return nil, errors.New("resnet: not a network file")
+	}
+	if h.Version != version {
+		return nil, fmt.Errorf("resnet: unsupported version: %d", h.Version)
+	}
+	if h.Blocks > 64 || h.Filters == 0 || h.Filters > 512 || h.ValueHidden == 0 || h.ValueHidden > 4096 {
+		return nil, fmt.Errorf("resnet: invalid sizes: %d blocks, %d filters, %d value hidden", h.Blocks, h.Filters, h.ValueHidden)
+	}
+
+	n := NewNetwork(int(h.Blocks), int(h.Filters), int(h.ValueHidden))
+	for _, data := range n.parameters() {
+		if err := binary.Read(br, binary.LittleEndian, data); err != nil {
+			return nil, fmt.Errorf("resnet: reading parameters: %w", err)
+		}
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		return nil, errors.New("resnet: trailing data after parameters")
+	}
+	return n, nil
+}
+
+// WriteTo writes the network to w.
+func (n *Network) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	h := header{
+		Version:     version,
+		Blocks:      uint32(n.Blocks),
+		Filters:     uint32(n.Filters),
+		ValueHidden: uint32(n.ValueHidden),
+	}
+	copy(h.Magic[:], magic)
+	if err := binary.Write(bw, binary.LittleEndian, h); err != nil {
+		return cw.n, err
+	}
+	for _, data := range n.parameters() {
+		if err := binary.Write(bw, binary.LittleEndian, data); err != nil {
+			return cw.n, err
+		}
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// countingWriter counts the bytes written to an underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// parameters returns pointers to all parameters, in file order.
+func (n *Network) parameters() []any {
+	return []any{
+		n.InputWeights, n.InputBiases,
+		n.BlockWeights, n.BlockBiases,
+		n.PolicyWeights, n.PolicyBiases,
+		n.ValueConvWeights, &n.ValueConvBias,
+		n.ValueWeights, n.ValueBiases,
+		n.ValueOutWeights, &n.ValueOutBias,
+	}
+}
+
+// Evaluate returns a prior probability for each of p's legal moves, in the
+// order of moves, and the win probability of the side to move.
+func (n *Network) Evaluate(p *chess.Position, moves []chess.Move) (priors []float64, value float64) {
+	return n.evaluate(n.newScratch(), p, moves)
+}
+
+// EvaluateBatch evaluates several positions as Evaluate does, in parallel.
+func (n *Network) EvaluateBatch(ps []*chess.Position, moves [][]chess.Move) (priors [][]float64, values []float64) {
+	priors, values = make([][]float64, len(ps)), make([]float64, len(ps))
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(ps) {
+		workers = len(ps)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			sc := n.newScratch()
+			for i := w; i < len(ps); i += workers {
+				priors[i], values[i] = n.evaluate(sc, ps[i], moves[i])
+			}
+		}(w)
+	}
+	wg.Wait()
+	return priors, values
+}
+
+// scratch holds the activations of one evaluation.
+type scratch struct {
+	input    []float32 // InputPlanes × 64.
+	x, y, z  []float32 // Filters × 64 each.
+	policy   []float32 // 64 × 64.
+	valueMap []float32 // 64.
+}
+
+func (n *Network) newScratch() *scratch {
+	f := n.Filters * 64
+	return &scratch{
+		input:    make([]float32, InputPlanes*64),
+		x:        make([]float32, f),
+		y:        make([]float32, f),
+		z:        make([]float32, f),
+		policy:   make([]float32, 64*64),
+		valueMap: make([]float32, 64),
+	}
+}
+
+func (n *Network) evaluate(sc *scratch, p *chess.Position, moves []chess.Move) ([]float64, float64) {
+	encode(sc.input, p)
+
+	f := n.Filters
+	conv3x3(sc.x, sc.input, n.InputWeights, n.InputBiases, InputPlanes, f)
+	relu(sc.x)
+	for b := 0; b < n.Blocks; b++ {
+		w1 := n.BlockWeights[(2*b)*f*f*9 : (2*b+1)*f*f*9]
+		w2 := n.BlockWeights[(2*b+1)*f*f*9 : (2*b+2)*f*f*9]
+		conv3x3(sc.y, sc.x, w1, n.BlockBiases[(2*b)*f:(2*b+1)*f], f, f)
+		relu(sc.y)
+		conv3x3(sc.z, sc.y, w2, n.BlockBiases[(2*b+1)*f:(2*b+2)*f], f, f)
+		for i := range sc.x {
+			sc.x[i] += sc.z[i]
+		}
+		relu(sc.x)
+	}
+
+	// Policy head.
+	conv1x1(sc.policy, sc.x, n.PolicyWeights, n.PolicyBiases, f, 64)
+	priors := make([]float64, len(moves))
+	maxLogit := math.Inf(-1)
+	for i, m := range moves {
+		from, to := relative(m.From(), p.SideToMove), relative(m.To(), p.SideToMove)
+		priors[i] = float64(sc.policy[int(to)*64+int(from)])
+		maxLogit = math.Max(maxLogit, priors[i])
+	}
+	var sum float64
+	for i := range priors {
+		priors[i] = math.Exp(priors[i] - maxLogit)
+		sum += priors[i]
+	}
+	for i := range priors {
+		priors[i] /= sum
+	}
+
+	// Value head.
+	conv1x1(sc.valueMap, sc.x, n.ValueConvWeights, []float32{n.ValueConvBias}, f, 1)
+	relu(sc.valueMap)
+	out := float64(n.ValueOutBias)
+	for h := 0; h < n.ValueHidden; h++ {
+		v := n.ValueBiases[h]
+		row := n.ValueWeights[h*64 : (h+1)*64]
+		for s, a := range sc.valueMap {
+			v += row[s] * a
+		}
+		if v > 0 {
+			out += float64(n.ValueOutWeights[h] * v)
+		}
+	}
+	return priors, 1 / (1 + math.Exp(-out))
+}
+
+// relative returns a square as seen by a color: flipped vertically for
+// black, so that both colors see their pieces moving up the board.
+func relative(s chess.Square, c chess.Color) chess.Square {
+	if c == chess.Black {
+		return s ^ 56
+	}
+	return s
+}
+
+// encode writes the input planes of p to dst.
+func encode(dst []float32, p *chess.Position) {
+	for i := range dst {
+		dst[i] = 0
+	}
+	us := p.SideToMove
+	for pc := chess.WhitePawn; pc <= chess.BlackKing; pc++ {
+		plane := planePieces + int(pc.Role())
+		if pc.Color() != us {
+			plane += 6
+		}
+		b := p.Board[pc]
+		for b != 0 {
+			dst[plane*64+int(relative(b.Pop(), us))] = 1
+		}
+	}
+
+	rights := []chess.CastleRight{
+		chess.WhiteShortCastleRight, chess.WhiteLongCastleRight,
+		chess.BlackShortCastleRight, chess.BlackLongCastleRight,
+	}
+	if us == chess.Black {
+		rights[0], rights[1], rights[2], rights[3] = rights[2], rights[3], rights[0], rights[1]
+	}
+	for i, r := range rights {
+		if p.CastleRights.Get(r) {
+			fill(dst[(planeCastling+i)*64:(planeCastling+i+1)*64], 1)
+		}
+	}
+
+	if p.EnPassantRight != chess.NoEnPassantRight {
+		dst[planeEnPassant*64+int(relative(chess.Square(p.EnPassantRight), us))] = 1
+	}
+	fill(dst[planeOnes*64:(planeOnes+1)*64], 1)
+}
+
+func fill(dst []float32, v float32) {
+	for i := range dst {
+		dst[i] = v
+	}
+}
+
+func relu(x []float32) {
+	for i, v := range x {
+		if v < 0 {
+			x[i] = 0
+		}
+	}
+}
+
+// neighbors holds, for each square and each cell of a 3x3 kernel, the
+// square under the cell, or -1 off the board.
+var neighbors [64][9]int
+
+func init() {
+	for s := 0; s < 64; s++ {
+		r, f := s/8, s%8
+		for k := 0; k < 9; k++ {
+			nr, nf := r+k/3-1, f+k%3-1
+			neighbors[s][k] = -1
+			if nr >= 0 && nr < 8 && nf >= 0 && nf < 8 {
+				neighbors[s][k] = nr*8 + nf
+			}
+		}
+	}
+}
+
+// conv3x3 computes a 3x3 convolution of in planes of src to out planes of
+// dst, zero-padded at the edges of the board.
+func conv3x3(dst, src, weights, biases []float32, in, out int) {
+	for o := 0; o < out; o++ {
+		d := dst[o*64 : (o+1)*64]
+		fill(d, biases[o])
+		for i := 0; i < in; i++ {
+			w := weights[(o*in+i)*9 : (o*in+i+1)*9]
+			plane := src[i*64 : (i+1)*64]
+			for s := range d {
+				var sum float32
+				for k, t := range neighbors[s] {
+					if t >= 0 {
+						sum += w[k] * plane[t]
+					}
+				}
+				d[s] += sum
+			}
+		}
+	}
+}
+
+// conv1x1 computes a 1x1 convolution of in planes of src to out planes of
+// dst.
+func conv1x1(dst, src, weights, biases []float32, in, out int) {
+	for o := 0; o < out; o++ {
+		d := dst[o*64 : (o+1)*64]
+		fill(d, biases[o])
+		for i := 0; i < in; i++ {
+			w := weights[o*in+i]
+			plane := src[i*64 : (i+1)*64]
+			for s := range d {
+				d[s] += w * plane[s]
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package resnet
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/fen"
+)
+
+// randomNetwork returns a small network with random parameters.
+func randomNetwork(r *rand.Rand) *Network {
+	n := NewNetwork(2, 8, 16)
+	for _, data := range n.parameters() {
+		switch d := data.(type) {
+		case []float32:
+			for i := range d {
+				d[i] = float32(r.NormFloat64() * 0.2)
+			}
+		case *float32:
+			*d = float32(r.NormFloat64() * 0.2)
+		}
+	}
+	return n
+}
+
+var testFENs = []string{
+	fen.Starting,
+	"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+	"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+	"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 b - - 0 1",
+}
+
+func TestNetwork_WriteTo(t *testing.T) {
+	n := randomNetwork(rand.New(rand.NewSource(1)))
+	var buf bytes.Buffer
+	if _, err := n.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	got, err := Load(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := chess.NewPosition()
+	moves := p.LegalMoves()
+	wantPriors, wantValue := n.Evaluate(&p, moves)
+	gotPriors, gotValue := got.Evaluate(&p, moves)
+	if gotValue != wantValue || gotPriors[0] != wantPriors[0] {
+		t.Errorf("loaded network evaluates to %v, %v; want %v, %v", gotPriors[0], gotValue, wantPriors[0], wantValue)
+	}
+
+	bad := map[string][]byte{
+		"truncated": data[:len(data)-1],
+		"trailing":  append(append([]byte(nil), data...), 0),
+		"magic":     append([]byte("BADMAGIC"), data[8:]...),
+	}
+	for name, b := range bad {
+		if _, err := Load(bytes.NewReader(b)); err == nil {
+			t.Errorf("%s: want an error", name)
+		}
+	}
+}
+
+func TestNetwork_Evaluate(t *testing.T) {
+	n := randomNetwork(rand.New(rand.NewSource(2)))
+	var (
+		ps    []*chess.Position
+		moves [][]chess.Move
+	)
+	for _, s := range testFENs {
+		p, err := fen.From(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ps = append(ps, &p)
+		moves = append(moves, p.LegalMoves())
+	}
+
+	batchPriors, batchValues := n.EvaluateBatch(ps, moves)
+	for i, p := range ps {
+		priors, value := n.Evaluate(p, moves[i])
+		if len(priors) != len(moves[i]) || value <= 0 || value >= 1 {
+			t.Errorf("%s: got %d priors and value %v", testFENs[i], len(priors), value)
+		}
+		var sum float64
+		for _, pr := range priors {
+			sum += pr
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			t.Errorf("%s: priors sum to %v", testFENs[i], sum)
+		}
+		if value != batchValues[i] || priors[0] != batchPriors[i][0] {
+			t.Errorf("%s: batch evaluation differs", testFENs[i])
+		}
+	}
+}
+
+// TestNetwork_Symmetry checks that the network sees positions from the side
+// to move's point of view, so that flipping colors changes nothing.
+func TestNetwork_Symmetry(t *testing.T) {
+	n := randomNetwork(rand.New(rand.NewSource(3)))
+	flip := func(m chess.Move) chess.Move {
+		return chess.NewMove(m.From()^56, m.To()^56)
+	}
+	for _, s := range testFENs {
+		p, err := fen.From(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		flipped := p
+		flipped.FlipColors()
+
+		moves := p.LegalMoves()
+		var flippedMoves []chess.Move
+		for _, m := range moves {
+			flippedMoves = append(flippedMoves, flip(m))
+		}
+		priors, value := n.Evaluate(&p, moves)
+		flippedPriors, flippedValue := n.Evaluate(&flipped, flippedMoves)
+		if math.Abs(value-flippedValue) > 1e-6 {
+			t.Errorf("%s: value %v, flipped %v", s, value, flippedValue)
+		}
+		for i := range priors {
+			if math.Abs(priors[i]-flippedPriors[i]) > 1e-6 {
+				t.Errorf("%s: %v has prior %v, flipped %v", s, moves[i], priors[i], flippedPriors[i])
+			}
+		}
+	}
+}
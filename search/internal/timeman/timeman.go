@@ -0,0 +1,150 @@
+// Package timeman decides how long to search a move from the clock.
+//
+// A search gets two limits. The hard limit is a deadline it must not pass,
+// and is far enough from the end of the clock that the engine can't lose on
+// time. The soft limit is how long a search should usually take: after each
+// iteration, the search stops if it's past the soft limit, stretched while
+// the best move is unstable or the score is dropping, and shrunk when one
+// move takes most of the effort.
+package timeman
+
+import (
+	"time"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/search/internal/core"
+)
+
+// A Clock is the time control of the side to move.
+type Clock struct {
+	Time time.Duration // The time left.
+	Inc  time.Duration // The increment per move.
+
+	// MovesToGo is the number of moves until the next time control, or 0 if
+	// there isn't one, as in sudden death or increment controls.
+	MovesToGo int
+
+	// Overhead is the time lost on each move outside the search, such as in
+	// communication with the GUI.
+	Overhead time.Duration
+}
+
+const (
+	// horizon is the number of moves a game is assumed to last beyond the
+	// current one, when there's no next time control, or it's further.
+	horizon = 40
+	// incShare is the share of the increment a move uses beyond its share
+	// of the time left.
+	incShare = 0.75
+	// maxShare is the most of the time left, after the overhead, that a
+	// move may take.
+	maxShare = 0.75
+	// The hard limit is stretch times the soft limit, where stretch grows
+	// from minStretch by stretchPerMove for each move to go. Near a time
+	// control, a long search would leave too little time for the rest of the
+	// moves.
+	minStretch     = 1
+	stretchPerMove = 0.05
+	// minHard is the least hard limit, within maxShare of the time left,
+	// so that a search on a short clock still completes an iteration or two.
+	minHard = 10 * time.Millisecond
+)
+
+// Stopping rules, applied to the soft limit after each iteration.
+const (
+	// instabilityDecay is how much of the best move's instability remains
+	// after each iteration. Each change of best move adds one to it.
+	instabilityDecay = 0.5
+	// instabilityWeight stretches the soft limit by this much per unit of
+	// instability.
+	instabilityWeight = 1
+	// dropScale is the drop in score, in centipawns, that doubles the soft
+	// limit. Larger drops count as this much.
+	dropScale = 100
+	// dominance is the effort share of the best move past which it's
+	// unlikely to be overtaken, and the soft limit is halved.
+	dominance = 0.9
+	// dominanceIterations is the number of iterations before effort is
+	// trusted, since early ones search too few nodes to tell.
+	dominanceIterations = 6
+)
+
+// A Manager budgets the time of a search.
+type Manager struct {
+	soft, hard time.Duration
+
+	iterations  int
+	best        chess.Move // The best move of the last iteration.
+	score       int        // The score of the last iteration.
+	instability float64
+}
+
+// New returns a manager for a search with clock c.
+func New(c Clock) *Manager {
+	moves := c.MovesToGo
+	if moves <= 0 || moves > horizon {
+		moves = horizon
+	}
+	// The soft limit shares the time left, after this move's overhead,
+	// among the moves to go.
+	left := nonNegative(c.Time - c.Overhead)
+	soft := left/time.Duration(moves) + time.Duration(incShare*float64(c.Inc))
+	stretch := minStretch + stretchPerMove*float64(moves)
+	hard := time.Duration(stretch * float64(soft))
+	if hard < minHard {
+		hard = minHard
+	}
+	if budget := time.Duration(maxShare * float64(left)); hard > budget {
+		hard = budget
+	}
+	if soft > hard {
+		soft = hard
+	}
+	return &Manager{soft: soft, hard: hard}
+}
+
+// nonNegative returns d, or 0 if d is negative.
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// Soft returns the time a search should usually take.
+func (m *Manager) Soft() time.Duration {
+	return m.soft
+}
+
+// Hard returns the time a search must not exceed.
+func (m *Manager) Hard() time.Duration {
+	return m.hard
+}
+
+// Stop reports whether a search should stop after completing an iteration,
+// elapsed after it started.
+func (m *Manager) Stop(it core.Iteration, elapsed time.Duration) bool {
+	if len(it.PV) == 0 {
+		return false
+	}
+	scale := 1.0
+	m.instability *= instabilityDecay
+	if m.iterations > 0 {
+		if it.PV[0] != m.best {
+			m.instability++
+		}
+		if drop := m.score - it.Score; drop > 0 && !core.IsMate(m.score) && !core.IsMate(it.Score) {
+			if drop > dropScale {
+				drop = dropScale
+			}
+			scale *= 1 + float64(drop)/dropScale
+		}
+	}
+	scale *= 1 + instabilityWeight*m.instability
+	m.iterations++
+	if m.iterations >= dominanceIterations && it.Effort >= dominance {
+		scale /= 2
+	}
+	m.best, m.score = it.PV[0], it.Score
+	return elapsed >= time.Duration(scale*float64(m.soft))
+}
@@ -0,0 +1,125 @@
+package timeman
+
+import (
+	"testing"
+	"time"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/search/internal/core"
+)
+
+const ms = time.Millisecond
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		clock      Clock
+		soft, hard time.Duration
+	}{
+		{Clock{Time: 60000 * ms}, 1500 * ms, 4500 * ms},                                            // Sudden death.
+		{Clock{Time: 60000 * ms, Inc: 1000 * ms}, 2250 * ms, 6750 * ms},                            // Increment.
+		{Clock{Time: 60000 * ms, MovesToGo: 20}, 3000 * ms, 6000 * ms},                             // Repeating.
+		{Clock{Time: 60000 * ms, MovesToGo: 1}, 45000 * ms, 45000 * ms},                            // Last move before the control.
+		{Clock{Time: 1410 * ms, Overhead: 10 * ms}, 35 * ms, 105 * ms},                             // Overhead.
+		{Clock{Time: 410 * ms, Overhead: 10 * ms}, 10 * ms, 30 * ms},                               // Bullet.
+		{Clock{Time: 90 * ms, Overhead: 10 * ms}, 2 * ms, 10 * ms},                                 // Short clock.
+		{Clock{Time: 20 * ms, Overhead: 10 * ms}, 250 * time.Microsecond, 7500 * time.Microsecond}, // Nearly out of time.
+		{Clock{Time: 1000 * ms, Inc: 2000 * ms}, 750 * ms, 750 * ms},                               // More increment than time.
+		{Clock{Time: 5 * ms, Inc: 1000 * ms, Overhead: 10 * ms}, 0, 0},                             // Out of time.
+		{Clock{Time: 60000 * ms, MovesToGo: 100}, 1500 * ms, 4500 * ms},                            // Far control.
+		{Clock{Time: 60000 * ms, Inc: 1000 * ms, MovesToGo: 1}, 45000 * ms, 45000 * ms},            // Increment and control.
+	}
+	for _, tc := range cases {
+		m := New(tc.clock)
+		if m.Soft() != tc.soft || m.Hard() != tc.hard {
+			t.Errorf("%+v: want soft %v and hard %v, got %v and %v", tc.clock, tc.soft, tc.hard, m.Soft(), m.Hard())
+		}
+	}
+}
+
+// TestNew_Game plays games in which every search takes as long as it may,
+// and checks that the clock never runs out.
+// TestNew_Short checks that short clocks without increment still leave time
+// to search.
+func TestNew_Short(t *testing.T) {
+	for left := 100 * ms; left <= 400*ms; left += 10 * ms {
+		m := New(Clock{Time: left, Overhead: 10 * ms})
+		if m.Soft() <= 0 || m.Hard() < 10*ms {
+			t.Errorf("%v: want some time to search, got soft %v and hard %v", left, m.Soft(), m.Hard())
+		}
+	}
+}
+
+func TestNew_Game(t *testing.T) {
+	cases := []struct {
+		name      string
+		time, inc time.Duration
+		movesToGo int // Moves per control, or 0 for one control.
+		moves     int
+	}{
+		{"sudden death", 60000 * ms, 0, 0, 60},
+		{"increment", 10000 * ms, 100 * ms, 0, 500},
+		{"small increment", 1000 * ms, 20 * ms, 0, 500},
+		{"repeating", 60000 * ms, 0, 40, 500},
+		{"repeating increment", 60000 * ms, 500 * ms, 40, 500},
+		{"one move per control", 1000 * ms, 0, 1, 500},
+		{"bullet", 400 * ms, 10 * ms, 0, 200},
+	}
+	const overhead = 10 * ms
+	for _, tc := range cases {
+		left := tc.time
+		for move := 0; move < tc.moves; move++ {
+			toGo := 0
+			if tc.movesToGo > 0 {
+				toGo = tc.movesToGo - move%tc.movesToGo
+			}
+			m := New(Clock{Time: left, Inc: tc.inc, MovesToGo: toGo, Overhead: overhead})
+			left -= m.Hard() + overhead
+			if left <= 0 {
+				t.Errorf("%s: lost on time on move %d", tc.name, move+1)
+				break
+			}
+			left += tc.inc
+			if toGo == 1 {
+				left += tc.time
+			}
+		}
+	}
+}
+
+func TestManager_Stop(t *testing.T) {
+	a, b := chess.NewMove(chess.E2, chess.E4), chess.NewMove(chess.D2, chess.D4)
+	iteration := func(m chess.Move, score int, effort float64) core.Iteration {
+		return core.Iteration{PV: []chess.Move{m}, Score: score, Effort: effort}
+	}
+	const soft = 1500 * ms
+	cases := []struct {
+		name    string
+		its     []core.Iteration
+		elapsed time.Duration // When the last iteration completes.
+		want    bool
+	}{
+		{"before soft", []core.Iteration{iteration(a, 0, 0.5)}, soft - ms, false},
+		{"at soft", []core.Iteration{iteration(a, 0, 0.5)}, soft, true},
+		{"new best", []core.Iteration{iteration(a, 0, 0.5), iteration(b, 0, 0.5)}, 2*soft - ms, false},
+		{"new best, later", []core.Iteration{iteration(a, 0, 0.5), iteration(b, 0, 0.5)}, 2 * soft, true},
+		{"new best, earlier", []core.Iteration{iteration(a, 0, 0.5), iteration(b, 0, 0.5), iteration(b, 0, 0.5)}, 3 * soft / 2, true},
+		{"score drop", []core.Iteration{iteration(a, 50, 0.5), iteration(a, 0, 0.5)}, 3*soft/2 - ms, false},
+		{"score rise", []core.Iteration{iteration(a, 0, 0.5), iteration(a, 50, 0.5)}, soft, true},
+		{"mated", []core.Iteration{iteration(a, 0, 0.5), iteration(a, -core.Mate+10, 0.5)}, soft, true},
+		{"dominant early", []core.Iteration{iteration(a, 0, 0.95)}, soft / 2, false},
+		{"dominant", []core.Iteration{
+			iteration(a, 0, 0.95), iteration(a, 0, 0.95), iteration(a, 0, 0.95),
+			iteration(a, 0, 0.95), iteration(a, 0, 0.95), iteration(a, 0, 0.95),
+		}, soft / 2, true},
+	}
+	for _, tc := range cases {
+		m := New(Clock{Time: 60000 * ms})
+		var got bool
+		for _, it := range tc.its {
+			got = m.Stop(it, tc.elapsed)
+		}
+		if got != tc.want {
+			t.Errorf("%s: want %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+// Package tt implements a transposition table, which caches search results
+// by position hash so that they can be reused when a position is reached
+// again, by another move order or in a later iteration.
+//
+// Tables are shared by search threads without locks. Each entry is two
+// words, the hash XOR the data and the data itself, each read and written
+// atomically. If two threads write the same entry at once, a reader may see
+// one word from each, but then the hash won't check out, and the entry is
+// treated as missing.
+package tt
+
+import (
+	"math/bits"
+	"sync/atomic"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/search/internal/core"
+)
+
+// Bound tells how a stored score relates to the true score of a position.
+type Bound uint8
+
+const (
+	NoBound Bound = iota
+	Upper         // The true score is at most the stored score.
+	Lower         // The true score is at least the stored score.
+	Exact         // The stored score is the true score.
+)
+
+// An Entry is a search result for one position.
+type Entry struct {
+	Move  chess.Move // The best move, or zero if unknown.
+	Score int        // The score found by the search.
+	Eval  int        // The static evaluation.
+	Depth int        // The depth searched, from -128 to 127.
+	Bound Bound
+}
+
+// bucketSize is the number of entries in a bucket. A position may be stored
+// in any entry of its bucket.
+const bucketSize = 4
+
+// entryBytes is the size of an entry.
+const entryBytes = 16
+
+// An entry holds a packed Entry in data, and the position's hash XOR data
+// in key. Both are accessed atomically.
+type entry struct {
+	key, data uint64
+}
+
+// Data layout, from the least significant bit.
+const (
+	moveShift  = 0  // 16 bits.
+	scoreShift = 16 // 16 bits, signed.
+	evalShift  = 32 // 16 bits, signed.
+	depthShift = 48 // 8 bits, signed.
+	boundShift = 56 // 2 bits.
+	genShift   = 58 // 6 bits.
+	genMask    = 63
+)
+
+func pack(e Entry, gen uint8) uint64 {
+	return uint64(e.Move)<<moveShift |
+		uint64(uint16(int16(e.Score)))<<scoreShift |
+		uint64(uint16(int16(e.Eval)))<<evalShift |
+		uint64(uint8(int8(e.Depth)))<<depthShift |
+		uint64(e.Bound&3)<<boundShift |
+		uint64(gen&genMask)<<genShift
+}
+
+func unpack(data uint64) (e Entry, gen uint8) {
+	e.Move = chess.Move(data >> moveShift)
+	e.Score = int(int16(data >> scoreShift))
+	e.Eval = int(int16(data >> evalShift))
+	e.Depth = int(int8(data >> depthShift))
+	e.Bound = Bound(data>>boundShift) & 3
+	return e, uint8(data>>genShift) & genMask
+}
+
+// A Table is a transposition table. Probe, Store, and Hashfull are safe for
+// concurrent use, but the other methods must not be called during a search.
+type Table struct {
+	entries []entry
+	buckets uint64
+	gen     uint32 // Generation of the current search, accessed atomically.
+}
+
+// New returns a table of about mb megabytes.
+func New(mb int) *Table {
+	t := &Table{}
+	t.Resize(mb)
+	return t
+}
+
+// Resize changes the size of the table to about mb megabytes, clearing it.
+// The table always has room for at least one bucket.
+func (t *Table) Resize(mb int) {
+	n := uint64(mb) << 20 / (bucketSize * entryBytes)
+	if n == 0 {
+		n = 1
+	}
+	t.entries = make([]entry, n*bucketSize)
+	t.buckets = n
+	atomic.StoreUint32(&t.gen, 0)
+}
+
+// Clear empties the table.
+func (t *Table) Clear() {
+	for i := range t.entries {
+		t.entries[i] = entry{}
+	}
+	atomic.StoreUint32(&t.gen, 0)
+}
+
+// NewSearch starts a new search. Entries from earlier searches are replaced
+// first.
+func (t *Table) NewSearch() {
+	atomic.AddUint32(&t.gen, 1)
+}
+
+func (t *Table) generation() uint8 {
+	return uint8(atomic.LoadUint32(&t.gen)) & genMask
+}
+
+// bucket returns the entries a hash may be stored in.
+func (t *Table) bucket(hash uint64) []entry {
+	i, _ := bits.Mul64(hash, t.buckets)
+	return t.entries[i*bucketSize : (i+1)*bucketSize]
+}
+
+// Probe returns the entry for a position, if there is one. Mate scores are
+// adjusted to count from a root ply plies above the position.
+func (t *Table) Probe(hash uint64, ply int) (Entry, bool) {
+	b := t.bucket(hash)
+	for i := range b {
+		ent := &b[i]
+		data := atomic.LoadUint64(&ent.data)
+		if atomic.LoadUint64(&ent.key)^data != hash {
+			continue
+		}
+		e, _ := unpack(data)
+		if e.Bound == NoBound {
+			continue
+		}
+		e.Score = fromTT(e.Score, ply)
+		return e, true
+	}
+	return Entry{}, false
+}
+
+// Store stores the entry for a position found ply plies below the root. If
+// the entry has no move, any move already stored for the position is kept.
+//
+// Another entry of the position's bucket is replaced if the position isn't
+// there: the shallowest one, preferring entries from earlier searches.
+func (t *Table) Store(hash uint64, ply int, e Entry) {
+	gen := t.generation()
+	b := t.bucket(hash)
+	victim := &b[0]
+	worst := 1 << 30
+	for i := range b {
+		ent := &b[i]
+		data := atomic.LoadUint64(&ent.data)
+		if atomic.LoadUint64(&ent.key)^data == hash {
+			if old, _ := unpack(data); e.Move == 0 {
+				e.Move = old.Move
+			}
+			victim = ent
+			break
+		}
+		old, oldGen := unpack(data)
+		value := old.Depth - 8*int((gen-oldGen)&genMask)
+		if old.Bound == NoBound {
+			value = -1 << 20
+		}
+		if value < worst {
+			victim, worst = ent, value
+		}
+	}
+
+	e.Score = toTT(e.Score, ply)
+	data := pack(e, gen)
+	atomic.StoreUint64(&victim.data, data)
+	atomic.StoreUint64(&victim.key, hash^data)
+}
+
+// Hashfull returns how full the table is with entries from the current
+// search, in permille, estimated from its first buckets.
+func (t *Table) Hashfull() int {
+	n := len(t.entries)
+	if n > 1000 {
+		n = 1000
+	}
+	gen := t.generation()
+	used := 0
+	for i := range t.entries[:n] {
+		e, g := unpack(atomic.LoadUint64(&t.entries[i].data))
+		if e.Bound != NoBound && g == gen {
+			used++
+		}
+	}
+	return used * 1000 / n
+}
+
+// toTT converts a mate score counted from the root to one counted from a
+// position ply plies below it, so that it holds wherever the position is
+// reached.
+func toTT(score, ply int) int {
+	switch {
+	case score >= core.Mate-core.MaxPly:
+		return score + ply
+	case score <= -core.Mate+core.MaxPly:
+		return score - ply
+	}
+	return score
+}
+
+// fromTT is the inverse of toTT.
+func fromTT(score, ply int) int {
+	switch {
+	case score >= core.Mate-core.MaxPly:
+		return score - ply
+	case score <= -core.Mate+core.MaxPly:
+		return score + ply
+	}
+	return score
+}
@@ -0,0 +1,130 @@
+package tt
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/search/internal/core"
+)
+
+func TestTable_StoreProbe(t *testing.T) {
+	tab := New(1)
+	cases := []Entry{
+		{Move: chess.NewMove(chess.E2, chess.E4), Score: 35, Eval: -12, Depth: 7, Bound: Exact},
+		{Move: chess.NewPromotionMove(chess.A7, chess.A8, chess.WhiteQueen), Score: -900, Eval: 900, Depth: -1, Bound: Upper},
+		{Score: core.Mate - 5, Depth: 127, Bound: Lower},
+	}
+	for i, want := range cases {
+		hash := uint64(i+1) * 0x9e3779b97f4a7c15
+		tab.Store(hash, 0, want)
+		got, ok := tab.Probe(hash, 0)
+		if !ok || got != want {
+			t.Errorf("want %+v, got %+v (%t)", want, got, ok)
+		}
+		if _, ok := tab.Probe(hash^1, 0); ok {
+			t.Errorf("%+v: found under another hash", want)
+		}
+	}
+}
+
+func TestTable_Mate(t *testing.T) {
+	tab := New(1)
+	// Mate in 3 plies from the root, found 2 plies below it, is mate in 1
+	// ply from the position, and mate in 5 plies from a root 4 plies above.
+	tab.Store(1, 2, Entry{Score: core.Mate - 3, Bound: Exact})
+	if e, _ := tab.Probe(1, 4); e.Score != core.Mate-5 {
+		t.Errorf("mating: want %d, got %d", core.Mate-5, e.Score)
+	}
+	tab.Store(2, 2, Entry{Score: -core.Mate + 3, Bound: Exact})
+	if e, _ := tab.Probe(2, 4); e.Score != -core.Mate+5 {
+		t.Errorf("mated: want %d, got %d", -core.Mate+5, e.Score)
+	}
+	tab.Store(3, 2, Entry{Score: 250, Bound: Exact})
+	if e, _ := tab.Probe(3, 4); e.Score != 250 {
+		t.Errorf("not mate: want 250, got %d", e.Score)
+	}
+}
+
+func TestTable_KeepMove(t *testing.T) {
+	tab := New(1)
+	m := chess.NewMove(chess.G1, chess.F3)
+	tab.Store(42, 0, Entry{Move: m, Depth: 3, Bound: Lower})
+	tab.Store(42, 0, Entry{Depth: 4, Bound: Upper})
+	if e, _ := tab.Probe(42, 0); e.Move != m || e.Depth != 4 {
+		t.Errorf("want move %v at depth 4, got %v at depth %d", m, e.Move, e.Depth)
+	}
+}
+
+func TestTable_Replace(t *testing.T) {
+	tab := New(0) // A single bucket.
+	for i := 0; i < bucketSize; i++ {
+		tab.Store(uint64(i+1), 0, Entry{Depth: 10 + i, Bound: Exact})
+	}
+	// The shallowest entry is replaced.
+	tab.Store(100, 0, Entry{Depth: 1, Bound: Exact})
+	if _, ok := tab.Probe(1, 0); ok {
+		t.Error("the shallowest entry wasn't replaced")
+	}
+	// Entries from earlier searches count as shallower than they are.
+	tab.NewSearch()
+	tab.Store(101, 0, Entry{Depth: 5, Bound: Exact})
+	tab.Store(102, 0, Entry{Depth: 5, Bound: Exact})
+	for _, hash := range []uint64{101, 102} {
+		if _, ok := tab.Probe(hash, 0); !ok {
+			t.Errorf("entry %d was replaced", hash)
+		}
+	}
+	if _, ok := tab.Probe(2, 0); ok {
+		t.Error("an entry from the earlier search at depth 11 wasn't replaced")
+	}
+}
+
+func TestTable_Hashfull(t *testing.T) {
+	tab := New(1)
+	if n := tab.Hashfull(); n != 0 {
+		t.Errorf("empty: want 0, got %d", n)
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < len(tab.entries); i++ {
+		tab.Store(r.Uint64(), 0, Entry{Bound: Exact})
+	}
+	if n := tab.Hashfull(); n < 500 || n > 800 {
+		t.Errorf("after filling: got %d", n)
+	}
+	tab.NewSearch()
+	if n := tab.Hashfull(); n != 0 {
+		t.Errorf("new search: want 0, got %d", n)
+	}
+	tab.Clear()
+	if _, ok := tab.Probe(r.Uint64(), 0); ok || tab.Hashfull() != 0 {
+		t.Error("cleared table isn't empty")
+	}
+}
+
+// TestTable_Concurrent checks that entries read while other goroutines write
+// to the same buckets are never mixed from two writes.
+func TestTable_Concurrent(t *testing.T) {
+	tab := New(0)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for i := 0; i < 20000; i++ {
+				hash := r.Uint64() % 16
+				if r.Intn(2) == 0 {
+					tab.Store(hash, 0, Entry{Score: int(hash), Eval: int(hash), Depth: r.Intn(20), Bound: Exact})
+					continue
+				}
+				if e, ok := tab.Probe(hash, 0); ok && (e.Score != int(hash) || e.Eval != int(hash)) {
+					t.Errorf("hash %d: got entry %+v", hash, e)
+					return
+				}
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+}
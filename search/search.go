@@ -1,2 +1,391 @@
 // Package search finds good moves in positions.
 package search
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/search/internal/alphabeta"
+	"github.com/clfs/good/search/internal/core"
+	"github.com/clfs/good/search/internal/mcts"
+	"github.com/clfs/good/search/internal/resnet"
+	"github.com/clfs/good/search/internal/timeman"
+	"github.com/clfs/good/search/internal/tt"
+)
+
+// A Score is the value of a position from the side to move's point of view,
+// in centipawns, unless it's a mate score.
+type Score int
+
+// MateScore is the score of delivering checkmate at the root. Mating in n
+// plies scores MateScore - n, and being mated in n plies scores
+// -MateScore + n.
+const MateScore Score = core.Mate
+
+// maxMatePly is the longest mate, in plies, that a search can find.
+const maxMatePly = core.MaxPly
+
+// IsMate reports whether s is a mate score.
+func (s Score) IsMate() bool {
+	return s >= MateScore-maxMatePly || s <= -MateScore+maxMatePly
+}
+
+// MateMoves returns, for a mate score, the number of moves to mate. It's
+// positive if the side to move mates, and negative or zero if it's mated.
+func (s Score) MateMoves() int {
+	if s > 0 {
+		return (int(MateScore-s) + 1) / 2
+	}
+	return -int(MateScore+s) / 2
+}
+
+// String returns the score as in UCI info output, like "cp 25" or "mate -3".
+func (s Score) String() string {
+	if s.IsMate() {
+		return fmt.Sprintf("mate %d", s.MateMoves())
+	}
+	return fmt.Sprintf("cp %d", int(s))
+}
+
+// Limits controls how long a search runs and what it reports. The search
+// ends when any limit is reached, or when its context is done.
+type Limits struct {
+	Depth    int           // The deepest iteration, in plies, or 0 for no limit.
+	Nodes    int64         // The most nodes to search, or 0 for no limit.
+	MoveTime time.Duration // The longest time to search, or 0 for no limit.
+	Mate     int           // If non-zero, end the search once it finds a mate in at most this many moves.
+
+	// WhiteTime and BlackTime are the time left on each side's clock, and
+	// WhiteInc and BlackInc their increments per move. If the side to move
+	// has time left, the search budgets its time from its clock, after the
+	// move overhead.
+	WhiteTime, BlackTime time.Duration
+	WhiteInc, BlackInc   time.Duration
+	MovesToGo            int // The moves until the next time control, or 0 if there isn't one.
+
+	// Infinite makes the search ignore the other limits and run until its
+	// context is done, as UCI's "go infinite" requires.
+	Infinite bool
+
+	// SearchMoves restricts the search to some legal moves. If it's empty,
+	// every legal move is searched.
+	SearchMoves []chess.Move
+
+	// Tablebase, if non-nil, gives the results of endgame positions. At the
+	// root, only the moves that keep the tablebase result are searched,
+	// unless none of them are in SearchMoves.
+	Tablebase Tablebase
+
+	// DTM, if non-nil, gives the distance to mate of endgame positions, so
+	// that the search finds exact mate scores in them.
+	DTM DTM
+
+	// OnInfo, if non-nil, is called after each iteration of the search
+	// completes, in the goroutine that called Search.
+	OnInfo func(Info)
+}
+
+// A Tablebase knows the results of some endgame positions, as
+// *tablebase.Tablebase does.
+type Tablebase = core.Tablebase
+
+// A DTM knows the distance to mate of some endgame positions, as *dtm.Set
+// does.
+type DTM = core.DTM
+
+// DefaultHashSize is the initial size of the transposition table, in
+// megabytes.
+const DefaultHashSize = 16
+
+// table caches search results across searches.
+var table = tt.New(DefaultHashSize)
+
+// tree is the MCTS backend's search tree, kept across searches.
+var tree = mcts.NewTree(DefaultHashSize)
+
+// SetHashSize resizes the transposition table, and the MCTS backend's tree,
+// to about mb megabytes each and clears them. It must not be called during a
+// search.
+func SetHashSize(mb int) {
+	table.Resize(mb)
+	tree.Resize(mb)
+}
+
+// ClearHash clears the transposition table and the MCTS backend's tree, so
+// that a search isn't affected by earlier ones, as when a new game starts. It
+// must not be called during a search.
+func ClearHash() {
+	table.Clear()
+	tree.Clear()
+}
+
+// A Backend is a search algorithm.
+type Backend int
+
+const (
+	AlphaBeta Backend = iota // Alpha-beta search, the default.
+	MCTS                     // Monte Carlo tree search.
+)
+
+var backendNames = [...]string{
+	AlphaBeta: "AlphaBeta",
+	MCTS:      "MCTS",
+}
+
+// String returns the backend's name.
+func (b Backend) String() string {
+	if b < 0 || int(b) >= len(backendNames) {
+		return fmt.Sprintf("Backend(%d)", int(b))
+	}
+	return backendNames[b]
+}
+
+// ParseBackend returns the backend with a name, ignoring case.
+func ParseBackend(s string) (Backend, error) {
+	for b, name := range backendNames {
+		if strings.EqualFold(s, name) {
+			return Backend(b), nil
+		}
+	}
+	return 0, fmt.Errorf("search: unknown backend %s", s)
+}
+
+// backend is the algorithm searches use.
+var backend = AlphaBeta
+
+// SetBackend sets the algorithm searches use. With MCTS, searches run in one
+// thread, nodes count playouts, and the depth is that of the principal
+// variation. It must not be called during a search.
+func SetBackend(b Backend) {
+	backend = b
+}
+
+// mctsConfig configures the MCTS backend.
+var mctsConfig = mcts.DefaultConfig()
+
+// SetMCTSExploration sets the MCTS backend's exploration constant. Higher
+// values spread the search over more moves. It must not be called during a
+// search.
+func SetMCTSExploration(c float64) {
+	mctsConfig.Exploration = c
+}
+
+// SetMCTSRollouts sets whether the MCTS backend evaluates positions by random
+// rollouts, rather than by the static evaluation. It must not be called
+// during a search.
+func SetMCTSRollouts(on bool) {
+	mctsConfig.Rollouts = on
+}
+
+// LoadMCTSNetwork loads a residual policy/value network from r, in the format
+// of search/internal/resnet, and makes the MCTS backend search by PUCT with
+// it. It must not be called during a search.
+func LoadMCTSNetwork(r io.Reader) error {
+	n, err := resnet.Load(r)
+	if err != nil {
+		return err
+	}
+	mctsConfig.Net = n
+	return nil
+}
+
+// ResetMCTSNetwork unloads the MCTS backend's network, so that it searches by
+// UCT again. It must not be called during a search.
+func ResetMCTSNetwork() {
+	mctsConfig.Net = nil
+}
+
+// SetMCTSNoise sets the weight, from 0 to 1, of the Dirichlet noise PUCT
+// mixes into the root's priors, for variety in self-play. It must not be
+// called during a search.
+func SetMCTSNoise(fraction float64) {
+	mctsConfig.NoiseFraction = fraction
+}
+
+// SetMCTSTemperature sets the temperature with which the MCTS backend picks
+// its move at random by visits, for variety in self-play. Zero plays the most
+// visited move. It must not be called during a search.
+func SetMCTSTemperature(t float64) {
+	mctsConfig.Temperature = t
+}
+
+// threads is the number of threads searches use.
+var threads = 1
+
+// SetThreads sets the number of threads searches use, at least one. More
+// threads search deeper in the same time, but results vary from run to run.
+// It must not be called during a search.
+func SetThreads(n int) {
+	if n < 1 {
+		n = 1
+	}
+	threads = n
+}
+
+// A Param is a tunable parameter of the selective search, such as a pruning
+// margin or a reduction, with its default and range.
+type Param = alphabeta.Param
+
+// Params returns the tunable parameters of the search.
+func Params() []Param {
+	return append([]Param(nil), alphabeta.Params...)
+}
+
+// SetParam sets a tunable parameter of the search by name. It must not be
+// called during a search.
+func SetParam(name string, value int) error {
+	return alphabeta.SetParam(name, value)
+}
+
+// DefaultMoveOverhead is the initial move overhead.
+const DefaultMoveOverhead = 10 * time.Millisecond
+
+// moveOverhead is the time lost on each move outside the search.
+var moveOverhead = DefaultMoveOverhead
+
+// SetMoveOverhead sets the time lost on each move outside the search, such as
+// in communication with the GUI, which searches with a clock keep in reserve.
+// It must not be called during a search.
+func SetMoveOverhead(d time.Duration) {
+	moveOverhead = d
+}
+
+// clock returns the clock of the side to move c, and whether it's set.
+func (l *Limits) clock(c chess.Color) (timeman.Clock, bool) {
+	clock := timeman.Clock{Time: l.WhiteTime, Inc: l.WhiteInc, MovesToGo: l.MovesToGo, Overhead: moveOverhead}
+	if c == chess.Black {
+		clock.Time, clock.Inc = l.BlackTime, l.BlackInc
+	}
+	return clock, clock.Time > 0
+}
+
+// Info describes a completed iteration of a search.
+type Info struct {
+	Depth int
+	Score Score
+	Nodes int64
+	Time  time.Duration // Since the search started.
+	PV    []chess.Move  // The principal variation, starting with the best move.
+
+	Hashfull int // How full the transposition table is, in permille.
+}
+
+// NPS returns the nodes searched per second.
+func (i Info) NPS() int64 {
+	if i.Time <= 0 {
+		return 0
+	}
+	return int64(float64(i.Nodes) / i.Time.Seconds())
+}
+
+// Result is the result of a search.
+type Result struct {
+	BestMove   chess.Move // Zero if the position has no legal moves.
+	PonderMove chess.Move // The expected reply to the best move, or zero if unknown.
+	Score      Score
+	Depth      int
+	Nodes      int64
+	PV         []chess.Move
+}
+
+// Search searches pos for the best move until limits are reached or ctx is
+// done. History holds the positions of the game before pos, oldest first, so
+// that repetitions can be detected; it may be nil.
+//
+// Search always returns a legal move if there is one, even if ctx is done
+// before the first iteration completes. Searches share a transposition
+// table, so only one may run at a time.
+func Search(ctx context.Context, pos chess.Position, history []chess.Position, limits Limits) Result {
+	start := time.Now()
+
+	opts := core.Options{Threads: threads, RootMoves: limits.SearchMoves, Tablebase: limits.Tablebase, DTM: limits.DTM}
+	if limits.Tablebase != nil {
+		if moves, _, ok := limits.Tablebase.RootMoves(&pos); ok {
+			if moves = core.Filter(moves, limits.SearchMoves); len(moves) > 0 {
+				opts.RootMoves = moves
+			}
+		}
+	}
+	for i := range history {
+		opts.History = append(opts.History, history[i].Hash())
+	}
+
+	searchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var tm *timeman.Manager // Set if the search budgets its time from the clock.
+	if !limits.Infinite {
+		// The mate limit doesn't limit depth: pruning and reductions can
+		// hide a mate in n moves from a search of 2n-1 plies.
+		opts.Depth, opts.Nodes = limits.Depth, limits.Nodes
+		if limits.MoveTime > 0 {
+			searchCtx, cancel = context.WithTimeout(searchCtx, limits.MoveTime)
+			defer cancel()
+		}
+		if clock, ok := limits.clock(pos.SideToMove); ok {
+			tm = timeman.New(clock)
+			searchCtx, cancel = context.WithTimeout(searchCtx, tm.Hard())
+			defer cancel()
+		}
+	}
+
+	opts.Report = func(it core.Iteration) {
+		score := Score(it.Score)
+		if limits.OnInfo != nil {
+			limits.OnInfo(Info{
+				Depth: it.Depth,
+				Score: score,
+				Nodes: it.Nodes,
+				Time:  time.Since(start),
+				PV:    it.PV,
+
+				Hashfull: hashfull(),
+			})
+		}
+		if !limits.Infinite && limits.Mate > 0 && score.IsMate() {
+			if n := score.MateMoves(); n > 0 && n <= limits.Mate {
+				cancel()
+			}
+		}
+		if tm != nil && tm.Stop(it, time.Since(start)) {
+			cancel()
+		}
+	}
+
+	var it core.Iteration
+	switch backend {
+	case MCTS:
+		cfg := mctsConfig
+		if cfg.NoiseFraction > 0 || cfg.Temperature > 0 {
+			// Self-play games shouldn't all be the same.
+			cfg.Seed = start.UnixNano()
+		}
+		it = mcts.Search(searchCtx, tree, pos, cfg, opts)
+	default:
+		it = alphabeta.Search(searchCtx, table, pos, opts)
+	}
+	if limits.Infinite {
+		<-ctx.Done()
+	}
+
+	res := Result{Score: Score(it.Score), Depth: it.Depth, Nodes: it.Nodes, PV: it.PV}
+	if len(it.PV) > 0 {
+		res.BestMove = it.PV[0]
+	}
+	if len(it.PV) > 1 {
+		res.PonderMove = it.PV[1]
+	}
+	return res
+}
+
+// hashfull returns how full the current backend's table or tree is, in
+// permille.
+func hashfull() int {
+	if backend == MCTS {
+		return tree.Hashfull()
+	}
+	return table.Hashfull()
+}
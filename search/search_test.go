@@ -0,0 +1,227 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/fen"
+	"github.com/clfs/good/search/internal/resnet"
+	"github.com/clfs/good/tablebase"
+)
+
+func mustParse(t *testing.T, s string) chess.Position {
+	t.Helper()
+	p, err := fen.From(s)
+	if err != nil {
+		t.Fatalf("%s: %v", s, err)
+	}
+	return p
+}
+
+func TestScore_String(t *testing.T) {
+	cases := []struct {
+		s    Score
+		want string
+	}{
+		{0, "cp 0"},
+		{-153, "cp -153"},
+		{MateScore - 1, "mate 1"},
+		{MateScore - 3, "mate 2"},
+		{-MateScore + 2, "mate -1"},
+		{-MateScore + 4, "mate -2"},
+		{-MateScore, "mate 0"},
+	}
+	for _, tc := range cases {
+		if got := tc.s.String(); got != tc.want {
+			t.Errorf("%d: want %q, got %q", int(tc.s), tc.want, got)
+		}
+	}
+}
+
+func TestSearch_Mate(t *testing.T) {
+	p := mustParse(t, "kbK5/pp6/1P6/8/8/8/8/R7 w - - 0 1")
+	var infos []Info
+	res := Search(context.Background(), p, nil, Limits{Mate: 2, OnInfo: func(i Info) { infos = append(infos, i) }})
+	if res.BestMove.String() != "a1a6" || res.Score.MateMoves() != 2 {
+		t.Errorf("want a1a6 mating in 2, got %v with score %v", res.BestMove, res.Score)
+	}
+	if res.PonderMove == 0 || res.PonderMove != res.PV[1] {
+		t.Errorf("want the ponder move from the PV %v, got %v", res.PV, res.PonderMove)
+	}
+	if len(infos) == 0 || infos[len(infos)-1].Depth != res.Depth {
+		t.Errorf("got infos %v for a depth %d result", infos, res.Depth)
+	}
+}
+
+func TestSearch_NoMoves(t *testing.T) {
+	res := Search(context.Background(), mustParse(t, "6Qk/5K2/8/8/8/8/8/8 b - - 0 1"), nil, Limits{Depth: 2})
+	if res.BestMove != 0 || res.Score != -MateScore {
+		t.Errorf("want no move and a mated score, got %v with score %v", res.BestMove, res.Score)
+	}
+}
+
+func TestSearch_SearchMoves(t *testing.T) {
+	m := chess.NewMove(chess.G2, chess.G4)
+	res := Search(context.Background(), chess.NewPosition(), nil, Limits{Depth: 2, SearchMoves: []chess.Move{m}})
+	if res.BestMove != m {
+		t.Errorf("want %v, got %v", m, res.BestMove)
+	}
+}
+
+func TestSearch_History(t *testing.T) {
+	p := mustParse(t, "r2qk2r/8/8/8/8/8/8/4K1N1 w - - 10 40")
+	earlier := p
+	earlier.Make(chess.NewMove(chess.G1, chess.F3))
+	res := Search(context.Background(), p, []chess.Position{earlier}, Limits{Depth: 3})
+	if res.BestMove.String() != "g1f3" || res.Score != 0 {
+		t.Errorf("want a repetition with g1f3, got %v with score %v", res.BestMove, res.Score)
+	}
+}
+
+func TestSearch_Stop(t *testing.T) {
+	p := chess.NewPosition()
+
+	start := time.Now()
+	res := Search(context.Background(), p, nil, Limits{MoveTime: 50 * time.Millisecond})
+	if elapsed := time.Since(start); elapsed > time.Second || res.BestMove == 0 {
+		t.Errorf("movetime 50ms: searched for %v, got %v", elapsed, res.BestMove)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	res = Search(ctx, p, nil, Limits{Infinite: true, Depth: 1})
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > time.Second || res.BestMove == 0 {
+		t.Errorf("infinite: searched for %v, got %v", elapsed, res.BestMove)
+	}
+
+	res = Search(context.Background(), p, nil, Limits{Nodes: 500})
+	if res.Nodes > 500 || res.BestMove == 0 {
+		t.Errorf("nodes 500: searched %d nodes, got %v", res.Nodes, res.BestMove)
+	}
+}
+
+func TestSearch_Clock(t *testing.T) {
+	SetMoveOverhead(0)
+	defer SetMoveOverhead(DefaultMoveOverhead)
+	cases := []struct {
+		fen    string
+		limits Limits
+		max    time.Duration // The hard limit.
+	}{
+		{fen.Starting, Limits{WhiteTime: 4 * time.Second}, 300 * time.Millisecond},
+		{fen.Starting, Limits{WhiteTime: time.Second, BlackTime: time.Hour, WhiteInc: 100 * time.Millisecond}, 300 * time.Millisecond},
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1", Limits{WhiteTime: time.Hour, BlackTime: 200 * time.Millisecond, MovesToGo: 1}, 150 * time.Millisecond},
+	}
+	for _, tc := range cases {
+		start := time.Now()
+		res := Search(context.Background(), mustParse(t, tc.fen), nil, tc.limits)
+		// Allow for a slow machine.
+		if elapsed := time.Since(start); elapsed > tc.max+200*time.Millisecond || res.BestMove == 0 {
+			t.Errorf("%+v: searched for %v, got %v", tc.limits, elapsed, res.BestMove)
+		}
+	}
+}
+
+// rootTablebase keeps only its moves at the root, and knows no other
+// positions.
+type rootTablebase struct {
+	moves []chess.Move
+}
+
+func (tb rootTablebase) ProbeWDL(p *chess.Position) (tablebase.WDL, bool) {
+	return 0, false
+}
+
+func (tb rootTablebase) RootMoves(p *chess.Position) ([]chess.Move, tablebase.WDL, bool) {
+	return tb.moves, tablebase.Win, true
+}
+
+func TestSearch_Tablebase(t *testing.T) {
+	a3, h3, e4 := chess.NewMove(chess.A2, chess.A3), chess.NewMove(chess.H2, chess.H3), chess.NewMove(chess.E2, chess.E4)
+	tb := rootTablebase{moves: []chess.Move{a3, h3}}
+	cases := []struct {
+		searchMoves []chess.Move
+		want        []chess.Move
+	}{
+		{nil, []chess.Move{a3, h3}},
+		{[]chess.Move{h3, e4}, []chess.Move{h3}},
+		{[]chess.Move{e4}, []chess.Move{e4}}, // The tablebase's moves aren't allowed.
+	}
+	for _, tc := range cases {
+		res := Search(context.Background(), chess.NewPosition(), nil, Limits{Depth: 3, SearchMoves: tc.searchMoves, Tablebase: tb})
+		ok := false
+		for _, m := range tc.want {
+			ok = ok || res.BestMove == m
+		}
+		if !ok {
+			t.Errorf("searchmoves %v: want one of %v, got %v", tc.searchMoves, tc.want, res.BestMove)
+		}
+	}
+}
+
+func TestSearch_Threads(t *testing.T) {
+	SetThreads(4)
+	defer SetThreads(1)
+	p := mustParse(t, "kbK5/pp6/1P6/8/8/8/8/R7 w - - 0 1")
+	res := Search(context.Background(), p, nil, Limits{Depth: 6})
+	if res.BestMove.String() != "a1a6" || res.Score.MateMoves() != 2 {
+		t.Errorf("want a1a6 mating in 2, got %v with score %v", res.BestMove, res.Score)
+	}
+}
+
+func TestSearch_MCTS(t *testing.T) {
+	SetBackend(MCTS)
+	defer SetBackend(AlphaBeta)
+	p := mustParse(t, "6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1")
+	var infos int
+	res := Search(context.Background(), p, nil, Limits{Nodes: 100000, OnInfo: func(Info) { infos++ }})
+	if res.BestMove.String() != "a1a8" || res.Score.MateMoves() != 1 {
+		t.Errorf("want a1a8 mating in 1, got %v with score %v", res.BestMove, res.Score)
+	}
+
+	res = Search(context.Background(), chess.NewPosition(), nil, Limits{Nodes: 5000, OnInfo: func(Info) { infos++ }})
+	if res.BestMove == 0 || res.Nodes != 5000 || infos == 0 {
+		t.Errorf("nodes 5000: searched %d nodes with %d infos, got %v", res.Nodes, infos, res.BestMove)
+	}
+}
+
+func TestLoadMCTSNetwork(t *testing.T) {
+	// A network of zeros has uniform priors and values every position as
+	// even, so PUCT finds mates by proving them.
+	var buf bytes.Buffer
+	if _, err := resnet.NewNetwork(1, 4, 8).WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadMCTSNetwork(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); err == nil {
+		t.Error("truncated network: want an error")
+	}
+	if err := LoadMCTSNetwork(&buf); err != nil {
+		t.Fatal(err)
+	}
+	defer ResetMCTSNetwork()
+	SetBackend(MCTS)
+	defer SetBackend(AlphaBeta)
+	SetMCTSNoise(0.25)
+	defer SetMCTSNoise(0)
+
+	p := mustParse(t, "6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1")
+	res := Search(context.Background(), p, nil, Limits{Nodes: 100000})
+	if res.BestMove.String() != "a1a8" || res.Score.MateMoves() != 1 {
+		t.Errorf("want a1a8 mating in 1, got %v with score %v", res.BestMove, res.Score)
+	}
+}
+
+func TestParseBackend(t *testing.T) {
+	for _, b := range []Backend{AlphaBeta, MCTS} {
+		if got, err := ParseBackend(b.String()); err != nil || got != b {
+			t.Errorf("%v: got %v, %v", b, got, err)
+		}
+	}
+	if _, err := ParseBackend("Minimax"); err == nil {
+		t.Error("Minimax: want an error")
+	}
+}
@@ -0,0 +1,279 @@
+// Package dtm generates and probes depth-to-mate endgame tables.
+//
+// A table holds, for every position with some material and either side to
+// move, the number of plies to mate with best play: the winner mates as fast
+// as possible, and the loser holds out as long as possible. The fifty-move
+// rule is ignored. Tables are generated by retrograde analysis, with Generate,
+// and only cover material without pawns.
+//
+// Table files hold the values in blocks, each compressed with DEFLATE, and an
+// index of where each block starts, so a probe only decompresses one block.
+package dtm
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/tablebase"
+)
+
+// magic identifies table files.
+const magic = "GOODDTM\x00"
+
+// version is the current table file version.
+const version = 1
+
+// blockSize is the number of values in a block.
+const blockSize = 1 << 12
+
+// maxCached is the number of decompressed blocks a table keeps.
+const maxCached = 256
+
+// A Table is a depth-to-mate table for one material signature. It's safe for
+// concurrent use.
+//
+// Values are coded as 0 for draws and positions that aren't valid, and as the
+// plies to mate plus one otherwise. The side to move wins if the plies to
+// mate are odd, and loses if they're even.
+type Table struct {
+	l      *layout
+	width  int      // Bytes per value: 1, or 2 for long mates.
+	starts []uint32 // Where each block starts in data, and where data ends.
+	data   []byte
+
+	mu    sync.Mutex
+	cache map[int][]uint16 // Decompressed blocks.
+}
+
+// newTable compresses the values of a table.
+func newTable(l *layout, codes []uint16) *Table {
+	t := &Table{l: l, width: 1, cache: make(map[int][]uint16)}
+	for _, c := range codes {
+		if c > 0xff {
+			t.width = 2
+			break
+		}
+	}
+	var b bytes.Buffer
+	raw := make([]byte, blockSize*t.width)
+	for start := 0; start < len(codes); start += blockSize {
+		block := codes[start:]
+		if len(block) > blockSize {
+			block = block[:blockSize]
+		}
+		raw = raw[:0]
+		for _, c := range block {
+			raw = append(raw, byte(c))
+			if t.width == 2 {
+				raw = append(raw, byte(c>>8))
+			}
+		}
+		t.starts = append(t.starts, uint32(b.Len()))
+		// Compressing into a buffer with a valid level can't fail.
+		fw, _ := flate.NewWriter(&b, flate.BestCompression)
+		fw.Write(raw)
+		fw.Close()
+	}
+	t.starts = append(t.starts, uint32(b.Len()))
+	t.data = b.Bytes()
+	return t
+}
+
+// Key returns the material signature of the table. The table also covers
+// the signature with the colors swapped.
+func (t *Table) Key() chess.MaterialKey {
+	return t.l.key
+}
+
+// Probe returns the result of p and the plies to mate, which are 0 for
+// draws and for checkmate. If p doesn't have the table's material or has
+// castling rights, ok is false.
+func (t *Table) Probe(p *chess.Position) (wdl tablebase.WDL, dtm int, ok bool) {
+	var buf [maxPieces]chess.Square
+	sq := buf[:len(t.l.pieces)]
+	stm, ok := t.l.squares(p, sq)
+	if !ok || p.CastleRights != chess.NoCastleRights {
+		return 0, 0, false
+	}
+	code, err := t.code(t.l.index(stm, sq))
+	if err != nil {
+		return 0, 0, false
+	}
+	switch {
+	case code == 0:
+		return tablebase.Draw, 0, true
+	case (code-1)%2 == 1:
+		return tablebase.Win, int(code) - 1, true
+	default:
+		return tablebase.Loss, int(code) - 1, true
+	}
+}
+
+// code returns the value at an index.
+func (t *Table) code(i int) (uint16, error) {
+	n := i / blockSize
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	block, ok := t.cache[n]
+	if !ok {
+		var err error
+		if block, err = t.decode(n); err != nil {
+			return 0, err
+		}
+		if len(t.cache) >= maxCached {
+			for k := range t.cache {
+				delete(t.cache, k)
+				break
+			}
+		}
+		t.cache[n] = block
+	}
+	return block[i%blockSize], nil
+}
+
+// decode decompresses a block.
+func (t *Table) decode(n int) ([]uint16, error) {
+	size := blockSize
+	if rest := t.l.size - n*blockSize; rest < size {
+		size = rest
+	}
+	raw := make([]byte, size*t.width)
+	fr := flate.NewReader(bytes.NewReader(t.data[t.starts[n]:t.starts[n+1]]))
+	if _, err := io.ReadFull(fr, raw); err != nil {
+		return nil, fmt.Errorf("dtm: %v: block %d: %w", t.l.key, n, err)
+	}
+	block := make([]uint16, size)
+	for i := range block {
+		if t.width == 2 {
+			block[i] = binary.LittleEndian.Uint16(raw[2*i:])
+		} else {
+			block[i] = uint16(raw[i])
+		}
+	}
+	return block, nil
+}
+
+// decodeAll decompresses every value.
+func (t *Table) decodeAll() ([]uint16, error) {
+	codes := make([]uint16, 0, t.l.size)
+	for n := 0; n < len(t.starts)-1; n++ {
+		block, err := t.decode(n)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, block...)
+	}
+	return codes, nil
+}
+
+// header is the fixed-size header of a table file. It's followed by the
+// block starts, and then the blocks.
+type header struct {
+	Magic   [8]byte
+	Version uint32
+	Key     uint64
+	Width   uint32
+	Blocks  uint32
+}
+
+// Load reads a table in the format written by WriteTo.
+func Load(r io.Reader) (*Table, error) {
+	br := bufio.NewReader(r)
+
+	var h header
+	if err := binary.Read(br, binary.LittleEndian, &h); err != nil {
+		return nil, fmt.Errorf("dtm: reading header: %w", err)
+	}
+	if string(h.Magic[:]) != magic {
+		return nil, errors.New("dtm: not a table file")
+	}
+	if h.Version != version {
+		return nil, fmt.Errorf("dtm: unsupported version: %d", h.Version)
+	}
+	l, err := newLayout(chess.MaterialKey(h.Key))
+	if err != nil {
+		return nil, err
+	}
+	if h.Width != 1 && h.Width != 2 {
+		return nil, fmt.Errorf("dtm: invalid value width: %d", h.Width)
+	}
+	if want := (l.size + blockSize - 1) / blockSize; int(h.Blocks) != want {
+		return nil, fmt.Errorf("dtm: %v: want %d blocks, got %d", l.key, want, h.Blocks)
+	}
+
+	t := &Table{l: l, width: int(h.Width), cache: make(map[int][]uint16)}
+	t.starts = make([]uint32, h.Blocks+1)
+	if err := binary.Read(br, binary.LittleEndian, t.starts); err != nil {
+		return nil, fmt.Errorf("dtm: reading block starts: %w", err)
+	}
+	for i := 1; i < len(t.starts); i++ {
+		if t.starts[i] < t.starts[i-1] {
+			return nil, errors.New("dtm: invalid block starts")
+		}
+	}
+	t.data = make([]byte, t.starts[h.Blocks])
+	if _, err := io.ReadFull(br, t.data); err != nil {
+		return nil, fmt.Errorf("dtm: reading blocks: %w", err)
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		return nil, errors.New("dtm: trailing data after blocks")
+	}
+	return t, nil
+}
+
+// WriteTo writes the table to w.
+func (t *Table) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	h := header{
+		Version: version,
+		Key:     uint64(t.l.key),
+		Width:   uint32(t.width),
+		Blocks:  uint32(len(t.starts) - 1),
+	}
+	copy(h.Magic[:], magic)
+	for _, data := range []any{h, t.starts, t.data} {
+		if err := binary.Write(bw, binary.LittleEndian, data); err != nil {
+			return cw.n, err
+		}
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// countingWriter counts the bytes written to an underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// Normalize returns key or key with the colors swapped, whichever has the
+// stronger side as white, so that a table file can be named for either.
+func Normalize(key chess.MaterialKey) chess.MaterialKey {
+	values := [6]int{chess.Knight: 3, chess.Bishop: 3, chess.Rook: 5, chess.Queen: 9}
+	diff := 0
+	for pc := chess.WhitePawn; pc <= chess.BlackKing; pc++ {
+		v := key.Count(pc) * values[pc.Role()]
+		if pc.Color() == chess.Black {
+			v = -v
+		}
+		diff += v
+	}
+	if flipped := key.Flip(); diff < 0 || (diff == 0 && flipped < key) {
+		return flipped
+	}
+	return key
+}
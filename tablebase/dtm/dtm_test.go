@@ -0,0 +1,254 @@
+package dtm
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/fen"
+	"github.com/clfs/good/tablebase"
+)
+
+// tables caches generated tables by normalized key.
+var tables = make(map[chess.MaterialKey]*Table)
+
+// generate returns the table for a material signature, generating it and
+// the tables it needs first if necessary.
+func generate(t *testing.T, key chess.MaterialKey) *Table {
+	t.Helper()
+	key = Normalize(key)
+	if tab, ok := tables[key]; ok {
+		return tab
+	}
+	tab, err := Generate(key, func(k chess.MaterialKey) (*Table, error) {
+		return generate(t, k), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables[key] = tab
+	return tab
+}
+
+func parseKey(t *testing.T, s string) chess.MaterialKey {
+	t.Helper()
+	key, err := chess.ParseMaterialKey(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestGenerate_LongestMates(t *testing.T) {
+	cases := []struct {
+		key       string
+		win, loss int // Longest mates for the side to move, in plies.
+	}{
+		{"KQK", 19, 20},
+		{"KRK", 31, 32},
+	}
+	for _, tc := range cases {
+		tab := generate(t, parseKey(t, tc.key))
+		codes, err := tab.decodeAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var win, loss int
+		for _, c := range codes {
+			plies := int(c) - 1
+			switch {
+			case c == 0:
+			case plies%2 == 1 && plies > win:
+				win = plies
+			case plies%2 == 0 && plies > loss:
+				loss = plies
+			}
+		}
+		if win != tc.win || loss != tc.loss {
+			t.Errorf("%s: want longest mates of %d and %d plies, got %d and %d", tc.key, tc.win, tc.loss, win, loss)
+		}
+	}
+}
+
+func TestGenerate_Unsupported(t *testing.T) {
+	for _, s := range []string{"KPK", "KQRBNK", "KK"} {
+		if _, err := Generate(parseKey(t, s), nil); err == nil {
+			t.Errorf("%s: want an error", s)
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+	cases := []struct {
+		fen string
+		wdl tablebase.WDL
+		dtm int
+	}{
+		{"7k/5K2/6Q1/8/8/8/8/8 b - - 0 1", tablebase.Draw, 0}, // Stalemate.
+		{"6Qk/5K2/8/8/8/8/8/8 b - - 0 1", tablebase.Loss, 0},  // Checkmate.
+		{"7k/5K2/8/8/8/8/8/6Q1 w - - 0 1", tablebase.Win, 1},  // Qg7#.
+		{"8/8/8/8/8/8/5k2/6qK w - - 0 1", tablebase.Loss, 0},  // Checkmate, colors swapped.
+		{"8/8/8/8/8/8/6k1/7q w - - 0 1", tablebase.Draw, -1},  // Wrong material.
+		{"7k/8/8/8/8/8/8/R3K3 w Q - 0 1", tablebase.Draw, -1}, // Castling rights.
+		{"k7/8/1K6/8/8/8/8/7R w - - 0 1", tablebase.Win, 1},   // Rh8#.
+		{"k7/8/1K6/8/8/8/8/7R b - - 0 1", tablebase.Loss, 2},  // Kb8 Rh8#.
+		{"8/8/8/8/8/1k6/8/K6r w - - 0 1", tablebase.Loss, 0},  // Checkmate.
+	}
+	for _, tc := range cases {
+		p, err := fen.From(tc.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tab := generate(t, parseKey(t, "KQK"))
+		if key := p.MaterialKey(); key.Count(chess.WhiteRook)+key.Count(chess.BlackRook) > 0 {
+			tab = generate(t, parseKey(t, "KRK"))
+		}
+		wdl, dtm, ok := tab.Probe(&p)
+		if tc.dtm < 0 {
+			if ok {
+				t.Errorf("%s: want no result, got %v in %d", tc.fen, wdl, dtm)
+			}
+			continue
+		}
+		if !ok || wdl != tc.wdl || dtm != tc.dtm {
+			t.Errorf("%s: want %v in %d, got %v in %d (%t)", tc.fen, tc.wdl, tc.dtm, wdl, dtm, ok)
+		}
+	}
+}
+
+// probe looks a position up in the generated tables, treating bare kings as
+// drawn.
+func probe(t *testing.T, p *chess.Position) (tablebase.WDL, int) {
+	t.Helper()
+	var pieces chess.Bitboard = p.AllPieces()
+	if pieces.Count() == 2 {
+		return tablebase.Draw, 0
+	}
+	wdl, dtm, ok := generate(t, p.MaterialKey()).Probe(p)
+	if !ok {
+		t.Fatalf("%s: can't probe", fen.To(*p))
+	}
+	return wdl, dtm
+}
+
+// randomPosition returns a random legal position with the material of key.
+func randomPosition(r *rand.Rand, key chess.MaterialKey) chess.Position {
+	for {
+		var p chess.Position
+		ok := true
+		for pc := chess.WhitePawn; pc <= chess.BlackKing; pc++ {
+			for i := key.Count(pc); i > 0; i-- {
+				s := chess.Square(r.Intn(64))
+				if _, occupied := p.Get(s); occupied {
+					ok = false
+				}
+				p.Put(pc, s)
+			}
+		}
+		p.SideToMove = chess.Color(r.Intn(2))
+		p.EnPassantRight = chess.NoEnPassantRight
+		p.FullMoves = 1
+		if ok && chess.Distance(p.King(chess.White), p.King(chess.Black)) > 1 &&
+			!p.IsAttacked(p.King(p.SideToMove.Opposite()), p.SideToMove) {
+			return p
+		}
+	}
+}
+
+// TestGenerate_Consistent checks that random positions' results follow from
+// their moves' results, using the chess package's move generation.
+func TestGenerate_Consistent(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	r := rand.New(rand.NewSource(1))
+	for _, s := range []string{"KQK", "KRK", "KBK", "KRKN"} {
+		key := parseKey(t, s)
+		for n := 0; n < 1000; n++ {
+			p := randomPosition(r, key)
+			if n%2 == 1 {
+				key = key.Flip()
+			}
+			wdl, dtm := probe(t, &p)
+
+			// The best move wins fastest or loses slowest.
+			want, wantDTM := tablebase.Loss, 0
+			moves := p.LegalMoves()
+			for _, m := range moves {
+				q := p
+				q.Make(m)
+				w, d := probe(t, &q)
+				w, d = -w, d+1
+				switch {
+				case w > want,
+					w == want && w == tablebase.Win && d < wantDTM,
+					w == want && w == tablebase.Loss && d > wantDTM:
+					want, wantDTM = w, d
+				}
+			}
+			switch {
+			case len(moves) == 0 && !p.InCheck():
+				want, wantDTM = tablebase.Draw, 0
+			case want == tablebase.Draw:
+				wantDTM = 0
+			}
+			if wdl != want || dtm != wantDTM {
+				t.Fatalf("%s: want %v in %d, got %v in %d", fen.To(p), want, wantDTM, wdl, dtm)
+			}
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tab := generate(t, parseKey(t, "KRK"))
+	var b bytes.Buffer
+	if _, err := tab.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Load(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := tab.decodeAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := got.decodeAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Key() != tab.Key() || len(codes) != len(want) {
+		t.Fatalf("want %v with %d values, got %v with %d", tab.Key(), len(want), got.Key(), len(codes))
+	}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Fatalf("index %d: want %d, got %d", i, want[i], codes[i])
+		}
+	}
+
+	for _, n := range []int{0, 8, b.Len() - 1} {
+		if _, err := Load(bytes.NewReader(b.Bytes()[:n])); err == nil {
+			t.Errorf("truncated to %d bytes: want an error", n)
+		}
+	}
+	if _, err := Load(bytes.NewReader(append(b.Bytes(), 0))); err == nil {
+		t.Error("trailing data: want an error")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"KQK", "KQvK"},
+		{"KKQ", "KQvK"},
+		{"KNKR", "KRvKN"},
+		{"KRKN", "KRvKN"},
+		{"KBKN", "KBvKN"},
+		{"KNKB", "KBvKN"},
+		{"KRKR", "KRvKR"},
+	} {
+		if got := Normalize(parseKey(t, tc.in)).String(); got != tc.want {
+			t.Errorf("%s: want %s, got %s", tc.in, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package dtm
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/clfs/good/chess"
+)
+
+// cannotLose marks positions with a move that doesn't lose, in place of their
+// count of moves left that might not lose.
+const cannotLose = 0xff
+
+// subtable is a table for the material left after a capture.
+type subtable struct {
+	l     *layout
+	codes []uint16
+}
+
+// A generator holds the state of a table's generation.
+type generator struct {
+	l    *layout
+	subs map[chess.MaterialKey]*subtable
+
+	// codes holds the results found so far, as in tables.
+	codes []uint16
+	// count holds, for each unresolved position, how many distinct positions
+	// in the table it can move to that haven't been found to lose for it. The
+	// position is lost once none are left.
+	count []uint8
+	// exitLoss holds, for each position, the plies to mate when it makes its
+	// longest losing capture.
+	exitLoss []uint16
+	// levels holds the positions to resolve at each number of plies to mate.
+	levels [][]int32
+}
+
+// Generate computes the table for the material of key by retrograde
+// analysis: starting from mates, it works backwards through the moves that
+// lead to them, one ply at a time. sub returns the tables for the material
+// left after captures, or those tables with the colors swapped. Pawns aren't
+// supported.
+func Generate(key chess.MaterialKey, sub func(chess.MaterialKey) (*Table, error)) (*Table, error) {
+	l, err := newLayout(key)
+	if err != nil {
+		return nil, err
+	}
+	g := &generator{
+		l:        l,
+		subs:     make(map[chess.MaterialKey]*subtable),
+		codes:    make([]uint16, l.size),
+		count:    make([]uint8, l.size),
+		exitLoss: make([]uint16, l.size),
+	}
+	for _, pc := range l.pieces[2:] {
+		var counts [12]int
+		for pc := chess.WhitePawn; pc <= chess.BlackKing; pc++ {
+			counts[pc] = key.Count(pc)
+		}
+		counts[pc]--
+		k := chess.NewMaterialKey(counts)
+		if _, ok := g.subs[k]; ok || len(l.pieces) == 3 {
+			continue // Kings alone are drawn.
+		}
+		t, err := sub(k)
+		if err != nil {
+			return nil, err
+		}
+		if t.l.key != k && t.l.key != k.Flip() {
+			return nil, fmt.Errorf("dtm: %v: got table for %v", k, t.l.key)
+		}
+		codes, err := t.decodeAll()
+		if err != nil {
+			return nil, err
+		}
+		g.subs[k] = &subtable{t.l, codes}
+	}
+
+	g.init()
+	g.solve()
+	return newTable(l, g.codes), nil
+}
+
+// init resolves positions by their captures and counts their other moves, in
+// parallel.
+func (g *generator) init() {
+	workers := runtime.GOMAXPROCS(0)
+	levels := make([][][]int32, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < g.l.size; i += workers {
+				if g.l.valid(i) {
+					if ply, ok := g.initPosition(i); ok {
+						levels[w] = schedule(levels[w], i, ply)
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	for _, ls := range levels {
+		for ply, l := range ls {
+			for _, i := range l {
+				g.levels = schedule(g.levels, int(i), ply)
+			}
+		}
+	}
+}
+
+// initPosition sets up the generation of a valid position. If its result is
+// already known to be reached in some number of plies, it returns them.
+func (g *generator) initPosition(i int) (ply int, ok bool) {
+	var buf [maxPieces]chess.Square
+	sq := buf[:len(g.l.pieces)]
+	stm := g.l.decode(i, sq)
+
+	var children []int
+	moves := 0
+	win, draw := -1, false
+	for _, m := range g.l.moves(stm, sq) {
+		moves++
+		if m.captured < 0 {
+			children = appendUnique(children, g.l.index(stm.Opposite(), m.squares[:len(sq)]))
+			continue
+		}
+		code := g.lookup(stm.Opposite(), m)
+		switch {
+		case code == 0:
+			draw = true
+		case (code-1)%2 == 1:
+			// The opponent wins, so the capture loses.
+			if int(code) > int(g.exitLoss[i]) {
+				g.exitLoss[i] = code
+			}
+		case win < 0 || int(code) < win:
+			win = int(code)
+		}
+	}
+
+	switch {
+	case moves == 0 && g.l.attacked(sq, -1, sq[stm], stm.Opposite()):
+		return 0, true // Checkmate.
+	case moves == 0:
+		g.count[i] = cannotLose // Stalemate.
+		return 0, false
+	case draw || win >= 0:
+		g.count[i] = cannotLose
+	default:
+		g.count[i] = uint8(len(children))
+	}
+	if win >= 0 {
+		return win, true
+	}
+	if len(children) == 0 && !draw {
+		return int(g.exitLoss[i]), true
+	}
+	return 0, false
+}
+
+// lookup returns the table code of the position after a capture, from the
+// side to move's point of view.
+func (g *generator) lookup(stm chess.Color, m move) uint16 {
+	if len(g.l.pieces) == 3 {
+		return 0 // Kings alone.
+	}
+
+	// The subtable swaps the colors back if it stores the material that
+	// way.
+	var p chess.Position
+	for j, pc := range g.l.pieces {
+		if j == m.captured {
+			continue
+		}
+		p.Put(pc, m.squares[j])
+	}
+	p.SideToMove = stm
+	sub := g.subs[p.MaterialKey()]
+	var buf [maxPieces]chess.Square
+	sq := buf[:len(sub.l.pieces)]
+	substm, _ := sub.l.squares(&p, sq)
+	return sub.codes[sub.l.index(substm, sq)]
+}
+
+// solve resolves positions in order of plies to mate. A position that's lost
+// in some plies lets the positions that move to it win in one more; a
+// position that's won lets those positions count one more losing move.
+// Whatever's left unresolved is drawn.
+func (g *generator) solve() {
+	var (
+		buf   [maxPieces]chess.Square
+		preds []int
+	)
+	sq := buf[:len(g.l.pieces)]
+	for ply := 0; ply < len(g.levels); ply++ {
+		for _, i := range g.levels[ply] {
+			if g.codes[i] != 0 {
+				continue // Resolved in fewer plies.
+			}
+			g.codes[i] = uint16(ply + 1)
+			stm := g.l.decode(int(i), sq)
+			preds = g.l.predecessors(preds[:0], stm, sq)
+			for _, p := range preds {
+				switch {
+				case g.codes[p] != 0:
+				case ply%2 == 0:
+					// i is lost, so p wins by moving to it.
+					g.levels = schedule(g.levels, p, ply+1)
+				case g.count[p] != cannotLose:
+					if g.count[p]--; g.count[p] == 0 {
+						loss := ply + 1
+						if int(g.exitLoss[p]) > loss {
+							loss = int(g.exitLoss[p])
+						}
+						g.levels = schedule(g.levels, p, loss)
+					}
+				}
+			}
+		}
+		g.levels[ply] = nil
+	}
+}
+
+// schedule adds a position to resolve in some plies.
+func schedule(levels [][]int32, i, ply int) [][]int32 {
+	for len(levels) <= ply {
+		levels = append(levels, nil)
+	}
+	levels[ply] = append(levels[ply], int32(i))
+	return levels
+}
+
+// appendUnique appends i to s if it isn't in s already.
+func appendUnique(s []int, i int) []int {
+	for _, j := range s {
+		if j == i {
+			return s
+		}
+	}
+	return append(s, i)
+}
+
+// A move is a legal move of a position, described by the squares after it
+// and the index of the captured piece, or -1.
+type move struct {
+	squares  [maxPieces]chess.Square
+	captured int
+}
+
+// moves returns the legal moves of a position.
+func (l *layout) moves(stm chess.Color, squares []chess.Square) []move {
+	var occupied, ours chess.Bitboard
+	for j, s := range squares {
+		occupied.Set(s)
+		if l.pieces[j].Color() == stm {
+			ours.Set(s)
+		}
+	}
+	var moves []move
+	for j, pc := range l.pieces {
+		if pc.Color() != stm {
+			continue
+		}
+		for b := attacks(pc, squares[j], occupied) &^ ours; b != 0; {
+			to := b.Pop()
+			var m move
+			copy(m.squares[:], squares)
+			m.squares[j] = to
+			m.captured = -1
+			for k, s := range squares {
+				if s == to {
+					m.captured = k
+				}
+			}
+			king := m.squares[stm]
+			if !l.attacked(m.squares[:len(squares)], m.captured, king, stm.Opposite()) {
+				moves = append(moves, m)
+			}
+		}
+	}
+	return moves
+}
+
+// predecessors appends the distinct indices of the positions that can move
+// to a position without capturing.
+func (l *layout) predecessors(dst []int, stm chess.Color, squares []chess.Square) []int {
+	var occupied chess.Bitboard
+	for _, s := range squares {
+		occupied.Set(s)
+	}
+	them := stm.Opposite()
+	var buf [maxPieces]chess.Square
+	sq := buf[:len(squares)]
+	for j, pc := range l.pieces {
+		if pc.Color() != them {
+			continue
+		}
+		for b := attacks(pc, squares[j], occupied) &^ occupied; b != 0; {
+			copy(sq, squares)
+			sq[j] = b.Pop()
+			if chess.Distance(sq[0], sq[1]) <= 1 || l.attacked(sq, -1, sq[stm], them) {
+				continue
+			}
+			dst = appendUnique(dst, l.index(them, sq))
+		}
+	}
+	return dst
+}
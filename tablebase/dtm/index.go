@@ -0,0 +1,241 @@
+package dtm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/clfs/good/chess"
+)
+
+// maxPieces is the most pieces, kings included, a table can have. Generating
+// a table of five pieces takes a few gigabytes of memory.
+const maxPieces = 5
+
+// triangle lists the squares of the A1-D1-D4 triangle, which positions are
+// mapped to have the white king in. triangleIndex numbers them, and is -1 for
+// other squares.
+var (
+	triangle      []chess.Square
+	triangleIndex [64]int
+)
+
+// kingTransforms lists, for each square of the white king, the symmetries
+// that map it into the triangle: two for squares on a diagonal, and one
+// otherwise.
+var kingTransforms [64][]int
+
+func init() {
+	for s := chess.A1; s <= chess.H8; s++ {
+		triangleIndex[s] = -1
+		if s.File() <= chess.FileD && s.Rank() <= chess.Rank(s.File()) {
+			triangleIndex[s] = len(triangle)
+			triangle = append(triangle, s)
+		}
+	}
+	for s := chess.A1; s <= chess.H8; s++ {
+		for t := 0; t < 8; t++ {
+			if triangleIndex[transform(s, t)] >= 0 {
+				kingTransforms[s] = append(kingTransforms[s], t)
+			}
+		}
+	}
+}
+
+// transform applies one of the eight symmetries of the board to a square.
+// Bit 2 of t mirrors the A1-H8 diagonal, bit 0 the files, and bit 1 the
+// ranks.
+func transform(s chess.Square, t int) chess.Square {
+	if t&4 != 0 {
+		s = (s>>3 | s<<3) & 63
+	}
+	if t&1 != 0 {
+		s ^= 7
+	}
+	if t&2 != 0 {
+		s ^= 56
+	}
+	return s
+}
+
+// A layout describes how a table indexes the positions of its material.
+// Positions are described by the squares of their pieces, in layout order: the
+// white king, the black king, and then the other pieces in piece order.
+//
+// Indices are the side to move, the white king's square in the triangle, and
+// then the squares of the other pieces in order. Of the positions that are
+// symmetric to each other, only the one with the lowest index is valid, so
+// identical pieces are stored in square order.
+type layout struct {
+	key    chess.MaterialKey
+	pieces []chess.Piece
+	size   int // Number of indices.
+}
+
+// newLayout returns the layout of the tables with the material of key.
+func newLayout(key chess.MaterialKey) (*layout, error) {
+	l := &layout{key: key, pieces: []chess.Piece{chess.WhiteKing, chess.BlackKing}}
+	if key.Count(chess.WhiteKing) != 1 || key.Count(chess.BlackKing) != 1 {
+		return nil, fmt.Errorf("dtm: %v: each side must have one king", key)
+	}
+	if key.Count(chess.WhitePawn) > 0 || key.Count(chess.BlackPawn) > 0 {
+		return nil, fmt.Errorf("dtm: %v: pawns aren't supported", key)
+	}
+	for pc := chess.WhiteKnight; pc <= chess.BlackQueen; pc++ {
+		if pc.Role() == chess.King {
+			continue
+		}
+		for i := key.Count(pc); i > 0; i-- {
+			l.pieces = append(l.pieces, pc)
+		}
+	}
+	if len(l.pieces) > maxPieces {
+		return nil, fmt.Errorf("dtm: %v: more than %d pieces", key, maxPieces)
+	}
+	if len(l.pieces) == 2 {
+		return nil, errors.New("dtm: bare kings are always drawn")
+	}
+	l.size = 2 * len(triangle)
+	for range l.pieces[1:] {
+		l.size *= 64
+	}
+	return l, nil
+}
+
+// index returns the index of a position, or of the position symmetric to it
+// that's valid.
+func (l *layout) index(stm chess.Color, squares []chess.Square) int {
+	var buf [maxPieces]chess.Square
+	best := -1
+	for _, t := range kingTransforms[squares[0]] {
+		sq := buf[:len(squares)]
+		for i, s := range squares {
+			sq[i] = transform(s, t)
+		}
+		l.sortGroups(sq)
+		if i := l.encode(stm, sq); best < 0 || i < best {
+			best = i
+		}
+	}
+	return best
+}
+
+// sortGroups sorts the squares of identical pieces.
+func (l *layout) sortGroups(squares []chess.Square) {
+	for i := 3; i < len(squares); i++ {
+		for j := i; j > 2 && l.pieces[j] == l.pieces[j-1] && squares[j] < squares[j-1]; j-- {
+			squares[j], squares[j-1] = squares[j-1], squares[j]
+		}
+	}
+}
+
+// encode returns the index of a position whose white king is in the
+// triangle.
+func (l *layout) encode(stm chess.Color, squares []chess.Square) int {
+	i := 0
+	for j := len(squares) - 1; j > 0; j-- {
+		i = i*64 + int(squares[j])
+	}
+	i = i*len(triangle) + triangleIndex[squares[0]]
+	return i*2 + int(stm)
+}
+
+// decode is the inverse of encode.
+func (l *layout) decode(i int, squares []chess.Square) (stm chess.Color) {
+	stm, i = chess.Color(i&1), i>>1
+	squares[0], i = triangle[i%len(triangle)], i/len(triangle)
+	for j := 1; j < len(l.pieces); j++ {
+		squares[j], i = chess.Square(i%64), i/64
+	}
+	return stm
+}
+
+// valid reports whether an index holds a legal position: one with the pieces
+// on distinct squares, the kings apart, the side not to move out of check,
+// and no symmetric position with a lower index.
+func (l *layout) valid(i int) bool {
+	var buf [maxPieces]chess.Square
+	sq := buf[:len(l.pieces)]
+	stm := l.decode(i, sq)
+	var occupied chess.Bitboard
+	for _, s := range sq {
+		if occupied.Get(s) {
+			return false
+		}
+		occupied.Set(s)
+	}
+	if chess.Distance(sq[0], sq[1]) <= 1 || l.index(stm, sq) != i {
+		return false
+	}
+	return !l.attacked(sq, -1, sq[stm.Opposite()], stm)
+}
+
+// attacked reports whether a square is attacked by a side's pieces, leaving
+// out the piece at index captured, if any.
+func (l *layout) attacked(squares []chess.Square, captured int, s chess.Square, by chess.Color) bool {
+	var occupied chess.Bitboard
+	for j, sq := range squares {
+		if j != captured {
+			occupied.Set(sq)
+		}
+	}
+	for j, pc := range l.pieces {
+		if j == captured || pc.Color() != by {
+			continue
+		}
+		a := attacks(pc, squares[j], occupied)
+		if a.Get(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// attacks returns the squares a piece attacks, which are also the squares it
+// can move to and from, since there are no pawns.
+func attacks(pc chess.Piece, s chess.Square, occupied chess.Bitboard) chess.Bitboard {
+	switch pc.Role() {
+	case chess.Bishop:
+		return chess.BishopAttacks(s, occupied)
+	case chess.Rook:
+		return chess.RookAttacks(s, occupied)
+	case chess.Queen:
+		return chess.QueenAttacks(s, occupied)
+	default:
+		return chess.Targets(pc, s) // Knights and kings.
+	}
+}
+
+// squares returns the squares of p's pieces in layout order, and its side to
+// move, with the colors swapped if the table stores p's material that way. If
+// p doesn't have the table's material, ok is false.
+func (l *layout) squares(p *chess.Position, squares []chess.Square) (stm chess.Color, ok bool) {
+	var flip bool
+	switch p.MaterialKey() {
+	case l.key:
+	case l.key.Flip():
+		flip = true
+	default:
+		return 0, false
+	}
+	stm = p.SideToMove
+	if flip {
+		stm = stm.Opposite()
+	}
+	for j := 0; j < len(l.pieces); {
+		pc := l.pieces[j]
+		var b chess.Bitboard
+		if flip {
+			b = p.Board[chess.NewPiece(pc.Color().Opposite(), pc.Role())]
+		} else {
+			b = p.Board[pc]
+		}
+		for ; b != 0; j++ {
+			s := b.Pop()
+			if flip {
+				s ^= 56
+			}
+			squares[j] = s
+		}
+	}
+	return stm, true
+}
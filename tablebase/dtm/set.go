@@ -0,0 +1,101 @@
+package dtm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/tablebase"
+)
+
+// A Set is the tables of some material signatures, for probing any position
+// they cover. It's safe for concurrent use.
+type Set struct {
+	tables map[chess.MaterialKey]*Table // By normalized signature.
+	max    int                          // Most pieces in a table.
+}
+
+// NewSet returns a set of tables.
+func NewSet(tables ...*Table) *Set {
+	s := &Set{tables: make(map[chess.MaterialKey]*Table)}
+	for _, t := range tables {
+		s.add(t)
+	}
+	return s
+}
+
+// add adds a table to the set, unless it has one for the same signature.
+func (s *Set) add(t *Table) {
+	key := Normalize(t.Key())
+	if _, dup := s.tables[key]; dup {
+		return
+	}
+	s.tables[key] = t
+	if n := len(t.l.pieces); n > s.max {
+		s.max = n
+	}
+}
+
+// Open loads the table files in a list of directories, separated as in the
+// PATH environment variable. Table files have the extension .dtm. If two
+// directories have a table for the same signature, the first wins.
+func Open(path string) (*Set, error) {
+	s := NewSet()
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasSuffix(e.Name(), ".dtm") {
+				continue
+			}
+			name := filepath.Join(dir, e.Name())
+			f, err := os.Open(name)
+			if err != nil {
+				return nil, err
+			}
+			t, err := Load(f)
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			s.add(t)
+		}
+	}
+	return s, nil
+}
+
+// Len returns the number of tables.
+func (s *Set) Len() int {
+	return len(s.tables)
+}
+
+// MaxPieces returns the most pieces, kings included, that a position can
+// have to be probed.
+func (s *Set) MaxPieces() int {
+	return s.max
+}
+
+// Probe returns the result of p and the plies to mate, as Table.Probe does.
+// Bare kings are drawn. If the set has no table for the material of p, or p
+// has castling rights, ok is false.
+func (s *Set) Probe(p *chess.Position) (wdl tablebase.WDL, dtm int, ok bool) {
+	all := p.AllPieces()
+	switch n := all.Count(); {
+	case n > s.max || p.CastleRights != chess.NoCastleRights:
+		return 0, 0, false
+	case n == 2:
+		return tablebase.Draw, 0, true
+	}
+	t, ok := s.tables[Normalize(p.MaterialKey())]
+	if !ok {
+		return 0, 0, false
+	}
+	return t.Probe(p)
+}
@@ -0,0 +1,75 @@
+package dtm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/clfs/good/fen"
+	"github.com/clfs/good/tablebase"
+)
+
+func TestSet(t *testing.T) {
+	dir := t.TempDir()
+	for _, s := range []string{"KQK", "KRK"} {
+		tab := generate(t, parseKey(t, s))
+		f, err := os.Create(filepath.Join(dir, tab.Key().String()+".dtm"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tab.WriteTo(f); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a table"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Open(filepath.Join(dir, "missing") + string(filepath.ListSeparator) + dir)
+	if err == nil {
+		t.Error("missing directory: want an error")
+	}
+	set, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Len() != 2 || set.MaxPieces() != 3 {
+		t.Errorf("want 2 tables of 3 pieces, got %d of %d", set.Len(), set.MaxPieces())
+	}
+
+	cases := []struct {
+		fen string
+		wdl tablebase.WDL
+		dtm int
+	}{
+		{"7k/5K2/8/8/8/8/8/6Q1 w - - 0 1", tablebase.Win, 1},   // Qg7#.
+		{"8/8/8/8/8/1k6/8/K6r w - - 0 1", tablebase.Loss, 0},   // Checkmate, colors swapped.
+		{"k7/8/1K6/8/8/8/8/7R b - - 0 1", tablebase.Loss, 2},   // Kb8 Rh8#.
+		{"8/8/8/3k4/8/8/8/K7 w - - 0 1", tablebase.Draw, 0},    // Bare kings.
+		{"8/8/8/3k4/8/8/8/KB6 w - - 0 1", tablebase.Draw, -1},  // No table.
+		{"8/8/8/3k4/8/8/8/KQR5 w - - 0 1", tablebase.Draw, -1}, // Too many pieces.
+	}
+	for _, tc := range cases {
+		p, err := fen.From(tc.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wdl, dtm, ok := set.Probe(&p)
+		if tc.dtm < 0 {
+			if ok {
+				t.Errorf("%s: want no result, got %v in %d", tc.fen, wdl, dtm)
+			}
+			continue
+		}
+		if !ok || wdl != tc.wdl || dtm != tc.dtm {
+			t.Errorf("%s: want %v in %d, got %v in %d (%t)", tc.fen, tc.wdl, tc.dtm, wdl, dtm, ok)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "KBK.dtm"), []byte("not a table"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(dir); err == nil {
+		t.Error("bad table file: want an error")
+	}
+}
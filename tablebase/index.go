@@ -0,0 +1,310 @@
+package tablebase
+
+import "github.com/clfs/good/chess"
+
+// Encoding tables, following the Syzygy generator. They're filled in by init.
+var (
+	// mapB1H1H7 numbers the 28 squares below the A1-H8 diagonal.
+	mapB1H1H7 [64]int
+	// mapA1D1D4 numbers the 10 squares of the A1-D1-D4 triangle, with the
+	// diagonal squares last.
+	mapA1D1D4 [64]int
+	// mapKK numbers the 462 legal placements of two kings, where the first
+	// king is in the A1-D1-D4 triangle.
+	mapKK [10][64]int
+	// binomial[k][n] is the number of ways to choose k of n things.
+	binomial [maxPieces][64]uint64
+	// mapPawns numbers pawn squares so that the leading pawn, the one nearest
+	// the edge and then nearest the first rank, has the highest number.
+	mapPawns [64]int
+	// leadPawnIdx and leadPawnsSize encode the leading pawns of a table,
+	// indexed by their count and then by square or file.
+	leadPawnIdx   [maxPieces][64]uint64
+	leadPawnsSize [maxPieces][4]uint64
+)
+
+func init() {
+	code := 0
+	for s := chess.A1; s <= chess.H8; s++ {
+		if offA1H8(s) < 0 {
+			mapB1H1H7[s] = code
+			code++
+		}
+	}
+
+	var diagonal []chess.Square
+	code = 0
+	for s := chess.A1; s <= chess.D4; s++ {
+		switch {
+		case offA1H8(s) < 0 && s.File() <= chess.FileD:
+			mapA1D1D4[s] = code
+			code++
+		case offA1H8(s) == 0 && s.File() <= chess.FileD:
+			diagonal = append(diagonal, s)
+		}
+	}
+	for _, s := range diagonal {
+		mapA1D1D4[s] = code
+		code++
+	}
+
+	type placement struct {
+		i int
+		s chess.Square
+	}
+	var bothOnDiagonal []placement
+	code = 0
+	for i := 0; i < 10; i++ {
+		for s1 := chess.A1; s1 <= chess.D4; s1++ {
+			if mapA1D1D4[s1] != i || (i == 0 && s1 != chess.B1) {
+				continue
+			}
+			for s2 := chess.A1; s2 <= chess.H8; s2++ {
+				switch {
+				case chess.Distance(s1, s2) <= 1:
+					// The kings can't be adjacent.
+				case offA1H8(s1) == 0 && offA1H8(s2) > 0:
+					// Mirror these across the diagonal instead.
+				case offA1H8(s1) == 0 && offA1H8(s2) == 0:
+					bothOnDiagonal = append(bothOnDiagonal, placement{i, s2})
+				default:
+					mapKK[i][s2] = code
+					code++
+				}
+			}
+		}
+	}
+	for _, x := range bothOnDiagonal {
+		mapKK[x.i][x.s] = code
+		code++
+	}
+
+	binomial[0][0] = 1
+	for n := 1; n < 64; n++ {
+		for k := 0; k < maxPieces && k <= n; k++ {
+			if k > 0 {
+				binomial[k][n] += binomial[k-1][n-1]
+			}
+			if k < n {
+				binomial[k][n] += binomial[k][n-1]
+			}
+		}
+	}
+
+	available := 47
+	for n := 1; n < maxPieces; n++ {
+		for f := chess.FileA; f <= chess.FileD; f++ {
+			var idx uint64
+			for r := chess.Rank2; r <= chess.Rank7; r++ {
+				s := chess.NewSquare(f, r)
+				if n == 1 {
+					mapPawns[s] = available
+					mapPawns[s^7] = available - 1
+					available -= 2
+				}
+				leadPawnIdx[n][s] = idx
+				idx += binomial[n-1][mapPawns[s]]
+			}
+			leadPawnsSize[n][f] = idx
+		}
+	}
+}
+
+// offA1H8 returns a positive number for squares above the A1-H8 diagonal, a
+// negative number for squares below it, and zero for squares on it.
+func offA1H8(s chess.Square) int {
+	return int(s.Rank()) - int(s.File())
+}
+
+// edgeDistance returns the distance of a file from the nearest edge.
+func edgeDistance(f chess.File) int {
+	if f > chess.FileD {
+		return int(chess.FileH - f)
+	}
+	return int(f)
+}
+
+// tbPiece returns the piece code used in table files: 1 to 6 for white pawns
+// to kings, and 9 to 14 for black ones.
+func tbPiece(pc chess.Piece) uint8 {
+	return uint8(pc.Role()) + 1 + 8*uint8(pc.Color())
+}
+
+// sortSquares sorts squares in place, keeping equal squares in order.
+func sortSquares(s []chess.Square, less func(a, b chess.Square) bool) {
+	for i := 1; i < len(s); i++ {
+		for j := i; j > 0 && less(s[j], s[j-1]); j-- {
+			s[j], s[j-1] = s[j-1], s[j]
+		}
+	}
+}
+
+func byPawnOrder(a, b chess.Square) bool { return mapPawns[a] < mapPawns[b] }
+
+func bySquare(a, b chess.Square) bool { return a < b }
+
+// encode returns the table index of p, whose material must match the table.
+// It also returns which side's and file's subtable holds the index. If the
+// table is a DTZ table that doesn't store p's side to move, status is
+// statusChangeSTM.
+func (t *table) encode(p *chess.Position) (d *pairsData, file int, idx uint64, s status) {
+	var (
+		squares      [maxPieces]chess.Square
+		pieces       [maxPieces]uint8
+		size         int
+		leadPawnsCnt int
+		leadPawns    chess.Bitboard
+	)
+
+	// Tables are stored with white as the stronger side, and tables with the
+	// same material on both sides only store white to move. Other positions
+	// are looked up with the colors swapped.
+	flip := p.MaterialKey() != t.key || (t.key == t.key2 && p.SideToMove == chess.Black)
+	var flipColor uint8
+	var flipSquares chess.Square
+	stm := int(p.SideToMove)
+	if flip {
+		flipColor, flipSquares, stm = 8, 56, stm^1
+	}
+
+	if t.hasPawns {
+		// Subtables are split by the file of the leading pawn, which is the
+		// first piece of every subtable.
+		pc := t.items[0][0].pieces[0] ^ flipColor
+		leadPawns = p.Board[chess.NewPiece(chess.Color(pc>>3), chess.Pawn)]
+		for b := leadPawns; b != 0; size++ {
+			squares[size] = b.Pop() ^ flipSquares
+		}
+		leadPawnsCnt = size
+		lead := 0
+		for i := 1; i < leadPawnsCnt; i++ {
+			if mapPawns[squares[i]] > mapPawns[squares[lead]] {
+				lead = i
+			}
+		}
+		squares[0], squares[lead] = squares[lead], squares[0]
+		file = edgeDistance(squares[0].File())
+	}
+
+	if t.dtz && !t.storesSide(stm, file) {
+		return nil, 0, 0, statusChangeSTM
+	}
+
+	for b := p.AllPieces() &^ leadPawns; b != 0; size++ {
+		s := b.Pop()
+		pc, _ := p.Get(s)
+		squares[size] = s ^ flipSquares
+		pieces[size] = tbPiece(pc) ^ flipColor
+	}
+
+	d = t.get(stm, file)
+
+	// Put the pieces in the order the subtable stores them.
+	for i := leadPawnsCnt; i < size-1; i++ {
+		for j := i + 1; j < size; j++ {
+			if d.pieces[i] == pieces[j] {
+				pieces[i], pieces[j] = pieces[j], pieces[i]
+				squares[i], squares[j] = squares[j], squares[i]
+				break
+			}
+		}
+	}
+
+	// Mirror the board so the leading piece is on files A to D.
+	if squares[0].File() > chess.FileD {
+		for i := 0; i < size; i++ {
+			squares[i] ^= 7
+		}
+	}
+
+	if t.hasPawns {
+		idx = leadPawnIdx[leadPawnsCnt][squares[0]]
+		sortSquares(squares[1:leadPawnsCnt], byPawnOrder)
+		for i := 1; i < leadPawnsCnt; i++ {
+			idx += binomial[i][mapPawns[squares[i]]]
+		}
+	} else {
+		idx = t.encodeLeadingPieces(d, squares[:size])
+	}
+
+	// Encode the remaining groups. Each square is numbered among the squares
+	// the previous groups leave free.
+	idx *= d.groupIdx[0]
+	g := d.groupLen[0]
+	remainingPawns := t.hasPawns && t.pawnCount[1] > 0
+	for next := 1; d.groupLen[next] != 0; next++ {
+		group := squares[g : g+d.groupLen[next]]
+		sortSquares(group, bySquare)
+		var n uint64
+		for i, s := range group {
+			k := int(s)
+			for _, q := range squares[:g] {
+				if s > q {
+					k--
+				}
+			}
+			if remainingPawns {
+				k -= 8
+			}
+			n += binomial[i+1][k]
+		}
+		remainingPawns = false
+		idx += n * d.groupIdx[next]
+		g += len(group)
+	}
+	return d, file, idx, statusOK
+}
+
+// encodeLeadingPieces returns the index of the leading group of a pawnless
+// position. It maps the board so the first piece is in the A1-D1-D4
+// triangle, and when that leaves a choice, below the A1-H8 diagonal.
+func (t *table) encodeLeadingPieces(d *pairsData, squares []chess.Square) uint64 {
+	if squares[0].Rank() > chess.Rank4 {
+		for i := range squares {
+			squares[i] ^= 56
+		}
+	}
+	for i := 0; i < d.groupLen[0]; i++ {
+		o := offA1H8(squares[i])
+		if o == 0 {
+			continue
+		}
+		if o > 0 {
+			for j := i; j < len(squares); j++ {
+				s := squares[j]
+				squares[j] = (s>>3 | s<<3) & 63
+			}
+		}
+		break
+	}
+
+	if !t.hasUniquePieces {
+		// Only the kings make up the leading group.
+		return uint64(mapKK[mapA1D1D4[squares[0]]][squares[1]])
+	}
+
+	// Three unique pieces make up the leading group.
+	s0, s1, s2 := int(squares[0]), int(squares[1]), int(squares[2])
+	adjust1 := 0
+	if s1 > s0 {
+		adjust1 = 1
+	}
+	adjust2 := 0
+	if s2 > s0 {
+		adjust2++
+	}
+	if s2 > s1 {
+		adjust2++
+	}
+	r0, r1, r2 := int(squares[0].Rank()), int(squares[1].Rank()), int(squares[2].Rank())
+	switch {
+	case offA1H8(squares[0]) != 0:
+		return uint64((mapA1D1D4[s0]*63+s1-adjust1)*62 + s2 - adjust2)
+	case offA1H8(squares[1]) != 0:
+		return uint64((6*63+r0*28+mapB1H1H7[s1])*62 + s2 - adjust2)
+	case offA1H8(squares[2]) != 0:
+		return uint64(6*63*62 + 4*28*62 + r0*7*28 + (r1-adjust1)*28 + mapB1H1H7[s2])
+	default:
+		return uint64(6*63*62 + 4*28*62 + 4*7*28 + r0*7*6 + (r1-adjust1)*6 + r2 - adjust2)
+	}
+}
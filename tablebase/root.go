@@ -0,0 +1,72 @@
+package tablebase
+
+import "github.com/clfs/good/chess"
+
+// RootMoves returns the legal moves of p that keep its best result under the
+// fifty-move rule, and that result. Among winning moves, only those with the
+// lowest DTZ are kept, so playing any of them makes progress; among losing
+// moves, only those that resist longest. If p can't be probed, ok is false.
+func (tb *Tablebase) RootMoves(p *chess.Position) (moves []chess.Move, wdl WDL, ok bool) {
+	if !tb.probeable(p) {
+		return nil, 0, false
+	}
+
+	// maxDTZ outranks any DTZ.
+	const maxDTZ = 1 << 18
+	halfMoves := int(p.HalfMoves)
+	best, bestDTZ := -maxDTZ-1, 0
+	for _, m := range p.LegalMoves() {
+		q := *p
+		q.Make(m)
+
+		// The DTZ of the move, counted from p.
+		var dtz int
+		if q.HalfMoves == 0 {
+			w, ok := tb.ProbeWDL(&q)
+			if !ok {
+				return nil, 0, false
+			}
+			dtz = beforeZeroing(-w)
+		} else {
+			v, ok := tb.ProbeDTZ(&q)
+			if !ok {
+				return nil, 0, false
+			}
+			dtz = -v + sign(-v)
+		}
+		if dtz == 2 && q.InCheck() && len(q.LegalMoves()) == 0 {
+			dtz = 1 // Mate.
+		}
+
+		// Faster wins and slower losses rank higher.
+		var rank int
+		switch {
+		case dtz > 0:
+			rank = maxDTZ - dtz
+		case dtz < 0:
+			rank = -maxDTZ - dtz
+		}
+		switch {
+		case rank > best:
+			best, bestDTZ = rank, dtz
+			moves = append(moves[:0], m)
+		case rank == best:
+			moves = append(moves, m)
+		}
+	}
+	if len(moves) == 0 {
+		return nil, 0, false // Mate or stalemate.
+	}
+
+	switch {
+	case bestDTZ > 0 && bestDTZ+halfMoves <= 100:
+		wdl = Win
+	case bestDTZ > 0:
+		wdl = CursedWin
+	case bestDTZ < 0 && -bestDTZ+halfMoves <= 100:
+		wdl = Loss
+	case bestDTZ < 0:
+		wdl = BlessedLoss
+	}
+	return moves, wdl, true
+}
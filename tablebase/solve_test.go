@@ -0,0 +1,232 @@
+package tablebase
+
+import (
+	"github.com/clfs/good/chess"
+)
+
+// A solution holds the exact WDL and DTZ of every position with a white king,
+// a black king and one white piece, found by retrograde analysis. It's the
+// reference the tables are checked against.
+type solution struct {
+	piece chess.Piece
+	valid []bool
+	wdl   []WDL
+	dtz   []int
+}
+
+// solutionSize is the number of solution indices: the side to move, and the
+// squares of the white king, the black king and the piece.
+const solutionSize = 1 << 19
+
+func solutionIndex(stm chess.Color, wk, bk, s chess.Square) int {
+	return int(stm) | int(wk)<<1 | int(bk)<<7 | int(s)<<13
+}
+
+// position returns the position at a solution index. If it isn't a legal
+// position, ok is false.
+func (sol *solution) position(i int) (p chess.Position, ok bool) {
+	stm := chess.Color(i & 1)
+	wk, bk, s := chess.Square(i>>1&63), chess.Square(i>>7&63), chess.Square(i>>13)
+	if wk == bk || wk == s || bk == s || chess.Distance(wk, bk) <= 1 {
+		return p, false
+	}
+	if sol.piece.Role() == chess.Pawn && (s.Rank() == chess.Rank1 || s.Rank() == chess.Rank8) {
+		return p, false
+	}
+	p.Put(chess.WhiteKing, wk)
+	p.Put(chess.BlackKing, bk)
+	p.Put(sol.piece, s)
+	p.SideToMove = stm
+	p.EnPassantRight = chess.NoEnPassantRight
+	p.FullMoves = 1
+	if p.IsAttacked(p.King(stm.Opposite()), stm) {
+		return p, false
+	}
+	return p, true
+}
+
+// index returns the solution index of a position with the solution's
+// material.
+func (sol *solution) index(p *chess.Position) int {
+	return solutionIndex(p.SideToMove, p.King(chess.White), p.King(chess.Black), p.Board[sol.piece].First())
+}
+
+// solve solves the endgame of a white king and piece against a king.
+// Promotions are looked up in the given solutions, and are drawn if there's
+// none.
+func solve(pc chess.Piece, promotions map[chess.Role]*solution) *solution {
+	sol := &solution{
+		piece: pc,
+		valid: make([]bool, solutionSize),
+		wdl:   make([]WDL, solutionSize),
+		dtz:   make([]int, solutionSize),
+	}
+
+	// A child is a move's resulting position. Children outside the solution,
+	// after captures and promotions, have their results filled in.
+	type child struct {
+		i       int // Or -1.
+		wdl     WDL
+		mated   bool
+		zeroing bool
+	}
+	children := make([][]child, solutionSize)
+	mated := make([]bool, solutionSize)
+	for i := range children {
+		p, ok := sol.position(i)
+		if !ok {
+			continue
+		}
+		sol.valid[i] = true
+		moves := p.LegalMoves()
+		if len(moves) == 0 {
+			mated[i] = p.InCheck()
+			continue
+		}
+		cs := make([]child, len(moves))
+		for j, m := range moves {
+			q := p
+			q.Make(m)
+			c := child{i: -1, zeroing: p.IsCapture(m) || isPawnMove(&p, m)}
+			promotion, isPromotion := m.Promotion()
+			switch {
+			case p.IsCapture(m):
+				// Only kings are left.
+			case isPromotion:
+				if s := promotions[promotion.Role()]; s != nil {
+					c.wdl = s.wdl[s.index(&q)]
+				}
+				c.mated = q.InCheck() && len(q.LegalMoves()) == 0
+			default:
+				c.i = sol.index(&q)
+			}
+			cs[j] = c
+		}
+		children[i] = cs
+	}
+
+	// Find the results: a position is won if some move loses for the
+	// opponent, and lost if every move wins for the opponent.
+	resolved := make([]bool, solutionSize)
+	for i, cs := range children {
+		if sol.valid[i] && len(cs) == 0 {
+			resolved[i] = true
+			if mated[i] {
+				sol.wdl[i] = Loss
+			}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for i, cs := range children {
+			if !sol.valid[i] || resolved[i] {
+				continue
+			}
+			win, loss := false, true
+			for _, c := range cs {
+				w := c.wdl
+				if c.i >= 0 {
+					if !resolved[c.i] {
+						loss = false
+						continue
+					}
+					w = sol.wdl[c.i]
+				}
+				if w == Loss {
+					win = true
+					break
+				}
+				if w != Win {
+					loss = false
+				}
+			}
+			switch {
+			case win:
+				sol.wdl[i] = Win
+			case loss:
+				sol.wdl[i] = Loss
+			default:
+				continue
+			}
+			resolved[i] = true
+			changed = true
+		}
+	}
+
+	// Find the DTZs, in order of distance. A zeroing or mating move takes one
+	// ply; any other move takes one more ply than the DTZ after it. Winners
+	// take the shortest way, and losers the longest.
+	known := make([]bool, solutionSize)
+	for {
+		var found []int
+		for i, cs := range children {
+			if !sol.valid[i] || known[i] || sol.wdl[i] == Draw {
+				continue
+			}
+			var plies []int
+			complete := true
+			for _, c := range cs {
+				w, m := c.wdl, c.mated
+				if c.i >= 0 {
+					w, m = sol.wdl[c.i], mated[c.i]
+				}
+				if sol.wdl[i] == Win && w != Loss {
+					continue
+				}
+				switch {
+				case c.zeroing || m:
+					plies = append(plies, 1)
+				case known[c.i]:
+					plies = append(plies, 1+abs(sol.dtz[c.i]))
+				default:
+					complete = false
+				}
+			}
+			switch {
+			case sol.wdl[i] == Win && len(plies) > 0:
+				sol.dtz[i] = min(plies)
+			case sol.wdl[i] == Loss && complete && len(plies) == 0:
+				sol.dtz[i] = -1 // Mated.
+			case sol.wdl[i] == Loss && complete:
+				sol.dtz[i] = -max(plies)
+			default:
+				continue
+			}
+			found = append(found, i)
+		}
+		if len(found) == 0 {
+			break
+		}
+		for _, i := range found {
+			known[i] = true
+		}
+	}
+	return sol
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func min(s []int) int {
+	m := s[0]
+	for _, x := range s[1:] {
+		if x < m {
+			m = x
+		}
+	}
+	return m
+}
+
+func max(s []int) int {
+	m := s[0]
+	for _, x := range s[1:] {
+		if x > m {
+			m = x
+		}
+	}
+	return m
+}
@@ -0,0 +1,651 @@
+package tablebase
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/clfs/good/chess"
+)
+
+// maxPieces is the most pieces a Syzygy table can have.
+const maxPieces = 7
+
+var (
+	wdlMagic = []byte{0x71, 0xe8, 0x23, 0x5d}
+	dtzMagic = []byte{0xd7, 0x66, 0x0c, 0xa5}
+)
+
+// Subtable flags.
+const (
+	flagSTM         = 1   // DTZ: the side to move stored, 0 for white.
+	flagMapped      = 2   // DTZ: values are indices into a map.
+	flagWinPlies    = 4   // DTZ: wins are stored in plies, not moves.
+	flagLossPlies   = 8   // DTZ: losses are stored in plies, not moves.
+	flagWide        = 16  // DTZ: the map holds 16-bit values.
+	flagSingleValue = 128 // Every position has the same value.
+)
+
+// errCorrupt is returned for malformed table files.
+var errCorrupt = errors.New("tablebase: corrupt table")
+
+// A table is a WDL or DTZ table file for one material signature. Tables are
+// read lazily: open reads the header on first use, and probes read the rest
+// of the file as needed.
+type table struct {
+	path string
+	dtz  bool
+
+	key   chess.MaterialKey // The material as named, with white first.
+	key2  chess.MaterialKey // The material with the colors swapped.
+	count int               // Number of pieces.
+
+	hasPawns        bool
+	hasUniquePieces bool   // Whether some side has exactly one of a non-king piece.
+	pawnCount       [2]int // Pawns of the leading side, then of the other side.
+
+	once   sync.Once
+	err    error
+	f      *os.File
+	items  [2][4]*pairsData // Subtables, by side to move and leading pawn file.
+	dtzMap []byte           // Value maps of a DTZ table.
+}
+
+// newTable returns a table for the material signature in name, such as
+// "KRPvKR".
+func newTable(path, name string, dtz bool) (*table, error) {
+	key, err := chess.ParseMaterialKey(name)
+	if err != nil {
+		return nil, err
+	}
+	t := &table{path: path, dtz: dtz, key: key, key2: key.Flip()}
+	for pc := chess.WhitePawn; pc <= chess.BlackKing; pc++ {
+		n := key.Count(pc)
+		t.count += n
+		if pc.Role() != chess.King && pc.Role() != chess.Pawn && n == 1 {
+			t.hasUniquePieces = true
+		}
+	}
+	if t.count > maxPieces {
+		return nil, fmt.Errorf("tablebase: too many pieces: %s", name)
+	}
+
+	// The leading side is the side with fewer pawns, but at least one.
+	white, black := key.Count(chess.WhitePawn), key.Count(chess.BlackPawn)
+	t.hasPawns = white+black > 0
+	if black == 0 || (white > 0 && black >= white) {
+		t.pawnCount = [2]int{white, black}
+	} else {
+		t.pawnCount = [2]int{black, white}
+	}
+	return t, nil
+}
+
+// sides returns the number of sides to move the table stores.
+func (t *table) sides() int {
+	if !t.dtz && t.key != t.key2 {
+		return 2
+	}
+	return 1
+}
+
+// files returns the number of leading pawn files the table is split by.
+func (t *table) files() int {
+	if t.hasPawns {
+		return 4
+	}
+	return 1
+}
+
+// get returns the subtable for a side to move and leading pawn file.
+func (t *table) get(stm, file int) *pairsData {
+	if !t.hasPawns {
+		file = 0
+	}
+	return t.items[stm%t.sides()][file]
+}
+
+// storesSide reports whether a DTZ table stores positions with stm to move.
+func (t *table) storesSide(stm, file int) bool {
+	return int(t.get(stm, file).flags&flagSTM) == stm || (t.key == t.key2 && !t.hasPawns)
+}
+
+// open opens the table file and reads its header, once.
+func (t *table) open() error {
+	t.once.Do(func() {
+		t.err = t.init()
+		if t.err != nil && t.f != nil {
+			t.f.Close()
+		}
+	})
+	return t.err
+}
+
+func (t *table) init() error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	t.f = f
+	if err := t.readHeader(newDecoder(f)); err != nil {
+		return fmt.Errorf("tablebase: %s: %w", t.path, err)
+	}
+	return nil
+}
+
+// readHeader reads everything in the file but the sparse indices, block
+// lengths and compressed data, which are only located.
+func (t *table) readHeader(r *decoder) error {
+	magic := wdlMagic
+	if t.dtz {
+		magic = dtzMagic
+	}
+	if !bytes.Equal(r.bytes(4), magic) {
+		return errors.New("bad magic")
+	}
+
+	const (
+		split    = 1
+		hasPawns = 2
+	)
+	flags := r.byte()
+	if (flags&hasPawns != 0) != t.hasPawns || (flags&split != 0) != (t.key != t.key2) {
+		return errCorrupt
+	}
+
+	sides, files := t.sides(), t.files()
+	pp := t.hasPawns && t.pawnCount[1] > 0
+	for f := 0; f < files; f++ {
+		for i := 0; i < sides; i++ {
+			t.items[i][f] = new(pairsData)
+		}
+		b := r.byte()
+		order := [2][2]int{{int(b & 0xf), 0xf}, {int(b >> 4), 0xf}}
+		if pp {
+			b := r.byte()
+			order[0][1], order[1][1] = int(b&0xf), int(b>>4)
+		}
+		for k := 0; k < t.count; k++ {
+			b := r.byte()
+			t.items[0][f].pieces[k] = b & 0xf
+			if sides == 2 {
+				t.items[1][f].pieces[k] = b >> 4
+			}
+		}
+		for i := 0; i < sides; i++ {
+			if err := t.setGroups(t.items[i][f], order[i], f); err != nil {
+				return err
+			}
+		}
+	}
+	r.align(2)
+
+	for f := 0; f < files; f++ {
+		for i := 0; i < sides; i++ {
+			if err := t.items[i][f].readSizes(r); err != nil {
+				return err
+			}
+		}
+	}
+
+	if t.dtz {
+		start := r.off
+		for f := 0; f < files; f++ {
+			d := t.items[0][f]
+			if d.flags&flagMapped == 0 {
+				continue
+			}
+			if d.flags&flagWide != 0 {
+				r.align(2)
+				for i := range d.mapIdx {
+					d.mapIdx[i] = int(r.off-start)/2 + 1
+					r.skip(2 * int64(r.u16()))
+				}
+			} else {
+				for i := range d.mapIdx {
+					d.mapIdx[i] = int(r.off-start) + 1
+					r.skip(int64(r.byte()))
+				}
+			}
+		}
+		r.align(2)
+		if r.err == nil {
+			t.dtzMap = make([]byte, r.off-start)
+			if _, err := t.f.ReadAt(t.dtzMap, start); err != nil {
+				return err
+			}
+		}
+	}
+
+	off := r.off
+	for f := 0; f < files; f++ {
+		for i := 0; i < sides; i++ {
+			d := t.items[i][f]
+			d.sparseIndex = off
+			off += 6 * d.sparseIndexSize
+		}
+	}
+	for f := 0; f < files; f++ {
+		for i := 0; i < sides; i++ {
+			d := t.items[i][f]
+			d.blockLength = off
+			off += 2 * d.blockLengthSize
+		}
+	}
+	for f := 0; f < files; f++ {
+		for i := 0; i < sides; i++ {
+			d := t.items[i][f]
+			off = (off + 63) &^ 63
+			d.data = off
+			off += int64(d.numBlocks) * d.blockSize
+		}
+	}
+	return r.err
+}
+
+// setGroups splits a subtable's pieces into groups that are encoded
+// together, and computes the index multiplier of each group. The leading
+// group is the leading pawns, or in pawnless tables, three unique pieces or
+// else the kings. Other groups are pieces of the same kind. The order
+// gives the position of the leading group, and of the remaining pawns if
+// both sides have pawns, among the groups.
+func (t *table) setGroups(d *pairsData, order [2]int, file int) error {
+	firstLen := 0
+	if !t.hasPawns {
+		firstLen = 2
+		if t.hasUniquePieces {
+			firstLen = 3
+		}
+	}
+	n := 0
+	d.groupLen[0] = 1
+	for i := 1; i < t.count; i++ {
+		firstLen--
+		if firstLen > 0 || d.pieces[i] == d.pieces[i-1] {
+			d.groupLen[n]++
+		} else {
+			n++
+			d.groupLen[n] = 1
+		}
+	}
+	n++
+	d.groupLen[n] = 0
+
+	pp := t.hasPawns && t.pawnCount[1] > 0
+	next := 1
+	free := 64 - d.groupLen[0]
+	if pp {
+		next = 2
+		free -= d.groupLen[1]
+	}
+	idx := uint64(1)
+	for k := 0; next < n || k == order[0] || k == order[1]; k++ {
+		switch {
+		case k == order[0]:
+			d.groupIdx[0] = idx
+			switch {
+			case t.hasPawns:
+				idx *= leadPawnsSize[d.groupLen[0]][file]
+			case t.hasUniquePieces:
+				idx *= 31332
+			default:
+				idx *= 462
+			}
+		case k == order[1]:
+			d.groupIdx[1] = idx
+			idx *= binomial[d.groupLen[1]][48-d.groupLen[0]]
+		default:
+			if next >= n || k >= maxPieces {
+				return errCorrupt
+			}
+			d.groupIdx[next] = idx
+			idx *= binomial[d.groupLen[next]][free]
+			free -= d.groupLen[next]
+			next++
+		}
+	}
+	d.groupIdx[n] = idx
+	return nil
+}
+
+// probe returns the value stored for p, whose material must match the table.
+// WDL values are returned as a WDL. DTZ values are returned in plies and
+// need the position's WDL to be interpreted.
+func (t *table) probe(p *chess.Position, wdl WDL) (int, status) {
+	d, _, idx, s := t.encode(p)
+	if s != statusOK {
+		return 0, s
+	}
+	v, err := d.decompress(t.f, idx)
+	if err != nil {
+		return 0, statusFail
+	}
+	if !t.dtz {
+		return v - 2, statusOK
+	}
+
+	// DTZ tables store no sign, so the values are mapped by WDL.
+	if d.flags&flagMapped != 0 {
+		i := d.mapIdx[[...]int{1, 3, 0, 2, 0}[wdl+2]] + v
+		if d.flags&flagWide != 0 {
+			if 2*i+2 > len(t.dtzMap) {
+				return 0, statusFail
+			}
+			v = int(binary.LittleEndian.Uint16(t.dtzMap[2*i:]))
+		} else {
+			if i >= len(t.dtzMap) {
+				return 0, statusFail
+			}
+			v = int(t.dtzMap[i])
+		}
+	}
+	if (wdl == Win && d.flags&flagWinPlies == 0) ||
+		(wdl == Loss && d.flags&flagLossPlies == 0) ||
+		wdl == CursedWin || wdl == BlessedLoss {
+		v *= 2
+	}
+	return v + 1, statusOK
+}
+
+// close closes the table file, if it's open.
+func (t *table) close() error {
+	if t.f == nil {
+		return nil
+	}
+	return t.f.Close()
+}
+
+// pairsData is a subtable: the values for one side to move and, in tables
+// with pawns, one leading pawn file. Values are split into blocks, and each
+// block is a canonical Huffman code of symbols that expand by recursive
+// pairing into one or more values.
+type pairsData struct {
+	flags     uint8
+	minSymLen int // Or the value, in single-value subtables.
+	maxSymLen int
+
+	blockSize       int64  // Size of each block in bytes.
+	span            uint64 // Number of values between sparse index entries.
+	numBlocks       uint32
+	blockLengthSize int64
+	sparseIndexSize int64
+
+	lowestSym []uint16 // lowestSym[l] is the first symbol of length l+minSymLen.
+	base64    []uint64 // base64[l] is the lowest code of length l+minSymLen, left aligned.
+	symlen    []int    // Number of values each symbol expands to, minus one.
+	btree     []byte   // The two symbols each symbol expands to, packed in 3 bytes.
+
+	// File offsets of the sparse index, the block lengths and the blocks.
+	sparseIndex, blockLength, data int64
+
+	pieces   [maxPieces]uint8      // Pieces in the order they're encoded.
+	groupLen [maxPieces + 1]int    // Lengths of the groups, ending with 0.
+	groupIdx [maxPieces + 1]uint64 // Index multipliers of the groups.
+	mapIdx   [4]int                // DTZ map offsets, by WDL.
+}
+
+// left and right return the symbols a symbol expands to. A symbol whose right
+// side is 0xfff is a value, stored in its left side.
+func (d *pairsData) left(sym int) int {
+	b := d.btree[3*sym:]
+	return int(b[1]&0xf)<<8 | int(b[0])
+}
+
+func (d *pairsData) right(sym int) int {
+	b := d.btree[3*sym:]
+	return int(b[2])<<4 | int(b[1]>>4)
+}
+
+// readSizes reads the subtable's compression parameters and symbol tree.
+func (d *pairsData) readSizes(r *decoder) error {
+	d.flags = r.byte()
+	if d.flags&flagSingleValue != 0 {
+		d.minSymLen = int(r.byte())
+		return r.err
+	}
+
+	n := 0
+	for d.groupLen[n] != 0 {
+		n++
+	}
+	size := d.groupIdx[n]
+
+	blockShift, spanShift := r.byte(), r.byte()
+	if blockShift > 30 || spanShift > 30 {
+		return errCorrupt
+	}
+	d.blockSize = 1 << blockShift
+	d.span = 1 << spanShift
+	d.sparseIndexSize = int64((size + d.span - 1) / d.span)
+	padding := r.byte()
+	d.numBlocks = r.u32()
+	d.blockLengthSize = int64(d.numBlocks) + int64(padding)
+	d.maxSymLen = int(r.byte())
+	d.minSymLen = int(r.byte())
+	if r.err != nil {
+		return r.err
+	}
+	if d.minSymLen == 0 || d.minSymLen > d.maxSymLen || d.maxSymLen > 64 {
+		return errCorrupt
+	}
+
+	// Codes of each length are consecutive, and longer codes are lower, so the
+	// lowest code of each length follows from the number of codes of the
+	// longer lengths.
+	lengths := d.maxSymLen - d.minSymLen + 1
+	d.lowestSym = make([]uint16, lengths)
+	for i := range d.lowestSym {
+		d.lowestSym[i] = r.u16()
+	}
+	d.base64 = make([]uint64, lengths)
+	for i := lengths - 2; i >= 0; i-- {
+		d.base64[i] = (d.base64[i+1] + uint64(d.lowestSym[i]) - uint64(d.lowestSym[i+1])) / 2
+	}
+	for i := range d.base64 {
+		d.base64[i] <<= 64 - i - d.minSymLen
+	}
+
+	syms := int(r.u16())
+	d.btree = r.bytes(3 * syms)
+	if syms%2 == 1 {
+		r.byte()
+	}
+	if r.err != nil {
+		return r.err
+	}
+	d.symlen = make([]int, syms)
+	visited := make([]bool, syms)
+	for sym := range d.symlen {
+		if !visited[sym] {
+			if err := d.setSymlen(sym, visited); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setSymlen computes the number of values a symbol expands to.
+func (d *pairsData) setSymlen(sym int, visited []bool) error {
+	visited[sym] = true
+	right := d.right(sym)
+	if right == 0xfff {
+		d.symlen[sym] = 0
+		return nil
+	}
+	left := d.left(sym)
+	if left >= len(d.symlen) || right >= len(d.symlen) {
+		return errCorrupt
+	}
+	for _, s := range []int{left, right} {
+		if !visited[s] {
+			if err := d.setSymlen(s, visited); err != nil {
+				return err
+			}
+		}
+	}
+	d.symlen[sym] = d.symlen[left] + d.symlen[right] + 1
+	return nil
+}
+
+// decompress returns the value at idx.
+func (d *pairsData) decompress(r io.ReaderAt, idx uint64) (int, error) {
+	if d.flags&flagSingleValue != 0 {
+		return d.minSymLen, nil
+	}
+
+	// The sparse index records the block and offset within it of the value
+	// in the middle of every span. Start from there and walk the blocks.
+	k := idx / d.span
+	if int64(k) >= d.sparseIndexSize {
+		return 0, errCorrupt
+	}
+	var entry [6]byte
+	if _, err := r.ReadAt(entry[:], d.sparseIndex+6*int64(k)); err != nil {
+		return 0, err
+	}
+	block := int64(binary.LittleEndian.Uint32(entry[:4]))
+	offset := int64(binary.LittleEndian.Uint16(entry[4:]))
+	offset += int64(idx%d.span) - int64(d.span/2)
+
+	blockLength := func(b int64) (int64, error) {
+		if b < 0 || b >= d.blockLengthSize {
+			return 0, errCorrupt
+		}
+		var buf [2]byte
+		if _, err := r.ReadAt(buf[:], d.blockLength+2*b); err != nil {
+			return 0, err
+		}
+		return int64(binary.LittleEndian.Uint16(buf[:])), nil
+	}
+	for offset < 0 {
+		block--
+		n, err := blockLength(block)
+		if err != nil {
+			return 0, err
+		}
+		offset += n + 1
+	}
+	for {
+		n, err := blockLength(block)
+		if err != nil {
+			return 0, err
+		}
+		if offset <= n {
+			break
+		}
+		offset -= n + 1
+		block++
+	}
+	if block >= int64(d.numBlocks) {
+		return 0, errCorrupt
+	}
+
+	// Blocks may end in the middle of the last word read, so pad them.
+	var small [64 + 8]byte
+	buf := small[:]
+	if d.blockSize > 64 {
+		buf = make([]byte, d.blockSize+8)
+	}
+	n, err := r.ReadAt(buf[:d.blockSize], d.data+block*d.blockSize)
+	if err != nil && !(err == io.EOF && n > 0) {
+		return 0, err
+	}
+
+	// Find the symbol that covers the offset.
+	code := binary.BigEndian.Uint64(buf)
+	pos := 8
+	bits := 64
+	var sym int
+	for {
+		l := 0
+		for code < d.base64[l] {
+			if l++; l == len(d.base64) {
+				return 0, errCorrupt
+			}
+		}
+		sym = int((code-d.base64[l])>>(64-l-d.minSymLen)) + int(d.lowestSym[l])
+		if sym >= len(d.symlen) {
+			return 0, errCorrupt
+		}
+		if offset < int64(d.symlen[sym])+1 {
+			break
+		}
+		offset -= int64(d.symlen[sym]) + 1
+		l += d.minSymLen
+		code <<= l
+		bits -= l
+		if bits <= 32 {
+			if pos+4 > len(buf) {
+				return 0, errCorrupt
+			}
+			bits += 32
+			code |= uint64(binary.BigEndian.Uint32(buf[pos:])) << (64 - bits)
+			pos += 4
+		}
+	}
+
+	// Expand the symbol down to the value.
+	for d.symlen[sym] != 0 {
+		left := d.left(sym)
+		if offset < int64(d.symlen[left])+1 {
+			sym = left
+		} else {
+			offset -= int64(d.symlen[left]) + 1
+			sym = d.right(sym)
+		}
+	}
+	return d.left(sym), nil
+}
+
+// A decoder reads the little-endian header fields of a table file. Errors
+// are sticky: after the first, reads return zeros.
+type decoder struct {
+	r   *bufio.Reader
+	off int64
+	err error
+}
+
+func newDecoder(r io.ReaderAt) *decoder {
+	return &decoder{r: bufio.NewReader(io.NewSectionReader(r, 0, 1<<62))}
+}
+
+func (d *decoder) bytes(n int) []byte {
+	b := make([]byte, n)
+	if d.err != nil {
+		return b
+	}
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		d.err = errCorrupt
+		return b
+	}
+	d.off += int64(n)
+	return b
+}
+
+func (d *decoder) byte() uint8 { return d.bytes(1)[0] }
+
+func (d *decoder) u16() uint16 { return binary.LittleEndian.Uint16(d.bytes(2)) }
+
+func (d *decoder) u32() uint32 { return binary.LittleEndian.Uint32(d.bytes(4)) }
+
+func (d *decoder) skip(n int64) {
+	if d.err != nil {
+		return
+	}
+	if _, err := d.r.Discard(int(n)); err != nil {
+		d.err = errCorrupt
+		return
+	}
+	d.off += n
+}
+
+// align skips to the next multiple of n bytes.
+func (d *decoder) align(n int64) {
+	d.skip((n - d.off%n) % n)
+}
@@ -0,0 +1,327 @@
+// Package tablebase probes Syzygy endgame tablebases.
+//
+// Syzygy tablebases come as two files per material signature. WDL files
+// (.rtbw) hold the result of each position under the fifty-move rule, and
+// DTZ files (.rtbz) hold the distance to the next capture or pawn move
+// (zeroing move) on the way to that result. The files are compressed, so
+// probing decodes one block of values per lookup.
+//
+// Tables store neither positions where the best move is a capture nor
+// positions with en passant rights correctly, so probes search captures
+// first, and castling rights must be gone.
+package tablebase
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/clfs/good/chess"
+)
+
+// WDL is the result of a position for the side to move.
+type WDL int
+
+const (
+	Loss        WDL = -2 // Loss.
+	BlessedLoss WDL = -1 // Loss, but drawn by the fifty-move rule.
+	Draw        WDL = 0  // Draw.
+	CursedWin   WDL = 1  // Win, but drawn by the fifty-move rule.
+	Win         WDL = 2  // Win.
+)
+
+func (w WDL) String() string {
+	switch w {
+	case Loss:
+		return "loss"
+	case BlessedLoss:
+		return "blessed loss"
+	case Draw:
+		return "draw"
+	case CursedWin:
+		return "cursed win"
+	case Win:
+		return "win"
+	}
+	return "invalid"
+}
+
+// status is the outcome of probing a table.
+type status int
+
+const (
+	statusOK        status = iota
+	statusFail             // The table is missing or unreadable.
+	statusChangeSTM        // The DTZ table only stores the other side to move.
+	statusZeroing          // The best move is a zeroing move.
+)
+
+// Tablebase is a set of Syzygy tables. It's safe for concurrent use.
+type Tablebase struct {
+	wdl, dtz map[chess.MaterialKey]*table
+	n        int // Number of WDL tables.
+	max      int // Most pieces in a WDL table.
+}
+
+// Open finds the tables in a list of directories, separated as in the PATH
+// environment variable. Table files are only opened when first probed.
+func Open(path string) (*Tablebase, error) {
+	tb := &Tablebase{
+		wdl: make(map[chess.MaterialKey]*table),
+		dtz: make(map[chess.MaterialKey]*table),
+	}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			name := e.Name()
+			ext := filepath.Ext(name)
+			if e.IsDir() || (ext != ".rtbw" && ext != ".rtbz") {
+				continue
+			}
+			name = strings.TrimSuffix(name, ext)
+			if !strings.Contains(name, "v") {
+				continue
+			}
+			t, err := newTable(filepath.Join(dir, e.Name()), name, ext == ".rtbz")
+			if err != nil {
+				continue // Not a table.
+			}
+			tables := tb.wdl
+			if t.dtz {
+				tables = tb.dtz
+			}
+			if _, dup := tables[t.key]; dup {
+				continue // The first directory wins.
+			}
+			tables[t.key], tables[t.key2] = t, t
+			if !t.dtz {
+				tb.n++
+				if t.count > tb.max {
+					tb.max = t.count
+				}
+			}
+		}
+	}
+	return tb, nil
+}
+
+// Close closes the table files. The tablebase can't be probed afterwards.
+func (tb *Tablebase) Close() error {
+	var errs []error
+	for _, tables := range []map[chess.MaterialKey]*table{tb.wdl, tb.dtz} {
+		for key, t := range tables {
+			if key == t.key {
+				if err := t.close(); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// Len returns the number of WDL tables.
+func (tb *Tablebase) Len() int {
+	return tb.n
+}
+
+// MaxPieces returns the most pieces, kings included, that a position can
+// have to be probed.
+func (tb *Tablebase) MaxPieces() int {
+	return tb.max
+}
+
+// probeable reports whether p can be looked up at all.
+func (tb *Tablebase) probeable(p *chess.Position) bool {
+	return tb != nil && p.CastleRights == chess.NoCastleRights && pieceCount(p) <= tb.max
+}
+
+// ProbeWDL returns the result of p. The fifty-move counter of p is ignored:
+// a cursed win is a win that takes more than 100 plies to the next zeroing
+// move. If p can't be probed, ok is false.
+func (tb *Tablebase) ProbeWDL(p *chess.Position) (wdl WDL, ok bool) {
+	if !tb.probeable(p) {
+		return 0, false
+	}
+	wdl, s := tb.search(p, false)
+	return wdl, s != statusFail
+}
+
+// ProbeDTZ returns the distance to zero of p in plies: positive if the side
+// to move wins, negative if it loses, and zero for draws. A value of 1 or -1
+// means the next move zeroes, or that the side to move is mated. Values for
+// cursed wins and blessed losses are offset by 100. If p can't be probed, ok
+// is false.
+func (tb *Tablebase) ProbeDTZ(p *chess.Position) (dtz int, ok bool) {
+	if !tb.probeable(p) {
+		return 0, false
+	}
+	dtz, s := tb.probeDTZ(p)
+	return dtz, s != statusFail
+}
+
+// probeTable looks p up in its WDL or DTZ table.
+func (tb *Tablebase) probeTable(p *chess.Position, dtz bool, wdl WDL) (int, status) {
+	if pieceCount(p) == 2 {
+		return int(Draw), statusOK // Only kings.
+	}
+	tables := tb.wdl
+	if dtz {
+		tables = tb.dtz
+	}
+	t := tables[p.MaterialKey()]
+	if t == nil || t.open() != nil {
+		return 0, statusFail
+	}
+	return t.probe(p, wdl)
+}
+
+// search returns the result of p, searching captures, and with zeroing set,
+// pawn moves too. Tables may store any value for positions where a capture
+// wins, and a loss for positions where a capture draws, so the best of the
+// searched moves and the table is the result. The status is statusZeroing
+// if a searched move is best.
+func (tb *Tablebase) search(p *chess.Position, zeroing bool) (WDL, status) {
+	best := Loss
+	moves := p.LegalMoves()
+	searched := 0
+	for _, m := range moves {
+		if !p.IsCapture(m) && (!zeroing || !isPawnMove(p, m)) {
+			continue
+		}
+		searched++
+		q := *p
+		q.Make(m)
+		v, s := tb.search(&q, false)
+		if s == statusFail {
+			return Draw, statusFail
+		}
+		if v = -v; v > best {
+			best = v
+			if v >= Win {
+				return v, statusZeroing
+			}
+		}
+	}
+
+	// With every move searched, the table isn't needed, and may be wrong
+	// anyway when there's an en passant capture.
+	all := searched > 0 && searched == len(moves)
+	v := best
+	if !all {
+		x, s := tb.probeTable(p, false, 0)
+		if s == statusFail {
+			return Draw, statusFail
+		}
+		v = WDL(x)
+	}
+	if best >= v {
+		if best > Draw || all {
+			return best, statusZeroing
+		}
+		return best, statusOK
+	}
+	return v, statusOK
+}
+
+// probeDTZ returns the DTZ of p.
+func (tb *Tablebase) probeDTZ(p *chess.Position) (int, status) {
+	wdl, s := tb.search(p, true)
+	switch {
+	case s == statusFail:
+		return 0, statusFail
+	case wdl == Draw:
+		return 0, statusOK // DTZ tables don't store draws.
+	case s == statusZeroing:
+		return beforeZeroing(wdl), statusOK
+	}
+
+	dtz, s := tb.probeTable(p, true, wdl)
+	switch s {
+	case statusFail:
+		return 0, statusFail
+	case statusOK:
+		if wdl == CursedWin || wdl == BlessedLoss {
+			dtz += 100
+		}
+		return dtz * sign(int(wdl)), statusOK
+	}
+
+	// The table stores the other side to move, so search one ply: the best
+	// move is the winning move with the lowest DTZ, or the losing move with
+	// the highest.
+	best := 0xffff
+	for _, m := range p.LegalMoves() {
+		zeroing := p.IsCapture(m) || isPawnMove(p, m)
+		q := *p
+		q.Make(m)
+		var v int
+		if zeroing {
+			w, s := tb.search(&q, false)
+			if s == statusFail {
+				return 0, statusFail
+			}
+			v = -beforeZeroing(w)
+		} else {
+			v, s = tb.probeDTZ(&q)
+			if s == statusFail {
+				return 0, statusFail
+			}
+			v = -v
+			if v == 1 && q.InCheck() && len(q.LegalMoves()) == 0 {
+				best = 1 // Mate.
+			}
+			v += sign(v)
+		}
+		if v < best && sign(v) == sign(int(wdl)) {
+			best = v
+		}
+	}
+	if best == 0xffff {
+		return -1, statusOK // Mated.
+	}
+	return best, statusOK
+}
+
+// beforeZeroing returns the DTZ of a position whose best move zeroes.
+func beforeZeroing(wdl WDL) int {
+	switch wdl {
+	case Win:
+		return 1
+	case CursedWin:
+		return 101
+	case BlessedLoss:
+		return -101
+	case Loss:
+		return -1
+	}
+	return 0
+}
+
+func pieceCount(p *chess.Position) int {
+	b := p.AllPieces()
+	return b.Count()
+}
+
+func isPawnMove(p *chess.Position, m chess.Move) bool {
+	return p.Board[chess.NewPiece(p.SideToMove, chess.Pawn)].Get(m.From())
+}
+
+func sign(x int) int {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
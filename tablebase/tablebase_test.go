@@ -0,0 +1,430 @@
+package tablebase
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/fen"
+)
+
+var solutions struct {
+	once              sync.Once
+	queen, rook, pawn *solution
+}
+
+// solved returns the solutions of KQvK, KRvK and KPvK.
+func solved() (queen, rook, pawn *solution) {
+	solutions.once.Do(func() {
+		solutions.queen = solve(chess.WhiteQueen, nil)
+		solutions.rook = solve(chess.WhiteRook, nil)
+		solutions.pawn = solve(chess.WhitePawn, map[chess.Role]*solution{
+			chess.Queen: solutions.queen,
+			chess.Rook:  solutions.rook,
+		})
+	})
+	return solutions.queen, solutions.rook, solutions.pawn
+}
+
+// entries returns table entries for every position of a solution.
+func entries(sol *solution) (wdl, dtz []entry) {
+	for i := 0; i < solutionSize; i++ {
+		p, ok := sol.position(i)
+		if !ok {
+			continue
+		}
+		wdl = append(wdl, entry{p, int(sol.wdl[i]) + 2})
+		if sol.dtz[i] != 0 {
+			dtz = append(dtz, entry{p, abs(sol.dtz[i]) - 1})
+		}
+	}
+	return wdl, dtz
+}
+
+// writeFixtures writes the tables of every endgame with three pieces, and
+// returns their directory.
+func writeFixtures(t *testing.T) string {
+	t.Helper()
+	queen, rook, pawn := solved()
+	dir := t.TempDir()
+	for name, sol := range map[string]*solution{"KQvK": queen, "KRvK": rook, "KPvK": pawn} {
+		wdl, dtz := entries(sol)
+		(&writer{dir: dir}).write(t, name, false, wdl)
+		(&writer{dir: dir, mapped: name == "KRvK"}).write(t, name, true, dtz)
+	}
+	for _, name := range []string{"KBvK", "KNvK"} {
+		(&writer{dir: dir, fill: int(Draw) + 2}).write(t, name, false, nil)
+	}
+	return dir
+}
+
+// flip mirrors a position vertically and swaps the colors.
+func flip(p chess.Position) chess.Position {
+	p.FlipColors()
+	return p
+}
+
+// check compares probes of every nth position of sol, and of the same
+// positions with colors swapped, against the solution. DTZ is only probed for
+// one in four of them.
+func check(t *testing.T, tb *Tablebase, sol *solution, n int) {
+	t.Helper()
+	errors := 0
+	for i := 0; i < solutionSize && errors < 10; i += n {
+		p, ok := sol.position(i)
+		if !ok {
+			continue
+		}
+		for _, q := range []chess.Position{p, flip(p)} {
+			wdl, ok := tb.ProbeWDL(&q)
+			if !ok || wdl != sol.wdl[i] {
+				t.Errorf("%s: want WDL %v, got %v (%t)", fen.To(q), sol.wdl[i], wdl, ok)
+				errors++
+			}
+			if i%(4*n) != 0 {
+				continue
+			}
+			dtz, ok := tb.ProbeDTZ(&q)
+			if !ok || dtz != sol.dtz[i] {
+				t.Errorf("%s: want DTZ %d, got %d (%t)", fen.To(q), sol.dtz[i], dtz, ok)
+				errors++
+			}
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	tb, err := Open(writeFixtures(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tb.Close()
+	if tb.Len() != 5 || tb.MaxPieces() != 3 {
+		t.Fatalf("want 5 tables of 3 pieces, got %d of %d", tb.Len(), tb.MaxPieces())
+	}
+
+	// Probe concurrently, as search threads do, from before any table file
+	// is open.
+	queen, rook, pawn := solved()
+	var wg sync.WaitGroup
+	for _, sol := range []*solution{queen, rook, pawn, queen, pawn} {
+		wg.Add(1)
+		go func(sol *solution) {
+			defer wg.Done()
+			check(t, tb, sol, 5)
+		}(sol)
+	}
+	wg.Wait()
+}
+
+// TestProbeFiles checks real Syzygy tables, as published by their generator,
+// against the solutions and against positions with known values. It needs
+// KQvK, KRvK, KPvK and KRvKN in testdata/syzygy, and is skipped only if that
+// directory doesn't exist.
+func TestProbeFiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	dir := filepath.Join("testdata", "syzygy")
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		t.Skipf("no %s", dir)
+	}
+	for _, name := range []string{"KQvK", "KRvK", "KPvK", "KRvKN"} {
+		for _, ext := range []string{".rtbw", ".rtbz"} {
+			if _, err := os.Stat(filepath.Join(dir, name+ext)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	tb, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tb.Close()
+
+	queen, rook, pawn := solved()
+	for _, sol := range []*solution{queen, rook, pawn} {
+		check(t, tb, sol, 5)
+	}
+
+	cases := []struct {
+		fen string
+		wdl WDL
+		dtz int
+	}{
+		{"k7/2K5/8/8/8/8/8/n6R w - - 0 1", Win, 1},  // Rxa1#.
+		{"1k6/8/1K6/8/8/8/8/n6R w - - 0 1", Win, 1}, // Rh8#.
+		{"8/8/8/8/8/1kR5/8/K6n b - - 0 1", Draw, 0}, // Kxc3.
+		{"8/8/8/8/8/2k5/8/1n1RK3 b - - 0 1", Draw, 0},
+	}
+	for _, tc := range cases {
+		p, err := fen.From(tc.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, q := range []chess.Position{p, flip(p), mirror(p)} {
+			if wdl, ok := tb.ProbeWDL(&q); !ok || wdl != tc.wdl {
+				t.Errorf("%s: want WDL %v, got %v (%t)", fen.To(q), tc.wdl, wdl, ok)
+			}
+			if dtz, ok := tb.ProbeDTZ(&q); !ok || dtz != tc.dtz {
+				t.Errorf("%s: want DTZ %d, got %d (%t)", fen.To(q), tc.dtz, dtz, ok)
+			}
+		}
+	}
+}
+
+func TestProbeUnavailable(t *testing.T) {
+	tb, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"8/8/8/4k3/8/8/8/Q3K3 w - - 0 1",
+		"4k3/8/8/8/8/8/8/R3K3 w Q - 0 1",
+	} {
+		p, err := fen.From(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := tb.ProbeWDL(&p); ok {
+			t.Errorf("%s: want no WDL", s)
+		}
+		if _, ok := tb.ProbeDTZ(&p); ok {
+			t.Errorf("%s: want no DTZ", s)
+		}
+		if _, _, ok := tb.RootMoves(&p); ok {
+			t.Errorf("%s: want no root moves", s)
+		}
+	}
+
+	var nilTB *Tablebase
+	p := chess.NewPosition()
+	if _, ok := nilTB.ProbeWDL(&p); ok {
+		t.Error("nil tablebase: want no WDL")
+	}
+}
+
+// lookup returns the WDL and DTZ of a position with at most three pieces,
+// from the solutions.
+func lookup(p *chess.Position) (WDL, int) {
+	queen, rook, pawn := solved()
+	q := *p
+	if black := q.Pieces(chess.Black); black.Count() > 1 {
+		q = flip(q)
+	}
+	for _, sol := range []*solution{queen, rook, pawn} {
+		if q.Board[sol.piece] != 0 {
+			i := sol.index(&q)
+			return sol.wdl[i], sol.dtz[i]
+		}
+	}
+	return Draw, 0
+}
+
+func TestRootMoves(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	tb, err := Open(writeFixtures(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tb.Close()
+
+	queen, _, pawn := solved()
+	r := rand.New(rand.NewSource(1))
+	for _, sol := range []*solution{queen, pawn} {
+		for n := 0; n < 200; {
+			i := r.Intn(solutionSize)
+			p, ok := sol.position(i)
+			if !ok {
+				continue
+			}
+			n++
+
+			// Rank the moves by DTZ, as counted from p.
+			want := make(map[chess.Move]bool)
+			best := -1 << 20
+			for _, m := range p.LegalMoves() {
+				q := p
+				q.Make(m)
+				wdl, dtz := lookup(&q)
+				if p.IsCapture(m) || isPawnMove(&p, m) {
+					dtz = beforeZeroing(-wdl)
+				} else {
+					dtz = -dtz + sign(-dtz)
+				}
+				if dtz == 2 && q.InCheck() && len(q.LegalMoves()) == 0 {
+					dtz = 1
+				}
+				rank := 0
+				switch {
+				case dtz > 0:
+					rank = 1000 - dtz
+				case dtz < 0:
+					rank = -1000 - dtz
+				}
+				if rank > best {
+					best = rank
+					want = make(map[chess.Move]bool)
+				}
+				if rank == best {
+					want[m] = true
+				}
+			}
+
+			moves, wdl, ok := tb.RootMoves(&p)
+			if len(want) == 0 {
+				if ok {
+					t.Errorf("%s: want no root moves, got %v", fen.To(p), moves)
+				}
+				continue
+			}
+			if !ok || wdl != sol.wdl[i] || len(moves) != len(want) {
+				t.Errorf("%s: want %v with %d moves, got %v with %v (%t)", fen.To(p), sol.wdl[i], len(want), wdl, moves, ok)
+				continue
+			}
+			for _, m := range moves {
+				if !want[m] {
+					t.Errorf("%s: %v isn't a best move", fen.To(p), m)
+				}
+			}
+		}
+	}
+}
+
+// symmetric returns a value of p, in [0, n), that's the same for positions
+// related by the symmetries the tables use: mirroring files, swapping colors
+// and, without pawns, mirroring ranks and the A1-H8 diagonal.
+func symmetric(p *chess.Position, n int) int {
+	transforms := 2
+	if p.Board[chess.WhitePawn]|p.Board[chess.BlackPawn] == 0 {
+		transforms = 8
+	}
+	var best uint64
+	for i := 0; i < 2*transforms; i++ {
+		var h uint64
+		for pc := chess.WhitePawn; pc <= chess.BlackKing; pc++ {
+			for b := p.Board[pc]; b != 0; {
+				s, q, g := b.Pop(), pc, i%transforms
+				if g&4 != 0 {
+					s = (s>>3 | s<<3) & 63
+				}
+				s ^= [...]chess.Square{0, 7, 56, 63}[g&3]
+				stm := p.SideToMove
+				if i >= transforms {
+					s ^= 56
+					q = chess.NewPiece(pc.Color().Opposite(), pc.Role())
+					stm = stm.Opposite()
+				}
+				h += mix(uint64(q)<<7 | uint64(s)<<1 | uint64(stm))
+			}
+		}
+		if h = mix(h); i == 0 || h < best {
+			best = h
+		}
+	}
+	return int(best % uint64(n))
+}
+
+// mix is the splitmix64 finalizer.
+func mix(x uint64) uint64 {
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// randomPosition returns a random legal position with the material of key.
+func randomPosition(r *rand.Rand, key chess.MaterialKey) chess.Position {
+	for {
+		var p chess.Position
+		ok := true
+		for pc := chess.WhitePawn; pc <= chess.BlackKing && ok; pc++ {
+			for i := key.Count(pc); i > 0; i-- {
+				s := chess.Square(r.Intn(64))
+				if _, occupied := p.Get(s); occupied {
+					ok = false
+					break
+				}
+				if pc.Role() == chess.Pawn && (s.Rank() == chess.Rank1 || s.Rank() == chess.Rank8) {
+					ok = false
+					break
+				}
+				p.Put(pc, s)
+			}
+		}
+		p.SideToMove = chess.Color(r.Intn(2))
+		p.EnPassantRight = chess.NoEnPassantRight
+		p.FullMoves = 1
+		if ok && chess.Distance(p.King(chess.White), p.King(chess.Black)) > 1 &&
+			!p.IsAttacked(p.King(p.SideToMove.Opposite()), p.SideToMove) {
+			return p
+		}
+	}
+}
+
+// TestProbeFourPieces checks tables with four pieces, covering every way of
+// encoding pieces, by storing a value that's the same for symmetric positions
+// and probing it back from symmetric positions.
+func TestProbeFourPieces(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	names := []string{"KRvKN", "KRRvK", "KPvKP", "KPPvK", "KRvKP"}
+	r := rand.New(rand.NewSource(1))
+	dir := t.TempDir()
+	samples := make(map[string][]chess.Position)
+	for _, name := range names {
+		key, err := chess.ParseMaterialKey(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wdl, dtz []entry
+		for i := 0; i < 2000; i++ {
+			p := randomPosition(r, key)
+			samples[name] = append(samples[name], p)
+			// Symmetric positions don't always share an index, such as
+			// mirrored ones with pawns on the D and E files, so they're all
+			// stored.
+			for _, q := range []chess.Position{p, flip(p), mirror(p), flip(mirror(p))} {
+				wdl = append(wdl, entry{q, symmetric(&q, 5)})
+				dtz = append(dtz, entry{q, symmetric(&q, 300)})
+			}
+		}
+		(&writer{dir: dir}).write(t, name, false, wdl)
+		(&writer{dir: dir, stm: int(chess.Black), mapped: name == "KPvKP"}).write(t, name, true, dtz)
+	}
+
+	tb, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tb.Close()
+	for _, name := range names {
+		for _, p := range samples[name] {
+			for _, q := range []chess.Position{p, flip(p), mirror(p)} {
+				if v, s := tb.probeTable(&q, false, 0); s != statusOK || v+2 != symmetric(&q, 5) {
+					t.Errorf("%s: %s: want WDL table value %d, got %d (%d)", name, fen.To(q), symmetric(&q, 5)-2, v, s)
+				}
+				want := symmetric(&q, 300) + 1
+				switch v, s := tb.probeTable(&q, true, Win); {
+				case s == statusChangeSTM:
+				case s != statusOK || v != want:
+					t.Errorf("%s: %s: want DTZ table value %d, got %d (%d)", name, fen.To(q), want, v, s)
+				}
+			}
+		}
+	}
+}
+
+// mirror mirrors a position horizontally.
+func mirror(p chess.Position) chess.Position {
+	p.MirrorFiles()
+	return p
+}
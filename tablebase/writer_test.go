@@ -0,0 +1,345 @@
+package tablebase
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/fen"
+)
+
+// An entry is a position to store in a test table, and its value: a WDL plus
+// 2 in WDL tables, and the absolute DTZ minus 1 in DTZ tables.
+type entry struct {
+	p chess.Position
+	v int
+}
+
+// A writer writes Syzygy table files for tests. It encodes positions with the
+// same code that probes them, so it can't catch an encoding that differs from
+// the real generator's, only one that's inconsistent: two positions that
+// aren't symmetric to each other, but share an index.
+type writer struct {
+	dir    string
+	fill   int  // The value of positions without entries.
+	stm    int  // DTZ: the side to move stored.
+	mapped bool // DTZ: store values through a map.
+}
+
+// write writes the table file for the material in name. In DTZ tables, only
+// entries the stored side to move covers are kept.
+func (w *writer) write(t *testing.T, name string, dtz bool, entries []entry) {
+	t.Helper()
+	ext := ".rtbw"
+	if dtz {
+		ext = ".rtbz"
+	}
+	tab, err := newTable(filepath.Join(w.dir, name+ext), name, dtz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := w.pieceOrder(tab)
+	pp := tab.hasPawns && tab.pawnCount[1] > 0
+	groupOrder := [2]int{0, 0xf}
+	if pp {
+		groupOrder[1] = 1
+	}
+
+	sides, files := tab.sides(), tab.files()
+	values := make(map[*pairsData][]int)
+	set := make(map[*pairsData][]bool)
+	for f := 0; f < files; f++ {
+		for i := 0; i < sides; i++ {
+			d := &pairsData{pieces: order}
+			if dtz {
+				d.flags = uint8(w.stm) | flagWinPlies | flagLossPlies
+				if w.mapped {
+					d.flags |= flagMapped
+				}
+			}
+			if err := tab.setGroups(d, groupOrder, f); err != nil {
+				t.Fatal(err)
+			}
+			tab.items[i][f] = d
+			n := d.groupIdx[groupCount(d)]
+			values[d], set[d] = make([]int, n), make([]bool, n)
+			for j := range values[d] {
+				values[d][j] = w.fill
+			}
+		}
+	}
+
+	for _, e := range entries {
+		d, _, idx, s := tab.encode(&e.p)
+		if s == statusChangeSTM {
+			continue
+		}
+		if s != statusOK {
+			t.Fatalf("%s: can't encode %s", name, fen.To(e.p))
+		}
+		if set[d][idx] && values[d][idx] != e.v {
+			t.Fatalf("%s: %s: index %d holds both %d and %d", name, fen.To(e.p), idx, values[d][idx], e.v)
+		}
+		values[d][idx], set[d][idx] = e.v, true
+	}
+
+	var b bytes.Buffer
+	if dtz {
+		b.Write(dtzMagic)
+	} else {
+		b.Write(wdlMagic)
+	}
+	var flags byte
+	if tab.key != tab.key2 {
+		flags |= 1
+	}
+	if tab.hasPawns {
+		flags |= 2
+	}
+	b.WriteByte(flags)
+	for f := 0; f < files; f++ {
+		b.WriteByte(byte(groupOrder[0] | groupOrder[0]<<4))
+		if pp {
+			b.WriteByte(byte(groupOrder[1] | groupOrder[1]<<4))
+		}
+		for _, pc := range order[:tab.count] {
+			b.WriteByte(pc | pc<<4)
+		}
+	}
+	pad(&b, 2)
+
+	type subtable struct {
+		d           *pairsData
+		sparse      []byte
+		blockLength []byte
+		data        []byte
+		dtzMap      [4][]int
+	}
+	var subtables []*subtable
+	for f := 0; f < files; f++ {
+		for i := 0; i < sides; i++ {
+			d := tab.items[i][f]
+			st := &subtable{d: d}
+			vs := values[d]
+			if w.mapped {
+				st.dtzMap = mapValues(vs)
+			}
+			st.sparse, st.blockLength, st.data = compress(&b, d.flags, vs)
+			subtables = append(subtables, st)
+		}
+	}
+	if dtz {
+		for _, st := range subtables {
+			if st.d.flags&flagMapped == 0 {
+				continue
+			}
+			for _, m := range st.dtzMap {
+				b.WriteByte(byte(len(m)))
+				for _, v := range m {
+					b.WriteByte(byte(v))
+				}
+			}
+		}
+		pad(&b, 2)
+	}
+	for _, st := range subtables {
+		b.Write(st.sparse)
+	}
+	for _, st := range subtables {
+		b.Write(st.blockLength)
+	}
+	for _, st := range subtables {
+		pad(&b, 64)
+		b.Write(st.data)
+	}
+	if err := os.WriteFile(tab.path, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pieceOrder returns the order pieces are encoded in: leading pawns, then the
+// other side's pawns, then the kings, then the other pieces with unique ones
+// first.
+func (w *writer) pieceOrder(tab *table) [maxPieces]uint8 {
+	var order [maxPieces]uint8
+	n := 0
+	add := func(pc chess.Piece) {
+		for i := tab.key.Count(pc); i > 0; i-- {
+			order[n] = tbPiece(pc)
+			n++
+		}
+	}
+	if tab.hasPawns {
+		lead := chess.White
+		if tab.key.Count(chess.WhitePawn) != tab.pawnCount[0] {
+			lead = chess.Black
+		}
+		add(chess.NewPiece(lead, chess.Pawn))
+		add(chess.NewPiece(lead.Opposite(), chess.Pawn))
+	}
+	add(chess.WhiteKing)
+	add(chess.BlackKing)
+	for _, unique := range []bool{true, false} {
+		for pc := chess.WhiteKnight; pc <= chess.BlackQueen; pc++ {
+			if pc.Role() != chess.Pawn && pc.Role() != chess.King && (tab.key.Count(pc) == 1) == unique {
+				add(pc)
+			}
+		}
+	}
+	return order
+}
+
+func groupCount(d *pairsData) int {
+	n := 0
+	for d.groupLen[n] != 0 {
+		n++
+	}
+	return n
+}
+
+func pad(b *bytes.Buffer, n int) {
+	for b.Len()%n != 0 {
+		b.WriteByte(0)
+	}
+}
+
+// mapValues replaces DTZ values by their indices in a map, and returns the
+// map. All values share the win map.
+func mapValues(vs []int) [4][]int {
+	var m [4][]int
+	index := make(map[int]int)
+	for i, v := range vs {
+		j, ok := index[v]
+		if !ok {
+			j = len(m[0])
+			index[v] = j
+			m[0] = append(m[0], v)
+		}
+		vs[i] = j
+	}
+	m[1] = m[0] // Losses.
+	return m
+}
+
+const (
+	blockShift = 5 // Blocks of 32 bytes.
+	spanShift  = 6 // A sparse index entry every 64 values.
+)
+
+// compress writes a subtable's sizes and symbol tree to b, and returns its
+// sparse index, block lengths and blocks. Values are coded with one symbol
+// each, plus a symbol for a pair of the most common value, using codes of at
+// most two lengths.
+func compress(b *bytes.Buffer, flags uint8, vs []int) (sparse, blockLength, data []byte) {
+	single := true
+	count := make(map[int]int)
+	common, maxValue := vs[0], 0
+	for _, v := range vs {
+		single = single && v == vs[0]
+		if count[v]++; count[v] > count[common] {
+			common = v
+		}
+		if v > maxValue {
+			maxValue = v
+		}
+	}
+	if single {
+		b.WriteByte(flags | flagSingleValue)
+		b.WriteByte(byte(vs[0]))
+		return nil, nil, nil
+	}
+
+	// Symbols 0 to maxValue are values, and the last one is the pair.
+	syms := maxValue + 2
+	pair := syms - 1
+	maxLen := bits.Len(uint(syms - 1))
+	short := 1<<maxLen - syms // Number of codes one bit shorter.
+	long := syms - short
+	minLen := maxLen
+	lowest := []uint16{0}
+	if short > 0 {
+		minLen = maxLen - 1
+		lowest = []uint16{uint16(long), 0}
+	}
+	code := func(sym int) (c uint64, n int) {
+		if sym < long {
+			return uint64(sym), maxLen
+		}
+		return uint64(long/2 + sym - long), maxLen - 1
+	}
+
+	// Split the symbols into blocks.
+	var blocks [][]byte
+	var lengths []int
+	for i := 0; i < len(vs); {
+		var block []byte
+		used, n := 0, 0
+		for i < len(vs) && n < 1<<16-1 {
+			sym, width := vs[i], 1
+			if vs[i] == common && i+1 < len(vs) && vs[i+1] == common && n+2 <= 1<<16 {
+				sym, width = pair, 2
+			}
+			c, l := code(sym)
+			if used+l > 8<<blockShift {
+				break
+			}
+			for k := l - 1; k >= 0; k-- {
+				if used%8 == 0 {
+					block = append(block, 0)
+				}
+				block[used/8] |= byte(c>>k&1) << (7 - used%8)
+				used++
+			}
+			i += width
+			n += width
+		}
+		block = append(block, make([]byte, 1<<blockShift-len(block))...)
+		blocks = append(blocks, block)
+		lengths = append(lengths, n)
+	}
+
+	b.WriteByte(flags)
+	b.WriteByte(blockShift)
+	b.WriteByte(spanShift)
+	b.WriteByte(0) // Padding.
+	binary.Write(b, binary.LittleEndian, uint32(len(blocks)))
+	b.WriteByte(byte(maxLen))
+	b.WriteByte(byte(minLen))
+	binary.Write(b, binary.LittleEndian, lowest)
+	binary.Write(b, binary.LittleEndian, uint16(syms))
+	for sym := 0; sym < syms; sym++ {
+		left, right := sym, 0xfff
+		if sym == pair {
+			left, right = common, common
+		}
+		b.Write([]byte{byte(left), byte(left>>8&0xf | right<<4&0xf0), byte(right >> 4)})
+	}
+	if syms%2 == 1 {
+		b.WriteByte(0)
+	}
+
+	// Point each sparse index entry at the middle of its span.
+	starts := make([]int, len(lengths))
+	for i := 1; i < len(lengths); i++ {
+		starts[i] = starts[i-1] + lengths[i-1]
+	}
+	span := 1 << spanShift
+	for k := 0; k*span < len(vs); k++ {
+		idx := k*span + span/2
+		block := len(starts) - 1
+		for block > 0 && starts[block] > idx {
+			block--
+		}
+		sparse = append(sparse, byte(block), byte(block>>8), byte(block>>16), byte(block>>24))
+		offset := idx - starts[block]
+		sparse = append(sparse, byte(offset), byte(offset>>8))
+	}
+	for _, n := range lengths {
+		blockLength = append(blockLength, byte(n-1), byte((n-1)>>8))
+	}
+	return sparse, blockLength, bytes.Join(blocks, nil)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/fen"
+	"github.com/clfs/good/tablebase"
+	"github.com/clfs/good/tablebase/dtm"
+)
+
+// runTB implements the "good tb" command.
+func runTB(args []string) error {
+	const usage = "usage: good tb gen [-dir dir] signature...\n       good tb probe [-dir dir] fen"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	switch args[0] {
+	case "gen":
+		return runTBGen(args[1:])
+	case "probe":
+		return runTBProbe(args[1:])
+	default:
+		return fmt.Errorf("tb: unknown command %q\n%s", args[0], usage)
+	}
+}
+
+// runTBGen implements the "good tb gen" command.
+func runTBGen(args []string) error {
+	fs := flag.NewFlagSet("tb gen", flag.ContinueOnError)
+	dir := fs.String("dir", ".", "`directory` to read and write table files in")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: good tb gen [-dir dir] signature...")
+		fmt.Fprintln(fs.Output(), "Signatures name each side's pieces, as in KQK, KRKN or KBNK.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("tb gen: no signatures")
+	}
+
+	tables := &tableDir{dir: *dir, tables: make(map[chess.MaterialKey]*dtm.Table)}
+	for _, s := range fs.Args() {
+		key, err := chess.ParseMaterialKey(strings.ToUpper(s))
+		if err != nil {
+			return err
+		}
+		if _, err := tables.load(key, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runTBProbe implements the "good tb probe" command.
+func runTBProbe(args []string) error {
+	fs := flag.NewFlagSet("tb probe", flag.ContinueOnError)
+	dir := fs.String("dir", ".", "`directory` to read table files from")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: good tb probe [-dir dir] fen")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	p, err := fen.From(strings.Join(fs.Args(), " "))
+	if err != nil {
+		return err
+	}
+
+	tables := &tableDir{dir: *dir, tables: make(map[chess.MaterialKey]*dtm.Table)}
+	t, err := tables.load(p.MaterialKey(), false)
+	if err != nil {
+		return err
+	}
+	wdl, plies, ok := t.Probe(&p)
+	switch {
+	case !ok:
+		return errors.New("tb probe: position can't be probed")
+	case wdl == tablebase.Draw:
+		fmt.Println("draw")
+	case plies == 0:
+		fmt.Println("checkmate")
+	case wdl == tablebase.Win:
+		fmt.Printf("win: mate in %d (%d plies)\n", (plies+1)/2, plies)
+	default:
+		fmt.Printf("loss: mated in %d (%d plies)\n", plies/2, plies)
+	}
+	return nil
+}
+
+// A tableDir is a directory of depth-to-mate table files, named for their
+// normalized material signatures.
+type tableDir struct {
+	dir    string
+	tables map[chess.MaterialKey]*dtm.Table
+}
+
+// load returns the table for the material of key, reading it from its file.
+// With generate set, missing tables are generated and written, along with the
+// tables they need.
+func (d *tableDir) load(key chess.MaterialKey, generate bool) (*dtm.Table, error) {
+	key = dtm.Normalize(key)
+	if t, ok := d.tables[key]; ok {
+		return t, nil
+	}
+	path := filepath.Join(d.dir, key.String()+".dtm")
+	f, err := os.Open(path)
+	switch {
+	case err == nil:
+		defer f.Close()
+		t, err := dtm.Load(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		d.tables[key] = t
+		return t, nil
+	case !errors.Is(err, os.ErrNotExist) || !generate:
+		return nil, err
+	}
+
+	log.Printf("generating %v", key)
+	t, err := dtm.Generate(key, func(k chess.MaterialKey) (*dtm.Table, error) {
+		return d.load(k, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := t.WriteTo(out); err != nil {
+		out.Close()
+		return nil, err
+	}
+	if err := out.Close(); err != nil {
+		return nil, err
+	}
+	log.Printf("wrote %s", path)
+	d.tables[key] = t
+	return t, nil
+}
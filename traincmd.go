@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/clfs/good/eval/train"
+)
+
+// runTrain implements the "good train" command.
+func runTrain(args []string) error {
+	cfg := train.DefaultConfig()
+
+	fs := flag.NewFlagSet("train", flag.ContinueOnError)
+	fs.StringVar(&cfg.Data, "data", "", "training data `file`, with lines of the form \"fen | score | result\"")
+	fs.StringVar(&cfg.Output, "o", "good.nnue", "output network `file`")
+	fs.StringVar(&cfg.Checkpoint, "checkpoint", "", "checkpoint `file` to save to and resume from")
+	fs.IntVar(&cfg.Hidden, "hidden", cfg.Hidden, "feature transformer size")
+	fs.IntVar(&cfg.L1, "l1", cfg.L1, "first hidden layer size")
+	fs.IntVar(&cfg.L2, "l2", cfg.L2, "second hidden layer size")
+	fs.IntVar(&cfg.Epochs, "epochs", cfg.Epochs, "number of epochs")
+	fs.IntVar(&cfg.BatchSize, "batch", cfg.BatchSize, "batch size")
+	fs.Float64Var(&cfg.LearningRate, "lr", cfg.LearningRate, "learning rate")
+	fs.Float64Var(&cfg.Lambda, "lambda", cfg.Lambda, "weight of evaluations versus game results in the target")
+	fs.Float64Var(&cfg.Scale, "scale", cfg.Scale, "centipawns to win probability scale")
+	fs.IntVar(&cfg.Threads, "threads", 0, "number of worker threads (0 means one per CPU)")
+	fs.Int64Var(&cfg.Seed, "seed", 0, "random seed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if cfg.Data == "" {
+		return errors.New("train: -data is required")
+	}
+	cfg.Log = os.Stderr
+	return train.Train(cfg)
+}
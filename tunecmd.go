@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/clfs/good/eval/tune"
+)
+
+// runTune implements the "good tune" command.
+func runTune(args []string) error {
+	cfg := tune.DefaultConfig()
+
+	fs := flag.NewFlagSet("tune", flag.ContinueOnError)
+	fs.StringVar(&cfg.Data, "data", "", "tuning data `file`, in EPD with c9 results or lines of \"fen result\"")
+	fs.StringVar(&cfg.Weights, "weights", "", "JSON weights `file` to start from, instead of the built-in weights")
+	fs.StringVar(&cfg.Output, "o", "weights.json", "output `file` for the tuned weights, as JSON")
+	fs.Float64Var(&cfg.K, "k", 0, "sigmoid scaling constant (0 means fit it to the data)")
+	fs.IntVar(&cfg.Epochs, "epochs", cfg.Epochs, "number of optimizer steps")
+	fs.Float64Var(&cfg.LearningRate, "lr", cfg.LearningRate, "learning rate, in centipawns")
+	fs.IntVar(&cfg.Threads, "threads", 0, "number of worker threads (0 means one per CPU)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if cfg.Data == "" {
+		return errors.New("tune: -data is required")
+	}
+	cfg.Log = os.Stderr
+	return tune.Tune(cfg)
+}
@@ -0,0 +1,318 @@
+package uci
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clfs/good/eval"
+	"github.com/clfs/good/search"
+	"github.com/clfs/good/tablebase"
+	"github.com/clfs/good/tablebase/dtm"
+)
+
+// An option is an engine setting that can be changed with setoption.
+type option struct {
+	name string
+	typ  string   // One of check, spin, combo, button, or string.
+	def  string   // Default value.
+	min  int      // Minimum value of a spin option.
+	max  int      // Maximum value of a spin option.
+	vars []string // Values of a combo option.
+	set  func(c *Client, value string) error
+
+	// hidden options aren't announced, but can still be set. The search's
+	// tuning parameters are hidden, for use by tuners rather than users.
+	hidden bool
+}
+
+// maxHashSize is the largest transposition table, in megabytes.
+const maxHashSize = 65536
+
+// maxThreads is the most search threads.
+const maxThreads = 1024
+
+// maxMoveOverhead is the largest move overhead, in milliseconds.
+const maxMoveOverhead = 5000
+
+// options lists the options announced in response to the uci command, and
+// the hidden ones.
+var options = []option{
+	{name: "Hash", typ: "spin", def: strconv.Itoa(search.DefaultHashSize), min: 1, max: maxHashSize, set: (*Client).setHash},
+	{name: "Threads", typ: "spin", def: "1", min: 1, max: maxThreads, set: (*Client).setThreads},
+	{name: "Move Overhead", typ: "spin", def: strconv.Itoa(int(search.DefaultMoveOverhead.Milliseconds())), min: 0, max: maxMoveOverhead, set: (*Client).setMoveOverhead},
+	{name: "Backend", typ: "combo", def: search.AlphaBeta.String(), vars: []string{search.AlphaBeta.String(), search.MCTS.String()}, set: (*Client).setBackend},
+	{name: "MCTSExploration", typ: "spin", def: "141", min: 0, max: 1000, set: (*Client).setMCTSExploration},
+	{name: "MCTSRollouts", typ: "check", def: "false", set: (*Client).setMCTSRollouts},
+	{name: "MCTSNetFile", typ: "string", def: "<empty>", set: (*Client).setMCTSNetFile},
+	{name: "MCTSNoise", typ: "spin", def: "0", min: 0, max: 100, set: (*Client).setMCTSNoise},
+	{name: "MCTSTemperature", typ: "spin", def: "0", min: 0, max: 1000, set: (*Client).setMCTSTemperature},
+	{name: "EvalFile", typ: "string", def: "<empty>", set: (*Client).setEvalFile},
+	{name: "SyzygyPath", typ: "string", def: "<empty>", set: (*Client).setSyzygyPath},
+	{name: "DTMPath", typ: "string", def: "<empty>", set: (*Client).setDTMPath},
+}
+
+func init() {
+	for _, p := range search.Params() {
+		options = append(options, paramOption(p))
+	}
+}
+
+// paramOption returns a hidden spin option that sets a search parameter.
+func paramOption(p search.Param) option {
+	return option{
+		name:   p.Name,
+		typ:    "spin",
+		def:    strconv.Itoa(p.Default),
+		min:    p.Min,
+		max:    p.Max,
+		hidden: true,
+		set: func(c *Client, value string) error {
+			n, err := parseSpin(p.Name, value, p.Min, p.Max)
+			if err != nil {
+				return err
+			}
+			c.stopSearch()
+			return search.SetParam(p.Name, n)
+		},
+	}
+}
+
+// printOptions announces every option that isn't hidden.
+func (c *Client) printOptions() {
+	for _, o := range options {
+		if o.hidden {
+			continue
+		}
+		switch o.typ {
+		case "spin":
+			fmt.Fprintf(c.w, "option name %s type %s default %s min %d max %d\n", o.name, o.typ, o.def, o.min, o.max)
+		case "combo":
+			fmt.Fprintf(c.w, "option name %s type %s default %s", o.name, o.typ, o.def)
+			for _, v := range o.vars {
+				fmt.Fprintf(c.w, " var %s", v)
+			}
+			fmt.Fprintln(c.w)
+		default:
+			fmt.Fprintf(c.w, "option name %s type %s default %s\n", o.name, o.typ, o.def)
+		}
+	}
+}
+
+// setOption handles the setoption command:
+//
+//	setoption name <id> [value <x>]
+//
+// Option names are case-insensitive, and both names and values may contain
+// spaces.
+func (c *Client) setOption(args []string) error {
+	if len(args) < 2 || args[0] != "name" {
+		return errors.New("uci: setoption: missing name")
+	}
+	args = args[1:]
+	var name, value string
+	for i, a := range args {
+		if a == "value" {
+			name, value = strings.Join(args[:i], " "), strings.Join(args[i+1:], " ")
+			break
+		}
+	}
+	if name == "" {
+		name = strings.Join(args, " ")
+	}
+	for _, o := range options {
+		if strings.EqualFold(o.name, name) {
+			return o.set(c, value)
+		}
+	}
+	return fmt.Errorf("uci: setoption: unknown option: %s", name)
+}
+
+// parseSpin parses the value of a spin option, which must be in [min, max].
+func parseSpin(name, value string, min, max int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("uci: %s: %w", name, err)
+	}
+	if n < min || n > max {
+		return 0, fmt.Errorf("uci: %s: %d is out of range [%d, %d]", name, n, min, max)
+	}
+	return n, nil
+}
+
+// parseCheck parses the value of a check option.
+func parseCheck(name, value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("uci: %s: want true or false, got %q", name, value)
+}
+
+// setHash resizes the transposition table, in megabytes, clearing it.
+func (c *Client) setHash(value string) error {
+	mb, err := parseSpin("Hash", value, 1, maxHashSize)
+	if err != nil {
+		return err
+	}
+	c.stopSearch()
+	search.SetHashSize(mb)
+	return nil
+}
+
+// setThreads sets the number of search threads.
+func (c *Client) setThreads(value string) error {
+	n, err := parseSpin("Threads", value, 1, maxThreads)
+	if err != nil {
+		return err
+	}
+	c.stopSearch()
+	search.SetThreads(n)
+	return nil
+}
+
+// setMoveOverhead sets the time lost on each move outside the search, in
+// milliseconds.
+func (c *Client) setMoveOverhead(value string) error {
+	n, err := parseSpin("Move Overhead", value, 0, maxMoveOverhead)
+	if err != nil {
+		return err
+	}
+	c.stopSearch()
+	search.SetMoveOverhead(time.Duration(n) * time.Millisecond)
+	return nil
+}
+
+// setBackend sets the search algorithm.
+func (c *Client) setBackend(value string) error {
+	b, err := search.ParseBackend(value)
+	if err != nil {
+		return fmt.Errorf("uci: Backend: %w", err)
+	}
+	c.stopSearch()
+	search.SetBackend(b)
+	return nil
+}
+
+// setMCTSExploration sets the MCTS exploration constant, in hundredths.
+func (c *Client) setMCTSExploration(value string) error {
+	n, err := parseSpin("MCTSExploration", value, 0, 1000)
+	if err != nil {
+		return err
+	}
+	c.stopSearch()
+	search.SetMCTSExploration(float64(n) / 100)
+	return nil
+}
+
+// setMCTSRollouts sets whether MCTS evaluates positions by rollouts.
+func (c *Client) setMCTSRollouts(value string) error {
+	on, err := parseCheck("MCTSRollouts", value)
+	if err != nil {
+		return err
+	}
+	c.stopSearch()
+	search.SetMCTSRollouts(on)
+	return nil
+}
+
+// setMCTSNetFile loads a policy/value network for MCTS, which then searches
+// by PUCT. An empty value unloads it.
+func (c *Client) setMCTSNetFile(value string) error {
+	c.stopSearch()
+	if value == "" || value == "<empty>" {
+		search.ResetMCTSNetwork()
+		return nil
+	}
+	f, err := os.Open(value)
+	if err != nil {
+		return fmt.Errorf("uci: MCTSNetFile: %w", err)
+	}
+	defer f.Close()
+	if err := search.LoadMCTSNetwork(f); err != nil {
+		return fmt.Errorf("uci: MCTSNetFile: %w", err)
+	}
+	return nil
+}
+
+// setMCTSNoise sets the weight of PUCT's root noise, in percent.
+func (c *Client) setMCTSNoise(value string) error {
+	n, err := parseSpin("MCTSNoise", value, 0, 100)
+	if err != nil {
+		return err
+	}
+	c.stopSearch()
+	search.SetMCTSNoise(float64(n) / 100)
+	return nil
+}
+
+// setMCTSTemperature sets the MCTS move choice temperature, in hundredths.
+func (c *Client) setMCTSTemperature(value string) error {
+	n, err := parseSpin("MCTSTemperature", value, 0, 1000)
+	if err != nil {
+		return err
+	}
+	c.stopSearch()
+	search.SetMCTSTemperature(float64(n) / 100)
+	return nil
+}
+
+// setEvalFile loads evaluation weights from a JSON weights file. An empty
+// value restores the built-in weights.
+func (c *Client) setEvalFile(value string) error {
+	if value == "" || value == "<empty>" {
+		eval.ResetWeights()
+		return nil
+	}
+	f, err := os.Open(value)
+	if err != nil {
+		return fmt.Errorf("uci: EvalFile: %w", err)
+	}
+	defer f.Close()
+	if err := eval.LoadWeights(f); err != nil {
+		return fmt.Errorf("uci: EvalFile: %w", err)
+	}
+	return nil
+}
+
+// setSyzygyPath opens the Syzygy tables in a list of directories, separated
+// as in the PATH environment variable. An empty value closes them.
+func (c *Client) setSyzygyPath(value string) error {
+	c.stopSearch()
+	if c.tb != nil {
+		c.tb.Close()
+		c.tb = nil
+	}
+	if value == "" || value == "<empty>" {
+		return nil
+	}
+	tb, err := tablebase.Open(value)
+	if err != nil {
+		return fmt.Errorf("uci: SyzygyPath: %w", err)
+	}
+	c.tb = tb
+	fmt.Fprintf(c.w, "info string found %d tablebases\n", tb.Len())
+	return nil
+}
+
+// setDTMPath loads the depth-to-mate tables in a list of directories,
+// separated as in the PATH environment variable. An empty value unloads them.
+func (c *Client) setDTMPath(value string) error {
+	c.stopSearch()
+	c.dtm = nil
+	if value == "" || value == "<empty>" {
+		return nil
+	}
+	set, err := dtm.Open(value)
+	if err != nil {
+		return fmt.Errorf("uci: DTMPath: %w", err)
+	}
+	c.dtm = set
+	fmt.Fprintf(c.w, "info string found %d depth-to-mate tables\n", set.Len())
+	return nil
+}
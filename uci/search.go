@@ -0,0 +1,150 @@
+package uci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/search"
+)
+
+// goSearch handles the go command:
+//
+//	go [searchmoves <move1> ... <movei>] [wtime <x>] [btime <x>] [winc <x>]
+//	   [binc <x>] [movestogo <x>] [depth <x>] [nodes <x>] [mate <x>]
+//	   [movetime <x>] [infinite]
+//
+// The search runs in the background until it ends or the stop command is
+// received, and then the best move is printed. Pondering isn't supported, so
+// the ponder argument is ignored.
+func (c *Client) goSearch(args []string) error {
+	if c.done != nil {
+		select {
+		case <-c.done:
+		default:
+			return errors.New("uci: go: already searching")
+		}
+	}
+	limits, err := parseGo(&c.pos, args)
+	if err != nil {
+		return err
+	}
+	limits.OnInfo = c.printInfo
+	if c.tb != nil {
+		limits.Tablebase = c.tb
+	}
+	if c.dtm != nil {
+		limits.DTM = c.dtm
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.stop, c.done, c.infinite = cancel, make(chan struct{}), limits.Infinite
+	pos, history, done := c.pos, c.history, c.done
+	go func() {
+		defer close(done)
+		res := search.Search(ctx, pos, history, limits)
+		switch {
+		case res.BestMove == 0:
+			fmt.Fprintln(c.w, "bestmove 0000")
+		case res.PonderMove == 0:
+			fmt.Fprintf(c.w, "bestmove %v\n", res.BestMove)
+		default:
+			fmt.Fprintf(c.w, "bestmove %v ponder %v\n", res.BestMove, res.PonderMove)
+		}
+	}()
+	return nil
+}
+
+// stopSearch stops the running search, if any, and waits for it to print
+// its best move.
+func (c *Client) stopSearch() {
+	if c.stop != nil {
+		c.stop()
+	}
+	c.waitSearch()
+}
+
+// waitSearch waits for the running search, if any, to end.
+func (c *Client) waitSearch() {
+	if c.done != nil {
+		<-c.done
+	}
+	c.stop, c.done, c.infinite = nil, nil, false
+}
+
+// printInfo reports a completed iteration of a search.
+func (c *Client) printInfo(i search.Info) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "info depth %d score %v nodes %d nps %d time %d hashfull %d pv",
+		i.Depth, i.Score, i.Nodes, i.NPS(), i.Time.Milliseconds(), i.Hashfull)
+	for _, m := range i.PV {
+		fmt.Fprintf(&b, " %v", m)
+	}
+	b.WriteString("\n")
+	fmt.Fprint(c.w, b.String())
+}
+
+// parseGo parses the arguments of a go command for a search of p.
+func parseGo(p *chess.Position, args []string) (search.Limits, error) {
+	var limits search.Limits
+	for i := 0; i < len(args); i++ {
+		name := args[i]
+		switch name {
+		case "infinite":
+			limits.Infinite = true
+			continue
+		case "ponder":
+			continue
+		case "searchmoves":
+			for ; i+1 < len(args); i++ {
+				m, err := parseMove(p, args[i+1])
+				if err != nil {
+					break
+				}
+				limits.SearchMoves = append(limits.SearchMoves, m)
+			}
+			continue
+		}
+
+		if i+1 >= len(args) {
+			return limits, fmt.Errorf("uci: go: missing value for %s", name)
+		}
+		i++
+		n, err := strconv.ParseInt(args[i], 10, 64)
+		if err == nil && n <= 0 && (name == "wtime" || name == "btime") {
+			// Some GUIs send times of zero or less once a clock has run
+			// into the move overhead. The search must still move at once.
+			n = 1
+		}
+		if err != nil || n < 0 {
+			return limits, fmt.Errorf("uci: go: invalid value for %s: %s", name, args[i])
+		}
+		switch name {
+		case "depth":
+			limits.Depth = int(n)
+		case "nodes":
+			limits.Nodes = n
+		case "mate":
+			limits.Mate = int(n)
+		case "movetime":
+			limits.MoveTime = time.Duration(n) * time.Millisecond
+		case "wtime":
+			limits.WhiteTime = time.Duration(n) * time.Millisecond
+		case "btime":
+			limits.BlackTime = time.Duration(n) * time.Millisecond
+		case "winc":
+			limits.WhiteInc = time.Duration(n) * time.Millisecond
+		case "binc":
+			limits.BlackInc = time.Duration(n) * time.Millisecond
+		case "movestogo":
+			limits.MovesToGo = int(n)
+		default:
+			// Other arguments are accepted but unused.
+		}
+	}
+	return limits, nil
+}
@@ -3,34 +3,180 @@ package uci
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
+	"sync"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/eval"
+	"github.com/clfs/good/fen"
+	"github.com/clfs/good/search"
+	"github.com/clfs/good/tablebase"
+	"github.com/clfs/good/tablebase/dtm"
 )
 
+// errQuit is returned by commands that end the session.
+var errQuit = errors.New("uci: quit")
+
 // Client is a client that communicates over UCI.
 type Client struct {
 	r io.Reader
 	w io.Writer
+
+	pos     chess.Position       // The position set by the last position command.
+	history []chess.Position     // The positions before pos in the game, oldest first.
+	tb      *tablebase.Tablebase // Set by the SyzygyPath option, or nil.
+	dtm     *dtm.Set             // Set by the DTMPath option, or nil.
+
+	// The running search, if any. Done is closed when it ends.
+	stop     context.CancelFunc
+	done     chan struct{}
+	infinite bool
 }
 
 // New returns a new client.
 func New(r io.Reader, w io.Writer) *Client {
-	return &Client{r, w}
+	return &Client{r: r, w: &lockedWriter{w: w}, pos: chess.NewPosition()}
 }
 
-// Run runs the client.
+// A lockedWriter serializes writes, so that searches can report progress
+// while commands are handled. Each line of output is written at once.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
+
+// Run runs the client until the input ends or the quit command is received.
+// When the input ends, a running search is allowed to finish, unless it's
+// infinite; the quit command stops it.
 func (c *Client) Run() error {
 	s := bufio.NewScanner(c.r)
 	for s.Scan() {
 		line := s.Text()
-		if err := c.dispatch(line); err != nil {
-			return err
+		err := c.dispatch(line)
+		if errors.Is(err, errQuit) {
+			c.stopSearch()
+			return nil
 		}
+		if err != nil {
+			// Bad commands shouldn't end the session, so just report them.
+			fmt.Fprintf(c.w, "info string %v\n", err)
+		}
+	}
+	if c.infinite {
+		c.stopSearch()
 	}
+	c.waitSearch()
 	return s.Err()
 }
 
 func (c *Client) dispatch(line string) error {
-	fmt.Fprintf(c.w, "echo: %s\n", line) // todo
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	args := fields[1:]
+	switch fields[0] {
+	case "uci":
+		fmt.Fprintln(c.w, "id name good")
+		fmt.Fprintln(c.w, "id author clfs")
+		c.printOptions()
+		fmt.Fprintln(c.w, "uciok")
+	case "isready":
+		fmt.Fprintln(c.w, "readyok")
+	case "setoption":
+		return c.setOption(args)
+	case "ucinewgame":
+		c.stopSearch()
+		c.pos, c.history = chess.NewPosition(), nil
+		search.ClearHash()
+	case "position":
+		return c.position(args)
+	case "go":
+		return c.goSearch(args)
+	case "stop":
+		c.stopSearch()
+	case "eval":
+		fmt.Fprint(c.w, eval.Trace(c.pos))
+	case "quit":
+		return errQuit
+	}
+	// Unknown commands are ignored, as the protocol requires.
+	return nil
+}
+
+// position handles the position command:
+//
+//	position [fen <fenstring> | startpos] moves <move1> ... <movei>
+func (c *Client) position(args []string) error {
+	if len(args) == 0 {
+		return errors.New("uci: position: missing arguments")
+	}
+
+	var (
+		p       chess.Position
+		history []chess.Position
+		moves   []string
+	)
+	switch args[0] {
+	case "startpos":
+		p = chess.NewPosition()
+		args = args[1:]
+	case "fen":
+		end := len(args)
+		for i, a := range args {
+			if a == "moves" {
+				end = i
+				break
+			}
+		}
+		var err error
+		p, err = fen.From(strings.Join(args[1:end], " "))
+		if err != nil {
+			return err
+		}
+		if p.Board[chess.WhiteKing].Count() != 1 || p.Board[chess.BlackKing].Count() != 1 {
+			return errors.New("uci: position: each side must have exactly one king")
+		}
+		args = args[end:]
+	default:
+		return fmt.Errorf("uci: position: invalid argument: %s", args[0])
+	}
+
+	if len(args) > 0 {
+		if args[0] != "moves" {
+			return fmt.Errorf("uci: position: invalid argument: %s", args[0])
+		}
+		moves = args[1:]
+	}
+	for _, s := range moves {
+		m, err := parseMove(&p, s)
+		if err != nil {
+			return err
+		}
+		history = append(history, p)
+		p.Make(m)
+	}
+
+	c.pos, c.history = p, history
 	return nil
 }
+
+// parseMove returns the legal move in p written as s in UCI notation.
+func parseMove(p *chess.Position, s string) (chess.Move, error) {
+	for _, m := range p.LegalMoves() {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("uci: illegal move: %s", s)
+}
@@ -0,0 +1,338 @@
+package uci
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clfs/good/chess"
+	"github.com/clfs/good/eval"
+	"github.com/clfs/good/fen"
+	"github.com/clfs/good/search"
+	"github.com/clfs/good/tablebase/dtm"
+)
+
+// run runs a client over a script and returns its output.
+func run(t *testing.T, script string) (*Client, string) {
+	t.Helper()
+	var out bytes.Buffer
+	c := New(strings.NewReader(script), &out)
+	if err := c.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return c, out.String()
+}
+
+func TestClient_Handshake(t *testing.T) {
+	_, out := run(t, "uci\nisready\nquit\n")
+	for _, want := range []string{"id name good\n", "uciok\n", "readyok\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output %q doesn't contain %q", out, want)
+		}
+	}
+}
+
+func TestClient_Position(t *testing.T) {
+	cases := []struct {
+		cmd  string
+		want string
+	}{
+		{"position startpos", fen.Starting},
+		{"position startpos moves e2e4 e7e5 g1f3", "rnbqkbnr/pppp1ppp/8/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 1 2"},
+		{"position fen 4k3/P7/8/8/8/8/8/4K3 w - - 0 1 moves a7a8n", "N3k3/8/8/8/8/8/8/4K3 b - - 0 1"},
+		{"position fen 4k3/8/8/8/8/8/8/4K3 w - - 0 1", "4k3/8/8/8/8/8/8/4K3 w - - 0 1"},
+	}
+	for _, tc := range cases {
+		c, _ := run(t, tc.cmd+"\n")
+		if got := fen.To(c.pos); got != tc.want {
+			t.Errorf("%s: want %s, got %s", tc.cmd, tc.want, got)
+		}
+	}
+}
+
+func TestClient_PositionErrors(t *testing.T) {
+	for _, cmd := range []string{
+		"position",
+		"position startpos moves e2e5",
+		"position fen 8/8/8 w - - 0 1",
+		"position fen 8/8/8/8/8/8/8/8 w - - 0 1",
+		"position somewhere",
+	} {
+		c, out := run(t, "position startpos moves e2e4\n"+cmd+"\n")
+		if !strings.HasPrefix(out, "info string ") {
+			t.Errorf("%s: want an error report, got %q", cmd, out)
+		}
+		// The previous position is kept.
+		if got, want := fen.To(c.pos), "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1"; got != want {
+			t.Errorf("%s: want %s, got %s", cmd, want, got)
+		}
+	}
+}
+
+func TestClient_Eval(t *testing.T) {
+	_, out := run(t, "position startpos\neval\n")
+	if !strings.Contains(out, "Final evaluation") {
+		t.Errorf("output %q doesn't contain an evaluation", out)
+	}
+}
+
+func TestClient_EvalFile(t *testing.T) {
+	var b bytes.Buffer
+	if err := eval.WriteWeights(&b); err != nil {
+		t.Fatal(err)
+	}
+	// Make pawns worth ten more pawns.
+	weights := strings.Replace(b.String(), `"Material": [[82, 94]`, `"Material": [[1082, 1094]`, 1)
+	path := filepath.Join(t.TempDir(), "weights.json")
+	if err := os.WriteFile(path, []byte(weights), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	defer eval.ResetWeights()
+
+	const pos = "position fen 4k3/8/8/8/8/8/P7/4K3 w - - 0 1\n"
+	_, before := run(t, pos+"eval\n")
+	_, after := run(t, "setoption name EvalFile value "+path+"\n"+pos+"eval\n")
+	_, reset := run(t, "setoption name EvalFile value <empty>\n"+pos+"eval\n")
+	if before == after {
+		t.Errorf("EvalFile didn't change the evaluation:\n%s", after)
+	}
+	if before != reset {
+		t.Errorf("resetting EvalFile didn't restore the evaluation:\n%s", reset)
+	}
+
+	_, out := run(t, "setoption name EvalFile value "+filepath.Join(t.TempDir(), "missing.json")+"\n")
+	if !strings.HasPrefix(out, "info string ") {
+		t.Errorf("want an error report, got %q", out)
+	}
+}
+
+func TestClient_SyzygyPath(t *testing.T) {
+	dir := t.TempDir()
+	// Tables are only read when probed, so empty files do.
+	for _, name := range []string{"KQvK.rtbw", "KQvK.rtbz", "KRvK.rtbw", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, out := run(t, "setoption name SyzygyPath value "+dir+"\n")
+	if out != "info string found 2 tablebases\n" || c.tb == nil {
+		t.Errorf("want 2 tablebases, got %q", out)
+	}
+	// Searches use the tablebases, and get on without the unreadable ones.
+	_, out = run(t, "setoption name SyzygyPath value "+dir+"\nposition fen 8/8/8/4k3/8/8/8/4K2Q w - - 0 1\ngo depth 3\n")
+	if !strings.Contains(out, "bestmove ") {
+		t.Errorf("want a search with tablebases, got %q", out)
+	}
+	c, _ = run(t, "setoption name SyzygyPath value "+dir+"\nsetoption name SyzygyPath value <empty>\n")
+	if c.tb != nil {
+		t.Error("clearing SyzygyPath didn't close the tablebases")
+	}
+	_, out = run(t, "setoption name SyzygyPath value "+filepath.Join(dir, "missing")+"\n")
+	if !strings.HasPrefix(out, "info string uci: SyzygyPath") {
+		t.Errorf("want an error report, got %q", out)
+	}
+}
+
+func TestClient_DTMPath(t *testing.T) {
+	key, err := chess.ParseMaterialKey("KRK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := dtm.Generate(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "KRK.dtm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := table.WriteTo(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// A shallow search reports the exact mate.
+	const kRK = "8/8/8/4k3/8/8/8/R3K3 w - - 0 1"
+	p, err := fen.From(kRK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, plies, _ := table.Probe(&p)
+	c, out := run(t, "setoption name DTMPath value "+dir+"\nposition fen "+kRK+"\ngo depth 2\n")
+	if !strings.HasPrefix(out, "info string found 1 depth-to-mate tables\n") || c.dtm == nil {
+		t.Errorf("want 1 table, got %q", out)
+	}
+	if want := fmt.Sprintf("score mate %d ", (plies+1)/2); !strings.Contains(out, want) {
+		t.Errorf("output %q doesn't contain %q", out, want)
+	}
+
+	c, _ = run(t, "setoption name DTMPath value "+dir+"\nsetoption name DTMPath value <empty>\n")
+	if c.dtm != nil {
+		t.Error("clearing DTMPath didn't unload the tables")
+	}
+	_, out = run(t, "setoption name DTMPath value "+filepath.Join(dir, "missing")+"\n")
+	if !strings.HasPrefix(out, "info string uci: DTMPath") {
+		t.Errorf("want an error report, got %q", out)
+	}
+}
+
+func TestClient_Options(t *testing.T) {
+	_, out := run(t, "uci\n")
+	if !strings.Contains(out, "option name EvalFile type string default <empty>\n") {
+		t.Errorf("output %q doesn't announce EvalFile", out)
+	}
+	if !strings.Contains(out, "option name Hash type spin default 16 min 1 max 65536\n") {
+		t.Errorf("output %q doesn't announce Hash", out)
+	}
+	_, out = run(t, "setoption name NoSuchOption value 1\n")
+	if !strings.HasPrefix(out, "info string ") {
+		t.Errorf("want an error report, got %q", out)
+	}
+}
+
+func TestClient_Hash(t *testing.T) {
+	defer search.SetHashSize(search.DefaultHashSize)
+	_, out := run(t, "setoption name Hash value 1\nposition startpos\ngo depth 2\n")
+	if !strings.Contains(out, " hashfull ") || !strings.Contains(out, "bestmove ") {
+		t.Errorf("want a search reporting hashfull, got %q", out)
+	}
+	for _, value := range []string{"0", "65537", "x"} {
+		_, out := run(t, "setoption name Hash value "+value+"\n")
+		if !strings.HasPrefix(out, "info string uci: Hash") {
+			t.Errorf("%s: want an error report, got %q", value, out)
+		}
+	}
+}
+
+func TestClient_Threads(t *testing.T) {
+	defer search.SetThreads(1)
+	_, out := run(t, "uci\n")
+	if !strings.Contains(out, "option name Threads type spin default 1 min 1 max 1024\n") {
+		t.Errorf("output %q doesn't announce Threads", out)
+	}
+	_, out = run(t, "setoption name Threads value 4\nposition startpos\ngo depth 4\n")
+	if strings.Contains(out, "info string ") || !strings.Contains(out, "bestmove ") {
+		t.Errorf("want a search with 4 threads, got %q", out)
+	}
+	for _, value := range []string{"0", "1025"} {
+		_, out := run(t, "setoption name Threads value "+value+"\n")
+		if !strings.HasPrefix(out, "info string uci: Threads") {
+			t.Errorf("%s: want an error report, got %q", value, out)
+		}
+	}
+}
+
+func TestClient_Backend(t *testing.T) {
+	defer search.SetBackend(search.AlphaBeta)
+	defer search.SetMCTSExploration(math.Sqrt2)
+	defer search.SetMCTSRollouts(false)
+	defer search.SetMCTSNoise(0)
+	defer search.SetMCTSTemperature(0)
+	_, out := run(t, "uci\n")
+	if !strings.Contains(out, "option name Backend type combo default AlphaBeta var AlphaBeta var MCTS\n") {
+		t.Errorf("output %q doesn't announce Backend", out)
+	}
+	if !strings.Contains(out, "option name MCTSRollouts type check default false\n") {
+		t.Errorf("output %q doesn't announce MCTSRollouts", out)
+	}
+	script := "setoption name Backend value mcts\n" +
+		"setoption name MCTSExploration value 100\n" +
+		"setoption name MCTSRollouts value true\n" +
+		"setoption name MCTSNoise value 25\n" +
+		"setoption name MCTSTemperature value 100\n" +
+		"setoption name MCTSNetFile value <empty>\n" +
+		"position fen 6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1\ngo nodes 5000\n"
+	_, out = run(t, script)
+	if strings.Contains(out, "info string ") || !strings.Contains(out, "bestmove a1a8") {
+		t.Errorf("want MCTS to find a1a8, got %q", out)
+	}
+	for _, line := range []string{
+		"setoption name Backend value Minimax\n",
+		"setoption name MCTSRollouts value maybe\n",
+		"setoption name MCTSExploration value -1\n",
+		"setoption name MCTSNoise value 101\n",
+		"setoption name MCTSTemperature value -1\n",
+		"setoption name MCTSNetFile value " + filepath.Join(t.TempDir(), "missing.bin") + "\n",
+	} {
+		_, out := run(t, line)
+		if !strings.HasPrefix(out, "info string uci: ") {
+			t.Errorf("%q: want an error report, got %q", line, out)
+		}
+	}
+}
+
+func TestClient_MoveOverhead(t *testing.T) {
+	defer search.SetMoveOverhead(search.DefaultMoveOverhead)
+	_, out := run(t, "uci\n")
+	if !strings.Contains(out, "option name Move Overhead type spin default 10 min 0 max 5000\n") {
+		t.Errorf("output %q doesn't announce Move Overhead", out)
+	}
+	_, out = run(t, "setoption name Move Overhead value 100\nposition startpos\ngo wtime 1000 btime 1000\n")
+	if strings.Contains(out, "info string ") || !strings.Contains(out, "bestmove ") {
+		t.Errorf("want a search with a move overhead, got %q", out)
+	}
+	_, out = run(t, "setoption name Move Overhead value 5001\n")
+	if !strings.HasPrefix(out, "info string uci: Move Overhead") {
+		t.Errorf("want an error report, got %q", out)
+	}
+}
+
+func TestClient_Params(t *testing.T) {
+	p := search.Params()[0]
+	defer search.SetParam(p.Name, p.Default)
+	_, out := run(t, "uci\n")
+	if strings.Contains(out, "option name "+p.Name+" ") {
+		t.Errorf("output %q announces the hidden option %s", out, p.Name)
+	}
+	_, out = run(t, fmt.Sprintf("setoption name %s value %d\nposition startpos\ngo depth 2\n", p.Name, p.Max))
+	if strings.Contains(out, "info string ") || !strings.Contains(out, "bestmove ") {
+		t.Errorf("want a search after setting %s, got %q", p.Name, out)
+	}
+	_, out = run(t, fmt.Sprintf("setoption name %s value %d\n", p.Name, p.Max+1))
+	if !strings.HasPrefix(out, "info string uci: "+p.Name) {
+		t.Errorf("want an error report, got %q", out)
+	}
+}
+
+func TestClient_Go(t *testing.T) {
+	cases := []struct {
+		script string
+		want   []string
+	}{
+		{"position startpos\ngo depth 2\n", []string{"info depth 1 ", "info depth 2 ", "bestmove "}},
+		{"position fen kbK5/pp6/1P6/8/8/8/8/R7 w - - 0 1\ngo mate 2\n", []string{"score mate 2 ", "bestmove a1a6 "}},
+		{"position startpos\ngo searchmoves h2h3 depth 1\n", []string{"bestmove h2h3"}},
+		{"position startpos\ngo infinite\nstop\n", []string{"bestmove "}},
+		{"position startpos\ngo infinite\n", []string{"bestmove "}},
+		{"position startpos\ngo wtime 1000 btime 1000 depth 1\nquit\n", []string{"bestmove "}},
+		{"position fen 6Qk/5K2/8/8/8/8/8/8 b - - 0 1\ngo depth 1\n", []string{"bestmove 0000\n"}},
+		{"position startpos\ngo wtime 500 btime 500 winc 10 binc 10\n", []string{"info depth 1 ", "bestmove "}},
+		{"position startpos moves e2e4\ngo wtime 100000 btime 300 movestogo 5\n", []string{"bestmove "}},
+		{"position startpos\ngo wtime -50 btime 1000\n", []string{"bestmove "}},
+	}
+	for _, tc := range cases {
+		_, out := run(t, tc.script)
+		for _, want := range tc.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("%q: output %q doesn't contain %q", tc.script, out, want)
+			}
+		}
+		if n := strings.Count(out, "bestmove"); n != 1 {
+			t.Errorf("%q: want one best move, got %d", tc.script, n)
+		}
+	}
+}
+
+func TestClient_GoErrors(t *testing.T) {
+	for _, cmd := range []string{"go depth", "go depth x", "go nodes -1", "go winc -1", "go movestogo x"} {
+		_, out := run(t, "position startpos\n"+cmd+"\n")
+		if !strings.HasPrefix(out, "info string ") || strings.Contains(out, "bestmove") {
+			t.Errorf("%s: want an error report, got %q", cmd, out)
+		}
+	}
+}